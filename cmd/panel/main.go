@@ -7,6 +7,8 @@ import (
 	"github.com/asergenalkan/serverpanel/internal/api"
 	"github.com/asergenalkan/serverpanel/internal/config"
 	"github.com/asergenalkan/serverpanel/internal/database"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/asergenalkan/serverpanel/internal/services/bandwidth"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -25,6 +27,29 @@ func main() {
 	}
 	defer db.Close()
 
+	// CLI subcommands run against the same DB and exit
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		code := runReconcile(db, os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
+	// Jobs cut short by a restart stay in the journal as failed
+	account.NewService(db).MarkInterruptedJobs()
+	account.NewService(db).MarkInterruptedBulkOperations()
+
+	// Terminated accounts are purged when their grace period ends
+	account.StartPurgeScheduler(db)
+
+	// Web, FTP and mail traffic is read from the logs every 15 minutes
+	bandwidth.StartCollector(db)
+
+	// Accounts near their package's inode limit are flagged hourly
+	account.StartInodeScheduler(db)
+
+	// Start scheduled backups
+	api.StartBackupScheduler(db)
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		AppName:               "ServerPanel v1.0.0",
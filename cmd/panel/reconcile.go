@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/asergenalkan/serverpanel/internal/database"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+)
+
+// runReconcile implements `panel reconcile [-rebuild] [-json] [username]`.
+// Without a username every account is checked; orphaned entries are listed
+// at the end. The exit code is 1 when drift remains.
+func runReconcile(db *database.DB, args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	rebuild := fs.Bool("rebuild", false, "regenerate the configuration from the panel DB")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: panel reconcile [-rebuild] [-json] [username]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	svc := account.NewService(db)
+	var report *account.ServerDriftReport
+
+	if username := fs.Arg(0); username != "" {
+		var userID int64
+		if err := db.QueryRow("SELECT id FROM users WHERE username = ? AND role = 'user'", username).Scan(&userID); err != nil {
+			fmt.Fprintf(os.Stderr, "account not found: %s\n", username)
+			return 2
+		}
+		var r *account.DriftReport
+		var err error
+		if *rebuild {
+			r, err = svc.RebuildAccount(userID)
+		} else {
+			r, err = svc.CheckAccount(userID)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", username, err)
+			return 2
+		}
+		report = &account.ServerDriftReport{Accounts: []account.DriftReport{*r}}
+	} else {
+		var err error
+		if *rebuild {
+			report, err = svc.RebuildAll()
+		} else {
+			report, err = svc.CheckAll()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reconcile failed: %v\n", err)
+			return 2
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printDriftReport(report)
+	}
+
+	for _, r := range report.Accounts {
+		if len(r.Drift) > 0 || len(r.Errors) > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printDriftReport(report *account.ServerDriftReport) {
+	for _, r := range report.Accounts {
+		switch {
+		case r.Skipped != "":
+			fmt.Printf("%s: skipped (%s)\n", r.Username, r.Skipped)
+		case len(r.Drift) == 0 && len(r.Errors) == 0:
+			fmt.Printf("%s: in sync\n", r.Username)
+		default:
+			fmt.Printf("%s:\n", r.Username)
+		}
+		for _, a := range r.Rebuilt {
+			fmt.Printf("  rebuilt   %-9s %s\n", a.Kind, a.Name)
+		}
+		for _, a := range r.Removed {
+			fmt.Printf("  removed   %-9s %s\n", a.Kind, a.Name)
+		}
+		for _, d := range r.Drift {
+			printDrift(d)
+		}
+		for _, e := range r.Errors {
+			fmt.Printf("  error     %s\n", e)
+		}
+	}
+
+	if len(report.Orphans) > 0 {
+		fmt.Println("orphaned entries:")
+		for _, d := range report.Orphans {
+			printDrift(d)
+		}
+	}
+}
+
+func printDrift(d account.Drift) {
+	line := fmt.Sprintf("  %-9s %-9s %s", d.Problem, d.Kind, d.Name)
+	if d.Detail != "" {
+		line += " (" + d.Detail + ")"
+	}
+	fmt.Println(line)
+}
@@ -158,16 +158,19 @@ func checkPolicy(attrs map[string]string) string {
 	}
 	senderDomain := senderParts[1]
 
-	// Find user by domain
+	// Find user by domain; the lower of the package and domain limits applies
 	var userID int64
 	var hourlyLimit, dailyLimit int
 
 	err := db.QueryRow(`
-		SELECT u.id, COALESCE(p.max_emails_per_hour, 100), COALESCE(p.max_emails_per_day, 500)
+		SELECT u.id,
+		       MIN(COALESCE(p.max_emails_per_hour, 100), COALESCE(es.hourly_limit, p.max_emails_per_hour, 100)),
+		       MIN(COALESCE(p.max_emails_per_day, 500), COALESCE(es.daily_limit, p.max_emails_per_day, 500))
 		FROM users u
 		JOIN domains d ON u.id = d.user_id
 		LEFT JOIN user_packages up ON u.id = up.user_id
 		LEFT JOIN packages p ON up.package_id = p.id
+		LEFT JOIN email_settings es ON es.domain_id = d.id
 		WHERE d.name = ?
 	`, senderDomain).Scan(&userID, &hourlyLimit, &dailyLimit)
 
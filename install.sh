@@ -326,7 +326,22 @@ port = ftp,ftp-data,ftps,ftps-data
 filter = pure-ftpd
 logpath = /var/log/syslog
 maxretry = 5
+
+[serverpanel]
+enabled = true
+port = 8443
+filter = serverpanel
+logpath = /var/log/serverpanel/auth.log
+maxretry = 10
 FAIL2BAN_EOF
+        # Panel girişleri için filtre
+        mkdir -p /var/log/serverpanel
+        touch /var/log/serverpanel/auth.log
+        cat > /etc/fail2ban/filter.d/serverpanel.conf << 'FILTER_EOF'
+[Definition]
+failregex = ^\s*serverpanel\[\d+\]: Authentication failure from <HOST> user=
+ignoreregex =
+FILTER_EOF
         systemctl enable fail2ban > /dev/null 2>&1
         systemctl restart fail2ban > /dev/null 2>&1
         if systemctl is-active --quiet fail2ban; then
@@ -729,6 +744,7 @@ configure_pureftpd() {
     echo "1" > "$conf_dir/TLS"                   # TLS opsiyonel (0=kapalı, 1=opsiyonel, 2=zorunlu)
     echo "yes" > "$conf_dir/DontResolve"         # DNS çözümlemesi yapma (hızlandırır)
     echo "yes" > "$conf_dir/VerboseLog"          # Detaylı log
+    echo "clf:/var/log/pure-ftpd/transfer.log" > "$conf_dir/AltLog"  # Bandwidth hesabı için transfer logu
     
     # Boş PureDB oluştur (eğer yoksa)
     if [[ ! -f /etc/pure-ftpd/pureftpd.passwd ]]; then
@@ -1267,7 +1283,7 @@ configure_apache() {
     
     # 3. Modülleri aktifleştir
     log_progress "Apache modülleri aktifleştiriliyor"
-    local modules=(proxy_fcgi setenvif rewrite headers ssl expires proxy alias)
+    local modules=(proxy_fcgi setenvif rewrite headers ssl expires proxy alias ratelimit)
     for mod in "${modules[@]}"; do
         a2enmod "$mod" > /dev/null 2>&1 || true
     done
@@ -1456,6 +1472,70 @@ BINDLOCAL
     fi
 }
 
+# ═══════════════════════════════════════════════════════════════════════════════
+# DİSK KOTALARI
+# ═══════════════════════════════════════════════════════════════════════════════
+
+configure_quota() {
+    log_step "Disk Kotaları Yapılandırılıyor"
+    
+    if ! command -v setquota &> /dev/null; then
+        log_progress "quota paketi kuruluyor"
+        DEBIAN_FRONTEND=noninteractive apt-get install -y quota > /dev/null 2>&1
+        log_done "quota paketi kuruldu"
+    fi
+    
+    # /home'un bulunduğu dosya sistemi
+    local mount_point=$(df --output=target /home | tail -1)
+    local fs_type=$(findmnt -n -o FSTYPE --target /home)
+    local options=$(findmnt -n -o OPTIONS --target /home)
+    log_detail "/home: $mount_point ($fs_type)"
+    
+    if [[ "$fs_type" == "xfs" ]]; then
+        # XFS kotaları mount sırasında açılır, remount ile açılamaz
+        if echo "$options" | grep -qE "usrquota|uquota"; then
+            log_info "XFS kullanıcı kotaları aktif ✓"
+        else
+            log_warn "XFS kotaları kapalı: $mount_point için fstab'a 'uquota' ekleyip yeniden başlatın (kök dizin için GRUB: rootflags=uquota)"
+        fi
+        return
+    fi
+    
+    if [[ "$fs_type" != ext* ]]; then
+        log_warn "$fs_type dosya sisteminde kullanıcı kotaları desteklenmiyor, disk kotaları uygulanmayacak"
+        return
+    fi
+    
+    # fstab'da usrquota yoksa ekle
+    if ! echo "$options" | grep -q "usrquota"; then
+        log_progress "fstab'a usrquota ekleniyor"
+        cp /etc/fstab /etc/fstab.serverpanel.bak
+        awk -v mp="$mount_point" '$2 == mp && $1 !~ /^#/ && $4 !~ /usrquota/ { $4 = $4 ",usrquota" } { print }' \
+            /etc/fstab.serverpanel.bak > /etc/fstab
+        if mount -o remount "$mount_point" > /dev/null 2>&1; then
+            log_done "usrquota etkinleştirildi"
+        else
+            cp /etc/fstab.serverpanel.bak /etc/fstab
+            log_warn "$mount_point yeniden bağlanamadı, fstab geri alındı"
+            return
+        fi
+    fi
+    
+    # Kota dosyaları ve kotaların açılması
+    if ! quotaon -p "$mount_point" 2>/dev/null | grep -q "user quota.*is on"; then
+        log_progress "Kota dosyaları oluşturuluyor"
+        quotacheck -cum "$mount_point" > /dev/null 2>&1 || true
+        quotaon -u "$mount_point" > /dev/null 2>&1 || true
+        log_done "Kota dosyaları oluşturuldu"
+    fi
+    
+    if quotaon -p "$mount_point" 2>/dev/null | grep -q "user quota.*is on"; then
+        log_info "Kullanıcı kotaları aktif ✓"
+    else
+        log_warn "Kullanıcı kotaları açılamadı, disk kotaları uygulanmayacak"
+    fi
+}
+
 # ═══════════════════════════════════════════════════════════════════════════════
 # PHPMYADMIN KURULUMU
 # ═══════════════════════════════════════════════════════════════════════════════
@@ -2149,6 +2229,7 @@ main() {
     configure_roundcube
     configure_apache
     configure_dns
+    configure_quota
     install_phpmyadmin
     install_go
     install_serverpanel
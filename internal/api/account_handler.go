@@ -1,18 +1,37 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/asergenalkan/serverpanel/internal/models"
 	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/asergenalkan/serverpanel/internal/services/reseller"
 	"github.com/gofiber/fiber/v2"
 )
 
-// ListAccounts returns all hosting accounts (Admin only)
+// resellerScope returns the caller's ID when a reseller is calling and 0 for
+// admins. Resellers only see and manage accounts whose parent_id is theirs.
+func resellerScope(c *fiber.Ctx) int64 {
+	if c.Locals("role").(string) == models.RoleReseller {
+		return c.Locals("user_id").(int64)
+	}
+	return 0
+}
+
+// accountInScope reports whether the caller may manage an account
+func (h *Handler) accountInScope(c *fiber.Ctx, id int64) bool {
+	owner := resellerScope(c)
+	return owner == 0 || reseller.NewManager(h.db).OwnsAccount(owner, id)
+}
+
+// ListAccounts returns hosting accounts; resellers get their own accounts
 func (h *Handler) ListAccounts(c *fiber.Ctx) error {
 	svc := account.NewService(h.db)
 
-	accounts, err := svc.ListAccounts()
+	accounts, err := svc.ListAccounts(resellerScope(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
 			Success: false,
@@ -26,7 +45,8 @@ func (h *Handler) ListAccounts(c *fiber.Ctx) error {
 	})
 }
 
-// CreateAccount creates a new hosting account (Admin only)
+// CreateAccount creates a new hosting account. Accounts created by a
+// reseller belong to them and must fit into their resource pool.
 func (h *Handler) CreateAccount(c *fiber.Ctx) error {
 	var req account.CreateAccountRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -44,14 +64,18 @@ func (h *Handler) CreateAccount(c *fiber.Ctx) error {
 		})
 	}
 
+	req.ParentID = resellerScope(c)
+	if req.ParentID > 0 {
+		if err := reseller.NewManager(h.db).CheckNewAccount(req.ParentID, req.PackageID); err != nil {
+			return resellerPoolError(c, err)
+		}
+	}
+
 	svc := account.NewService(h.db)
 
 	acc, err := svc.CreateAccount(req)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		return accountJobError(c, err, fiber.StatusBadRequest)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
@@ -71,27 +95,37 @@ func (h *Handler) GetAccount(c *fiber.Ctx) error {
 	}
 
 	var acc struct {
-		ID          int64  `json:"id"`
-		Username    string `json:"username"`
-		Email       string `json:"email"`
-		Role        string `json:"role"`
-		Active      bool   `json:"active"`
-		CreatedAt   string `json:"created_at"`
-		Domain      string `json:"domain"`
-		PackageName string `json:"package_name"`
+		ID            int64  `json:"id"`
+		Username      string `json:"username"`
+		Email         string `json:"email"`
+		Role          string `json:"role"`
+		Active        bool   `json:"active"`
+		Suspended     bool   `json:"suspended"`
+		SuspendReason string `json:"suspend_reason,omitempty"`
+		Terminated    bool   `json:"terminated"`
+		PurgeAfter    string `json:"purge_after,omitempty"`
+		CreatedAt     string `json:"created_at"`
+		Domain        string `json:"domain"`
+		PackageName   string `json:"package_name"`
 	}
 
+	owner := resellerScope(c)
 	err = h.db.QueryRow(`
 		SELECT u.id, u.username, u.email, u.role, u.active, u.created_at,
 			   COALESCE(d.name, '') as domain,
-			   COALESCE(p.name, 'No Package') as package_name
+			   COALESCE(p.name, 'No Package') as package_name,
+			   s.user_id IS NOT NULL, COALESCE(s.reason, ''),
+			   t.user_id IS NOT NULL, COALESCE(t.purge_after, '')
 		FROM users u
 		LEFT JOIN domains d ON d.user_id = u.id
 		LEFT JOIN user_packages up ON up.user_id = u.id
 		LEFT JOIN packages p ON p.id = up.package_id
-		WHERE u.id = ?
-	`, id).Scan(&acc.ID, &acc.Username, &acc.Email, &acc.Role, &acc.Active,
-		&acc.CreatedAt, &acc.Domain, &acc.PackageName)
+		LEFT JOIN account_suspensions s ON s.user_id = u.id
+		LEFT JOIN account_terminations t ON t.user_id = u.id
+		WHERE u.id = ? AND (? = 0 OR u.parent_id = ?)
+	`, id, owner, owner).Scan(&acc.ID, &acc.Username, &acc.Email, &acc.Role, &acc.Active,
+		&acc.CreatedAt, &acc.Domain, &acc.PackageName, &acc.Suspended, &acc.SuspendReason,
+		&acc.Terminated, &acc.PurgeAfter)
 
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
@@ -106,7 +140,9 @@ func (h *Handler) GetAccount(c *fiber.Ctx) error {
 	})
 }
 
-// DeleteAccount deletes a hosting account
+// DeleteAccount terminates a hosting account: services are disabled and its
+// data is kept in the holding area until the grace period ends. Admins can
+// pass ?purge=true to delete it completely right away.
 func (h *Handler) DeleteAccount(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
@@ -116,23 +152,68 @@ func (h *Handler) DeleteAccount(c *fiber.Ctx) error {
 		})
 	}
 
+	if !h.accountInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
 	svc := account.NewService(h.db)
+	actorID := c.Locals("user_id").(int64)
+
+	if c.QueryBool("purge") {
+		if c.Locals("role").(string) != models.RoleAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Only admins can purge accounts",
+			})
+		}
+		var username string
+		h.db.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username)
+		if err := svc.DeleteAccount(id); err != nil {
+			return accountJobError(c, err, fiber.StatusInternalServerError)
+		}
+		h.logActivity(actorID, "account_purge", fmt.Sprintf("Purged account %s", username), c.IP())
 
-	if err := svc.DeleteAccount(id); err != nil {
+		return c.JSON(models.APIResponse{
+			Success: true,
+			Data:    map[string]string{"message": "Account deleted successfully"},
+		})
+	}
+
+	termination, err := svc.TerminateAccount(id, actorID)
+	if err != nil {
+		return terminationError(c, err)
+	}
+	h.logActivity(actorID, "account_terminate",
+		fmt.Sprintf("Terminated account %s, purge after %s", termination.Username, termination.PurgeAfter), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Account terminated, it can be restored until " + termination.PurgeAfter,
+		Data:    termination,
+	})
+}
+
+// ListTerminatedAccounts returns accounts waiting to be purged
+func (h *Handler) ListTerminatedAccounts(c *fiber.Ctx) error {
+	terminations, err := account.NewService(h.db).ListTerminations(resellerScope(c))
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "Failed to fetch terminated accounts",
 		})
 	}
 
 	return c.JSON(models.APIResponse{
 		Success: true,
-		Data:    map[string]string{"message": "Account deleted successfully"},
+		Data:    terminations,
 	})
 }
 
-// SuspendAccount suspends an account
-func (h *Handler) SuspendAccount(c *fiber.Ctx) error {
+// RestoreAccount brings a terminated account back before it is purged (Admin only)
+func (h *Handler) RestoreAccount(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
@@ -142,21 +223,70 @@ func (h *Handler) SuspendAccount(c *fiber.Ctx) error {
 	}
 
 	svc := account.NewService(h.db)
+	if err := svc.RestoreAccount(id); err != nil {
+		return terminationError(c, err)
+	}
 
-	if err := svc.SuspendAccount(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+	var username string
+	h.db.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username)
+	h.logActivity(c.Locals("user_id").(int64), "account_restore", fmt.Sprintf("Restored terminated account %s", username), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Account restored",
+	})
+}
+
+// SuspendAccount suspends an account with an optional reason
+func (h *Handler) SuspendAccount(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "Invalid account ID",
+		})
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	if !h.accountInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
 		})
 	}
 
+	svc := account.NewService(h.db)
+	actorID := c.Locals("user_id").(int64)
+
+	if err := svc.SuspendAccount(id, req.Reason, actorID); err != nil {
+		return suspensionError(c, err)
+	}
+
+	details := fmt.Sprintf("Account #%d suspended", id)
+	if req.Reason != "" {
+		details += ": " + req.Reason
+	}
+	h.logActivity(actorID, "account_suspend", details, c.IP())
+
 	return c.JSON(models.APIResponse{
 		Success: true,
 		Data:    map[string]string{"message": "Account suspended"},
 	})
 }
 
-// UnsuspendAccount unsuspends an account
+// UnsuspendAccount restores a suspended account
 func (h *Handler) UnsuspendAccount(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
@@ -166,10 +296,179 @@ func (h *Handler) UnsuspendAccount(c *fiber.Ctx) error {
 		})
 	}
 
+	if !h.accountInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
 	svc := account.NewService(h.db)
 
+	if owner := resellerScope(c); owner > 0 {
+		if err := svc.CheckSuspender(id, owner); err != nil {
+			return suspensionError(c, err)
+		}
+	}
+
 	if err := svc.UnsuspendAccount(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+		return suspensionError(c, err)
+	}
+
+	h.logActivity(c.Locals("user_id").(int64), "account_unsuspend", fmt.Sprintf("Account #%d unsuspended", id), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    map[string]string{"message": "Account unsuspended"},
+	})
+}
+
+// ChangeAccountPackage moves an account to another package. Resellers can
+// only use their own packages and the change must fit into their pool.
+func (h *Handler) ChangeAccountPackage(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	var req struct {
+		PackageID int64 `json:"package_id"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.PackageID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "package_id is required",
+		})
+	}
+
+	if !h.accountInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
+	if owner := resellerScope(c); owner > 0 {
+		if err := reseller.NewManager(h.db).CheckPackageChange(owner, id, req.PackageID); err != nil {
+			return resellerPoolError(c, err)
+		}
+	}
+
+	svc := account.NewService(h.db)
+	report, err := svc.ChangePackage(id, req.PackageID)
+	if err != nil {
+		return packageChangeError(c, err)
+	}
+
+	var username, packageName string
+	h.db.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username)
+	h.db.QueryRow("SELECT name FROM packages WHERE id = ?", req.PackageID).Scan(&packageName)
+	h.logActivity(c.Locals("user_id").(int64), "account_package_change",
+		fmt.Sprintf("Account %s moved to package %s", username, packageName), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Package changed",
+		Data:    report,
+	})
+}
+
+// suspensionError maps suspend/unsuspend errors to a response
+func suspensionError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, account.ErrAlreadySuspended), errors.Is(err, account.ErrNotSuspended),
+		errors.Is(err, account.ErrAccountTerminated):
+		status = fiber.StatusConflict
+	case errors.Is(err, account.ErrNotSuspender):
+		status = fiber.StatusForbidden
+	}
+	return c.Status(status).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// terminationError maps terminate/restore errors to a response
+func terminationError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, account.ErrAlreadyTerminated), errors.Is(err, account.ErrNotTerminated):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// packageChangeError maps package change errors to a response
+func packageChangeError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, account.ErrPackageNotFound):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, account.ErrSamePackage), errors.Is(err, account.ErrAccountTerminated):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// resellerPoolError maps reseller pool errors to a response
+func resellerPoolError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, reseller.ErrNoPool), errors.Is(err, reseller.ErrPoolExceeded):
+		status = fiber.StatusForbidden
+	case errors.Is(err, reseller.ErrPackageNotOwned), errors.Is(err, reseller.ErrNotReseller):
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// GetAccountInodes returns an account's inode usage against its package's
+// max_inodes and the per-directory counts of ?path= in its home
+func (h *Handler) GetAccountInodes(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	if !h.accountInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
+	report, err := account.NewService(h.db).GetInodeReport(id, c.Query("path", "/"))
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, account.ErrAccountNotFound):
+			status = fiber.StatusNotFound
+		case errors.Is(err, account.ErrInvalidPath):
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(models.APIResponse{
 			Success: false,
 			Error:   err.Error(),
 		})
@@ -177,6 +476,26 @@ func (h *Handler) UnsuspendAccount(c *fiber.Ctx) error {
 
 	return c.JSON(models.APIResponse{
 		Success: true,
-		Data:    map[string]string{"message": "Account unsuspended"},
+		Data:    report,
+	})
+}
+
+// CheckInodeLimits counts every limited account's inodes now instead of
+// waiting for the hourly check; returns the accounts near or at the limit
+func (h *Handler) CheckInodeLimits(c *fiber.Ctx) error {
+	flagged, err := account.NewService(h.db).CheckInodeLimits()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to check inode limits",
+		})
+	}
+	if flagged == nil {
+		flagged = []account.InodeUsage{}
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    flagged,
 	})
 }
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListAPITokens returns the API tokens of the current user. Admins can pass
+// ?all=true to see every token.
+func (h *Handler) ListAPITokens(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	if c.Query("all") == "true" && c.Locals("role").(string) == models.RoleAdmin {
+		userID = 0
+	}
+
+	tokens, err := auth.ListAPITokens(h.db, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch API tokens",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    tokens,
+	})
+}
+
+// CreateAPIToken creates a personal API token; the secret is returned only once
+func (h *Handler) CreateAPIToken(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		AllowedIPs    []string `json:"allowed_ips"`
+		ExpiresInDays int      `json:"expires_in_days"` // 0 = never expires
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Token name is required",
+		})
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	secret, token, err := auth.CreateAPIToken(h.db, userID, req.Name, req.Scopes, req.AllowedIPs, expiresAt)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidScope) || errors.Is(err, auth.ErrInvalidAllowedIP) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	h.logActivity(userID, "api_token_create", fmt.Sprintf("API token %s created (%s)", token.Name, strings.Join(token.Scopes, ", ")), c.IP())
+
+	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
+		Success: true,
+		Data: fiber.Map{
+			"token":  secret,
+			"detail": token,
+		},
+	})
+}
+
+// RevokeAPIToken deletes an API token. Admins can revoke any token.
+func (h *Handler) RevokeAPIToken(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid token ID",
+		})
+	}
+
+	userID := c.Locals("user_id").(int64)
+	owner := userID
+	if c.Locals("role").(string) == models.RoleAdmin {
+		owner = 0
+	}
+
+	if err := auth.RevokeAPIToken(h.db, id, owner); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, auth.ErrAPITokenNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	h.logActivity(userID, "api_token_revoke", fmt.Sprintf("API token #%d revoked", id), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "API token revoked",
+	})
+}
@@ -2,10 +2,14 @@ package api
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/asergenalkan/serverpanel/internal/auth"
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/sso"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -25,40 +29,86 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	if lockout := auth.LoginLockout(h.db, c.IP(), req.Username); lockout > 0 {
+		return tooManyLoginAttempts(c, lockout)
+	}
+
+	// Panel usernames cannot contain "@", so name@account is a sub-user
+	if strings.Contains(req.Username, "@") {
+		return h.subUserLogin(c, req.Username, req.Password)
+	}
+
 	// Find user
 	var user models.User
-	var password string
+	var password, source string
 	err := h.db.QueryRow(`
-		SELECT id, username, email, password, role, parent_id, active, created_at, updated_at
+		SELECT id, username, email, password, role, parent_id, active, created_at, updated_at,
+			COALESCE(auth_source, 'local')
 		FROM users WHERE username = ? AND active = 1
 	`, req.Username).Scan(
 		&user.ID, &user.Username, &user.Email, &password,
-		&user.Role, &user.ParentID, &user.Active, &user.CreatedAt, &user.UpdatedAt,
+		&user.Role, &user.ParentID, &user.Active, &user.CreatedAt, &user.UpdatedAt, &source,
 	)
 
-	if err == sql.ErrNoRows {
-		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
-			Success: false,
-			Error:   "Invalid credentials",
-		})
-	}
-	if err != nil {
+	if err != nil && err != sql.ErrNoRows {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
 			Success: false,
 			Error:   "Database error",
 		})
 	}
 
+	// Directory users, and unknown users a directory may provision, are
+	// checked by the SSO password backends
+	if err == sql.ErrNoRows || source != sso.SourceLocal {
+		if backends := sso.PasswordBackends(h.db); len(backends) > 0 {
+			return h.directoryLogin(c, backends, req.Username, req.Password, user.ID)
+		}
+	}
+
+	if err == sql.ErrNoRows {
+		return h.loginFailed(c, req.Username, 0, "unknown user", "Invalid credentials")
+	}
+	if source != sso.SourceLocal {
+		return h.loginFailed(c, req.Username, user.ID, source+" login disabled", "Invalid credentials")
+	}
+
 	// Verify password
 	if !auth.CheckPassword(req.Password, password) {
-		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
-			Success: false,
-			Error:   "Invalid credentials",
+		return h.loginFailed(c, req.Username, user.ID, "invalid password", "Invalid credentials")
+	}
+
+	return h.passwordVerified(c, &user, "User logged in")
+}
+
+// passwordVerified continues a login whose password was accepted: it asks
+// for the second factor when needed, otherwise it completes the login
+func (h *Handler) passwordVerified(c *fiber.Ctx, user *models.User, details string) error {
+	// Second step: TOTP code, or enrollment when the role requires 2FA
+	if purpose := h.twoFactorStep(user.ID, user.Role); purpose != "" {
+		preAuth, err := auth.GeneratePreAuthToken(user, purpose, h.cfg.JWTSecret)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Failed to generate token",
+			})
+		}
+		return c.JSON(models.APIResponse{
+			Success: true,
+			Data: models.LoginResponse{
+				User:                   *user,
+				PreAuthToken:           preAuth,
+				TwoFactorRequired:      purpose == auth.PurposeTwoFactor,
+				TwoFactorSetupRequired: purpose == auth.PurposeTwoFactorSetup,
+			},
 		})
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(&user, h.cfg.JWTSecret)
+	return h.completeLogin(c, user, details, nil)
+}
+
+// completeLogin issues the session token once every login step passed
+func (h *Handler) completeLogin(c *fiber.Ctx, user *models.User, details string, recoveryCodes []string) error {
+	tokens, err := auth.CreateSession(h.db, user, h.cfg.JWTSecret, c.IP(), c.Get("User-Agent"))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
 			Success: false,
@@ -66,14 +116,55 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	auth.ResetLoginFailures(h.db, c.IP(), user.Username)
+
 	// Log activity
-	h.logActivity(user.ID, "login", "User logged in", c.IP())
+	h.logActivity(user.ID, "login", details, c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data: models.LoginResponse{
+			Token:         tokens.AccessToken,
+			RefreshToken:  tokens.RefreshToken,
+			ExpiresIn:     tokens.ExpiresIn,
+			User:          *user,
+			RecoveryCodes: recoveryCodes,
+		},
+	})
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. A refresh token works once; presenting it again revokes
+// the session.
+func (h *Handler) Refresh(c *fiber.Ctx) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Refresh token is required",
+		})
+	}
+
+	tokens, user, err := auth.RefreshSession(h.db, req.RefreshToken, h.cfg.JWTSecret, c.IP(), c.Get("User-Agent"))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			h.logActivity(user.ID, "refresh_token_reuse", "Refresh token reused, session revoked", c.IP())
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid or expired refresh token",
+		})
+	}
 
 	return c.JSON(models.APIResponse{
 		Success: true,
 		Data: models.LoginResponse{
-			Token: token,
-			User:  user,
+			Token:        tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+			ExpiresIn:    tokens.ExpiresIn,
+			User:         *user,
 		},
 	})
 }
@@ -97,15 +188,49 @@ func (h *Handler) GetCurrentUser(c *fiber.Ctx) error {
 		})
 	}
 
+	current := models.CurrentUser{User: user}
+	if subUserID, ok := c.Locals("subuser_id").(int64); ok {
+		perms, _ := c.Locals("subuser_permissions").([]string)
+		root, _ := c.Locals("file_root").(string)
+		current.SubUser = &models.SubUserIdentity{
+			ID:          subUserID,
+			Login:       fmt.Sprintf("%s@%s", c.Locals("subuser_name"), user.Username),
+			Permissions: perms,
+			FileRoot:    root,
+		}
+	}
+	if actorID, ok := c.Locals("actor_id").(int64); ok {
+		current.Impersonating = true
+		current.Impersonator = &models.Impersonator{ID: actorID}
+		h.db.QueryRow("SELECT username, role FROM users WHERE id = ?", actorID).Scan(
+			&current.Impersonator.Username, &current.Impersonator.Role)
+	}
+
 	return c.JSON(models.APIResponse{
 		Success: true,
-		Data:    user,
+		Data:    current,
 	})
 }
 
 func (h *Handler) Logout(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(int64)
-	h.logActivity(userID, "logout", "User logged out", c.IP())
+	if sessionID, ok := c.Locals("session_id").(string); ok {
+		auth.RevokeSession(h.db, sessionID, userID, auth.RevokeLogout)
+	}
+
+	// Ending an impersonation is logged for the real actor
+	if actorID, ok := c.Locals("actor_id").(int64); ok {
+		h.logActivity(actorID, "impersonation_end", fmt.Sprintf("Stopped acting as %s", c.Locals("username")), c.IP())
+		return c.JSON(models.APIResponse{
+			Success: true,
+			Message: "Impersonation ended",
+		})
+	}
+	if name, ok := c.Locals("subuser_name").(string); ok {
+		h.logActivity(userID, "logout", fmt.Sprintf("Sub-user %s@%s logged out", name, c.Locals("username")), c.IP())
+	} else {
+		h.logActivity(userID, "logout", "User logged out", c.IP())
+	}
 
 	return c.JSON(models.APIResponse{
 		Success: true,
@@ -130,3 +255,69 @@ func (h *Handler) logActivity(userID int64, action, details, ip string) {
 		VALUES (?, ?, ?, ?)
 	`, userID, action, details, ip)
 }
+
+// ChangePassword changes the current user's panel password and ends their
+// other sessions
+func (h *Handler) ChangePassword(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+	if len(req.NewPassword) < 8 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "New password must be at least 8 characters",
+		})
+	}
+
+	var hash, source string
+	if err := h.db.QueryRow("SELECT password, COALESCE(auth_source, 'local') FROM users WHERE id = ?", userID).Scan(&hash, &source); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+	}
+	if source != sso.SourceLocal {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Password is managed by the %s identity provider", strings.ToUpper(source)),
+		})
+	}
+	if !auth.CheckPassword(req.CurrentPassword, hash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Current password is incorrect",
+		})
+	}
+
+	newHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to hash password",
+		})
+	}
+	if _, err := h.db.Exec("UPDATE users SET password = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", newHash, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to update password",
+		})
+	}
+
+	current, _ := c.Locals("session_id").(string)
+	auth.RevokeUserSessions(h.db, userID, auth.RevokePasswordChange, current)
+	h.logActivity(userID, "password_change", "Password changed", c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Password changed",
+	})
+}
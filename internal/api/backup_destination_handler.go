@@ -0,0 +1,374 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/backup"
+	"github.com/gofiber/fiber/v2"
+)
+
+// destinationRequest is the body of create/update destination requests.
+// Credentials are write-only: they are never returned by the API and an
+// empty set keeps the stored credentials on update.
+type destinationRequest struct {
+	Name        string                        `json:"name"`
+	Type        string                        `json:"type"`
+	Config      backup.DestinationConfig      `json:"config"`
+	Credentials backup.DestinationCredentials `json:"credentials"`
+	Active      *bool                         `json:"active"`
+}
+
+func (r *destinationRequest) record() *backup.DestinationRecord {
+	d := &backup.DestinationRecord{
+		Name:   r.Name,
+		Type:   r.Type,
+		Config: r.Config,
+		Active: true,
+	}
+	if r.Active != nil {
+		d.Active = *r.Active
+	}
+	return d
+}
+
+// ListBackupDestinations returns remote backup destinations (Admin only)
+func (h *Handler) ListBackupDestinations(c *fiber.Ctx) error {
+	destinations, err := backup.NewManager(h.db).ListDestinations()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch backup destinations",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    destinations,
+	})
+}
+
+// CreateBackupDestination adds a remote backup destination
+func (h *Handler) CreateBackupDestination(c *fiber.Ctx) error {
+	var req destinationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	destination, err := backup.NewManager(h.db).CreateDestination(req.record(), req.Credentials)
+	if err != nil {
+		return destinationErrorResponse(c, err)
+	}
+
+	userID := c.Locals("user_id").(int64)
+	h.logActivity(userID, "backup_destination_create", fmt.Sprintf("Backup destination created: %s (%s)", destination.Name, destination.Type), c.IP())
+
+	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
+		Success: true,
+		Message: "Backup destination created",
+		Data:    destination,
+	})
+}
+
+// UpdateBackupDestination changes the settings of a destination
+func (h *Handler) UpdateBackupDestination(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return destinationErrorResponse(c, backup.ErrDestinationNotFound)
+	}
+
+	var req destinationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	destination, err := backup.NewManager(h.db).UpdateDestination(id, req.record(), req.Credentials)
+	if err != nil {
+		return destinationErrorResponse(c, err)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Backup destination updated",
+		Data:    destination,
+	})
+}
+
+// DeleteBackupDestination removes a destination; stored archives are kept
+func (h *Handler) DeleteBackupDestination(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return destinationErrorResponse(c, backup.ErrDestinationNotFound)
+	}
+
+	if err := backup.NewManager(h.db).DeleteDestination(id); err != nil {
+		return destinationErrorResponse(c, err)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Backup destination deleted",
+	})
+}
+
+// TestBackupDestination checks that a destination is reachable and writable
+func (h *Handler) TestBackupDestination(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return destinationErrorResponse(c, backup.ErrDestinationNotFound)
+	}
+
+	if err := backup.NewManager(h.db).TestDestination(id); err != nil {
+		if errors.Is(err, backup.ErrDestinationNotFound) {
+			return destinationErrorResponse(c, err)
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Connection test failed: " + err.Error(),
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Connection test succeeded",
+	})
+}
+
+// ListRemoteBackups lists the archives stored on a destination
+func (h *Handler) ListRemoteBackups(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return destinationErrorResponse(c, backup.ErrDestinationNotFound)
+	}
+
+	files, err := backup.NewManager(h.db).ListRemote(id)
+	if err != nil {
+		if errors.Is(err, backup.ErrDestinationNotFound) {
+			return destinationErrorResponse(c, err)
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to list remote archives: " + err.Error(),
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    files,
+	})
+}
+
+// UploadToDestination copies a local backup, or a snapshot of the panel
+// database, to a destination as a background task
+func (h *Handler) UploadToDestination(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return destinationErrorResponse(c, backup.ErrDestinationNotFound)
+	}
+
+	var req struct {
+		BackupID int64 `json:"backup_id"`
+		PanelDB  bool  `json:"panel_db"`
+	}
+	if err := c.BodyParser(&req); err != nil || (req.BackupID == 0 && !req.PanelDB) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "backup_id or panel_db is required",
+		})
+	}
+
+	mgr := backup.NewManager(h.db)
+	destination, err := mgr.GetDestination(id)
+	if err != nil {
+		return destinationErrorResponse(c, err)
+	}
+
+	taskName := fmt.Sprintf("Panel veritabanı %s hedefine yükleniyor", destination.Name)
+	if !req.PanelDB {
+		record, err := mgr.GetBackup(req.BackupID)
+		if err != nil {
+			return backupErrorResponse(c, err)
+		}
+		taskName = fmt.Sprintf("Yedek #%d %s hedefine yükleniyor", record.ID, destination.Name)
+	}
+
+	userID := c.Locals("user_id").(int64)
+	ip := c.IP()
+	taskID := fmt.Sprintf("backup-upload-%d-%d", id, time.Now().UnixNano())
+	taskManager.createTask(taskID, "backup", taskName)
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+		progress := func(msg string) { taskManager.addLog(taskID, msg) }
+
+		var file *backup.RemoteFile
+		var err error
+		if req.PanelDB {
+			file, err = mgr.UploadPanelDatabase(id, progress)
+		} else {
+			file, err = mgr.UploadBackup(id, req.BackupID, progress)
+		}
+		if err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		h.logActivity(userID, "backup_upload", fmt.Sprintf("%s uploaded to %s", file.Name, destination.Name), ip)
+		taskManager.addLog(taskID, fmt.Sprintf("✅ Yüklendi: %s", file.Name))
+		taskManager.completeTask(taskID, true)
+	}()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"message": "Yükleme başlatıldı",
+	})
+}
+
+// FetchFromDestination downloads a remote archive and verifies its checksum.
+// Account archives are registered as local backups so they can be restored,
+// panel database snapshots are stored under backups/panel.
+func (h *Handler) FetchFromDestination(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return destinationErrorResponse(c, backup.ErrDestinationNotFound)
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil || !backup.ValidRemoteName(req.Name) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Valid archive name is required",
+		})
+	}
+
+	isArchive := strings.HasSuffix(req.Name, ".tar.gz")
+	if !isArchive && !strings.HasSuffix(req.Name, ".db") {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Only account archives (.tar.gz) and panel database snapshots (.db) can be fetched",
+		})
+	}
+
+	mgr := backup.NewManager(h.db)
+	destination, err := mgr.GetDestination(id)
+	if err != nil {
+		return destinationErrorResponse(c, err)
+	}
+
+	dir := filepath.Join(mgr.BackupDir(), "uploads")
+	if !isArchive {
+		dir = filepath.Join(mgr.BackupDir(), "panel")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	localPath := filepath.Join(dir, fmt.Sprintf("%d-%s", time.Now().Unix(), path.Base(req.Name)))
+
+	userID := c.Locals("user_id").(int64)
+	ip := c.IP()
+	taskID := fmt.Sprintf("backup-fetch-%d-%d", id, time.Now().UnixNano())
+	taskName := fmt.Sprintf("%s %s hedefinden indiriliyor", req.Name, destination.Name)
+	taskManager.createTask(taskID, "backup", taskName)
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+
+		if err := mgr.Fetch(id, req.Name, localPath, func(msg string) { taskManager.addLog(taskID, msg) }); err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		if isArchive {
+			record, err := mgr.ImportArchive(localPath)
+			if err != nil {
+				os.Remove(localPath)
+				taskManager.addLog(taskID, fmt.Sprintf("❌ Arşiv kaydedilemedi: %s", err.Error()))
+				taskManager.completeTask(taskID, false)
+				return
+			}
+			taskManager.addLog(taskID, fmt.Sprintf("💾 Yerel yedek olarak kaydedildi (#%d)", record.ID))
+		} else {
+			taskManager.addLog(taskID, fmt.Sprintf("💾 Kaydedildi: %s", localPath))
+		}
+
+		h.logActivity(userID, "backup_fetch", fmt.Sprintf("%s fetched from %s", req.Name, destination.Name), ip)
+		taskManager.addLog(taskID, "✅ İndirme tamamlandı")
+		taskManager.completeTask(taskID, true)
+	}()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"message": "İndirme başlatıldı",
+	})
+}
+
+// DeleteRemoteBackup removes an archive from a destination (?name=...)
+func (h *Handler) DeleteRemoteBackup(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return destinationErrorResponse(c, backup.ErrDestinationNotFound)
+	}
+
+	name := c.Query("name")
+	if !backup.ValidRemoteName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Valid archive name is required",
+		})
+	}
+
+	if err := backup.NewManager(h.db).DeleteRemote(id, name); err != nil {
+		return destinationErrorResponse(c, err)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Remote archive deleted",
+	})
+}
+
+func destinationErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, backup.ErrDestinationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Backup destination not found",
+		})
+	case errors.Is(err, backup.ErrRemoteNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Remote archive not found",
+		})
+	case errors.Is(err, backup.ErrInvalidDestination):
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,516 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/backup"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListBackups returns account backups (Admin only)
+func (h *Handler) ListBackups(c *fiber.Ctx) error {
+	mgr := backup.NewManager(h.db)
+
+	records, err := mgr.ListBackups(c.Query("username"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch backups",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    records,
+	})
+}
+
+// GetBackup returns a single backup with its manifest
+func (h *Handler) GetBackup(c *fiber.Ctx) error {
+	record, err := h.backupFromParam(c)
+	if err != nil {
+		return backupErrorResponse(c, err)
+	}
+
+	data := map[string]interface{}{"backup": record}
+	if manifest, err := backup.ReadManifest(record.FilePath); err == nil {
+		data["manifest"] = manifest
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// CreateBackup starts a full account backup as a background task
+func (h *Handler) CreateBackup(c *fiber.Ctx) error {
+	var req struct {
+		UserID        int64 `json:"user_id"`
+		SkipHome      bool  `json:"skip_home"`
+		SkipDatabases bool  `json:"skip_databases"`
+		SkipMail      bool  `json:"skip_mail"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.UserID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "user_id is required",
+		})
+	}
+
+	var username string
+	if err := h.db.QueryRow("SELECT username FROM users WHERE id = ? AND role = 'user'", req.UserID).Scan(&username); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
+	ip := c.IP()
+	taskID := fmt.Sprintf("backup-create-%s-%d", username, time.Now().UnixNano())
+	taskName := fmt.Sprintf("%s hesabı yedekleniyor", username)
+	taskManager.createTask(taskID, "backup", taskName)
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+
+		mgr := backup.NewManager(h.db)
+		record, err := mgr.CreateAccountBackup(req.UserID, backup.Options{
+			SkipHome:      req.SkipHome,
+			SkipDatabases: req.SkipDatabases,
+			SkipMail:      req.SkipMail,
+			Progress:      func(msg string) { taskManager.addLog(taskID, msg) },
+		})
+		if err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		h.logActivity(req.UserID, "backup_create", fmt.Sprintf("Backup #%d created for %s", record.ID, username), ip)
+		taskManager.addLog(taskID, fmt.Sprintf("✅ Yedek hazır (#%d)", record.ID))
+		taskManager.completeTask(taskID, true)
+	}()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"message": "Yedekleme başlatıldı",
+	})
+}
+
+// UploadBackup registers an uploaded archive so it can be restored
+func (h *Handler) UploadBackup(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Backup file is required",
+		})
+	}
+
+	mgr := backup.NewManager(h.db)
+	uploadDir := filepath.Join(mgr.BackupDir(), "uploads")
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to create upload directory",
+		})
+	}
+
+	filePath := filepath.Join(uploadDir, fmt.Sprintf("%d-%s", time.Now().Unix(), filepath.Base(file.Filename)))
+	if err := c.SaveFile(file, filePath); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to save backup file",
+		})
+	}
+
+	record, err := mgr.ImportArchive(filePath)
+	if err != nil {
+		os.Remove(filePath)
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
+		Success: true,
+		Data:    record,
+	})
+}
+
+// DownloadBackup streams the archive file
+func (h *Handler) DownloadBackup(c *fiber.Ctx) error {
+	record, err := h.backupFromParam(c)
+	if err != nil {
+		return backupErrorResponse(c, err)
+	}
+
+	return c.Download(record.FilePath, filepath.Base(record.FilePath))
+}
+
+// RestoreBackup restores an archive as a background task. The account is
+// recreated when it was deleted in the meantime.
+func (h *Handler) RestoreBackup(c *fiber.Ctx) error {
+	record, err := h.backupFromParam(c)
+	if err != nil {
+		return backupErrorResponse(c, err)
+	}
+	if record.Status != "completed" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Only completed backups can be restored",
+		})
+	}
+
+	var req struct {
+		SkipHome      bool `json:"skip_home"`
+		SkipDatabases bool `json:"skip_databases"`
+		SkipMail      bool `json:"skip_mail"`
+	}
+	c.BodyParser(&req)
+
+	ip := c.IP()
+	taskID := fmt.Sprintf("backup-restore-%d-%d", record.ID, time.Now().UnixNano())
+	taskName := fmt.Sprintf("%s hesabı geri yükleniyor", record.Username)
+	taskManager.createTask(taskID, "backup", taskName)
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+
+		result, err := h.restoreArchive(taskID, record.FilePath, backup.Options{
+			SkipHome:      req.SkipHome,
+			SkipDatabases: req.SkipDatabases,
+			SkipMail:      req.SkipMail,
+		})
+		if err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		h.logActivity(result.UserID, "backup_restore", fmt.Sprintf("Backup #%d restored for %s", record.ID, result.Username), ip)
+		taskManager.addLog(taskID, "✅ Geri yükleme tamamlandı")
+		taskManager.completeTask(taskID, true)
+	}()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"message": "Geri yükleme başlatıldı",
+	})
+}
+
+// DeleteBackup removes a backup archive
+func (h *Handler) DeleteBackup(c *fiber.Ctx) error {
+	record, err := h.backupFromParam(c)
+	if err != nil {
+		return backupErrorResponse(c, err)
+	}
+
+	if err := backup.NewManager(h.db).DeleteBackup(record.ID); err != nil {
+		if errors.Is(err, backup.ErrBackupInUse) {
+			return c.Status(fiber.StatusConflict).JSON(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Backup deleted",
+	})
+}
+
+// backupFromParam loads the backup referenced by :id
+func (h *Handler) backupFromParam(c *fiber.Ctx) (*backup.Record, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, backup.ErrBackupNotFound
+	}
+	return backup.NewManager(h.db).GetBackup(id)
+}
+
+func backupErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, backup.ErrBackupNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Backup not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// restoreArchive restores account data and files, then rebuilds the system
+// configuration (vhosts, DNS, mail, FTP, cron) from the restored rows
+func (h *Handler) restoreArchive(taskID, archivePath string, opts backup.Options) (*backup.RestoreResult, error) {
+	opts.Progress = func(msg string) { taskManager.addLog(taskID, msg) }
+
+	result, err := backup.NewManager(h.db).Restore(archivePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data := result.Data
+	username := result.Username
+	primary := data.PrimaryDomain()
+
+	// Extra domains and subdomains (the primary domain is handled by CreateAccount)
+	for _, name := range result.CreatedDomains {
+		for _, d := range data.Domains {
+			if d.Name == name && d.Name != primary {
+				taskManager.addLog(taskID, fmt.Sprintf("🌐 Domain yapılandırılıyor: %s", d.Name))
+				h.createDomainResources(username, d.Name, d.DocumentRoot)
+			}
+		}
+	}
+	for _, name := range result.CreatedSubdomains {
+		for _, s := range data.Subdomains {
+			if s.FullName == name {
+				taskManager.addLog(taskID, fmt.Sprintf("🌐 Subdomain yapılandırılıyor: %s", s.FullName))
+				h.createSubdomainResources(username, s.FullName, s.DocumentRoot, s.RedirectURL, s.RedirectType)
+			}
+		}
+	}
+
+	// Zone files are rebuilt from the restored dns_records
+	for _, d := range data.Domains {
+		if err := h.updateZoneFile(d.Name); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("DNS zone %s: %v", d.Name, err))
+		}
+	}
+
+	// PHP-FPM pool settings of the primary domain
+	for _, p := range data.PHPSettings {
+		if p.Domain != primary || config.IsDevelopment() {
+			continue
+		}
+		phpVersion := h.cfg.PHPVersion
+		for _, d := range data.Domains {
+			if d.Name == primary && d.PHPVersion != "" {
+				phpVersion = d.PHPVersion
+			}
+		}
+		settings := PHPSettings{
+			MemoryLimit:       p.MemoryLimit,
+			MaxExecutionTime:  p.MaxExecutionTime,
+			MaxInputTime:      p.MaxInputTime,
+			PostMaxSize:       p.PostMaxSize,
+			UploadMaxFilesize: p.UploadMaxFilesize,
+			MaxFileUploads:    p.MaxFileUploads,
+			DisplayErrors:     p.DisplayErrors,
+			ErrorReporting:    p.ErrorReporting,
+		}
+		if err := h.updatePHPFPMPoolSettings(username, filepath.Join(h.cfg.HomeBaseDir, username), phpVersion, settings); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("PHP-FPM pool: %v", err))
+		}
+	}
+
+	// Mailboxes keep their original Dovecot hash; the bcrypt hash from the
+	// panel database is a valid BLF-CRYPT fallback
+	for _, e := range data.EmailAccounts {
+		hash, ok := data.MailPasswords[e.Email]
+		if !ok {
+			hash = "{BLF-CRYPT}" + e.PasswordHash
+		}
+		h.registerMailbox(e.Email, hash, e.Domain)
+	}
+	for _, f := range data.EmailForwarders {
+		h.deleteForwarder(f.Source)
+		if f.Active {
+			h.createForwarder(f.Source, f.Destination)
+		}
+	}
+	for _, a := range data.EmailAutoresponders {
+		if a.Active {
+			h.createAutoresponder(a.Email, a.Subject, a.Body)
+		}
+	}
+	if len(data.EmailAccounts) > 0 {
+		taskManager.addLog(taskID, fmt.Sprintf("📧 %d mail hesabı yapılandırıldı", len(data.EmailAccounts)))
+	}
+
+	// FTP accounts
+	if !config.IsDevelopment() {
+		restored := map[string]bool{}
+		for _, entry := range data.FTPEntries {
+			if err := restorePureFTPdEntry(entry, username); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("FTP: %v", err))
+				continue
+			}
+			restored[strings.SplitN(entry, ":", 2)[0]] = true
+		}
+		for _, f := range data.FTPAccounts {
+			if !restored[f.Username] {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("FTP account %s needs a new password", f.Username))
+			}
+		}
+	}
+
+	// Cron jobs
+	if err := h.SyncUserCrontabFromDB(result.UserID, username); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("crontab: %v", err))
+	}
+
+	for _, w := range result.Warnings {
+		taskManager.addLog(taskID, "⚠️ "+w)
+	}
+
+	return result, nil
+}
+
+// ListBackupSchedules returns all backup schedules (Admin only)
+func (h *Handler) ListBackupSchedules(c *fiber.Ctx) error {
+	schedules, err := backup.NewManager(h.db).ListSchedules()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch backup schedules",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    schedules,
+	})
+}
+
+// CreateBackupSchedule adds a new backup schedule
+func (h *Handler) CreateBackupSchedule(c *fiber.Ctx) error {
+	req := backup.Schedule{Active: true, Retention: 7, FullEvery: 7}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	schedule, err := backup.NewManager(h.db).CreateSchedule(&req)
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	userID := c.Locals("user_id").(int64)
+	h.logActivity(userID, "backup_schedule_create", fmt.Sprintf("Backup schedule created: %s", schedule.Name), c.IP())
+
+	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
+		Success: true,
+		Message: "Backup schedule created",
+		Data:    schedule,
+	})
+}
+
+// UpdateBackupSchedule replaces the settings of a backup schedule
+func (h *Handler) UpdateBackupSchedule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return scheduleErrorResponse(c, backup.ErrScheduleNotFound)
+	}
+
+	mgr := backup.NewManager(h.db)
+	current, err := mgr.GetSchedule(id)
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	// Fields missing from the body keep their current values
+	req := *current
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	schedule, err := mgr.UpdateSchedule(id, &req)
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Backup schedule updated",
+		Data:    schedule,
+	})
+}
+
+// DeleteBackupSchedule removes a backup schedule; existing backups are kept
+func (h *Handler) DeleteBackupSchedule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return scheduleErrorResponse(c, backup.ErrScheduleNotFound)
+	}
+
+	if err := backup.NewManager(h.db).DeleteSchedule(id); err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Backup schedule deleted",
+	})
+}
+
+// RunBackupSchedule starts a schedule immediately as a background task
+func (h *Handler) RunBackupSchedule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return scheduleErrorResponse(c, backup.ErrScheduleNotFound)
+	}
+
+	schedule, err := backup.NewManager(h.db).GetSchedule(id)
+	if err != nil {
+		return scheduleErrorResponse(c, err)
+	}
+
+	taskID := startScheduledBackup(h.db, schedule)
+	if taskID == "" {
+		return c.Status(fiber.StatusConflict).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Backup schedule is already running",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"message": "Zamanlanmış yedekleme başlatıldı",
+	})
+}
+
+func scheduleErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, backup.ErrScheduleNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Backup schedule not found",
+		})
+	case errors.Is(err, backup.ErrInvalidSchedule):
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/backup"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImportCpanelBackup imports a cPanel cpmove archive as a new account
+// (Admin only). The archive is uploaded as "file" or read from a server-local
+// "path". With dry_run only the import report is returned.
+func (h *Handler) ImportCpanelBackup(c *fiber.Ctx) error {
+	var req struct {
+		Path     string `json:"path" form:"path"`
+		DryRun   bool   `json:"dry_run" form:"dry_run"`
+		Password string `json:"password" form:"password"`
+		Package  string `json:"package" form:"package"`
+	}
+	c.BodyParser(&req)
+
+	mgr := backup.NewManager(h.db)
+	archivePath := req.Path
+	uploaded := false
+
+	if file, err := c.FormFile("file"); err == nil {
+		uploadDir := filepath.Join(mgr.BackupDir(), "uploads")
+		if err := os.MkdirAll(uploadDir, 0700); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Failed to create upload directory",
+			})
+		}
+		archivePath = filepath.Join(uploadDir, fmt.Sprintf("%d-%s", time.Now().Unix(), filepath.Base(file.Filename)))
+		if err := c.SaveFile(file, archivePath); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Failed to save backup file",
+			})
+		}
+		uploaded = true
+	} else if archivePath == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "cpmove archive file or path is required",
+		})
+	} else if !filepath.IsAbs(archivePath) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Archive path must be absolute",
+		})
+	}
+
+	opts := backup.CpmoveOptions{Password: req.Password, Package: req.Package}
+
+	report, err := mgr.InspectCpmove(archivePath, opts)
+	if err != nil {
+		if uploaded {
+			os.Remove(archivePath)
+		}
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, backup.ErrInvalidCpmove) || os.IsNotExist(err) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	if req.DryRun {
+		if uploaded {
+			os.Remove(archivePath)
+		}
+		return c.JSON(models.APIResponse{
+			Success: true,
+			Data:    report,
+		})
+	}
+
+	if len(report.Conflicts) > 0 {
+		if uploaded {
+			os.Remove(archivePath)
+		}
+		return c.Status(fiber.StatusConflict).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Import conflicts: " + strings.Join(report.Conflicts, ", "),
+			Data:    report,
+		})
+	}
+
+	// cPanel only keeps a crypt hash of the account password
+	generated := ""
+	if opts.Password == "" {
+		generated = generatePassword(16)
+		opts.Password = generated
+	}
+
+	ip := c.IP()
+	userID := c.Locals("user_id").(int64)
+	taskID := fmt.Sprintf("backup-cpanel-%s-%d", report.Username, time.Now().UnixNano())
+	taskName := fmt.Sprintf("%s cPanel hesabı içe aktarılıyor", report.Username)
+	taskManager.createTask(taskID, "backup", taskName)
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+		if uploaded {
+			defer os.Remove(archivePath)
+		}
+
+		opts.Progress = func(msg string) { taskManager.addLog(taskID, msg) }
+		record, report, err := mgr.ConvertCpmove(archivePath, opts)
+		if err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+		for _, item := range report.Unmapped {
+			taskManager.addLog(taskID, fmt.Sprintf("⚠️ Aktarılmadı: %s", item))
+		}
+
+		result, err := h.restoreArchive(taskID, record.FilePath, backup.Options{})
+		if err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		h.logActivity(userID, "cpanel_import", fmt.Sprintf("cPanel account %s imported as backup #%d", result.Username, record.ID), ip)
+		taskManager.addLog(taskID, "✅ cPanel hesabı içe aktarıldı")
+		taskManager.completeTask(taskID, true)
+	}()
+
+	response := fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"message": "cPanel içe aktarma başlatıldı",
+		"data":    report,
+	}
+	if generated != "" {
+		response["password"] = generated
+	}
+	return c.JSON(response)
+}
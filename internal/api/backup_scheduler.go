@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/database"
+	"github.com/asergenalkan/serverpanel/internal/services/backup"
+)
+
+// runningSchedules prevents a schedule from running twice at the same time
+// (e.g. a manual trigger while the scheduler is already running it)
+var runningSchedules = struct {
+	sync.Mutex
+	ids map[int64]bool
+}{ids: make(map[int64]bool)}
+
+// StartBackupScheduler checks backup schedules every minute and starts due
+// ones as background tasks
+func StartBackupScheduler(db *database.DB) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			mgr := backup.NewManager(db)
+			schedules, err := mgr.DueSchedules(time.Now())
+			if err != nil {
+				log.Printf("⚠️ Yedekleme zamanlamaları okunamadı: %v", err)
+			}
+			for i := range schedules {
+				startScheduledBackup(db, &schedules[i])
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// startScheduledBackup runs a schedule as a task and returns the task ID.
+// An empty ID means the schedule is already running.
+func startScheduledBackup(db *database.DB, s *backup.Schedule) string {
+	runningSchedules.Lock()
+	if runningSchedules.ids[s.ID] {
+		runningSchedules.Unlock()
+		return ""
+	}
+	runningSchedules.ids[s.ID] = true
+	runningSchedules.Unlock()
+
+	taskID := fmt.Sprintf("backup-schedule-%d-%d", s.ID, time.Now().UnixNano())
+	taskName := fmt.Sprintf("Zamanlanmış yedekleme: %s", s.Name)
+	taskManager.createTask(taskID, "backup", taskName)
+
+	go func() {
+		defer func() {
+			runningSchedules.Lock()
+			delete(runningSchedules.ids, s.ID)
+			runningSchedules.Unlock()
+		}()
+
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+
+		mgr := backup.NewManager(db)
+		failed, err := mgr.RunSchedule(s, func(msg string) { taskManager.addLog(taskID, msg) })
+		if err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+		if failed > 0 {
+			taskManager.addLog(taskID, fmt.Sprintf("⚠️ %d hesap yedeklenemedi", failed))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		taskManager.addLog(taskID, "✅ Zamanlanmış yedekleme tamamlandı")
+		taskManager.completeTask(taskID, true)
+	}()
+
+	return taskID
+}
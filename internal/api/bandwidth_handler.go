@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/bandwidth"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAccountBandwidth returns an account's daily web, FTP and mail traffic
+// for a month (?month=YYYY-MM, default the current month)
+func (h *Handler) GetAccountBandwidth(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	if !h.accountInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
+	report, err := bandwidth.NewCollector(h.db).GetReport(id, c.Query("month"))
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, bandwidth.ErrInvalidMonth) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// ListBandwidthOverages returns the accounts over their monthly limit
+func (h *Handler) ListBandwidthOverages(c *fiber.Ctx) error {
+	overages, err := bandwidth.NewCollector(h.db).ListOverages()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch bandwidth overages",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    overages,
+	})
+}
+
+// CollectBandwidth reads the logs now instead of waiting for the next run
+func (h *Handler) CollectBandwidth(c *fiber.Ctx) error {
+	result, err := bandwidth.NewCollector(h.db).Collect()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Bandwidth collection failed: " + err.Error(),
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Bandwidth collected",
+		Data:    result,
+	})
+}
@@ -0,0 +1,370 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/asergenalkan/serverpanel/internal/services/reseller"
+	"github.com/gofiber/fiber/v2"
+)
+
+// BulkCreateAccounts provisions many accounts at once from a CSV file
+// (multipart "file" or a text/csv body) or a JSON list. Every row is
+// validated first; if any row is rejected nothing is provisioned. Accepted
+// rows run through the bulk queue, passwords left empty are generated and
+// returned once in the response.
+func (h *Handler) BulkCreateAccounts(c *fiber.Ctx) error {
+	data, format, err := bulkUpload(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	rows, err := account.ParseBulkRows(data, format)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	parentID := resellerScope(c)
+	svc := account.NewService(h.db)
+	reqs, rowErrors := svc.ValidateBulkRows(rows, parentID)
+	if rowErrors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   account.ErrBulkInvalid.Error(),
+			Data:    rowErrors,
+		})
+	}
+
+	if parentID > 0 {
+		packageIDs := make([]int64, len(reqs))
+		for i, req := range reqs {
+			packageIDs[i] = req.PackageID
+		}
+		if err := reseller.NewManager(h.db).CheckNewAccounts(parentID, packageIDs); err != nil {
+			return resellerPoolError(c, err)
+		}
+	}
+
+	type generatedPassword struct {
+		Row      int    `json:"row"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	passwords := []generatedPassword{}
+	items := make([]account.BulkItem, len(reqs))
+	for i := range reqs {
+		if reqs[i].Password == "" {
+			reqs[i].Password = generatePassword(16)
+			passwords = append(passwords, generatedPassword{Row: i + 1, Username: reqs[i].Username, Password: reqs[i].Password})
+		}
+		items[i] = account.BulkItem{Username: reqs[i].Username}
+	}
+
+	op, taskID, err := h.startBulk(c, svc, account.BulkCreate, items,
+		fmt.Sprintf("%d hesap oluşturuluyor", len(items)), func(item *account.BulkItem) error {
+			req := reqs[item.Row-1]
+			// The pool may have shrunk while the queue was waiting
+			if req.ParentID > 0 {
+				if err := reseller.NewManager(h.db).CheckNewAccount(req.ParentID, req.PackageID); err != nil {
+					return err
+				}
+			}
+			acc, err := account.NewService(h.db).CreateAccount(req)
+			if err != nil {
+				return err
+			}
+			item.AccountID = acc.ID
+			return nil
+		})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to start bulk operation",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success":      true,
+		"operation_id": op.ID,
+		"task_id":      taskID,
+		"message":      "Toplu hesap oluşturma başlatıldı",
+		"data":         passwords,
+	})
+}
+
+// BulkAccountAction suspends, unsuspends, moves to another package or
+// deletes a list of accounts: POST /accounts/bulk/:action with
+// {"ids": [...]} and the options of the single-account call ("reason",
+// "package_id", "purge"). Every account is checked first, then the rows run
+// through the bulk queue.
+func (h *Handler) BulkAccountAction(c *fiber.Ctx) error {
+	var req struct {
+		IDs       []int64 `json:"ids"`
+		Reason    string  `json:"reason"`
+		PackageID int64   `json:"package_id"`
+		Purge     bool    `json:"purge"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	owner := resellerScope(c)
+	actorID := c.Locals("user_id").(int64)
+	ip := c.IP()
+	svc := account.NewService(h.db)
+
+	if len(req.IDs) == 0 || len(req.IDs) > account.MaxBulkRows {
+		err := account.ErrBulkEmpty
+		if len(req.IDs) > 0 {
+			err = account.ErrBulkTooLarge
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	items, rowErrors := h.bulkTargets(req.IDs, owner)
+	if rowErrors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   account.ErrBulkInvalid.Error(),
+			Data:    rowErrors,
+		})
+	}
+
+	var action, taskName string
+	var run func(item *account.BulkItem) error
+
+	switch c.Params("action") {
+	case "suspend":
+		action, taskName = account.BulkSuspend, fmt.Sprintf("%d hesap askıya alınıyor", len(items))
+		run = func(item *account.BulkItem) error {
+			if err := account.NewService(h.db).SuspendAccount(item.AccountID, req.Reason, actorID); err != nil {
+				return err
+			}
+			details := fmt.Sprintf("Account #%d suspended", item.AccountID)
+			if req.Reason != "" {
+				details += ": " + req.Reason
+			}
+			h.logActivity(actorID, "account_suspend", details, ip)
+			return nil
+		}
+	case "unsuspend":
+		action, taskName = account.BulkUnsuspend, fmt.Sprintf("%d hesabın askısı kaldırılıyor", len(items))
+		run = func(item *account.BulkItem) error {
+			if owner > 0 {
+				if err := account.NewService(h.db).CheckSuspender(item.AccountID, owner); err != nil {
+					return err
+				}
+			}
+			if err := account.NewService(h.db).UnsuspendAccount(item.AccountID); err != nil {
+				return err
+			}
+			h.logActivity(actorID, "account_unsuspend", fmt.Sprintf("Account #%d unsuspended", item.AccountID), ip)
+			return nil
+		}
+	case "package":
+		var packageName string
+		err := h.db.QueryRow("SELECT name FROM packages WHERE id = ? AND (? = 0 OR owner_id = ?)",
+			req.PackageID, owner, owner).Scan(&packageName)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+				Success: false,
+				Error:   account.ErrPackageNotFound.Error(),
+			})
+		}
+		action, taskName = account.BulkChangePackage, fmt.Sprintf("%d hesap %s paketine taşınıyor", len(items), packageName)
+		run = func(item *account.BulkItem) error {
+			if owner > 0 {
+				if err := reseller.NewManager(h.db).CheckPackageChange(owner, item.AccountID, req.PackageID); err != nil {
+					return err
+				}
+			}
+			if _, err := account.NewService(h.db).ChangePackage(item.AccountID, req.PackageID); err != nil {
+				return err
+			}
+			h.logActivity(actorID, "account_package_change",
+				fmt.Sprintf("Account %s moved to package %s", item.Username, packageName), ip)
+			return nil
+		}
+	case "delete":
+		if req.Purge && owner > 0 {
+			return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Only admins can purge accounts",
+			})
+		}
+		action, taskName = account.BulkDelete, fmt.Sprintf("%d hesap kapatılıyor", len(items))
+		run = func(item *account.BulkItem) error {
+			svc := account.NewService(h.db)
+			if req.Purge {
+				if err := svc.DeleteAccount(item.AccountID); err != nil {
+					return err
+				}
+				h.logActivity(actorID, "account_purge", fmt.Sprintf("Purged account %s", item.Username), ip)
+				return nil
+			}
+			termination, err := svc.TerminateAccount(item.AccountID, actorID)
+			if err != nil {
+				return err
+			}
+			h.logActivity(actorID, "account_terminate",
+				fmt.Sprintf("Terminated account %s, purge after %s", termination.Username, termination.PurgeAfter), ip)
+			return nil
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Unknown bulk action, use suspend, unsuspend, package or delete",
+		})
+	}
+
+	op, taskID, err := h.startBulk(c, svc, action, items, taskName, run)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to start bulk operation",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success":      true,
+		"operation_id": op.ID,
+		"task_id":      taskID,
+		"message":      "Toplu işlem başlatıldı",
+	})
+}
+
+// ListBulkOperations returns recent bulk operations; resellers see their own
+func (h *Handler) ListBulkOperations(c *fiber.Ctx) error {
+	ops, err := account.NewService(h.db).ListBulkOperations(resellerScope(c), c.QueryInt("limit", 100))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch bulk operations",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    ops,
+	})
+}
+
+// GetBulkOperation returns a bulk operation with its per-row results
+func (h *Handler) GetBulkOperation(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid operation ID",
+		})
+	}
+
+	op, err := account.NewService(h.db).GetBulkOperation(id, resellerScope(c))
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, account.ErrBulkNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    op,
+	})
+}
+
+// startBulk records a bulk operation and works through it in the
+// background, relaying each row's result to a task
+func (h *Handler) startBulk(c *fiber.Ctx, svc *account.Service, action string, items []account.BulkItem,
+	taskName string, run func(item *account.BulkItem) error) (*account.BulkOperation, string, error) {
+	actorID := c.Locals("user_id").(int64)
+	op, err := svc.NewBulkOperation(action, actorID, items)
+	if err != nil {
+		return nil, "", err
+	}
+
+	taskID := fmt.Sprintf("bulk-%d", op.ID)
+	taskManager.createTask(taskID, "bulk_"+action, taskName)
+	svc.SetProgress(func(msg string) { taskManager.addLog(taskID, msg) })
+	h.logActivity(actorID, "bulk_"+action, fmt.Sprintf("Bulk %s of %d accounts started (#%d)", action, len(items), op.ID), c.IP())
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s (işlem #%d)...", taskName, op.ID))
+		svc.RunBulk(op, run)
+		taskManager.addLog(taskID, fmt.Sprintf("📋 %d başarılı, %d başarısız", op.Succeeded, op.Failed))
+		taskManager.completeTask(taskID, op.Failed == 0)
+	}()
+
+	return op, taskID, nil
+}
+
+// bulkTargets checks the accounts of a bulk action: each must exist, be
+// managed by the caller and be listed once
+func (h *Handler) bulkTargets(ids []int64, owner int64) ([]account.BulkItem, []account.BulkRowError) {
+	var items []account.BulkItem
+	var rowErrors []account.BulkRowError
+	seen := map[int64]int{}
+
+	for i, id := range ids {
+		if prev, ok := seen[id]; ok {
+			rowErrors = append(rowErrors, account.BulkRowError{Row: i + 1, Error: fmt.Sprintf("account repeats row %d", prev)})
+			continue
+		}
+		seen[id] = i + 1
+
+		var username string
+		err := h.db.QueryRow("SELECT username FROM users WHERE id = ? AND role = 'user' AND (? = 0 OR parent_id = ?)",
+			id, owner, owner).Scan(&username)
+		if err != nil {
+			rowErrors = append(rowErrors, account.BulkRowError{Row: i + 1, Error: account.ErrAccountNotFound.Error()})
+			continue
+		}
+		items = append(items, account.BulkItem{AccountID: id, Username: username})
+	}
+	return items, rowErrors
+}
+
+// bulkUpload returns the bulk create payload and whether it is CSV or JSON
+func bulkUpload(c *fiber.Ctx) ([]byte, string, error) {
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, "", err
+		}
+		if strings.HasSuffix(strings.ToLower(file.Filename), ".json") {
+			return data, "json", nil
+		}
+		return data, "csv", nil
+	}
+
+	if strings.Contains(c.Get(fiber.HeaderContentType), "csv") || c.Query("format") == "csv" {
+		return c.Body(), "csv", nil
+	}
+	return c.Body(), "json", nil
+}
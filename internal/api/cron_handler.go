@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -672,60 +673,5 @@ func isValidCronField(field string, min, max int) bool {
 
 // SyncUserCrontabFromDB syncs crontab from database - called by handlers
 func (h *Handler) SyncUserCrontabFromDB(userID int64, username string) error {
-	cronDir := "/var/spool/cron/crontabs"
-	cronFile := filepath.Join(cronDir, username)
-
-	// Ensure directory exists
-	os.MkdirAll(cronDir, 0755)
-
-	// Get active cron jobs for user
-	rows, err := h.db.Query(`
-		SELECT schedule, command FROM cron_jobs 
-		WHERE user_id = ? AND active = 1
-		ORDER BY id
-	`, userID)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	// Build crontab content
-	var content strings.Builder
-	content.WriteString("# ServerPanel managed crontab - DO NOT EDIT MANUALLY\n")
-	content.WriteString("# Changes will be overwritten by the panel\n")
-	content.WriteString(fmt.Sprintf("# User: %s\n\n", username))
-
-	// Add environment variables
-	content.WriteString(fmt.Sprintf("HOME=/home/%s\n", username))
-	content.WriteString("SHELL=/bin/bash\n")
-	content.WriteString("PATH=/usr/local/bin:/usr/bin:/bin\n\n")
-
-	for rows.Next() {
-		var schedule, command string
-		if err := rows.Scan(&schedule, &command); err != nil {
-			continue
-		}
-		content.WriteString(fmt.Sprintf("%s %s\n", schedule, command))
-	}
-
-	// Write to temp file first
-	tempFile := cronFile + ".tmp"
-	if err := os.WriteFile(tempFile, []byte(content.String()), 0600); err != nil {
-		return err
-	}
-
-	// Set proper ownership (crontab files need specific permissions)
-	exec.Command("chown", fmt.Sprintf("%s:crontab", username), tempFile).Run()
-	exec.Command("chmod", "600", tempFile).Run()
-
-	// Move to final location
-	if err := os.Rename(tempFile, cronFile); err != nil {
-		os.Remove(tempFile)
-		return err
-	}
-
-	// Reload cron daemon to pick up changes
-	exec.Command("systemctl", "reload", "cron").Run()
-
-	return nil
+	return account.NewService(h.db).SyncCrontab(userID, username)
 }
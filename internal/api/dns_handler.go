@@ -511,115 +511,17 @@ func (h *Handler) updateZoneFile(domainName string) error {
 	}
 	defer rows.Close()
 
-	var records []struct {
-		Name     string
-		Type     string
-		Content  string
-		TTL      int
-		Priority int
-	}
-
+	var records []dns.Record
 	for rows.Next() {
-		var r struct {
-			Name     string
-			Type     string
-			Content  string
-			TTL      int
-			Priority int
-		}
+		var r dns.Record
 		if err := rows.Scan(&r.Name, &r.Type, &r.Content, &r.TTL, &r.Priority); err != nil {
 			continue
 		}
 		records = append(records, r)
 	}
 
-	// Generate zone file content
-	zoneContent := h.generateZoneFileContent(domainName, records)
-
-	// Write zone file using DNS manager
 	dnsManager := dns.NewManager(h.cfg.SimulateMode, h.cfg.SimulateBasePath)
-	zonePath := dnsManager.GetZonePath()
-	zoneFile := zonePath + "/db." + domainName
-
-	if err := os.WriteFile(zoneFile, []byte(zoneContent), 0644); err != nil {
-		return fmt.Errorf("failed to write zone file: %w", err)
-	}
-
-	// Reload BIND
-	return dnsManager.Reload()
-}
-
-func (h *Handler) generateZoneFileContent(domain string, records []struct {
-	Name     string
-	Type     string
-	Content  string
-	TTL      int
-	Priority int
-}) string {
-	serial := time.Now().Format("2006010215")
-
-	zone := fmt.Sprintf(`; Zone file for %s
-; Generated by ServerPanel
-; Last updated: %s
-$TTL 3600
-@       IN      SOA     ns1.serverpanel.local. hostmaster.%s. (
-                        %s      ; Serial
-                        3600            ; Refresh
-                        1800            ; Retry
-                        604800          ; Expire
-                        86400 )         ; Minimum TTL
-
-`, domain, time.Now().Format("2006-01-02 15:04:05"), domain, serial)
-
-	// Group records by type
-	recordsByType := make(map[string][]struct {
-		Name     string
-		Type     string
-		Content  string
-		TTL      int
-		Priority int
-	})
-
-	for _, r := range records {
-		recordsByType[r.Type] = append(recordsByType[r.Type], r)
-	}
-
-	// Write records in order: NS, A, AAAA, CNAME, MX, TXT, SRV, CAA
-	typeOrder := []string{"NS", "A", "AAAA", "CNAME", "MX", "TXT", "SRV", "CAA"}
-
-	for _, recordType := range typeOrder {
-		recs, ok := recordsByType[recordType]
-		if !ok || len(recs) == 0 {
-			continue
-		}
-
-		zone += fmt.Sprintf("; %s Records\n", recordType)
-		for _, r := range recs {
-			name := r.Name
-			if name == "" {
-				name = "@"
-			}
-
-			switch r.Type {
-			case "MX":
-				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%d\t%s\n", name, r.TTL, r.Type, r.Priority, r.Content)
-			case "SRV":
-				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%d\t%s\n", name, r.TTL, r.Type, r.Priority, r.Content)
-			case "TXT":
-				// Ensure TXT content is quoted
-				content := r.Content
-				if !strings.HasPrefix(content, "\"") {
-					content = "\"" + content + "\""
-				}
-				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%s\n", name, r.TTL, r.Type, content)
-			default:
-				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%s\n", name, r.TTL, r.Type, r.Content)
-			}
-		}
-		zone += "\n"
-	}
-
-	return zone
+	return dnsManager.WriteZone(domainName, records)
 }
 
 func isValidRecordType(recordType string) bool {
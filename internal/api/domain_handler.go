@@ -13,6 +13,7 @@ import (
 
 	"github.com/asergenalkan/serverpanel/internal/config"
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
 	dnsService "github.com/asergenalkan/serverpanel/internal/services/dns"
 	"github.com/gofiber/fiber/v2"
 )
@@ -531,6 +532,15 @@ func (h *Handler) CreateSubdomain(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.RedirectURL != "" {
+		if err := account.NewService(nil).ValidateRedirectURL(req.RedirectURL); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Geçersiz yönlendirme adresi (http:// veya https:// ile başlamalı)",
+			})
+		}
+	}
+
 	// Get domain info and check ownership
 	var domainUserID int64
 	var domainName string
@@ -779,8 +789,11 @@ func (h *Handler) createDomainResources(username, domain, documentRoot string) {
 </html>
 `, domain, domain)
 	indexPath := filepath.Join(documentRoot, "index.html")
-	os.WriteFile(indexPath, []byte(welcomeHTML), 0644)
-	exec.Command("chown", fmt.Sprintf("%s:%s", username, username), indexPath).Run()
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		// Don't overwrite existing content (e.g. restored from backup)
+		os.WriteFile(indexPath, []byte(welcomeHTML), 0644)
+		exec.Command("chown", fmt.Sprintf("%s:%s", username, username), indexPath).Run()
+	}
 }
 
 func (h *Handler) removeDomainResources(username, domain string) {
@@ -895,8 +908,10 @@ func (h *Handler) createSubdomainResources(username, fullName, documentRoot, red
 </html>
 `, fullName, fullName)
 		indexPath := filepath.Join(documentRoot, "index.html")
-		os.WriteFile(indexPath, []byte(welcomeHTML), 0644)
-		exec.Command("chown", fmt.Sprintf("%s:%s", username, username), indexPath).Run()
+		if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+			os.WriteFile(indexPath, []byte(welcomeHTML), 0644)
+			exec.Command("chown", fmt.Sprintf("%s:%s", username, username), indexPath).Run()
+		}
 	}
 
 	vhostPath := fmt.Sprintf("/etc/apache2/sites-available/%s.conf", fullName)
@@ -998,6 +998,27 @@ func (h *Handler) createMailbox(email, password string, quotaMB int, domain stri
 		return
 	}
 
+	// Generate Dovecot-compatible password hash using doveadm
+	dovecotHash := ""
+	out, err := exec.Command("doveadm", "pw", "-s", "BLF-CRYPT", "-p", password).Output()
+	if err == nil {
+		dovecotHash = strings.TrimSpace(string(out))
+	} else {
+		log.Printf("⚠️ doveadm pw hatası: %v", err)
+		return
+	}
+
+	h.registerMailbox(email, dovecotHash, domain)
+}
+
+// registerMailbox creates the maildir and writes Postfix/Dovecot entries for
+// an already hashed password. Existing entries for the address are replaced.
+func (h *Handler) registerMailbox(email, dovecotHash, domain string) {
+	if config.IsDevelopment() {
+		log.Printf("🔧 [DEV] Mailbox kaydedilecek: %s", email)
+		return
+	}
+
 	parts := strings.Split(email, "@")
 	if len(parts) != 2 {
 		return
@@ -1026,6 +1047,7 @@ func (h *Handler) createMailbox(email, password string, quotaMB int, domain stri
 
 	// Add to Postfix virtual mailbox maps
 	virtualMailboxFile := "/etc/postfix/vmailbox"
+	removeLinesWithPrefix(virtualMailboxFile, email+" ", 0644)
 	f, err := os.OpenFile(virtualMailboxFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err == nil {
 		f.WriteString(fmt.Sprintf("%s %s/%s/\n", email, domain, localPart))
@@ -1033,18 +1055,9 @@ func (h *Handler) createMailbox(email, password string, quotaMB int, domain stri
 		exec.Command("postmap", virtualMailboxFile).Run()
 	}
 
-	// Generate Dovecot-compatible password hash using doveadm
-	dovecotHash := ""
-	out, err := exec.Command("doveadm", "pw", "-s", "BLF-CRYPT", "-p", password).Output()
-	if err == nil {
-		dovecotHash = strings.TrimSpace(string(out))
-	} else {
-		log.Printf("⚠️ doveadm pw hatası: %v", err)
-		return
-	}
-
 	// Add to Dovecot passwd file
 	passwdFile := "/etc/dovecot/users"
+	removeLinesWithPrefix(passwdFile, email+":", 0640)
 	f, err = os.OpenFile(passwdFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
 	if err == nil {
 		// Format: user@domain:{SCHEME}password
@@ -1060,6 +1073,22 @@ func (h *Handler) createMailbox(email, password string, quotaMB int, domain stri
 	log.Printf("✅ Mailbox oluşturuldu: %s", email)
 }
 
+// removeLinesWithPrefix drops every line starting with prefix from a map file
+func removeLinesWithPrefix(path, prefix string, perm os.FileMode) {
+	content, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(content), prefix) {
+		return
+	}
+
+	var newLines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			newLines = append(newLines, line)
+		}
+	}
+	os.WriteFile(path, []byte(strings.Join(newLines, "\n")), perm)
+}
+
 func (h *Handler) updateMailboxPassword(email, passwordHash string) {
 	if config.IsDevelopment() {
 		log.Printf("🔧 [DEV] Mailbox şifresi güncellenecek: %s", email)
@@ -1322,10 +1351,14 @@ func (h *Handler) GetEmailSettings(c *fiber.Ctx) error {
 	)
 
 	if err != nil {
-		// Create default settings
+		// Create default settings; send limits start at the package's
 		cfg := config.Get()
 		settings.HourlyLimit = 100
 		settings.DailyLimit = 500
+		h.db.QueryRow(`
+			SELECT COALESCE(p.max_emails_per_hour, 100), COALESCE(p.max_emails_per_day, 500)
+			FROM user_packages up JOIN packages p ON p.id = up.package_id WHERE up.user_id = ?
+		`, domainUserID).Scan(&settings.HourlyLimit, &settings.DailyLimit)
 		settings.DKIMSelector = "default"
 		settings.SPFRecord = fmt.Sprintf("v=spf1 ip4:%s ~all", cfg.ServerIP)
 		settings.DMARCRecord = fmt.Sprintf("v=DMARC1; p=none; rua=mailto:postmaster@%s", domainName)
@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/asergenalkan/serverpanel/internal/services/quota"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -34,8 +36,21 @@ func getUserFromContext(c *fiber.Ctx) (username string, role string) {
 	return
 }
 
-// validatePath ensures the path is within the user's allowed directory
-func (h *Handler) validatePath(basePath, requestedPath string) (string, error) {
+// inodeLimitReached reports whether the caller's account is at its
+// package's inode limit. Where the filesystem has no quotas this is what
+// stops new files; with quotas the kernel refuses them as well.
+func (h *Handler) inodeLimitReached(c *fiber.Ctx) bool {
+	if _, role := getUserFromContext(c); role != models.RoleUser {
+		return false
+	}
+	userID, _ := c.Locals("user_id").(int64)
+	return account.NewService(h.db).InodeLimitReached(userID)
+}
+
+// validatePath ensures the path is within the user's allowed directory.
+// Sub-users with a file root are further confined to that subtree of the
+// account's home.
+func (h *Handler) validatePath(c *fiber.Ctx, basePath, requestedPath string) (string, error) {
 	// Clean and join the paths
 	fullPath := filepath.Clean(filepath.Join(basePath, requestedPath))
 
@@ -44,6 +59,14 @@ func (h *Handler) validatePath(basePath, requestedPath string) (string, error) {
 		return "", fmt.Errorf("access denied: path outside home directory")
 	}
 
+	if root, _ := c.Locals("file_root").(string); root != "" {
+		username, _ := getUserFromContext(c)
+		rootPath := filepath.Join(h.cfg.HomeBaseDir, username, root)
+		if fullPath != rootPath && !strings.HasPrefix(fullPath, rootPath+string(filepath.Separator)) {
+			return "", fmt.Errorf("access denied: path outside %s", "/"+root)
+		}
+	}
+
 	return fullPath, nil
 }
 
@@ -61,7 +84,7 @@ func (h *Handler) ListFiles(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	fullPath, err := h.validatePath(basePath, path)
+	fullPath, err := h.validatePath(c, basePath, path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -147,7 +170,7 @@ func (h *Handler) ReadFile(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	fullPath, err := h.validatePath(basePath, path)
+	fullPath, err := h.validatePath(c, basePath, path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -184,6 +207,9 @@ func (h *Handler) ReadFile(c *fiber.Ctx) error {
 // WriteFile creates or updates a file
 func (h *Handler) WriteFile(c *fiber.Ctx) error {
 	username, role := getUserFromContext(c)
+	if h.inodeLimitReached(c) {
+		return c.Status(507).JSON(fiber.Map{"success": false, "error": account.ErrInodeLimitReached.Error()})
+	}
 
 	var req struct {
 		Path    string `json:"path"`
@@ -205,7 +231,7 @@ func (h *Handler) WriteFile(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	fullPath, err := h.validatePath(basePath, req.Path)
+	fullPath, err := h.validatePath(c, basePath, req.Path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -232,6 +258,9 @@ func (h *Handler) WriteFile(c *fiber.Ctx) error {
 // CreateDirectory creates a new directory
 func (h *Handler) CreateDirectory(c *fiber.Ctx) error {
 	username, role := getUserFromContext(c)
+	if h.inodeLimitReached(c) {
+		return c.Status(507).JSON(fiber.Map{"success": false, "error": account.ErrInodeLimitReached.Error()})
+	}
 
 	var req struct {
 		Path string `json:"path"`
@@ -248,7 +277,7 @@ func (h *Handler) CreateDirectory(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	fullPath, err := h.validatePath(basePath, req.Path)
+	fullPath, err := h.validatePath(c, basePath, req.Path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -290,7 +319,7 @@ func (h *Handler) DeleteFiles(c *fiber.Ctx) error {
 
 	var errors []string
 	for _, path := range req.Paths {
-		fullPath, err := h.validatePath(basePath, path)
+		fullPath, err := h.validatePath(c, basePath, path)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("%s: %v", path, err))
 			continue
@@ -342,12 +371,12 @@ func (h *Handler) RenameFile(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	oldFullPath, err := h.validatePath(basePath, req.OldPath)
+	oldFullPath, err := h.validatePath(c, basePath, req.OldPath)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
 
-	newFullPath, err := h.validatePath(basePath, req.NewPath)
+	newFullPath, err := h.validatePath(c, basePath, req.NewPath)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -367,6 +396,9 @@ func (h *Handler) RenameFile(c *fiber.Ctx) error {
 // CopyFiles copies files or directories
 func (h *Handler) CopyFiles(c *fiber.Ctx) error {
 	username, role := getUserFromContext(c)
+	if h.inodeLimitReached(c) {
+		return c.Status(507).JSON(fiber.Map{"success": false, "error": account.ErrInodeLimitReached.Error()})
+	}
 
 	var req struct {
 		Sources     []string `json:"sources"`
@@ -384,14 +416,14 @@ func (h *Handler) CopyFiles(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	destPath, err := h.validatePath(basePath, req.Destination)
+	destPath, err := h.validatePath(c, basePath, req.Destination)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
 
 	var errors []string
 	for _, src := range req.Sources {
-		srcPath, err := h.validatePath(basePath, src)
+		srcPath, err := h.validatePath(c, basePath, src)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("%s: %v", src, err))
 			continue
@@ -430,14 +462,14 @@ func (h *Handler) MoveFiles(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	destPath, err := h.validatePath(basePath, req.Destination)
+	destPath, err := h.validatePath(c, basePath, req.Destination)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
 
 	var errors []string
 	for _, src := range req.Sources {
-		srcPath, err := h.validatePath(basePath, src)
+		srcPath, err := h.validatePath(c, basePath, src)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("%s: %v", src, err))
 			continue
@@ -459,6 +491,9 @@ func (h *Handler) MoveFiles(c *fiber.Ctx) error {
 // UploadFiles handles file uploads
 func (h *Handler) UploadFiles(c *fiber.Ctx) error {
 	username, role := getUserFromContext(c)
+	if h.inodeLimitReached(c) {
+		return c.Status(507).JSON(fiber.Map{"success": false, "error": account.ErrInodeLimitReached.Error()})
+	}
 	path := c.FormValue("path", "/")
 
 	var basePath string
@@ -468,7 +503,7 @@ func (h *Handler) UploadFiles(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	destPath, err := h.validatePath(basePath, path)
+	destPath, err := h.validatePath(c, basePath, path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -530,7 +565,7 @@ func (h *Handler) DownloadFile(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	fullPath, err := h.validatePath(basePath, path)
+	fullPath, err := h.validatePath(c, basePath, path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -559,6 +594,9 @@ func (h *Handler) DownloadFile(c *fiber.Ctx) error {
 // CompressFiles creates a zip archive
 func (h *Handler) CompressFiles(c *fiber.Ctx) error {
 	username, role := getUserFromContext(c)
+	if h.inodeLimitReached(c) {
+		return c.Status(507).JSON(fiber.Map{"success": false, "error": account.ErrInodeLimitReached.Error()})
+	}
 
 	var req struct {
 		Paths       []string `json:"paths"`
@@ -576,7 +614,7 @@ func (h *Handler) CompressFiles(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	destPath, err := h.validatePath(basePath, req.Destination)
+	destPath, err := h.validatePath(c, basePath, req.Destination)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -597,7 +635,7 @@ func (h *Handler) CompressFiles(c *fiber.Ctx) error {
 	defer zipWriter.Close()
 
 	for _, path := range req.Paths {
-		srcPath, err := h.validatePath(basePath, path)
+		srcPath, err := h.validatePath(c, basePath, path)
 		if err != nil {
 			continue
 		}
@@ -620,6 +658,9 @@ func (h *Handler) CompressFiles(c *fiber.Ctx) error {
 // ExtractFiles extracts a zip archive
 func (h *Handler) ExtractFiles(c *fiber.Ctx) error {
 	username, role := getUserFromContext(c)
+	if h.inodeLimitReached(c) {
+		return c.Status(507).JSON(fiber.Map{"success": false, "error": account.ErrInodeLimitReached.Error()})
+	}
 
 	var req struct {
 		Path        string `json:"path"`
@@ -637,12 +678,12 @@ func (h *Handler) ExtractFiles(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	zipPath, err := h.validatePath(basePath, req.Path)
+	zipPath, err := h.validatePath(c, basePath, req.Path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
 
-	destPath, err := h.validatePath(basePath, req.Destination)
+	destPath, err := h.validatePath(c, basePath, req.Destination)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
@@ -695,6 +736,48 @@ func (h *Handler) ExtractFiles(c *fiber.Ctx) error {
 	})
 }
 
+// GetInodeUsage returns the inode count of each directory under path, so a
+// directory full of small files (typically a cache) can be found. Accounts
+// also get their usage against the package's max_inodes.
+func (h *Handler) GetInodeUsage(c *fiber.Ctx) error {
+	username, role := getUserFromContext(c)
+	path := c.Query("path", "/")
+
+	var basePath string
+	if role == models.RoleAdmin {
+		basePath = h.cfg.HomeBaseDir
+	} else {
+		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
+	}
+
+	fullPath, err := h.validatePath(c, basePath, path)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
+	}
+
+	if role == models.RoleUser {
+		userID, _ := c.Locals("user_id").(int64)
+		report, err := account.NewService(h.db).GetInodeReport(userID, strings.TrimPrefix(fullPath, basePath))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"success": false, "error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"success": true, "data": report})
+	}
+
+	dirs, total, err := quota.NewManager(h.cfg.SimulateMode, h.cfg.SimulateBasePath, h.cfg.HomeBaseDir).InodeBreakdown(fullPath)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"success": false, "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"path":        path,
+			"total":       total,
+			"directories": dirs,
+		},
+	})
+}
+
 // GetFileInfo returns detailed file information
 func (h *Handler) GetFileInfo(c *fiber.Ctx) error {
 	username, role := getUserFromContext(c)
@@ -711,7 +794,7 @@ func (h *Handler) GetFileInfo(c *fiber.Ctx) error {
 		basePath = filepath.Join(h.cfg.HomeBaseDir, username)
 	}
 
-	fullPath, err := h.validatePath(basePath, path)
+	fullPath, err := h.validatePath(c, basePath, path)
 	if err != nil {
 		return c.Status(403).JSON(fiber.Map{"success": false, "error": err.Error()})
 	}
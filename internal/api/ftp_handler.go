@@ -661,6 +661,39 @@ func deletePureFTPdUser(username string) error {
 	return nil
 }
 
+// restorePureFTPdEntry writes a pureftpd.passwd line taken from a backup.
+// uid/gid are remapped to the system user on this server.
+func restorePureFTPdEntry(entry, systemUser string) error {
+	fields := strings.Split(entry, ":")
+	if len(fields) < 6 {
+		return fmt.Errorf("invalid pureftpd entry")
+	}
+
+	uid, err := exec.Command("id", "-u", systemUser).Output()
+	if err != nil {
+		return fmt.Errorf("system user not found: %s", systemUser)
+	}
+	gid, err := exec.Command("id", "-g", systemUser).Output()
+	if err != nil {
+		return fmt.Errorf("system user not found: %s", systemUser)
+	}
+	fields[2] = strings.TrimSpace(string(uid))
+	fields[3] = strings.TrimSpace(string(gid))
+
+	passwdFile := "/etc/pure-ftpd/pureftpd.passwd"
+	removeLinesWithPrefix(passwdFile, fields[0]+":", 0600)
+
+	f, err := os.OpenFile(passwdFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	f.WriteString(strings.Join(fields, ":") + "\n")
+	f.Close()
+
+	// Rebuild the PureDB
+	return exec.Command("pure-pw", "mkdb").Run()
+}
+
 func updatePureFTPdPassword(username, password string) error {
 	cmd := exec.Command("pure-pw", "passwd", username, "-m")
 
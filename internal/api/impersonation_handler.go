@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImpersonateAccount issues a token that lets an admin, or a reseller for
+// their own accounts, see the panel exactly as the user does. The token
+// names both users and every change made with it is logged under the actor.
+func (h *Handler) ImpersonateAccount(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	// Impersonation needs an interactive login, not an automation token
+	if c.Locals("api_token_id") != nil {
+		return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+			Success: false,
+			Error:   "API tokens cannot impersonate users",
+		})
+	}
+
+	if !h.accountInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
+	target, err := h.loadLoginUser(id)
+	if err != nil || !target.Active {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found or suspended",
+		})
+	}
+	if target.Role == models.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Admin users cannot be impersonated",
+		})
+	}
+
+	actorID := c.Locals("user_id").(int64)
+	actor, err := h.loadLoginUser(actorID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+	}
+
+	token, err := auth.CreateImpersonationSession(h.db, target, actor, h.cfg.JWTSecret, c.IP(), c.Get("User-Agent"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to generate token",
+		})
+	}
+
+	h.logActivity(actorID, "impersonation_start", fmt.Sprintf("Started acting as %s (#%d)", target.Username, target.ID), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data: models.LoginResponse{
+			Token:     token,
+			ExpiresIn: int64(auth.ImpersonationTTL.Seconds()),
+			User:      *target,
+			Impersonator: &models.Impersonator{
+				ID:       actor.ID,
+				Username: actor.Username,
+				Role:     actor.Role,
+			},
+		},
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// authLogPath is where failed logins are written for fail2ban
+const authLogPath = "/var/log/serverpanel/auth.log"
+
+var (
+	authLogMu sync.Mutex
+	// Anything outside this set is masked so a crafted username cannot
+	// forge log fields
+	unsafeLogChars = regexp.MustCompile(`[^A-Za-z0-9._@-]`)
+)
+
+// loginFailed records a failed login attempt in the lockout counters,
+// activity_logs and the fail2ban log, and sends the error response. userID
+// is 0 when the username does not exist.
+func (h *Handler) loginFailed(c *fiber.Ctx, username string, userID int64, reason, message string) error {
+	ip := c.IP()
+	failure := auth.RecordLoginFailure(h.db, ip, username)
+
+	// Unknown usernames are logged without a user
+	var uid interface{}
+	if userID > 0 {
+		uid = userID
+	}
+	h.logLoginActivity(uid, "login_failed", fmt.Sprintf("Failed login for %s: %s", username, reason), ip)
+
+	writeAuthLog(h.authLogFile(), ip, username, reason)
+	if failure.UsernameLocked {
+		writeAuthLog(h.authLogFile(), ip, username, "username_locked")
+	}
+
+	if failure.Lockout > 0 {
+		h.logLoginActivity(uid, "login_locked", fmt.Sprintf("Login locked for %s (%s)", username, failure.Lockout), ip)
+		return tooManyLoginAttempts(c, failure.Lockout)
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// logLoginActivity is logActivity with a nullable user ID
+func (h *Handler) logLoginActivity(userID interface{}, action, details, ip string) {
+	h.db.Exec(`
+		INSERT INTO activity_logs (user_id, action, details, ip_address)
+		VALUES (?, ?, ?, ?)
+	`, userID, action, details, ip)
+}
+
+// authLogFile returns the fail2ban log path; simulate mode keeps it in the
+// data directory
+func (h *Handler) authLogFile() string {
+	if h.cfg.SimulateMode {
+		return filepath.Join(h.cfg.DataDir, "logs", "auth.log")
+	}
+	return authLogPath
+}
+
+// writeAuthLog appends a line fail2ban's serverpanel filter matches:
+//
+//	2026-01-02 15:04:05 serverpanel[1234]: Authentication failure from 203.0.113.7 user=admin reason=invalid_password
+func writeAuthLog(path, ip, username, reason string) {
+	authLogMu.Lock()
+	defer authLogMu.Unlock()
+
+	os.MkdirAll(filepath.Dir(path), 0755)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "%s serverpanel[%d]: Authentication failure from %s user=%s reason=%s\n",
+		time.Now().Format("2006-01-02 15:04:05"), os.Getpid(), ip,
+		unsafeLogChars.ReplaceAllString(username, "?"), unsafeLogChars.ReplaceAllString(reason, "_"))
+}
+
+func tooManyLoginAttempts(c *fiber.Ctx, lockout time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(lockout.Seconds())))
+	return c.Status(fiber.StatusTooManyRequests).JSON(models.APIResponse{
+		Success: false,
+		Error:   fmt.Sprintf("Too many failed login attempts, try again in %s", lockout.Round(time.Second)),
+	})
+}
@@ -1,29 +1,45 @@
 package api
 
 import (
+	"database/sql"
+	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/asergenalkan/serverpanel/internal/services/feature"
+	"github.com/asergenalkan/serverpanel/internal/services/reseller"
 	"github.com/gofiber/fiber/v2"
 )
 
 // Package represents a hosting package with all limits
 type Package struct {
-	ID                  int64  `json:"id"`
-	Name                string `json:"name"`
-	DiskQuota           int    `json:"disk_quota"`
-	BandwidthQuota      int    `json:"bandwidth_quota"`
-	MaxDomains          int    `json:"max_domains"`
-	MaxDatabases        int    `json:"max_databases"`
-	MaxEmails           int    `json:"max_emails"`
-	MaxFTP              int    `json:"max_ftp"`
-	MaxPHPMemory        string `json:"max_php_memory"`
-	MaxPHPUpload        string `json:"max_php_upload"`
-	MaxPHPExecutionTime int    `json:"max_php_execution_time"`
-	MaxEmailsPerHour    int    `json:"max_emails_per_hour"`
-	MaxEmailsPerDay     int    `json:"max_emails_per_day"`
-	CreatedAt           string `json:"created_at"`
-	UserCount           int    `json:"user_count,omitempty"`
+	ID                  int64    `json:"id"`
+	Name                string   `json:"name"`
+	DiskQuota           int      `json:"disk_quota"`
+	BandwidthQuota      int      `json:"bandwidth_quota"`
+	MaxDomains          int      `json:"max_domains"`
+	MaxDatabases        int      `json:"max_databases"`
+	MaxEmails           int      `json:"max_emails"`
+	MaxFTP              int      `json:"max_ftp"`
+	MaxPHPMemory        string   `json:"max_php_memory"`
+	MaxPHPUpload        string   `json:"max_php_upload"`
+	MaxPHPExecutionTime int      `json:"max_php_execution_time"`
+	MaxEmailsPerHour    int      `json:"max_emails_per_hour"`
+	MaxEmailsPerDay     int      `json:"max_emails_per_day"`
+	MaxInodes           int64    `json:"max_inodes"`         // files and directories, 0 means unlimited
+	Features            []string `json:"features"`           // modules the package includes
+	OwnerID             *int64   `json:"owner_id,omitempty"` // reseller that defined the package
+	CreatedAt           string   `json:"created_at"`
+	UserCount           int      `json:"user_count,omitempty"`
+}
+
+// packageInScope reports whether the caller may manage a package. Resellers
+// only manage the packages they defined.
+func (h *Handler) packageInScope(c *fiber.Ctx, id int64) bool {
+	owner := resellerScope(c)
+	return owner == 0 || reseller.NewManager(h.db).OwnsPackage(owner, id)
 }
 
 func (h *Handler) ListPackages(c *fiber.Ctx) error {
@@ -32,10 +48,12 @@ func (h *Handler) ListPackages(c *fiber.Ctx) error {
 		       p.max_databases, p.max_emails, p.max_ftp, 
 		       p.max_php_memory, p.max_php_upload, p.max_php_execution_time,
 		       COALESCE(p.max_emails_per_hour, 100), COALESCE(p.max_emails_per_day, 500),
-		       p.created_at,
+		       COALESCE(p.max_inodes, 0), COALESCE(p.features, ''), p.owner_id, p.created_at,
 		       (SELECT COUNT(*) FROM user_packages WHERE package_id = p.id) as user_count
-		FROM packages p ORDER BY p.name
-	`)
+		FROM packages p
+		WHERE (? = 0 OR p.owner_id = ?)
+		ORDER BY p.name
+	`, resellerScope(c), resellerScope(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
 			Success: false,
@@ -47,13 +65,15 @@ func (h *Handler) ListPackages(c *fiber.Ctx) error {
 	var packages []Package
 	for rows.Next() {
 		var p Package
+		var features string
 		if err := rows.Scan(&p.ID, &p.Name, &p.DiskQuota, &p.BandwidthQuota, &p.MaxDomains,
 			&p.MaxDatabases, &p.MaxEmails, &p.MaxFTP,
 			&p.MaxPHPMemory, &p.MaxPHPUpload, &p.MaxPHPExecutionTime,
-			&p.MaxEmailsPerHour, &p.MaxEmailsPerDay,
-			&p.CreatedAt, &p.UserCount); err != nil {
+			&p.MaxEmailsPerHour, &p.MaxEmailsPerDay, &p.MaxInodes, &features,
+			&p.OwnerID, &p.CreatedAt, &p.UserCount); err != nil {
 			continue
 		}
+		p.Features = feature.Parse(features)
 		packages = append(packages, p)
 	}
 
@@ -72,18 +92,27 @@ func (h *Handler) GetPackage(c *fiber.Ctx) error {
 		})
 	}
 
+	if !h.packageInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Package not found",
+		})
+	}
+
 	var p Package
+	var features string
 	err = h.db.QueryRow(`
 		SELECT id, name, disk_quota, bandwidth_quota, max_domains, 
 		       max_databases, max_emails, max_ftp,
 		       max_php_memory, max_php_upload, max_php_execution_time,
 		       COALESCE(max_emails_per_hour, 100), COALESCE(max_emails_per_day, 500),
-		       created_at
+		       COALESCE(max_inodes, 0), COALESCE(features, ''), owner_id, created_at
 		FROM packages WHERE id = ?
 	`, id).Scan(&p.ID, &p.Name, &p.DiskQuota, &p.BandwidthQuota, &p.MaxDomains,
 		&p.MaxDatabases, &p.MaxEmails, &p.MaxFTP,
 		&p.MaxPHPMemory, &p.MaxPHPUpload, &p.MaxPHPExecutionTime,
-		&p.MaxEmailsPerHour, &p.MaxEmailsPerDay, &p.CreatedAt)
+		&p.MaxEmailsPerHour, &p.MaxEmailsPerDay, &p.MaxInodes, &features, &p.OwnerID, &p.CreatedAt)
+	p.Features = feature.Parse(features)
 
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
@@ -148,11 +177,29 @@ func (h *Handler) CreatePackage(c *fiber.Ctx) error {
 	if pkg.MaxEmailsPerDay == 0 {
 		pkg.MaxEmailsPerDay = 500
 	}
+	if pkg.Features == nil {
+		pkg.Features = feature.All
+	}
+	if err := feature.Validate(pkg.Features); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	// Reseller packages must fit into the reseller's resource pool
+	var ownerID sql.NullInt64
+	if owner := resellerScope(c); owner > 0 {
+		if err := reseller.NewManager(h.db).CheckPackage(owner, int64(pkg.DiskQuota), int64(pkg.MaxDomains)); err != nil {
+			return resellerPoolError(c, err)
+		}
+		ownerID = sql.NullInt64{Int64: owner, Valid: true}
+	}
 
 	result, err := h.db.Exec(`
-		INSERT INTO packages (name, disk_quota, bandwidth_quota, max_domains, max_databases, max_emails, max_ftp, max_php_memory, max_php_upload, max_php_execution_time, max_emails_per_hour, max_emails_per_day)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, pkg.Name, pkg.DiskQuota, pkg.BandwidthQuota, pkg.MaxDomains, pkg.MaxDatabases, pkg.MaxEmails, pkg.MaxFTP, pkg.MaxPHPMemory, pkg.MaxPHPUpload, pkg.MaxPHPExecutionTime, pkg.MaxEmailsPerHour, pkg.MaxEmailsPerDay)
+		INSERT INTO packages (name, disk_quota, bandwidth_quota, max_domains, max_databases, max_emails, max_ftp, max_php_memory, max_php_upload, max_php_execution_time, max_emails_per_hour, max_emails_per_day, max_inodes, features, owner_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, pkg.Name, pkg.DiskQuota, pkg.BandwidthQuota, pkg.MaxDomains, pkg.MaxDatabases, pkg.MaxEmails, pkg.MaxFTP, pkg.MaxPHPMemory, pkg.MaxPHPUpload, pkg.MaxPHPExecutionTime, pkg.MaxEmailsPerHour, pkg.MaxEmailsPerDay, pkg.MaxInodes, feature.Join(pkg.Features), ownerID)
 
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
@@ -187,13 +234,37 @@ func (h *Handler) UpdatePackage(c *fiber.Ctx) error {
 		})
 	}
 
+	if !h.packageInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Package not found",
+		})
+	}
+	// Features stay unchanged when not sent
+	var features sql.NullString
+	if pkg.Features != nil {
+		if err := feature.Validate(pkg.Features); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		features = sql.NullString{String: feature.Join(pkg.Features), Valid: true}
+	}
+	if owner := resellerScope(c); owner > 0 {
+		if err := reseller.NewManager(h.db).CheckPackageUpdate(owner, id, int64(pkg.DiskQuota), int64(pkg.MaxDomains)); err != nil {
+			return resellerPoolError(c, err)
+		}
+	}
+
 	_, err = h.db.Exec(`
 		UPDATE packages SET name = ?, disk_quota = ?, bandwidth_quota = ?, 
 		max_domains = ?, max_databases = ?, max_emails = ?, max_ftp = ?,
 		max_php_memory = ?, max_php_upload = ?, max_php_execution_time = ?,
-		max_emails_per_hour = ?, max_emails_per_day = ?
+		max_emails_per_hour = ?, max_emails_per_day = ?, max_inodes = ?,
+		features = COALESCE(?, features)
 		WHERE id = ?
-	`, pkg.Name, pkg.DiskQuota, pkg.BandwidthQuota, pkg.MaxDomains, pkg.MaxDatabases, pkg.MaxEmails, pkg.MaxFTP, pkg.MaxPHPMemory, pkg.MaxPHPUpload, pkg.MaxPHPExecutionTime, pkg.MaxEmailsPerHour, pkg.MaxEmailsPerDay, id)
+	`, pkg.Name, pkg.DiskQuota, pkg.BandwidthQuota, pkg.MaxDomains, pkg.MaxDatabases, pkg.MaxEmails, pkg.MaxFTP, pkg.MaxPHPMemory, pkg.MaxPHPUpload, pkg.MaxPHPExecutionTime, pkg.MaxEmailsPerHour, pkg.MaxEmailsPerDay, pkg.MaxInodes, features, id)
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
@@ -202,9 +273,32 @@ func (h *Handler) UpdatePackage(c *fiber.Ctx) error {
 		})
 	}
 
+	// Accounts on the package get the new limits in the background; each
+	// account's result, including resources above the new limits, goes to
+	// the task log
+	taskID := fmt.Sprintf("package-limits-%d-%d", id, time.Now().UnixNano())
+	taskName := fmt.Sprintf("%s paketinin limitleri uygulanıyor", pkg.Name)
+	taskManager.createTask(taskID, "package", taskName)
+	svc := account.NewService(h.db)
+	svc.SetProgress(func(msg string) { taskManager.addLog(taskID, msg) })
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+		reports := svc.ApplyPackageLimits(id)
+		failed := 0
+		for _, r := range reports {
+			if len(r.Failed) > 0 {
+				failed++
+			}
+		}
+		taskManager.addLog(taskID, fmt.Sprintf("📋 %d hesap, %d hatalı", len(reports), failed))
+		taskManager.completeTask(taskID, failed == 0)
+	}()
+
 	return c.JSON(models.APIResponse{
 		Success: true,
 		Message: "Package updated successfully",
+		Data:    fiber.Map{"task_id": taskID},
 	})
 }
 
@@ -217,6 +311,13 @@ func (h *Handler) DeletePackage(c *fiber.Ctx) error {
 		})
 	}
 
+	if !h.packageInScope(c, id) {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Package not found",
+		})
+	}
+
 	// Check if package is in use
 	var count int
 	h.db.QueryRow("SELECT COUNT(*) FROM user_packages WHERE package_id = ?", id).Scan(&count)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/asergenalkan/serverpanel/internal/config"
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/webserver"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -315,7 +316,7 @@ func (h *Handler) UpdateDomainPHPSettings(c *fiber.Ctx) error {
 	// Validate settings (apply package limits for non-admin users)
 	if role != models.RoleAdmin {
 		// Apply package memory limit
-		if !isValidMemoryLimit(req.MemoryLimit, maxMemory) {
+		if !webserver.PHPSizeWithin(req.MemoryLimit, maxMemory) {
 			req.MemoryLimit = maxMemory
 		}
 		// Apply package execution time limit
@@ -323,11 +324,11 @@ func (h *Handler) UpdateDomainPHPSettings(c *fiber.Ctx) error {
 			req.MaxExecutionTime = maxExecTime
 		}
 		// Apply package upload size limit
-		if !isValidMemoryLimit(req.UploadMaxFilesize, maxUpload) {
+		if !webserver.PHPSizeWithin(req.UploadMaxFilesize, maxUpload) {
 			req.UploadMaxFilesize = maxUpload
 		}
 		// post_max_size should be at least upload_max_filesize
-		if !isValidMemoryLimit(req.PostMaxSize, maxUpload) {
+		if !webserver.PHPSizeWithin(req.PostMaxSize, maxUpload) {
 			req.PostMaxSize = maxUpload
 		}
 	}
@@ -361,16 +362,14 @@ func (h *Handler) UpdateDomainPHPSettings(c *fiber.Ctx) error {
 
 	// Update PHP-FPM pool config
 	if !config.IsDevelopment() {
-		homeDir := filepath.Join("/home", username)
+		// The pool is written and PHP-FPM reloaded
+		homeDir := filepath.Join(h.cfg.HomeBaseDir, username)
 		if err := h.updatePHPFPMPoolSettings(username, homeDir, phpVersion, req); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
 				Success: false,
 				Error:   "Failed to update PHP-FPM config: " + err.Error(),
 			})
 		}
-
-		// Reload PHP-FPM
-		exec.Command("systemctl", "reload", fmt.Sprintf("php%s-fpm", phpVersion)).Run()
 	}
 
 	return c.JSON(models.APIResponse{
@@ -403,81 +402,23 @@ func (h *Handler) updateApacheVhostPHP(domain, username, documentRoot, phpVersio
 	return os.WriteFile(vhostPath, []byte(strings.Join(lines, "\n")), 0644)
 }
 
+// updatePHPFPMPoolSettings rewrites a user's pool with the webserver
+// package's template, so it matches pools created with the account
 func (h *Handler) updatePHPFPMPoolSettings(username, homeDir, phpVersion string, settings PHPSettings) error {
-	poolPath := fmt.Sprintf("/etc/php/%s/fpm/pool.d/%s.conf", phpVersion, username)
-
-	displayErrors := "off"
-	if settings.DisplayErrors {
-		displayErrors = "on"
-	}
-
-	socketPath := fmt.Sprintf("/run/php/php%s-fpm-%s.sock", phpVersion, username)
-
-	poolConfig := fmt.Sprintf(`[%s]
-; Pool for user %s
-
-user = %s
-group = %s
-
-listen = %s
-listen.owner = www-data
-listen.group = www-data
-listen.mode = 0660
-
-pm = dynamic
-pm.max_children = 5
-pm.start_servers = 2
-pm.min_spare_servers = 1
-pm.max_spare_servers = 3
-pm.max_requests = 500
-
-; Logging
-php_admin_value[error_log] = %s/logs/php-error.log
-php_admin_flag[log_errors] = on
-
-; Security
-php_admin_value[open_basedir] = %s:/tmp:/usr/share/php
-php_admin_value[upload_tmp_dir] = %s/tmp
-php_admin_value[session.save_path] = %s/tmp
-
-; Custom Settings
-php_admin_value[memory_limit] = %s
-php_admin_value[max_execution_time] = %d
-php_admin_value[max_input_time] = %d
-php_admin_value[post_max_size] = %s
-php_admin_value[upload_max_filesize] = %s
-php_admin_value[max_file_uploads] = %d
-php_admin_flag[display_errors] = %s
-php_admin_value[error_reporting] = %s
-`,
-		username, username, username, username, socketPath,
-		homeDir, homeDir, homeDir, homeDir,
-		settings.MemoryLimit, settings.MaxExecutionTime, settings.MaxInputTime,
-		settings.PostMaxSize, settings.UploadMaxFilesize, settings.MaxFileUploads,
-		displayErrors, settings.ErrorReporting,
-	)
-
-	return os.WriteFile(poolPath, []byte(poolConfig), 0644)
-}
-
-// isValidMemoryLimit checks if a memory limit is within allowed range
-func isValidMemoryLimit(value, maxAllowed string) bool {
-	parseSize := func(s string) int64 {
-		s = strings.ToUpper(strings.TrimSpace(s))
-		multiplier := int64(1)
-		if strings.HasSuffix(s, "G") {
-			multiplier = 1024 * 1024 * 1024
-			s = strings.TrimSuffix(s, "G")
-		} else if strings.HasSuffix(s, "M") {
-			multiplier = 1024 * 1024
-			s = strings.TrimSuffix(s, "M")
-		} else if strings.HasSuffix(s, "K") {
-			multiplier = 1024
-			s = strings.TrimSuffix(s, "K")
-		}
-		val, _ := strconv.ParseInt(s, 10, 64)
-		return val * multiplier
+	pool := webserver.PHPFPMConfig{
+		Username:   username,
+		HomeDir:    homeDir,
+		PHPVersion: phpVersion,
+		Settings: webserver.PHPSettings{
+			MemoryLimit:       settings.MemoryLimit,
+			MaxExecutionTime:  settings.MaxExecutionTime,
+			MaxInputTime:      settings.MaxInputTime,
+			PostMaxSize:       settings.PostMaxSize,
+			UploadMaxFilesize: settings.UploadMaxFilesize,
+			MaxFileUploads:    settings.MaxFileUploads,
+			DisplayErrors:     settings.DisplayErrors,
+			ErrorReporting:    settings.ErrorReporting,
+		},
 	}
-
-	return parseSize(value) <= parseSize(maxAllowed)
+	return webserver.NewPHPFPMManager(h.cfg.SimulateMode, h.cfg.SimulateBasePath, phpVersion).UpdatePool(pool)
 }
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListProvisioningJobs returns recent account create/delete jobs (Admin only).
+// ?status=failed lists the jobs waiting for a resume or rollback.
+func (h *Handler) ListProvisioningJobs(c *fiber.Ctx) error {
+	jobs, err := account.NewService(h.db).ListJobs(c.Query("status"), c.QueryInt("limit", 100))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch provisioning jobs",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    jobs,
+	})
+}
+
+// GetProvisioningJob returns a job with its step journal (Admin only)
+func (h *Handler) GetProvisioningJob(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid job ID",
+		})
+	}
+
+	job, err := account.NewService(h.db).GetJob(id)
+	if err != nil {
+		return provisioningError(c, err, nil)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// ResumeProvisioningJob runs a job again from the step where it stopped (Admin only)
+func (h *Handler) ResumeProvisioningJob(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid job ID",
+		})
+	}
+
+	job, err := account.NewService(h.db).ResumeJob(id)
+	if job != nil {
+		h.logActivity(c.Locals("user_id").(int64), "provisioning_resume",
+			fmt.Sprintf("Resumed %s job #%d for %s: %s", job.Action, job.ID, job.Username, job.Status), c.IP())
+	}
+	if err != nil {
+		return provisioningError(c, err, job)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// RollbackProvisioningJob undoes the completed steps of a failed create job (Admin only)
+func (h *Handler) RollbackProvisioningJob(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid job ID",
+		})
+	}
+
+	job, err := account.NewService(h.db).RollbackJob(id)
+	if job != nil {
+		h.logActivity(c.Locals("user_id").(int64), "provisioning_rollback",
+			fmt.Sprintf("Rolled back %s job #%d for %s: %s", job.Action, job.ID, job.Username, job.Status), c.IP())
+	}
+	if err != nil {
+		return provisioningError(c, err, job)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// provisioningError maps journal errors to a response. A failed step
+// returns the job so the caller sees where it stopped.
+func provisioningError(c *fiber.Ctx, err error, job *account.Job) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, account.ErrJobNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, account.ErrJobRunning), errors.Is(err, account.ErrJobNotResumable),
+		errors.Is(err, account.ErrJobNotRollbackable):
+		status = fiber.StatusConflict
+	}
+
+	resp := models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	}
+	if job != nil {
+		resp.Data = job
+	}
+	return c.Status(status).JSON(resp)
+}
+
+// accountJobError responds to a failed account create or delete. When a
+// journaled step failed, the job ID is returned for resume or rollback.
+func accountJobError(c *fiber.Ctx, err error, status int) error {
+	resp := models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	}
+	var jobErr *account.JobError
+	if errors.As(err, &jobErr) {
+		status = fiber.StatusInternalServerError
+		resp.Data = map[string]int64{"job_id": jobErr.JobID}
+	}
+	return c.Status(status).JSON(resp)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CheckServerDrift compares the panel DB with the system for every account (Admin only)
+func (h *Handler) CheckServerDrift(c *fiber.Ctx) error {
+	report, err := account.NewService(h.db).CheckAll()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to check configuration drift",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// CheckAccountDrift compares the panel DB with the system for one account (Admin only)
+func (h *Handler) CheckAccountDrift(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	report, err := account.NewService(h.db).CheckAccount(id)
+	if err != nil {
+		return reconcileError(c, err)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// RebuildAccount regenerates an account's vhosts, zones, PHP pool, mail,
+// FTP and cron configuration from the panel DB (Admin only)
+func (h *Handler) RebuildAccount(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	report, err := account.NewService(h.db).RebuildAccount(id)
+	if err != nil {
+		return reconcileError(c, err)
+	}
+
+	h.logActivity(c.Locals("user_id").(int64), "account_rebuild",
+		fmt.Sprintf("Rebuilt account %s: %d artifacts, %d removed, %d errors",
+			report.Username, len(report.Rebuilt), len(report.Removed), len(report.Errors)), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Account rebuilt",
+		Data:    report,
+	})
+}
+
+// RebuildServer rebuilds every account that is not suspended (Admin only)
+func (h *Handler) RebuildServer(c *fiber.Ctx) error {
+	report, err := account.NewService(h.db).RebuildAll()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to rebuild accounts",
+		})
+	}
+
+	h.logActivity(c.Locals("user_id").(int64), "server_rebuild",
+		fmt.Sprintf("Rebuilt %d accounts", len(report.Accounts)), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Accounts rebuilt",
+		Data:    report,
+	})
+}
+
+func reconcileError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	case errors.Is(err, account.ErrRebuildSuspended):
+		return c.Status(fiber.StatusConflict).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Suspended accounts cannot be rebuilt, unsuspend the account first",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RenameAccount changes an account's username: Linux user, home directory,
+// PHP-FPM pool, MySQL and FTP prefixes and crontab. It runs as a background
+// task; a failed rename is resumed from the provisioning journal.
+func (h *Handler) RenameAccount(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	newUsername := strings.ToLower(strings.TrimSpace(req.Username))
+
+	svc := account.NewService(h.db)
+	job, err := svc.StartRename(id, newUsername)
+	if err != nil {
+		return accountChangeError(c, err)
+	}
+
+	taskID := fmt.Sprintf("rename-%d-%d", id, time.Now().UnixNano())
+	h.runAccountJob(c, svc, job, taskID, fmt.Sprintf("%s hesabı %s olarak yeniden adlandırılıyor", job.Username, newUsername),
+		"account_rename", fmt.Sprintf("Account %s renamed to %s", job.Username, newUsername))
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"job_id":  job.ID,
+		"message": "Yeniden adlandırma başlatıldı",
+	})
+}
+
+// ChangeAccountDomain moves an account to a new primary domain: vhosts, DNS
+// zone, mail maps and SSL. It runs as a background task like RenameAccount.
+func (h *Handler) ChangeAccountDomain(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	var req struct {
+		Domain string `json:"domain"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	newDomain := strings.ToLower(strings.TrimSpace(req.Domain))
+
+	svc := account.NewService(h.db)
+	job, err := svc.StartDomainChange(id, newDomain)
+	if err != nil {
+		return accountChangeError(c, err)
+	}
+
+	taskID := fmt.Sprintf("domain-%d-%d", id, time.Now().UnixNano())
+	h.runAccountJob(c, svc, job, taskID, fmt.Sprintf("%s hesabının alan adı %s olarak değiştiriliyor", job.Username, newDomain),
+		"account_domain_change", fmt.Sprintf("Account %s primary domain changed to %s", job.Username, newDomain))
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"job_id":  job.ID,
+		"message": "Alan adı değişikliği başlatıldı",
+	})
+}
+
+// runAccountJob runs a journaled account job in the background, relaying
+// its step progress to the task
+func (h *Handler) runAccountJob(c *fiber.Ctx, svc *account.Service, job *account.Job, taskID, taskName, action, details string) {
+	ip := c.IP()
+	adminID := c.Locals("user_id").(int64)
+	taskManager.createTask(taskID, job.Action, taskName)
+	svc.SetProgress(func(msg string) { taskManager.addLog(taskID, msg) })
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s (iş #%d)...", taskName, job.ID))
+		if err := svc.RunJob(job); err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.addLog(taskID, fmt.Sprintf("🔁 Kaldığı yerden devam etmek için: POST /api/v1/provisioning/jobs/%d/resume", job.ID))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		h.logActivity(adminID, action, details, ip)
+		taskManager.addLog(taskID, "✅ Tamamlandı")
+		taskManager.completeTask(taskID, true)
+	}()
+}
+
+// accountChangeError maps rename and domain change errors to a response
+func accountChangeError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, account.ErrInvalidUsername), errors.Is(err, account.ErrInvalidDomain),
+		errors.Is(err, account.ErrSameUsername), errors.Is(err, account.ErrSameDomain):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, account.ErrUserExists), errors.Is(err, account.ErrDomainExists),
+		errors.Is(err, account.ErrRenameConflict), errors.Is(err, account.ErrRenameTriggers),
+		errors.Is(err, account.ErrHomeDirExists),
+		errors.Is(err, account.ErrSuspended), errors.Is(err, account.ErrAccountTerminated),
+		errors.Is(err, account.ErrJobPending):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
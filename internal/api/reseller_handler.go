@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/reseller"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListResellers returns every reseller with their resource pool and usage
+func (h *Handler) ListResellers(c *fiber.Ctx) error {
+	pools, err := reseller.NewManager(h.db).ListPools()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch resellers",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    pools,
+	})
+}
+
+// GetResellerPool returns the resource pool of a reseller
+func (h *Handler) GetResellerPool(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid reseller ID",
+		})
+	}
+	return h.resellerPoolResponse(c, id)
+}
+
+// GetMyResellerPool returns the calling reseller's pool and usage
+func (h *Handler) GetMyResellerPool(c *fiber.Ctx) error {
+	return h.resellerPoolResponse(c, c.Locals("user_id").(int64))
+}
+
+func (h *Handler) resellerPoolResponse(c *fiber.Ctx, id int64) error {
+	pool, err := reseller.NewManager(h.db).GetPool(id)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, reseller.ErrNoPool) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    pool,
+	})
+}
+
+// UpdateResellerPool grants or changes a reseller's resource pool
+func (h *Handler) UpdateResellerPool(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid reseller ID",
+		})
+	}
+
+	var req struct {
+		MaxAccounts int64 `json:"max_accounts"`
+		DiskQuota   int64 `json:"disk_quota"` // MB
+		MaxDomains  int64 `json:"max_domains"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	if err := reseller.NewManager(h.db).SetPool(id, req.MaxAccounts, req.DiskQuota, req.MaxDomains); err != nil {
+		return resellerPoolError(c, err)
+	}
+
+	userID := c.Locals("user_id").(int64)
+	h.logActivity(userID, "reseller_pool_update", fmt.Sprintf("Reseller #%d pool: %d accounts, %d MB, %d domains",
+		id, req.MaxAccounts, req.DiskQuota, req.MaxDomains), c.IP())
+
+	return h.resellerPoolResponse(c, id)
+}
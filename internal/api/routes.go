@@ -5,6 +5,8 @@ import (
 	"github.com/asergenalkan/serverpanel/internal/database"
 	"github.com/asergenalkan/serverpanel/internal/middleware"
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/feature"
+	"github.com/asergenalkan/serverpanel/internal/services/subuser"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -19,19 +21,80 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 
 	// Public routes
 	router.Post("/auth/login", h.Login)
+	router.Post("/auth/login/2fa", h.LoginTwoFactor)
+	router.Post("/auth/login/2fa/setup", h.LoginTwoFactorSetup)
+	router.Post("/auth/login/2fa/enable", h.LoginTwoFactorEnable)
+	router.Post("/auth/refresh", h.Refresh)
+	router.Get("/auth/sso", h.GetSSOProviders)
+	router.Get("/auth/oidc/login", h.OIDCLogin)
+	router.Get("/auth/oidc/callback", h.OIDCCallback)
+	router.Post("/auth/sso/exchange", h.ExchangeSSOCode)
 	router.Get("/health", h.Health)
 	router.Get("/internal/pma-credentials", h.GetPhpMyAdminCredentials)
 
+	// Account transfer - Diğer panellerden gelen istekler (transfer token ile)
+	router.Post("/transfers/check", h.TransferTokenAuth, h.CheckTransfer)
+	router.Post("/transfers/receive", h.TransferTokenAuth, h.ReceiveTransfer)
+	router.Get("/transfers/receive/:task_id", h.TransferTokenAuth, h.GetTransferStatus)
+
 	// Protected routes
-	protected := router.Group("/", middleware.AuthMiddleware(cfg.JWTSecret))
+	protected := router.Group("/", middleware.AuthMiddleware(cfg.JWTSecret, db))
+
+	// Sub-users only reach the features their account owner granted them
+	accountOwner := middleware.DenySubUsers()
+	// Admins and resellers impersonating a user never reach its credentials
+	credentials := middleware.DenyImpersonation()
+	canFiles := middleware.RequirePermission(subuser.PermFiles)
+	canDatabases := middleware.RequirePermission(subuser.PermDatabases)
+	canEmail := middleware.RequirePermission(subuser.PermEmail)
+	canDNS := middleware.RequirePermission(subuser.PermDNS)
+	canCron := middleware.RequirePermission(subuser.PermCron)
+	canSSL := middleware.RequirePermission(subuser.PermSSL)
+	canFTP := middleware.RequirePermission(subuser.PermFTP)
+
+	// Hosting accounts only reach the modules their package includes
+	filesFeature := middleware.RequireFeature(db, feature.Files)
+	emailFeature := middleware.RequireFeature(db, feature.Email)
+	ftpFeature := middleware.RequireFeature(db, feature.FTP)
+	dnsFeature := middleware.RequireFeature(db, feature.DNS)
+	sslFeature := middleware.RequireFeature(db, feature.SSL)
+	cronFeature := middleware.RequireFeature(db, feature.Cron)
+	malwareFeature := middleware.RequireFeature(db, feature.Malware)
 
 	// Auth
 	protected.Get("/auth/me", h.GetCurrentUser)
 	protected.Post("/auth/logout", h.Logout)
+	protected.Post("/auth/password", accountOwner, credentials, h.ChangePassword)
+
+	// Sessions
+	protected.Get("/auth/sessions", accountOwner, credentials, h.ListSessions)
+	protected.Delete("/auth/sessions", accountOwner, credentials, h.RevokeAllSessions)
+	protected.Delete("/auth/sessions/:id", accountOwner, credentials, h.RevokeSession)
+
+	// Two-factor authentication (TOTP)
+	protected.Get("/auth/2fa", accountOwner, credentials, h.GetTwoFactorStatus)
+	protected.Post("/auth/2fa/setup", accountOwner, credentials, h.SetupTwoFactor)
+	protected.Post("/auth/2fa/enable", accountOwner, credentials, h.EnableTwoFactor)
+	protected.Post("/auth/2fa/disable", accountOwner, credentials, h.DisableTwoFactor)
+	protected.Post("/auth/2fa/recovery-codes", accountOwner, credentials, h.RegenerateRecoveryCodes)
+
+	// API tokens - Otomasyon için kişisel token'lar
+	protected.Get("/auth/tokens", accountOwner, credentials, h.ListAPITokens)
+	protected.Post("/auth/tokens", accountOwner, credentials, h.CreateAPIToken)
+	protected.Delete("/auth/tokens/:id", accountOwner, credentials, h.RevokeAPIToken)
 
 	// Dashboard
 	protected.Get("/dashboard/stats", h.GetDashboardStats)
 
+	// Sub-users - Hesap sahibinin alt kullanıcıları
+	subUserOwner := middleware.RoleMiddleware(models.RoleUser)
+	protected.Get("/subusers/permissions", subUserOwner, accountOwner, h.GetSubUserPermissions)
+	protected.Get("/subusers", subUserOwner, accountOwner, h.ListSubUsers)
+	protected.Post("/subusers", subUserOwner, accountOwner, h.CreateSubUser)
+	protected.Get("/subusers/:id", subUserOwner, accountOwner, h.GetSubUser)
+	protected.Put("/subusers/:id", subUserOwner, accountOwner, h.UpdateSubUser)
+	protected.Delete("/subusers/:id", subUserOwner, accountOwner, h.DeleteSubUser)
+
 	// Admin middleware for admin-only routes
 	admin := middleware.RoleMiddleware(models.RoleAdmin)
 
@@ -41,46 +104,118 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 	protected.Get("/users/:id", admin, h.GetUser)
 	protected.Put("/users/:id", admin, h.UpdateUser)
 	protected.Delete("/users/:id", admin, h.DeleteUser)
-
-	// Packages (admin only)
-	protected.Get("/packages", admin, h.ListPackages)
-	protected.Get("/packages/:id", admin, h.GetPackage)
-	protected.Post("/packages", admin, h.CreatePackage)
-	protected.Put("/packages/:id", admin, h.UpdatePackage)
-	protected.Delete("/packages/:id", admin, h.DeletePackage)
-
-	// Accounts - Hosting hesapları (admin only)
-	protected.Get("/accounts", admin, h.ListAccounts)
-	protected.Post("/accounts", admin, h.CreateAccount)
-	protected.Get("/accounts/:id", admin, h.GetAccount)
-	protected.Delete("/accounts/:id", admin, h.DeleteAccount)
-	protected.Post("/accounts/:id/suspend", admin, h.SuspendAccount)
-	protected.Post("/accounts/:id/unsuspend", admin, h.UnsuspendAccount)
+	protected.Delete("/users/:id/2fa", admin, h.ResetUserTwoFactor)
+	protected.Get("/users/:id/sessions", admin, h.ListUserSessions)
+	protected.Delete("/users/:id/sessions", admin, h.RevokeUserSessions)
+
+	// Resellers manage their own packages and accounts (parent_id)
+	adminOrReseller := middleware.RoleMiddleware(models.RoleAdmin, models.RoleReseller)
+	reseller := middleware.RoleMiddleware(models.RoleReseller)
+
+	// Reseller resource pools
+	protected.Get("/resellers", admin, h.ListResellers)
+	protected.Get("/resellers/:id/pool", admin, h.GetResellerPool)
+	protected.Put("/resellers/:id/pool", admin, h.UpdateResellerPool)
+	protected.Get("/reseller/pool", reseller, h.GetMyResellerPool)
+
+	// Packages (admin, reseller: own packages)
+	protected.Get("/packages", adminOrReseller, h.ListPackages)
+	protected.Get("/packages/:id", adminOrReseller, h.GetPackage)
+	protected.Post("/packages", adminOrReseller, h.CreatePackage)
+	protected.Put("/packages/:id", adminOrReseller, h.UpdatePackage)
+	protected.Delete("/packages/:id", adminOrReseller, h.DeletePackage)
+
+	// Accounts - Hosting hesapları (admin, reseller: own accounts)
+	protected.Get("/accounts", adminOrReseller, h.ListAccounts)
+	protected.Post("/accounts", adminOrReseller, h.CreateAccount)
+	protected.Get("/accounts/terminated", adminOrReseller, h.ListTerminatedAccounts)
+	protected.Post("/accounts/bulk", adminOrReseller, h.BulkCreateAccounts)
+	protected.Get("/accounts/bulk", adminOrReseller, h.ListBulkOperations)
+	protected.Get("/accounts/bulk/:id", adminOrReseller, h.GetBulkOperation)
+	protected.Post("/accounts/bulk/:action", adminOrReseller, h.BulkAccountAction)
+	protected.Get("/accounts/:id", adminOrReseller, h.GetAccount)
+	protected.Delete("/accounts/:id", adminOrReseller, h.DeleteAccount)
+	protected.Post("/accounts/:id/suspend", adminOrReseller, h.SuspendAccount)
+	protected.Post("/accounts/:id/unsuspend", adminOrReseller, h.UnsuspendAccount)
+	protected.Put("/accounts/:id/package", adminOrReseller, h.ChangeAccountPackage)
+	protected.Get("/accounts/:id/bandwidth", adminOrReseller, h.GetAccountBandwidth)
+	protected.Get("/accounts/:id/inodes", adminOrReseller, h.GetAccountInodes)
+	protected.Post("/accounts/:id/restore", admin, h.RestoreAccount)
+	protected.Post("/accounts/:id/impersonate", credentials, adminOrReseller, h.ImpersonateAccount)
+	protected.Post("/accounts/:id/transfer", admin, h.TransferAccount)
+	protected.Post("/accounts/:id/rename", admin, h.RenameAccount)
+	protected.Post("/accounts/:id/domain", admin, h.ChangeAccountDomain)
+
+	// Provisioning journal - hesap oluşturma/silme adımları (admin only)
+	protected.Get("/provisioning/jobs", admin, h.ListProvisioningJobs)
+	protected.Get("/provisioning/jobs/:id", admin, h.GetProvisioningJob)
+	protected.Post("/provisioning/jobs/:id/resume", admin, h.ResumeProvisioningJob)
+	protected.Post("/provisioning/jobs/:id/rollback", admin, h.RollbackProvisioningJob)
+	protected.Get("/reconcile", admin, h.CheckServerDrift)
+	protected.Post("/reconcile/rebuild", admin, h.RebuildServer)
+	protected.Get("/reconcile/accounts/:id", admin, h.CheckAccountDrift)
+	protected.Post("/reconcile/accounts/:id/rebuild", admin, h.RebuildAccount)
+
+	// Bandwidth - Log tabanlı trafik sayımı ve limit aşımları (admin only)
+	protected.Get("/bandwidth/overages", admin, h.ListBandwidthOverages)
+	protected.Post("/bandwidth/collect", admin, h.CollectBandwidth)
+
+	// Inodes - Paket max_inodes kontrolü, saatlik çalışır (admin only)
+	protected.Post("/inodes/check", admin, h.CheckInodeLimits)
+
+	// Transfer tokens - Bu panele hesap gönderebilecek paneller (admin only)
+	protected.Get("/transfers/tokens", admin, h.ListTransferTokens)
+	protected.Post("/transfers/tokens", admin, h.CreateTransferToken)
+	protected.Delete("/transfers/tokens/:id", admin, h.DeleteTransferToken)
+
+	// Backups - Hesap yedekleme ve geri yükleme (admin only)
+	protected.Get("/backups", admin, h.ListBackups)
+	protected.Post("/backups", admin, h.CreateBackup)
+	protected.Post("/backups/upload", admin, h.UploadBackup)
+	protected.Post("/backups/import/cpanel", admin, h.ImportCpanelBackup)
+	protected.Get("/backups/schedules", admin, h.ListBackupSchedules)
+	protected.Post("/backups/schedules", admin, h.CreateBackupSchedule)
+	protected.Put("/backups/schedules/:id", admin, h.UpdateBackupSchedule)
+	protected.Delete("/backups/schedules/:id", admin, h.DeleteBackupSchedule)
+	protected.Post("/backups/schedules/:id/run", admin, h.RunBackupSchedule)
+	protected.Get("/backups/destinations", admin, h.ListBackupDestinations)
+	protected.Post("/backups/destinations", admin, h.CreateBackupDestination)
+	protected.Put("/backups/destinations/:id", admin, h.UpdateBackupDestination)
+	protected.Delete("/backups/destinations/:id", admin, h.DeleteBackupDestination)
+	protected.Post("/backups/destinations/:id/test", admin, h.TestBackupDestination)
+	protected.Get("/backups/destinations/:id/files", admin, h.ListRemoteBackups)
+	protected.Delete("/backups/destinations/:id/files", admin, h.DeleteRemoteBackup)
+	protected.Post("/backups/destinations/:id/upload", admin, h.UploadToDestination)
+	protected.Post("/backups/destinations/:id/fetch", admin, h.FetchFromDestination)
+	protected.Get("/backups/:id", admin, h.GetBackup)
+	protected.Get("/backups/:id/download", admin, h.DownloadBackup)
+	protected.Post("/backups/:id/restore", admin, h.RestoreBackup)
+	protected.Delete("/backups/:id", admin, h.DeleteBackup)
 
 	// Domains (all authenticated users)
-	protected.Get("/domains", h.ListDomains)
-	protected.Get("/domains/limits", h.GetUserLimits)
-	protected.Post("/domains", h.CreateDomain)
-	protected.Get("/domains/:id", h.GetDomain)
-	protected.Put("/domains/:id", h.UpdateDomain)
-	protected.Delete("/domains/:id", h.DeleteDomain)
+	protected.Get("/domains", accountOwner, h.ListDomains)
+	protected.Get("/domains/limits", accountOwner, h.GetUserLimits)
+	protected.Post("/domains", accountOwner, h.CreateDomain)
+	protected.Get("/domains/:id", accountOwner, h.GetDomain)
+	protected.Put("/domains/:id", accountOwner, h.UpdateDomain)
+	protected.Delete("/domains/:id", accountOwner, h.DeleteDomain)
 
 	// Subdomains (all authenticated users)
-	protected.Get("/subdomains", h.ListSubdomains)
-	protected.Post("/subdomains", h.CreateSubdomain)
-	protected.Delete("/subdomains/:id", h.DeleteSubdomain)
+	protected.Get("/subdomains", accountOwner, h.ListSubdomains)
+	protected.Post("/subdomains", accountOwner, h.CreateSubdomain)
+	protected.Delete("/subdomains/:id", accountOwner, h.DeleteSubdomain)
 
 	// Databases (all authenticated users)
-	protected.Get("/databases", h.ListDatabases)
-	protected.Post("/databases", h.CreateDatabase)
-	protected.Delete("/databases/:id", h.DeleteDatabase)
-	protected.Get("/databases/:id/size", h.GetDatabaseSize)
-	protected.Get("/databases/phpmyadmin", h.GetPhpMyAdminURL)
+	protected.Get("/databases", canDatabases, h.ListDatabases)
+	protected.Post("/databases", canDatabases, h.CreateDatabase)
+	protected.Delete("/databases/:id", canDatabases, h.DeleteDatabase)
+	protected.Get("/databases/:id/size", canDatabases, h.GetDatabaseSize)
+	protected.Get("/databases/phpmyadmin", canDatabases, h.GetPhpMyAdminURL)
 
 	// Database Users (all authenticated users)
-	protected.Get("/database-users", h.ListDatabaseUsers)
-	protected.Post("/database-users", h.CreateDatabaseUser)
-	protected.Delete("/database-users/:id", h.DeleteDatabaseUser)
+	protected.Get("/database-users", canDatabases, h.ListDatabaseUsers)
+	protected.Post("/database-users", canDatabases, h.CreateDatabaseUser)
+	protected.Delete("/database-users/:id", canDatabases, h.DeleteDatabaseUser)
 
 	// System (admin only)
 	protected.Get("/system/stats", admin, h.GetSystemStats)
@@ -88,25 +223,25 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 	protected.Post("/system/services/:name/restart", admin, h.RestartService)
 
 	// SSL Certificates (all authenticated users)
-	protected.Get("/ssl", h.ListSSLCertificates)
-	protected.Get("/ssl/:id", h.GetSSLCertificate)
-	protected.Post("/ssl/:id/issue", h.IssueSSLCertificate)
-	protected.Post("/ssl/issue-fqdn", h.IssueSSLForFQDN)
-	protected.Post("/ssl/:id/renew", h.RenewSSLCertificate)
-	protected.Delete("/ssl/:id", h.RevokeSSLCertificate)
+	protected.Get("/ssl", sslFeature, canSSL, h.ListSSLCertificates)
+	protected.Get("/ssl/:id", sslFeature, canSSL, h.GetSSLCertificate)
+	protected.Post("/ssl/:id/issue", sslFeature, canSSL, h.IssueSSLCertificate)
+	protected.Post("/ssl/issue-fqdn", sslFeature, canSSL, h.IssueSSLForFQDN)
+	protected.Post("/ssl/:id/renew", sslFeature, canSSL, h.RenewSSLCertificate)
+	protected.Delete("/ssl/:id", sslFeature, canSSL, h.RevokeSSLCertificate)
 
 	// PHP Management (all authenticated users)
-	protected.Get("/php/versions", h.GetInstalledPHPVersions)
-	protected.Get("/php/domains/:id", h.GetDomainPHPSettings)
-	protected.Put("/php/domains/:id/version", h.UpdateDomainPHPVersion)
-	protected.Put("/php/domains/:id/settings", h.UpdateDomainPHPSettings)
+	protected.Get("/php/versions", accountOwner, h.GetInstalledPHPVersions)
+	protected.Get("/php/domains/:id", accountOwner, h.GetDomainPHPSettings)
+	protected.Put("/php/domains/:id/version", accountOwner, h.UpdateDomainPHPVersion)
+	protected.Put("/php/domains/:id/settings", accountOwner, h.UpdateDomainPHPSettings)
 
 	// FTP Management (all authenticated users)
-	protected.Get("/ftp/accounts", h.ListFTPAccounts)
-	protected.Post("/ftp/accounts", h.CreateFTPAccount)
-	protected.Put("/ftp/accounts/:id", h.UpdateFTPAccount)
-	protected.Delete("/ftp/accounts/:id", h.DeleteFTPAccount)
-	protected.Post("/ftp/accounts/:id/toggle", h.ToggleFTPAccount)
+	protected.Get("/ftp/accounts", ftpFeature, canFTP, h.ListFTPAccounts)
+	protected.Post("/ftp/accounts", ftpFeature, canFTP, h.CreateFTPAccount)
+	protected.Put("/ftp/accounts/:id", ftpFeature, canFTP, h.UpdateFTPAccount)
+	protected.Delete("/ftp/accounts/:id", ftpFeature, canFTP, h.DeleteFTPAccount)
+	protected.Post("/ftp/accounts/:id/toggle", ftpFeature, canFTP, h.ToggleFTPAccount)
 
 	// FTP Server Settings (admin only)
 	protected.Get("/ftp/settings", admin, h.GetFTPSettings)
@@ -115,46 +250,47 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 	protected.Post("/ftp/restart", admin, h.RestartFTPServer)
 
 	// DNS Management (all authenticated users)
-	protected.Get("/dns/zones", h.ListDNSZones)
-	protected.Get("/dns/zones/:id", h.GetDNSZone)
-	protected.Post("/dns/records", h.CreateDNSRecord)
-	protected.Put("/dns/records/:id", h.UpdateDNSRecord)
-	protected.Delete("/dns/records/:id", h.DeleteDNSRecord)
-	protected.Post("/dns/zones/:id/reset", h.ResetDNSZone)
+	protected.Get("/dns/zones", dnsFeature, canDNS, h.ListDNSZones)
+	protected.Get("/dns/zones/:id", dnsFeature, canDNS, h.GetDNSZone)
+	protected.Post("/dns/records", dnsFeature, canDNS, h.CreateDNSRecord)
+	protected.Put("/dns/records/:id", dnsFeature, canDNS, h.UpdateDNSRecord)
+	protected.Delete("/dns/records/:id", dnsFeature, canDNS, h.DeleteDNSRecord)
+	protected.Post("/dns/zones/:id/reset", dnsFeature, canDNS, h.ResetDNSZone)
 
 	// Email Management (all authenticated users)
-	protected.Get("/email/accounts", h.ListEmailAccounts)
-	protected.Post("/email/accounts", h.CreateEmailAccount)
-	protected.Put("/email/accounts/:id", h.UpdateEmailAccount)
-	protected.Delete("/email/accounts/:id", h.DeleteEmailAccount)
-	protected.Post("/email/accounts/:id/toggle", h.ToggleEmailAccount)
-	protected.Get("/email/forwarders", h.ListEmailForwarders)
-	protected.Post("/email/forwarders", h.CreateEmailForwarder)
-	protected.Delete("/email/forwarders/:id", h.DeleteEmailForwarder)
-	protected.Get("/email/autoresponders", h.ListAutoresponders)
-	protected.Post("/email/autoresponders", h.CreateAutoresponder)
-	protected.Delete("/email/autoresponders/:id", h.DeleteAutoresponder)
-	protected.Get("/email/webmail", h.GetWebmailURL)
-	protected.Get("/email/stats", h.GetEmailStats)
-	protected.Get("/email/settings/:domain_id", h.GetEmailSettings)
-	protected.Put("/email/settings/:domain_id", h.UpdateEmailSettings)
-	protected.Post("/email/dkim/:domain_id", h.GenerateDKIM)
-	protected.Get("/email/dns-records/:domain_id", h.GetDNSRecordsForEmail)
+	protected.Get("/email/accounts", emailFeature, canEmail, h.ListEmailAccounts)
+	protected.Post("/email/accounts", emailFeature, canEmail, h.CreateEmailAccount)
+	protected.Put("/email/accounts/:id", emailFeature, canEmail, h.UpdateEmailAccount)
+	protected.Delete("/email/accounts/:id", emailFeature, canEmail, h.DeleteEmailAccount)
+	protected.Post("/email/accounts/:id/toggle", emailFeature, canEmail, h.ToggleEmailAccount)
+	protected.Get("/email/forwarders", emailFeature, canEmail, h.ListEmailForwarders)
+	protected.Post("/email/forwarders", emailFeature, canEmail, h.CreateEmailForwarder)
+	protected.Delete("/email/forwarders/:id", emailFeature, canEmail, h.DeleteEmailForwarder)
+	protected.Get("/email/autoresponders", emailFeature, canEmail, h.ListAutoresponders)
+	protected.Post("/email/autoresponders", emailFeature, canEmail, h.CreateAutoresponder)
+	protected.Delete("/email/autoresponders/:id", emailFeature, canEmail, h.DeleteAutoresponder)
+	protected.Get("/email/webmail", emailFeature, canEmail, h.GetWebmailURL)
+	protected.Get("/email/stats", emailFeature, canEmail, h.GetEmailStats)
+	protected.Get("/email/settings/:domain_id", emailFeature, canEmail, h.GetEmailSettings)
+	protected.Put("/email/settings/:domain_id", emailFeature, canEmail, h.UpdateEmailSettings)
+	protected.Post("/email/dkim/:domain_id", emailFeature, canEmail, h.GenerateDKIM)
+	protected.Get("/email/dns-records/:domain_id", emailFeature, canEmail, h.GetDNSRecordsForEmail)
 
 	// File Manager (all authenticated users)
-	protected.Get("/files/list", h.ListFiles)
-	protected.Get("/files/read", h.ReadFile)
-	protected.Post("/files/write", h.WriteFile)
-	protected.Post("/files/mkdir", h.CreateDirectory)
-	protected.Post("/files/delete", h.DeleteFiles)
-	protected.Post("/files/rename", h.RenameFile)
-	protected.Post("/files/copy", h.CopyFiles)
-	protected.Post("/files/move", h.MoveFiles)
-	protected.Post("/files/upload", h.UploadFiles)
-	protected.Get("/files/download", h.DownloadFile)
-	protected.Post("/files/compress", h.CompressFiles)
-	protected.Post("/files/extract", h.ExtractFiles)
-	protected.Get("/files/info", h.GetFileInfo)
+	protected.Get("/files/list", filesFeature, canFiles, h.ListFiles)
+	protected.Get("/files/read", filesFeature, canFiles, h.ReadFile)
+	protected.Post("/files/write", filesFeature, canFiles, h.WriteFile)
+	protected.Post("/files/mkdir", filesFeature, canFiles, h.CreateDirectory)
+	protected.Post("/files/delete", filesFeature, canFiles, h.DeleteFiles)
+	protected.Post("/files/rename", filesFeature, canFiles, h.RenameFile)
+	protected.Post("/files/copy", filesFeature, canFiles, h.CopyFiles)
+	protected.Post("/files/move", filesFeature, canFiles, h.MoveFiles)
+	protected.Post("/files/upload", filesFeature, canFiles, h.UploadFiles)
+	protected.Get("/files/download", filesFeature, canFiles, h.DownloadFile)
+	protected.Post("/files/compress", filesFeature, canFiles, h.CompressFiles)
+	protected.Post("/files/extract", filesFeature, canFiles, h.ExtractFiles)
+	protected.Get("/files/info", filesFeature, canFiles, h.GetFileInfo)
+	protected.Get("/files/inodes", filesFeature, canFiles, h.GetInodeUsage)
 
 	// Server Status (admin only)
 	protected.Get("/server/info", admin, h.GetServerInfo)
@@ -171,7 +307,7 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 	protected.Post("/mail-queue/clear", admin, h.ClearMailQueue)
 
 	// User Mail Stats (all users)
-	protected.Get("/email/my-stats", h.GetUserMailStats)
+	protected.Get("/email/my-stats", emailFeature, canEmail, h.GetUserMailStats)
 
 	// Software Manager (admin only)
 	protected.Get("/software/overview", admin, h.GetSoftwareOverview)
@@ -187,6 +323,12 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 	// Server Settings (admin only)
 	protected.Get("/settings/server", admin, h.GetServerSettings)
 	protected.Put("/settings/server", admin, h.UpdateServerSettings)
+	protected.Get("/settings/2fa", admin, h.GetTwoFactorSettings)
+	protected.Put("/settings/2fa", admin, h.UpdateTwoFactorSettings)
+	protected.Get("/settings/sso", admin, h.GetSSOSettings)
+	protected.Put("/settings/sso/ldap", admin, h.UpdateLDAPSettings)
+	protected.Put("/settings/sso/oidc", admin, h.UpdateOIDCSettings)
+	protected.Post("/settings/sso/ldap/test", admin, h.TestLDAPLogin)
 
 	// Server Features (all users - read only)
 	protected.Get("/server/features", h.GetServerFeatures)
@@ -197,34 +339,34 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 	protected.Get("/tasks/:task_id", admin, h.GetTaskStatus)
 
 	// Spam Filters (all authenticated users)
-	protected.Get("/spam/settings", h.GetSpamSettings)
-	protected.Put("/spam/settings", h.UpdateSpamSettings)
+	protected.Get("/spam/settings", emailFeature, canEmail, h.GetSpamSettings)
+	protected.Put("/spam/settings", emailFeature, canEmail, h.UpdateSpamSettings)
 	protected.Post("/spam/update-clamav", admin, h.UpdateClamAV)
 	protected.Get("/spam/global", admin, h.GetGlobalSpamSettings)
 	protected.Post("/spam/toggle-service", admin, h.ToggleSpamService)
 	// Malware Scanning
-	protected.Post("/malware/scan", h.ScanPath)
-	protected.Post("/malware/quick-scan", h.QuickScan)
-	protected.Post("/malware/quarantine", h.QuarantineFile)
-	protected.Delete("/malware/file", h.DeleteInfectedFile)
-	protected.Get("/malware/quarantine", h.GetQuarantinedFiles)
-	protected.Post("/malware/restore", h.RestoreFromQuarantine)
+	protected.Post("/malware/scan", malwareFeature, accountOwner, h.ScanPath)
+	protected.Post("/malware/quick-scan", malwareFeature, accountOwner, h.QuickScan)
+	protected.Post("/malware/quarantine", malwareFeature, accountOwner, h.QuarantineFile)
+	protected.Delete("/malware/file", malwareFeature, accountOwner, h.DeleteInfectedFile)
+	protected.Get("/malware/quarantine", malwareFeature, accountOwner, h.GetQuarantinedFiles)
+	protected.Post("/malware/restore", malwareFeature, accountOwner, h.RestoreFromQuarantine)
 	// Background Scanning
-	protected.Post("/malware/scan/start", h.StartBackgroundScan)
-	protected.Get("/malware/scan/status/:id", h.GetScanStatus)
-	protected.Post("/malware/scan/cancel/:id", h.CancelScan)
-	protected.Get("/malware/scan/history", h.GetScanHistory)
-	protected.Get("/malware/scan/active", h.GetActiveScan)
+	protected.Post("/malware/scan/start", malwareFeature, accountOwner, h.StartBackgroundScan)
+	protected.Get("/malware/scan/status/:id", malwareFeature, accountOwner, h.GetScanStatus)
+	protected.Post("/malware/scan/cancel/:id", malwareFeature, accountOwner, h.CancelScan)
+	protected.Get("/malware/scan/history", malwareFeature, accountOwner, h.GetScanHistory)
+	protected.Get("/malware/scan/active", malwareFeature, accountOwner, h.GetActiveScan)
 
 	// Cron Jobs (all authenticated users)
-	protected.Get("/cron/jobs", h.ListCronJobs)
-	protected.Get("/cron/jobs/:id", h.GetCronJob)
-	protected.Post("/cron/jobs", h.CreateCronJob)
-	protected.Put("/cron/jobs/:id", h.UpdateCronJob)
-	protected.Delete("/cron/jobs/:id", h.DeleteCronJob)
-	protected.Post("/cron/jobs/:id/toggle", h.ToggleCronJob)
-	protected.Post("/cron/jobs/:id/run", h.RunCronJob)
-	protected.Get("/cron/presets", h.GetCronPresets)
+	protected.Get("/cron/jobs", cronFeature, canCron, h.ListCronJobs)
+	protected.Get("/cron/jobs/:id", cronFeature, canCron, h.GetCronJob)
+	protected.Post("/cron/jobs", cronFeature, canCron, h.CreateCronJob)
+	protected.Put("/cron/jobs/:id", cronFeature, canCron, h.UpdateCronJob)
+	protected.Delete("/cron/jobs/:id", cronFeature, canCron, h.DeleteCronJob)
+	protected.Post("/cron/jobs/:id/toggle", cronFeature, canCron, h.ToggleCronJob)
+	protected.Post("/cron/jobs/:id/run", cronFeature, canCron, h.RunCronJob)
+	protected.Get("/cron/presets", cronFeature, canCron, h.GetCronPresets)
 
 	// System Health (admin only)
 	protected.Get("/system/process-manager", admin, h.GetProcessManager)
@@ -244,6 +386,7 @@ func SetupRoutes(router fiber.Router, db *database.DB) {
 	protected.Post("/security/fail2ban/ban", admin, h.BanIP)
 	protected.Post("/security/fail2ban/unban", admin, h.UnbanIP)
 	protected.Put("/security/fail2ban/jail", admin, h.UpdateJailSettings)
+	protected.Post("/security/fail2ban/jail/serverpanel", admin, h.InstallPanelJail)
 	protected.Get("/security/fail2ban/whitelist", admin, h.GetFail2banWhitelist)
 	protected.Put("/security/fail2ban/whitelist", admin, h.UpdateFail2banWhitelist)
 	// Firewall (UFW)
@@ -395,6 +395,64 @@ func (h *Handler) UpdateFail2banWhitelist(c *fiber.Ctx) error {
 	})
 }
 
+// panelJailFilter matches the failed logins written by writeAuthLog
+const panelJailFilter = `# Server Panel - başarısız panel girişleri
+[Definition]
+failregex = ^\s*serverpanel\[\d+\]: Authentication failure from <HOST> user=
+ignoreregex =
+`
+
+// panelJailConfig returns the serverpanel jail for the panel port and auth log
+func panelJailConfig(port, logPath string) string {
+	return fmt.Sprintf(`[serverpanel]
+enabled = true
+port = %s
+filter = serverpanel
+logpath = %s
+maxretry = 10
+findtime = 600
+bantime = 3600
+`, port, logPath)
+}
+
+// InstallPanelJail installs the serverpanel fail2ban jail, which bans IPs
+// with repeated failed panel logins
+func (h *Handler) InstallPanelJail(c *fiber.Ctx) error {
+	fail2banDir := "/etc/fail2ban"
+	if h.cfg.SimulateMode {
+		fail2banDir = filepath.Join(h.cfg.SimulateBasePath, "fail2ban")
+	}
+
+	logPath := h.authLogFile()
+	os.MkdirAll(filepath.Dir(logPath), 0755)
+	if f, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640); err == nil {
+		f.Close()
+	}
+
+	files := map[string]string{
+		filepath.Join(fail2banDir, "filter.d", "serverpanel.conf"): panelJailFilter,
+		filepath.Join(fail2banDir, "jail.d", "serverpanel.conf"):   panelJailConfig(h.cfg.Port, logPath),
+	}
+	for path, content := range files {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"error":   "Yapılandırma dosyası yazılamadı: " + err.Error(),
+			})
+		}
+	}
+
+	if !h.cfg.SimulateMode {
+		exec.Command("fail2ban-client", "reload").Run()
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "serverpanel jail'i kuruldu",
+	})
+}
+
 // ==================== UFW FIREWALL ====================
 
 // FirewallStatus represents UFW status
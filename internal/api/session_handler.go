@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListSessions returns the active sessions of the current user
+func (h *Handler) ListSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	current, _ := c.Locals("session_id").(string)
+
+	sessions, err := auth.ListSessions(h.db, userID, current)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch sessions",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    sessions,
+	})
+}
+
+// RevokeSession ends one of the current user's sessions
+func (h *Handler) RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	id := c.Params("id")
+
+	if err := auth.RevokeSession(h.db, id, userID, auth.RevokeManual); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	h.logActivity(userID, "session_revoke", fmt.Sprintf("Session %s revoked", shortSessionID(id)), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Session revoked",
+	})
+}
+
+// RevokeAllSessions ends every other session of the current user. Pass
+// ?include_current=true to log out the calling session as well.
+func (h *Handler) RevokeAllSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	except, _ := c.Locals("session_id").(string)
+	if c.Query("include_current") == "true" {
+		except = ""
+	}
+
+	count, err := auth.RevokeUserSessions(h.db, userID, auth.RevokeManual, except)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to revoke sessions",
+		})
+	}
+
+	h.logActivity(userID, "session_revoke_all", fmt.Sprintf("%d sessions revoked", count), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d sessions revoked", count),
+		Data:    fiber.Map{"revoked": count},
+	})
+}
+
+// ListUserSessions returns the active sessions of any user (admin)
+func (h *Handler) ListUserSessions(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+		})
+	}
+
+	current, _ := c.Locals("session_id").(string)
+	sessions, err := auth.ListSessions(h.db, id, current)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch sessions",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    sessions,
+	})
+}
+
+// RevokeUserSessions logs a user out everywhere (admin)
+func (h *Handler) RevokeUserSessions(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+		})
+	}
+
+	count, err := auth.RevokeUserSessions(h.db, id, auth.RevokeManual, "")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to revoke sessions",
+		})
+	}
+
+	userID := c.Locals("user_id").(int64)
+	h.logActivity(userID, "session_revoke_all", fmt.Sprintf("%d sessions of user #%d revoked", count, id), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d sessions revoked", count),
+		Data:    fiber.Map{"revoked": count},
+	})
+}
+
+// shortSessionID keeps activity logs from containing full session IDs
+func shortSessionID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
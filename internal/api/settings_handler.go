@@ -2,27 +2,41 @@ package api
 
 import (
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/bandwidth"
+	"github.com/asergenalkan/serverpanel/internal/services/feature"
+	"github.com/asergenalkan/serverpanel/internal/services/subuser"
 	"github.com/gofiber/fiber/v2"
 )
 
 // ServerSettings represents server configuration
 type ServerSettings struct {
-	MultiPHPEnabled    bool     `json:"multiphp_enabled"`
-	DefaultPHPVersion  string   `json:"default_php_version"`
-	AllowedPHPVersions []string `json:"allowed_php_versions"`
-	DomainBasedPHP     bool     `json:"domain_based_php"`
+	MultiPHPEnabled      bool     `json:"multiphp_enabled"`
+	DefaultPHPVersion    string   `json:"default_php_version"`
+	AllowedPHPVersions   []string `json:"allowed_php_versions"`
+	DomainBasedPHP       bool     `json:"domain_based_php"`
+	TerminationGraceDays int      `json:"termination_grace_days"`  // days before a terminated account is purged
+	BulkWorkers          int      `json:"bulk_workers"`            // parallel rows of a bulk account operation
+	BulkRatePerMinute    int      `json:"bulk_rate_per_minute"`    // bulk rows started per minute
+	BandwidthAction      string   `json:"bandwidth_action"`        // warn, throttle or suspend when over the monthly limit
+	BandwidthThrottle    int      `json:"bandwidth_throttle_kbps"` // rate limit of throttled sites
 }
 
 // GetServerSettings returns server settings (admin only)
 func (h *Handler) GetServerSettings(c *fiber.Ctx) error {
 	settings := ServerSettings{
-		MultiPHPEnabled:    true,
-		DefaultPHPVersion:  "8.1",
-		AllowedPHPVersions: []string{"7.4", "8.0", "8.1", "8.2", "8.3"},
-		DomainBasedPHP:     true,
+		MultiPHPEnabled:      true,
+		DefaultPHPVersion:    "8.1",
+		AllowedPHPVersions:   []string{"7.4", "8.0", "8.1", "8.2", "8.3"},
+		DomainBasedPHP:       true,
+		TerminationGraceDays: 30,
+		BulkWorkers:          2,
+		BulkRatePerMinute:    30,
+		BandwidthAction:      bandwidth.ActionWarn,
+		BandwidthThrottle:    256,
 	}
 
 	// Load from database
@@ -41,6 +55,24 @@ func (h *Handler) GetServerSettings(c *fiber.Ctx) error {
 				settings.AllowedPHPVersions = strings.Split(value, ",")
 			case "domain_based_php":
 				settings.DomainBasedPHP = value == "true"
+			case "termination_grace_days":
+				if days, err := strconv.Atoi(value); err == nil {
+					settings.TerminationGraceDays = days
+				}
+			case "bulk_workers":
+				if n, err := strconv.Atoi(value); err == nil {
+					settings.BulkWorkers = n
+				}
+			case "bulk_rate_per_minute":
+				if n, err := strconv.Atoi(value); err == nil {
+					settings.BulkRatePerMinute = n
+				}
+			case "bandwidth_action":
+				settings.BandwidthAction = value
+			case "bandwidth_throttle_kbps":
+				if n, err := strconv.Atoi(value); err == nil {
+					settings.BandwidthThrottle = n
+				}
 			}
 		}
 	}
@@ -80,6 +112,29 @@ func (h *Handler) UpdateServerSettings(c *fiber.Ctx) error {
 		"allowed_php_versions": strings.Join(req.AllowedPHPVersions, ","),
 		"domain_based_php":     boolToString(req.DomainBasedPHP),
 	}
+	// Left unchanged when not sent
+	if req.TerminationGraceDays > 0 {
+		updates["termination_grace_days"] = strconv.Itoa(req.TerminationGraceDays)
+	}
+	if req.BulkWorkers > 0 {
+		updates["bulk_workers"] = strconv.Itoa(req.BulkWorkers)
+	}
+	if req.BulkRatePerMinute > 0 {
+		updates["bulk_rate_per_minute"] = strconv.Itoa(req.BulkRatePerMinute)
+	}
+	switch req.BandwidthAction {
+	case "":
+	case bandwidth.ActionWarn, bandwidth.ActionThrottle, bandwidth.ActionSuspend:
+		updates["bandwidth_action"] = req.BandwidthAction
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "bandwidth_action must be warn, throttle or suspend",
+		})
+	}
+	if req.BandwidthThrottle > 0 {
+		updates["bandwidth_throttle_kbps"] = strconv.Itoa(req.BandwidthThrottle)
+	}
 
 	for key, value := range updates {
 		_, err := h.db.Exec(`
@@ -137,12 +192,14 @@ func (h *Handler) GetAllowedPHPVersions(c *fiber.Ctx) error {
 }
 
 // GetServerFeatures returns server features for users (read-only view)
+// and the panel features the caller's package allows
 func (h *Handler) GetServerFeatures(c *fiber.Ctx) error {
 	features := map[string]interface{}{
 		"php_versions":        h.getPHPVersions(),
 		"php_extensions":      h.getPHPExtensionsSimple(),
 		"apache_modules":      h.getApacheModulesSimple(),
 		"additional_software": h.getAdditionalSoftwareSimple(),
+		"features":            h.effectiveFeatures(c),
 	}
 
 	return c.JSON(models.APIResponse{
@@ -151,6 +208,25 @@ func (h *Handler) GetServerFeatures(c *fiber.Ctx) error {
 	})
 }
 
+// effectiveFeatures returns the package features the caller can use; a
+// sub-user only keeps those its account owner granted
+func (h *Handler) effectiveFeatures(c *fiber.Ctx) []string {
+	userID, _ := c.Locals("user_id").(int64)
+	features := feature.ForUser(h.db, userID)
+	if c.Locals("subuser_id") == nil {
+		return features
+	}
+
+	perms, _ := c.Locals("subuser_permissions").([]string)
+	granted := []string{}
+	for _, f := range features {
+		if subuser.Has(perms, f) {
+			granted = append(granted, f)
+		}
+	}
+	return granted
+}
+
 // getPHPExtensionsSimple returns simplified PHP extensions list
 func (h *Handler) getPHPExtensionsSimple() []map[string]interface{} {
 	extensions := []map[string]interface{}{}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/sso"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ssoLoginPage is the frontend route the OIDC callback returns to
+const ssoLoginPage = "/login"
+
+// oidcStateCookie ties an OIDC login to the browser that started it
+const (
+	oidcStateCookie     = "sp_oidc_state"
+	oidcStateCookiePath = "/api/v1/auth/oidc"
+)
+
+// SSOSettings is the admin view of the SSO configuration. Secrets are never
+// returned, only whether they are set.
+type SSOSettings struct {
+	LDAP                *sso.LDAPConfig `json:"ldap"`
+	LDAPBindPasswordSet bool            `json:"ldap_bind_password_set"`
+	OIDC                *sso.OIDCConfig `json:"oidc"`
+	OIDCClientSecretSet bool            `json:"oidc_client_secret_set"`
+}
+
+// directoryLogin checks a username and password against the enabled SSO
+// password backends. On success the user is provisioned or synced (role
+// from group mapping) and continues with the normal second factor step.
+func (h *Handler) directoryLogin(c *fiber.Ctx, backends []sso.PasswordBackend, username, password string, userID int64) error {
+	for _, b := range backends {
+		ident, err := b.Authenticate(username, password)
+		if err != nil {
+			if !errors.Is(err, sso.ErrInvalidLogin) {
+				log.Printf("⚠️ %s login for %s: %v", strings.ToUpper(b.Source()), username, err)
+			}
+			continue
+		}
+
+		user, err := h.provisionSSOUser(c, ident, b)
+		if err != nil {
+			return h.loginFailed(c, username, userID, err.Error(), "Invalid credentials")
+		}
+		return h.passwordVerified(c, user, fmt.Sprintf("User logged in via %s", strings.ToUpper(b.Source())))
+	}
+
+	return h.loginFailed(c, username, userID, "invalid password", "Invalid credentials")
+}
+
+// ssoRoleSource is what provisioning needs from a backend
+type ssoRoleSource interface {
+	Role(ident *sso.Identity) (string, error)
+	AutoProvision() bool
+}
+
+// provisionSSOUser maps an identity to a panel role and returns the local
+// user, creating it on first login when auto-provisioning is on
+func (h *Handler) provisionSSOUser(c *fiber.Ctx, ident *sso.Identity, backend ssoRoleSource) (*models.User, error) {
+	role, err := backend.Role(ident)
+	if err != nil {
+		return nil, err
+	}
+
+	id, created, err := sso.Provision(h.db, ident, role, backend.AutoProvision())
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		h.logActivity(id, "sso_provision", fmt.Sprintf("User %s provisioned from %s as %s", ident.Username,
+			strings.ToUpper(ident.Source), role), c.IP())
+	}
+
+	user, err := h.loadLoginUser(id)
+	if err != nil {
+		return nil, errors.New("user is inactive")
+	}
+	return user, nil
+}
+
+// GetSSOProviders tells the login page which SSO methods are enabled
+func (h *Handler) GetSSOProviders(c *fiber.Ctx) error {
+	ldapCfg, _ := sso.LoadLDAPConfig(h.db)
+	oidcCfg, _ := sso.LoadOIDCConfig(h.db)
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"ldap":           ldapCfg != nil && ldapCfg.Enabled,
+			"oidc":           oidcCfg != nil && oidcCfg.Enabled,
+			"oidc_login_url": "/api/v1/auth/oidc/login",
+		},
+	})
+}
+
+// OIDCLogin redirects the browser to the identity provider
+func (h *Handler) OIDCLogin(c *fiber.Ctx) error {
+	provider, err := sso.NewOIDCProvider(h.db)
+	if err != nil {
+		return ssoRedirectError(c, err)
+	}
+
+	authURL, state, err := provider.AuthURL()
+	if err != nil {
+		log.Printf("⚠️ OIDC login: %v", err)
+		return ssoRedirectError(c, err)
+	}
+	// Lax still sends the cookie on the IdP's top-level redirect back
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		MaxAge:   int(sso.OIDCStateTTL.Seconds()),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallback finishes the authorization code flow. The browser goes back
+// to the login page with a single-use code the frontend exchanges for
+// tokens at /auth/sso/exchange.
+func (h *Handler) OIDCCallback(c *fiber.Ctx) error {
+	browserState := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcStateCookiePath,
+		Expires:  time.Unix(0, 0),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		h.logLoginActivity(nil, "login_failed", fmt.Sprintf("OIDC login failed: %s", idpErr), c.IP())
+		return ssoRedirectError(c, errors.New(idpErr))
+	}
+
+	provider, err := sso.NewOIDCProvider(h.db)
+	if err != nil {
+		return ssoRedirectError(c, err)
+	}
+
+	ident, err := provider.Exchange(c.Query("state"), browserState, c.Query("code"))
+	if err != nil {
+		log.Printf("⚠️ OIDC callback: %v", err)
+		h.logLoginActivity(nil, "login_failed", fmt.Sprintf("OIDC login failed: %v", err), c.IP())
+		return ssoRedirectError(c, err)
+	}
+
+	user, err := h.provisionSSOUser(c, ident, provider)
+	if err != nil {
+		h.logLoginActivity(nil, "login_failed", fmt.Sprintf("OIDC login failed for %s: %v", ident.Username, err), c.IP())
+		return ssoRedirectError(c, err)
+	}
+
+	code, err := sso.CreateHandoff(h.db, user.ID)
+	if err != nil {
+		return ssoRedirectError(c, err)
+	}
+	return c.Redirect(ssoLoginPage+"?sso_code="+url.QueryEscape(code), fiber.StatusFound)
+}
+
+// ExchangeSSOCode trades an OIDC handoff code for a session. A second
+// factor required by the panel is still asked after the IdP login.
+func (h *Handler) ExchangeSSOCode(c *fiber.Ctx) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Code is required",
+		})
+	}
+
+	userID, err := sso.RedeemHandoff(h.db, req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid or expired code",
+		})
+	}
+	user, err := h.loadLoginUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid credentials",
+		})
+	}
+
+	return h.passwordVerified(c, user, "User logged in via OIDC")
+}
+
+func ssoRedirectError(c *fiber.Ctx, err error) error {
+	return c.Redirect(ssoLoginPage+"?sso_error="+url.QueryEscape(err.Error()), fiber.StatusFound)
+}
+
+// GetSSOSettings returns the LDAP and OIDC configuration (Admin only)
+func (h *Handler) GetSSOSettings(c *fiber.Ctx) error {
+	ldapCfg, err := sso.LoadLDAPConfig(h.db)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to load SSO settings",
+		})
+	}
+	oidcCfg, err := sso.LoadOIDCConfig(h.db)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to load SSO settings",
+		})
+	}
+
+	settings := SSOSettings{
+		LDAP:                ldapCfg,
+		LDAPBindPasswordSet: ldapCfg.BindPassword != "",
+		OIDC:                oidcCfg,
+		OIDCClientSecretSet: oidcCfg.ClientSecret != "",
+	}
+	ldapCfg.BindPassword = ""
+	oidcCfg.ClientSecret = ""
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    settings,
+	})
+}
+
+// UpdateLDAPSettings stores the LDAP configuration (Admin only). An empty
+// bind_password keeps the stored one.
+func (h *Handler) UpdateLDAPSettings(c *fiber.Ctx) error {
+	var req sso.LDAPConfig
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	if err := sso.SaveLDAPConfig(h.db, &req); err != nil {
+		return ssoSettingsError(c, err)
+	}
+
+	h.logActivity(c.Locals("user_id").(int64), "sso_settings", fmt.Sprintf("LDAP login enabled: %v (%s)", req.Enabled, req.URL), c.IP())
+	return h.GetSSOSettings(c)
+}
+
+// UpdateOIDCSettings stores the OIDC configuration (Admin only). An empty
+// client_secret keeps the stored one.
+func (h *Handler) UpdateOIDCSettings(c *fiber.Ctx) error {
+	var req sso.OIDCConfig
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	if err := sso.SaveOIDCConfig(h.db, &req); err != nil {
+		return ssoSettingsError(c, err)
+	}
+
+	h.logActivity(c.Locals("user_id").(int64), "sso_settings", fmt.Sprintf("OIDC login enabled: %v (%s)", req.Enabled, req.Issuer), c.IP())
+	return h.GetSSOSettings(c)
+}
+
+// TestLDAPLogin checks credentials against the saved LDAP settings and shows
+// the identity and role a login would get, without creating a user or a
+// session (Admin only)
+func (h *Handler) TestLDAPLogin(c *fiber.Ctx) error {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	backend, err := sso.NewLDAPBackend(h.db)
+	if err != nil {
+		return ssoSettingsError(c, err)
+	}
+	ident, err := backend.Authenticate(req.Username, req.Password)
+	if err != nil {
+		return ssoSettingsError(c, err)
+	}
+
+	role, err := backend.Role(ident)
+	result := map[string]interface{}{
+		"dn":       ident.ExternalID,
+		"username": ident.Username,
+		"email":    ident.Email,
+		"groups":   ident.Groups,
+		"role":     role,
+	}
+	if err != nil {
+		result["role_error"] = err.Error()
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+func ssoSettingsError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, sso.ErrInvalidLogin):
+		status = fiber.StatusUnauthorized
+	case errors.Is(err, sso.ErrDisabled), errors.Is(err, sso.ErrMisconfiguration), errors.Is(err, sso.ErrInvalidMapping):
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/subuser"
+	"github.com/gofiber/fiber/v2"
+)
+
+// subUserLogin signs in a sub-user with their name@account login. The
+// session belongs to the account owner and carries the sub-user's identity.
+func (h *Handler) subUserLogin(c *fiber.Ctx, login, password string) error {
+	sub, err := subuser.NewManager(h.db).Authenticate(login, password)
+	if err != nil {
+		return h.loginFailed(c, login, 0, "invalid sub-user login", "Invalid credentials")
+	}
+
+	owner, err := h.loadLoginUser(sub.OwnerID)
+	if err != nil {
+		return h.loginFailed(c, login, 0, "inactive account", "Invalid credentials")
+	}
+
+	// Sub-users have no second factor of their own, so they cannot sign
+	// in where the owner's role must use 2FA
+	if h.twoFactorRequired(owner.Role) {
+		h.logActivity(owner.ID, "subuser_login_denied",
+			fmt.Sprintf("Sub-user %s refused: two-factor authentication is required for %s accounts", sub.Login, owner.Role), c.IP())
+		return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Two-factor authentication is required for this account, sub-user logins are disabled",
+		})
+	}
+
+	tokens, err := auth.CreateSubUserSession(h.db, owner, &auth.SubUser{ID: sub.ID, Name: sub.Name},
+		h.cfg.JWTSecret, c.IP(), c.Get("User-Agent"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to generate token",
+		})
+	}
+
+	auth.ResetLoginFailures(h.db, c.IP(), login)
+	h.logActivity(owner.ID, "subuser_login", fmt.Sprintf("Sub-user %s logged in", sub.Login), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data: models.LoginResponse{
+			Token:        tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+			ExpiresIn:    tokens.ExpiresIn,
+			User:         *owner,
+			SubUser: &models.SubUserIdentity{
+				ID:          sub.ID,
+				Login:       sub.Login,
+				Permissions: sub.Permissions,
+				FileRoot:    sub.FileRoot,
+			},
+		},
+	})
+}
+
+// GetSubUserPermissions lists the permissions a sub-user can be granted
+func (h *Handler) GetSubUserPermissions(c *fiber.Ctx) error {
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    subuser.Permissions,
+	})
+}
+
+// ListSubUsers returns the sub-users of the current account
+func (h *Handler) ListSubUsers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	subUsers, err := subuser.NewManager(h.db).List(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch sub-users",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    subUsers,
+	})
+}
+
+// GetSubUser returns one sub-user of the current account
+func (h *Handler) GetSubUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid sub-user ID",
+		})
+	}
+
+	sub, err := subuser.NewManager(h.db).Get(id, userID)
+	if err != nil {
+		return subUserError(c, err)
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    sub,
+	})
+}
+
+// CreateSubUser adds a sub-user to the current account
+func (h *Handler) CreateSubUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req subuser.Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	sub, err := subuser.NewManager(h.db).Create(userID, req)
+	if err != nil {
+		return subUserError(c, err)
+	}
+
+	h.logActivity(userID, "subuser_create", fmt.Sprintf("Created sub-user %s (%v)", sub.Login, sub.Permissions), c.IP())
+
+	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
+		Success: true,
+		Message: "Sub-user created successfully",
+		Data:    sub,
+	})
+}
+
+// UpdateSubUser changes a sub-user's details, permissions or file root.
+// A new password or disabling the sub-user ends their sessions.
+func (h *Handler) UpdateSubUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid sub-user ID",
+		})
+	}
+
+	var req subuser.Request
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	sub, endSessions, err := subuser.NewManager(h.db).Update(id, userID, req)
+	if err != nil {
+		return subUserError(c, err)
+	}
+
+	if endSessions {
+		reason := auth.RevokePasswordChange
+		if !sub.Active {
+			reason = auth.RevokeDeactivated
+		}
+		auth.RevokeSubUserSessions(h.db, sub.ID, reason)
+	}
+
+	h.logActivity(userID, "subuser_update", fmt.Sprintf("Updated sub-user %s (%v)", sub.Login, sub.Permissions), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Sub-user updated successfully",
+		Data:    sub,
+	})
+}
+
+// DeleteSubUser removes a sub-user and their sessions
+func (h *Handler) DeleteSubUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid sub-user ID",
+		})
+	}
+
+	m := subuser.NewManager(h.db)
+	sub, err := m.Get(id, userID)
+	if err != nil {
+		return subUserError(c, err)
+	}
+	if err := m.Delete(id, userID); err != nil {
+		return subUserError(c, err)
+	}
+
+	h.logActivity(userID, "subuser_delete", fmt.Sprintf("Deleted sub-user %s", sub.Login), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Sub-user deleted successfully",
+	})
+}
+
+// subUserError maps sub-user errors to responses
+func subUserError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, subuser.ErrNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, subuser.ErrExists):
+		status = fiber.StatusConflict
+	case errors.Is(err, subuser.ErrInvalidName), errors.Is(err, subuser.ErrInvalidPermission),
+		errors.Is(err, subuser.ErrInvalidFileRoot), errors.Is(err, subuser.ErrWeakPassword):
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(models.APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
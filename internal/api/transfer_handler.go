@@ -0,0 +1,507 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/backup"
+	"github.com/asergenalkan/serverpanel/internal/services/transfer"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListTransferTokens returns the tokens other panels can use to send
+// accounts to this panel (Admin only)
+func (h *Handler) ListTransferTokens(c *fiber.Ctx) error {
+	tokens, err := transfer.NewManager(h.db).ListTokens()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to fetch transfer tokens",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    tokens,
+	})
+}
+
+// CreateTransferToken creates a token; the secret is returned only once
+func (h *Handler) CreateTransferToken(c *fiber.Ctx) error {
+	var req struct {
+		Name           string `json:"name"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Token name is required",
+		})
+	}
+
+	userID := c.Locals("user_id").(int64)
+	secret, token, err := transfer.NewManager(h.db).CreateToken(strings.TrimSpace(req.Name), time.Duration(req.ExpiresInHours)*time.Hour, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to create transfer token",
+		})
+	}
+
+	h.logActivity(userID, "transfer_token_create", fmt.Sprintf("Transfer token %s created", token.Name), c.IP())
+
+	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
+		Success: true,
+		Data: fiber.Map{
+			"token":  secret,
+			"detail": token,
+		},
+	})
+}
+
+// DeleteTransferToken revokes a token
+func (h *Handler) DeleteTransferToken(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid token ID",
+		})
+	}
+
+	if err := transfer.NewManager(h.db).DeleteToken(id); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, transfer.ErrTokenNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	h.logActivity(c.Locals("user_id").(int64), "transfer_token_delete", fmt.Sprintf("Transfer token #%d revoked", id), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Transfer token revoked",
+	})
+}
+
+// TransferAccount packages an account and sends it to another panel as a
+// background task. The source account keeps serving until DNS is switched.
+func (h *Handler) TransferAccount(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid account ID",
+		})
+	}
+
+	var req struct {
+		TargetURL  string `json:"target_url"`
+		Token      string `json:"token"`
+		Insecure   bool   `json:"insecure"`    // skip TLS verification of the target
+		RewriteDNS bool   `json:"rewrite_dns"` // point the source zones at the target
+		TargetIP   string `json:"target_ip"`   // defaults to the IP reported by the target
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	client, err := transfer.NewClient(req.TargetURL, req.Token, req.Insecure)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	var username, role string
+	if err := h.db.QueryRow("SELECT username, role FROM users WHERE id = ?", id).Scan(&username, &role); err != nil || role != models.RoleUser {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Account not found",
+		})
+	}
+
+	var domains []string
+	rows, err := h.db.Query("SELECT name FROM domains WHERE user_id = ?", id)
+	if err == nil {
+		for rows.Next() {
+			var name string
+			rows.Scan(&name)
+			domains = append(domains, name)
+		}
+		rows.Close()
+	}
+
+	ip := c.IP()
+	adminID := c.Locals("user_id").(int64)
+	taskID := fmt.Sprintf("transfer-%d-%d", id, time.Now().UnixNano())
+	taskName := fmt.Sprintf("%s hesabı transfer ediliyor", username)
+	taskManager.createTask(taskID, "transfer", taskName)
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+		fail := func(err error) {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+		}
+
+		taskManager.addLog(taskID, "🔍 Hedef panel kontrol ediliyor...")
+		check, err := client.Check(transfer.CheckRequest{Username: username, Domains: domains})
+		if err != nil {
+			fail(err)
+			return
+		}
+		if len(check.Conflicts) > 0 {
+			fail(fmt.Errorf("hedefte çakışma: %s", strings.Join(check.Conflicts, ", ")))
+			return
+		}
+		taskManager.addLog(taskID, fmt.Sprintf("✅ Hedef: %s (%s)", check.Hostname, check.ServerIP))
+
+		record, err := backup.NewManager(h.db).CreateAccountBackup(id, backup.Options{
+			Progress: func(msg string) { taskManager.addLog(taskID, msg) },
+		})
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		lastPercent := int64(-1)
+		received, err := client.Send(record.FilePath, h.cfg.ServerIP, func(sent, total int64) {
+			if total == 0 {
+				return
+			}
+			if percent := sent * 100 / total; percent/10 != lastPercent/10 {
+				lastPercent = percent
+				taskManager.addLog(taskID, fmt.Sprintf("⬆️ Gönderiliyor: %%%d (%.1f / %.1f MB)", percent, float64(sent)/1048576, float64(total)/1048576))
+			}
+		})
+		if err != nil {
+			fail(err)
+			return
+		}
+		taskManager.addLog(taskID, "✅ Arşiv hedefe aktarıldı, geri yükleme başladı")
+
+		if err := h.followRemoteTask(taskID, client, received.TaskID); err != nil {
+			fail(err)
+			return
+		}
+
+		if req.RewriteDNS {
+			targetIP := req.TargetIP
+			if targetIP == "" {
+				targetIP = received.ServerIP
+			}
+			count := h.rewriteAccountARecords(id, h.cfg.ServerIP, targetIP)
+			taskManager.addLog(taskID, fmt.Sprintf("🌐 %d DNS kaydı %s adresine yönlendirildi", count, targetIP))
+		}
+
+		h.logActivity(adminID, "account_transfer", fmt.Sprintf("Account %s transferred to %s", username, req.TargetURL), ip)
+		taskManager.addLog(taskID, "✅ Transfer tamamlandı")
+		taskManager.completeTask(taskID, true)
+	}()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"task_id": taskID,
+		"message": "Transfer başlatıldı",
+	})
+}
+
+// followRemoteTask relays the logs of the restore task on the target into
+// the local task until it finishes
+func (h *Handler) followRemoteTask(taskID string, client *transfer.Client, remoteID string) error {
+	seen, failures := 0, 0
+	for {
+		time.Sleep(2 * time.Second)
+
+		task, err := client.Status(remoteID)
+		if err != nil {
+			// The target may be briefly unreachable while it reloads services
+			failures++
+			if failures >= 15 {
+				return err
+			}
+			continue
+		}
+		failures = 0
+
+		for ; seen < len(task.Logs); seen++ {
+			taskManager.addLog(taskID, "🎯 "+task.Logs[seen])
+		}
+		switch task.Status {
+		case "completed":
+			return nil
+		case "failed":
+			return errors.New("hedef panelde geri yükleme başarısız")
+		}
+	}
+}
+
+// rewriteAccountARecords points the A records of an account that hold fromIP
+// at toIP and rebuilds the affected zone files
+func (h *Handler) rewriteAccountARecords(userID int64, fromIP, toIP string) int {
+	if fromIP == "" || toIP == "" || fromIP == toIP {
+		return 0
+	}
+
+	rows, err := h.db.Query("SELECT id, name FROM domains WHERE user_id = ?", userID)
+	if err != nil {
+		return 0
+	}
+	type domainRow struct {
+		id   int64
+		name string
+	}
+	var domains []domainRow
+	for rows.Next() {
+		var d domainRow
+		rows.Scan(&d.id, &d.name)
+		domains = append(domains, d)
+	}
+	rows.Close()
+
+	count := 0
+	for _, d := range domains {
+		result, err := h.db.Exec("UPDATE dns_records SET content = ? WHERE domain_id = ? AND type = 'A' AND content = ?", toIP, d.id, fromIP)
+		if err != nil {
+			continue
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			count += int(n)
+			h.updateZoneFile(d.name)
+		}
+	}
+	return count
+}
+
+// TransferTokenAuth authenticates panel-to-panel requests by transfer token
+func (h *Handler) TransferTokenAuth(c *fiber.Ctx) error {
+	token, err := transfer.NewManager(h.db).ValidateToken(c.Get(transfer.TokenHeader))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	c.Locals("transfer_token", token)
+	return c.Next()
+}
+
+// CheckTransfer reports whether an account can be received by this panel
+func (h *Handler) CheckTransfer(c *fiber.Ctx) error {
+	var req transfer.CheckRequest
+	if err := c.BodyParser(&req); err != nil || req.Username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Username is required",
+		})
+	}
+
+	hostname, _ := os.Hostname()
+	resp := transfer.CheckResponse{
+		Hostname:  hostname,
+		ServerIP:  h.cfg.ServerIP,
+		Conflicts: h.transferConflicts(req.Username, req.Domains),
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    resp,
+	})
+}
+
+// transferConflicts lists existing rows a received account would clash with
+func (h *Handler) transferConflicts(username string, domains []string) []string {
+	conflicts := []string{}
+	var count int
+	if h.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&count); count > 0 {
+		conflicts = append(conflicts, fmt.Sprintf("username %s already exists", username))
+	}
+	for _, domain := range domains {
+		if h.db.QueryRow("SELECT COUNT(*) FROM domains WHERE name = ?", domain).Scan(&count); count > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("domain %s already exists", domain))
+		}
+	}
+	return conflicts
+}
+
+// ReceiveTransfer stores an account archive streamed by a source panel and
+// restores it as a background task
+func (h *Handler) ReceiveTransfer(c *fiber.Ctx) error {
+	name := filepath.Base(c.Query("name"))
+	if !strings.HasSuffix(name, ".tar.gz") {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Archive name must end with .tar.gz",
+		})
+	}
+	checksum := strings.ToLower(c.Get(transfer.ChecksumHeader))
+	if checksum == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Archive checksum is required",
+		})
+	}
+
+	mgr := backup.NewManager(h.db)
+	uploadDir := filepath.Join(mgr.BackupDir(), "uploads")
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to create upload directory",
+		})
+	}
+	filePath := filepath.Join(uploadDir, fmt.Sprintf("%d-%s", time.Now().Unix(), name))
+
+	// Large archives arrive as a stream instead of a buffered body
+	var body io.Reader = bytes.NewReader(c.Body())
+	if c.Request().IsBodyStream() {
+		body = c.Context().RequestBodyStream()
+	}
+
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to save archive",
+		})
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to save archive",
+		})
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != checksum {
+		os.Remove(filePath)
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   backup.ErrChecksumMismatch.Error(),
+		})
+	}
+
+	// The account and every domain in the archive must be new here, so the
+	// restore cannot take over rows of a local account
+	manifest, data, err := backup.ReadMetadata(filePath)
+	if err != nil {
+		os.Remove(filePath)
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	// Anyone holding a token can send an archive, so hostile names and
+	// paths refuse it as a whole instead of being skipped during restore
+	if problems := mgr.CheckMetadata(manifest, data); len(problems) > 0 {
+		os.Remove(filePath)
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid archive metadata: " + strings.Join(problems, ", "),
+		})
+	}
+	domains := make([]string, 0, len(data.Domains))
+	for _, d := range data.Domains {
+		domains = append(domains, d.Name)
+	}
+	if conflicts := h.transferConflicts(manifest.Username, domains); len(conflicts) > 0 {
+		os.Remove(filePath)
+		return c.Status(fiber.StatusConflict).JSON(models.APIResponse{
+			Success: false,
+			Error:   strings.Join(conflicts, ", "),
+		})
+	}
+
+	record, err := mgr.ImportArchive(filePath)
+	if err != nil {
+		os.Remove(filePath)
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	token := c.Locals("transfer_token").(*transfer.Token)
+	sourceIP := c.Query("source_ip")
+	ip := c.IP()
+	taskID := fmt.Sprintf("transfer-receive-%d-%d", record.ID, time.Now().UnixNano())
+	taskName := fmt.Sprintf("%s hesabı transfer ile alınıyor", record.Username)
+	taskManager.createTask(taskID, "transfer", taskName)
+
+	go func() {
+		taskManager.addLog(taskID, fmt.Sprintf("🚀 %s...", taskName))
+
+		result, err := h.restoreArchive(taskID, record.FilePath, backup.Options{})
+		if err != nil {
+			taskManager.addLog(taskID, fmt.Sprintf("❌ Hata: %s", err.Error()))
+			taskManager.completeTask(taskID, false)
+			return
+		}
+
+		// Restored zones still point at the source server
+		if count := h.rewriteAccountARecords(result.UserID, sourceIP, h.cfg.ServerIP); count > 0 {
+			taskManager.addLog(taskID, fmt.Sprintf("🌐 %d DNS kaydı bu sunucuya (%s) yönlendirildi", count, h.cfg.ServerIP))
+		}
+
+		h.logActivity(token.CreatedBy, "transfer_receive", fmt.Sprintf("Account %s received from %s with token %s", result.Username, ip, token.Name), ip)
+		taskManager.addLog(taskID, "✅ Hesap transferi tamamlandı")
+		taskManager.completeTask(taskID, true)
+	}()
+
+	return c.Status(fiber.StatusCreated).JSON(models.APIResponse{
+		Success: true,
+		Data: transfer.ReceiveResponse{
+			TaskID:   taskID,
+			BackupID: record.ID,
+			ServerIP: h.cfg.ServerIP,
+		},
+	})
+}
+
+// GetTransferStatus returns a receive task to the source panel
+func (h *Handler) GetTransferStatus(c *fiber.Ctx) error {
+	taskID := c.Params("task_id")
+	task := taskManager.getTask(taskID)
+	if task == nil || !strings.HasPrefix(taskID, "transfer-receive-") {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Task not found",
+		})
+	}
+
+	taskManager.mu.RLock()
+	resp := transfer.RemoteTask{
+		ID:     task.ID,
+		Status: task.Status,
+		Logs:   append([]string(nil), task.Logs...),
+	}
+	taskManager.mu.RUnlock()
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    resp,
+	})
+}
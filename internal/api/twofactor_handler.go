@@ -0,0 +1,566 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// totpIssuer is the account label shown in authenticator apps
+const totpIssuer = "ServerPanel"
+
+var errTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+// TwoFactorStatus describes the 2FA state of the current user
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSettings holds the roles that must use 2FA
+type TwoFactorSettings struct {
+	RequiredRoles []string `json:"required_roles"`
+}
+
+// twoFactorStep returns the pre-auth purpose of the next login step, or ""
+// when the password alone completes the login
+func (h *Handler) twoFactorStep(userID int64, role string) string {
+	var enabled bool
+	h.db.QueryRow("SELECT COALESCE(totp_enabled, 0) FROM users WHERE id = ?", userID).Scan(&enabled)
+	if enabled {
+		return auth.PurposeTwoFactor
+	}
+	if h.twoFactorRequired(role) {
+		return auth.PurposeTwoFactorSetup
+	}
+	return ""
+}
+
+// requiredTwoFactorRoles reads the require_2fa_roles server setting
+func (h *Handler) requiredTwoFactorRoles() []string {
+	var value string
+	h.db.QueryRow("SELECT value FROM server_settings WHERE key = 'require_2fa_roles'").Scan(&value)
+
+	roles := []string{}
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func (h *Handler) twoFactorRequired(role string) bool {
+	for _, r := range h.requiredTwoFactorRoles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// loadLoginUser loads an active user for the second login step
+func (h *Handler) loadLoginUser(userID int64) (*models.User, error) {
+	var user models.User
+	err := h.db.QueryRow(`
+		SELECT id, username, email, role, parent_id, active, created_at, updated_at
+		FROM users WHERE id = ? AND active = 1
+	`, userID).Scan(
+		&user.ID, &user.Username, &user.Email,
+		&user.Role, &user.ParentID, &user.Active, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// verifyTOTP checks a code against the enrolled (or pending) secret and
+// remembers the time step so the same code cannot be used twice
+func (h *Handler) verifyTOTP(userID int64, code string) bool {
+	var encrypted sql.NullString
+	var lastStep int64
+	h.db.QueryRow("SELECT totp_secret, COALESCE(totp_last_step, 0) FROM users WHERE id = ?", userID).Scan(&encrypted, &lastStep)
+	if !encrypted.Valid || encrypted.String == "" {
+		return false
+	}
+
+	secret, err := auth.DecryptSecret(encrypted.String)
+	if err != nil {
+		return false
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, lastStep, time.Now())
+	if !ok {
+		return false
+	}
+	// The step only moves forward, so of two requests with the same code
+	// only the first one updates the row
+	result, err := h.db.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND COALESCE(totp_last_step, -1) < ?", step, userID, step)
+	if err != nil {
+		return false
+	}
+	n, _ := result.RowsAffected()
+	return n > 0
+}
+
+// useRecoveryCode consumes a matching unused recovery code
+func (h *Handler) useRecoveryCode(userID int64, code string) bool {
+	code = auth.NormalizeRecoveryCode(code)
+	if code == "" {
+		return false
+	}
+
+	rows, err := h.db.Query("SELECT id, code_hash FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		return false
+	}
+	var matched int64
+	for rows.Next() {
+		var id int64
+		var hash string
+		rows.Scan(&id, &hash)
+		if matched == 0 && auth.CheckPassword(code, hash) {
+			matched = id
+		}
+	}
+	rows.Close()
+
+	if matched == 0 {
+		return false
+	}
+	result, err := h.db.Exec("UPDATE user_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", matched)
+	if err != nil {
+		return false
+	}
+	n, _ := result.RowsAffected()
+	return n > 0
+}
+
+// startTOTPSetup stores a new pending secret; 2FA stays off until a code
+// generated from it is confirmed
+func (h *Handler) startTOTPSetup(userID int64, username string) (fiber.Map, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := auth.EncryptSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.db.Exec("UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND COALESCE(totp_enabled, 0) = 0", encrypted, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, errTwoFactorEnabled
+	}
+
+	return fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, username, secret),
+	}, nil
+}
+
+// enableTOTP confirms the pending secret and returns fresh recovery codes
+func (h *Handler) enableTOTP(userID int64, code string) ([]string, error) {
+	var enabled bool
+	h.db.QueryRow("SELECT COALESCE(totp_enabled, 0) FROM users WHERE id = ?", userID).Scan(&enabled)
+	if enabled {
+		return nil, errTwoFactorEnabled
+	}
+	if !h.verifyTOTP(userID, code) {
+		return nil, fmt.Errorf("invalid verification code")
+	}
+
+	codes, err := h.replaceRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	h.db.Exec("UPDATE users SET totp_enabled = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?", userID)
+	return codes, nil
+}
+
+// replaceRecoveryCodes drops every recovery code of a user and stores new ones
+func (h *Handler) replaceRecoveryCodes(userID int64) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		hash, err := auth.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+// clearTwoFactor turns 2FA off and removes the secret and recovery codes
+func (h *Handler) clearTwoFactor(userID int64) {
+	h.db.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?", userID)
+	h.db.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID)
+}
+
+// LoginTwoFactor completes a login with a TOTP or recovery code
+func (h *Handler) LoginTwoFactor(c *fiber.Ctx) error {
+	var req struct {
+		PreAuthToken string `json:"pre_auth_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	claims, err := auth.ValidatePreAuthToken(req.PreAuthToken, auth.PurposeTwoFactor, h.cfg.JWTSecret)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid or expired pre-auth token",
+		})
+	}
+
+	if lockout := auth.LoginLockout(h.db, c.IP(), claims.Username); lockout > 0 {
+		return tooManyLoginAttempts(c, lockout)
+	}
+
+	user, err := h.loadLoginUser(claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid credentials",
+		})
+	}
+
+	switch {
+	case req.Code != "" && h.verifyTOTP(user.ID, req.Code):
+		return h.completeLogin(c, user, "User logged in (2FA)", nil)
+	case req.RecoveryCode != "" && h.useRecoveryCode(user.ID, req.RecoveryCode):
+		return h.completeLogin(c, user, "User logged in with a recovery code", nil)
+	}
+
+	return h.loginFailed(c, user.Username, user.ID, "invalid two-factor code", "Invalid two-factor code")
+}
+
+// LoginTwoFactorSetup starts enrollment for a user whose role requires 2FA
+func (h *Handler) LoginTwoFactorSetup(c *fiber.Ctx) error {
+	var req struct {
+		PreAuthToken string `json:"pre_auth_token"`
+	}
+	c.BodyParser(&req)
+
+	claims, err := auth.ValidatePreAuthToken(req.PreAuthToken, auth.PurposeTwoFactorSetup, h.cfg.JWTSecret)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid or expired pre-auth token",
+		})
+	}
+
+	setup, err := h.startTOTPSetup(claims.UserID, claims.Username)
+	if errors.Is(err, errTwoFactorEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Two-factor authentication is already enabled",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to start 2FA setup",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    setup,
+	})
+}
+
+// LoginTwoFactorEnable confirms enrollment and completes the login
+func (h *Handler) LoginTwoFactorEnable(c *fiber.Ctx) error {
+	var req struct {
+		PreAuthToken string `json:"pre_auth_token"`
+		Code         string `json:"code"`
+	}
+	c.BodyParser(&req)
+
+	claims, err := auth.ValidatePreAuthToken(req.PreAuthToken, auth.PurposeTwoFactorSetup, h.cfg.JWTSecret)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid or expired pre-auth token",
+		})
+	}
+
+	user, err := h.loadLoginUser(claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid credentials",
+		})
+	}
+
+	codes, err := h.enableTOTP(user.ID, req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	h.logActivity(user.ID, "2fa_enable", "Two-factor authentication enabled", c.IP())
+	return h.completeLogin(c, user, "User logged in (2FA enrolled)", codes)
+}
+
+// GetTwoFactorStatus returns the 2FA state of the current user
+func (h *Handler) GetTwoFactorStatus(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	role := c.Locals("role").(string)
+
+	var status TwoFactorStatus
+	h.db.QueryRow("SELECT COALESCE(totp_enabled, 0) FROM users WHERE id = ?", userID).Scan(&status.Enabled)
+	h.db.QueryRow("SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&status.RecoveryCodesRemaining)
+	status.Required = h.twoFactorRequired(role)
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// SetupTwoFactor returns a new secret and otpauth URI for the current user
+func (h *Handler) SetupTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	username := c.Locals("username").(string)
+
+	setup, err := h.startTOTPSetup(userID, username)
+	if errors.Is(err, errTwoFactorEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Two-factor authentication is already enabled",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to start 2FA setup",
+		})
+	}
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    setup,
+	})
+}
+
+// EnableTwoFactor confirms the pending secret with a code
+func (h *Handler) EnableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	c.BodyParser(&req)
+
+	codes, err := h.enableTOTP(userID, req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	h.logActivity(userID, "2fa_enable", "Two-factor authentication enabled", c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    fiber.Map{"recovery_codes": codes},
+	})
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a code
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+	role := c.Locals("role").(string)
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	c.BodyParser(&req)
+
+	if h.twoFactorRequired(role) {
+		return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Two-factor authentication is required for your role",
+		})
+	}
+
+	var hash string
+	h.db.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&hash)
+	if !auth.CheckPassword(req.Password, hash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid password",
+		})
+	}
+	if !h.verifyTOTP(userID, req.Code) && !h.useRecoveryCode(userID, req.Code) {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid two-factor code",
+		})
+	}
+
+	h.clearTwoFactor(userID)
+	h.logActivity(userID, "2fa_disable", "Two-factor authentication disabled", c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func (h *Handler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(int64)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	c.BodyParser(&req)
+
+	var enabled bool
+	h.db.QueryRow("SELECT COALESCE(totp_enabled, 0) FROM users WHERE id = ?", userID).Scan(&enabled)
+	if !enabled {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Two-factor authentication is not enabled",
+		})
+	}
+	if !h.verifyTOTP(userID, req.Code) {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid two-factor code",
+		})
+	}
+
+	codes, err := h.replaceRecoveryCodes(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to generate recovery codes",
+		})
+	}
+
+	h.logActivity(userID, "2fa_recovery_codes", "Recovery codes regenerated", c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    fiber.Map{"recovery_codes": codes},
+	})
+}
+
+// ResetUserTwoFactor removes the 2FA enrollment of a user (Admin only). If
+// the role requires 2FA the user enrolls again at the next login.
+func (h *Handler) ResetUserTwoFactor(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+		})
+	}
+
+	var username string
+	if err := h.db.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.APIResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+	}
+
+	h.clearTwoFactor(id)
+	h.logActivity(c.Locals("user_id").(int64), "2fa_reset", fmt.Sprintf("Two-factor authentication reset for %s", username), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication reset",
+	})
+}
+
+// GetTwoFactorSettings returns the roles that must use 2FA (Admin only)
+func (h *Handler) GetTwoFactorSettings(c *fiber.Ctx) error {
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    TwoFactorSettings{RequiredRoles: h.requiredTwoFactorRoles()},
+	})
+}
+
+// UpdateTwoFactorSettings sets the roles that must use 2FA (Admin only)
+func (h *Handler) UpdateTwoFactorSettings(c *fiber.Ctx) error {
+	var req TwoFactorSettings
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	roles := []string{}
+	for _, role := range req.RequiredRoles {
+		switch role {
+		case models.RoleAdmin, models.RoleReseller, models.RoleUser:
+			roles = append(roles, role)
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(models.APIResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Unknown role: %s", role),
+			})
+		}
+	}
+
+	_, err := h.db.Exec(`
+		INSERT INTO server_settings (key, value, updated_at)
+		VALUES ('require_2fa_roles', ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, strings.Join(roles, ","))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Failed to save settings",
+		})
+	}
+
+	h.logActivity(c.Locals("user_id").(int64), "2fa_settings", fmt.Sprintf("2FA required for roles: %s", strings.Join(roles, ", ")), c.IP())
+
+	return c.JSON(models.APIResponse{
+		Success: true,
+		Data:    TwoFactorSettings{RequiredRoles: roles},
+	})
+}
@@ -196,6 +196,18 @@ func (h *Handler) UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// A new password or deactivation ends the user's existing sessions; an
+	// admin changing their own password keeps the current one
+	if req.Password != "" {
+		except := ""
+		if id == c.Locals("user_id").(int64) {
+			except, _ = c.Locals("session_id").(string)
+		}
+		auth.RevokeUserSessions(h.db, id, auth.RevokePasswordChange, except)
+	} else if req.Active != nil && !*req.Active {
+		auth.RevokeUserSessions(h.db, id, auth.RevokeDeactivated, "")
+	}
+
 	return c.JSON(models.APIResponse{
 		Success: true,
 		Message: "User updated successfully",
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/asergenalkan/serverpanel/internal/auth"
 	"github.com/asergenalkan/serverpanel/internal/config"
 	"github.com/asergenalkan/serverpanel/internal/database"
 	"github.com/gofiber/contrib/websocket"
@@ -62,7 +63,12 @@ func (h *Handler) validateToken(tokenString string) (jwt.MapClaims, error) {
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+	// Pre-auth tokens (2FA step) carry a purpose and are not sessions
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["purpose"] == nil {
+		jti, _ := claims["jti"].(string)
+		if err := auth.ValidateSession(h.db, jti); err != nil {
+			return nil, err
+		}
 		return claims, nil
 	}
 	return nil, fmt.Errorf("invalid token")
@@ -603,7 +609,22 @@ port = ftp,ftp-data,ftps,ftps-data
 filter = pure-ftpd
 logpath = /var/log/syslog
 maxretry = 5
+
+[serverpanel]
+enabled = true
+port = 8443
+filter = serverpanel
+logpath = /var/log/serverpanel/auth.log
+maxretry = 10
 JAILEOF
+# Panel girişleri için filtre
+mkdir -p /var/log/serverpanel
+touch /var/log/serverpanel/auth.log
+cat > /etc/fail2ban/filter.d/serverpanel.conf << 'FILTEREOF'
+[Definition]
+failregex = ^\s*serverpanel\[\d+\]: Authentication failure from <HOST> user=
+ignoreregex =
+FILTEREOF
 
 systemctl enable fail2ban && systemctl restart fail2ban
 `
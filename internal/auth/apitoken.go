@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix marks personal API tokens so they can be told apart from
+// JWTs in the Authorization header
+const APITokenPrefix = "spt_"
+
+// ScopeAll grants every permission of the token owner's role
+const ScopeAll = "*"
+
+var (
+	ErrAPITokenNotFound = errors.New("api token not found")
+	ErrInvalidScope     = errors.New("invalid scope")
+	ErrInvalidAllowedIP = errors.New("invalid allowed IP")
+)
+
+// DB interface for database operations
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// scopeResources maps the first segment of an API path to the resource name
+// used in scopes ("dns:write", "email:read")
+var scopeResources = map[string]string{
+	"accounts":       "accounts",
+	"backups":        "backups",
+	"cron":           "cron",
+	"dashboard":      "dashboard",
+	"databases":      "databases",
+	"database-users": "databases",
+	"dns":            "dns",
+	"domains":        "domains",
+	"subdomains":     "domains",
+	"email":          "email",
+	"mail-queue":     "email",
+	"spam":           "email",
+	"files":          "files",
+	"ftp":            "ftp",
+	"packages":       "packages",
+	"php":            "php",
+	"ssl":            "ssl",
+	"users":          "users",
+	"resellers":      "users",
+	"subusers":       "users",
+	"reseller":       "accounts",
+	"transfers":      "transfers",
+	"tasks":          "tasks",
+	"security":       "security",
+	"malware":        "security",
+	"server":         "server",
+	"system":         "server",
+	"software":       "server",
+	"settings":       "server",
+}
+
+var scopePattern = regexp.MustCompile(`^([a-z]+):(read|write)$`)
+
+// APIToken is a long-lived personal token. Only the SHA-256 of the secret
+// is stored; Prefix identifies the token in listings.
+type APIToken struct {
+	ID         int64    `json:"id"`
+	UserID     int64    `json:"user_id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	AllowedIPs []string `json:"allowed_ips"`
+	ExpiresAt  *string  `json:"expires_at,omitempty"`
+	LastUsedAt *string  `json:"last_used_at,omitempty"`
+	LastUsedIP *string  `json:"last_used_ip,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// APITokenClaims is the identity behind a validated API token
+type APITokenClaims struct {
+	TokenID  int64
+	UserID   int64
+	Username string
+	Role     string
+	Scopes   []string
+}
+
+// IsAPIToken reports whether a bearer value is a personal API token
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// ValidateScopes checks scope names against the known resources
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	known := map[string]bool{}
+	for _, resource := range scopeResources {
+		known[resource] = true
+	}
+	for _, scope := range scopes {
+		if scope == ScopeAll {
+			continue
+		}
+		m := scopePattern.FindStringSubmatch(scope)
+		if m == nil || !known[m[1]] {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+// ValidateAllowedIPs checks that every entry is an IP address or CIDR
+func ValidateAllowedIPs(ips []string) error {
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidAllowedIP, ip)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateAPIToken stores a new token and returns its secret, which is shown
+// only once. expiresAt may be nil for a token that does not expire.
+func CreateAPIToken(db DB, userID int64, name string, scopes, allowedIPs []string, expiresAt *time.Time) (string, *APIToken, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+	if err := ValidateAllowedIPs(allowedIPs); err != nil {
+		return "", nil, err
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := APITokenPrefix + hex.EncodeToString(b)
+
+	var expires sql.NullString
+	if expiresAt != nil {
+		expires = sql.NullString{String: expiresAt.UTC().Format("2006-01-02 15:04:05"), Valid: true}
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, allowed_ips, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, userID, name, secret[:len(APITokenPrefix)+6], hashAPIToken(secret),
+		strings.Join(scopes, ","), strings.Join(allowedIPs, ","), expires)
+	if err != nil {
+		return "", nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	token, err := GetAPIToken(db, id)
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, token, nil
+}
+
+const apiTokenColumns = "id, user_id, name, token_prefix, scopes, allowed_ips, expires_at, last_used_at, last_used_ip, created_at"
+
+func scanAPIToken(scanner interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	var scopes, allowedIPs string
+	err := scanner.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &allowedIPs,
+		&t.ExpiresAt, &t.LastUsedAt, &t.LastUsedIP, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = splitList(scopes)
+	t.AllowedIPs = splitList(allowedIPs)
+	return &t, nil
+}
+
+func GetAPIToken(db DB, id int64) (*APIToken, error) {
+	t, err := scanAPIToken(db.QueryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITokenNotFound
+	}
+	return t, err
+}
+
+// ListAPITokens returns the tokens of a user, or every token when userID is 0
+func ListAPITokens(db DB, userID int64) ([]APIToken, error) {
+	query := "SELECT " + apiTokenColumns + " FROM api_tokens"
+	var args []interface{}
+	if userID > 0 {
+		query += " WHERE user_id = ?"
+		args = append(args, userID)
+	}
+	rows, err := db.Query(query+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes a token. userID limits the delete to the owner's
+// tokens; 0 revokes any token.
+func RevokeAPIToken(db DB, id, userID int64) error {
+	query := "DELETE FROM api_tokens WHERE id = ?"
+	args := []interface{}{id}
+	if userID > 0 {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// ValidateAPIToken checks the secret, expiry, IP allowlist and owner, and
+// records the use
+func ValidateAPIToken(db DB, secret, ip string) (*APITokenClaims, error) {
+	var claims APITokenClaims
+	var scopes, allowedIPs string
+	var expiresAt sql.NullString
+	err := db.QueryRow(`
+		SELECT t.id, t.scopes, t.allowed_ips, t.expires_at, u.id, u.username, u.role
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND u.active = 1
+	`, hashAPIToken(secret)).Scan(&claims.TokenID, &scopes, &allowedIPs, &expiresAt,
+		&claims.UserID, &claims.Username, &claims.Role)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if expiresAt.Valid && expiresAt.String != "" {
+		expires, err := time.Parse("2006-01-02 15:04:05", strings.Replace(strings.TrimSuffix(expiresAt.String, "Z"), "T", " ", 1))
+		if err != nil || time.Now().UTC().After(expires) {
+			return nil, ErrTokenExpired
+		}
+	}
+
+	if allowed := splitList(allowedIPs); len(allowed) > 0 && !ipAllowed(ip, allowed) {
+		return nil, ErrInvalidToken
+	}
+
+	db.Exec("UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = ? WHERE id = ?", ip, claims.TokenID)
+
+	claims.Scopes = splitList(scopes)
+	return &claims, nil
+}
+
+// HasScope reports whether scopes allow a request. path is relative to the
+// API root (e.g. /dns/zones/1). GET and HEAD need read, everything else
+// write; write includes read.
+func HasScope(scopes []string, method, path string) bool {
+	segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	resource, ok := scopeResources[segment]
+	if !ok {
+		return false
+	}
+
+	for _, scope := range scopes {
+		if scope == ScopeAll || scope == resource+":write" {
+			return true
+		}
+		if scope == resource+":read" && (method == "GET" || method == "HEAD") {
+			return true
+		}
+	}
+	return false
+}
+
+func ipAllowed(ip string, allowed []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -15,10 +15,34 @@ var (
 	ErrInvalidToken       = errors.New("invalid token")
 )
 
+// Pre-auth token purposes. A pre-auth token only completes the login, it is
+// never accepted as a session token.
+const (
+	PurposeTwoFactor      = "2fa"       // password verified, TOTP code pending
+	PurposeTwoFactorSetup = "2fa-setup" // 2FA is required but not enrolled yet
+)
+
+// preAuthTTL is the lifetime of a pre-auth token
+const preAuthTTL = 5 * time.Minute
+
+// AccessTokenTTL is the lifetime of a session JWT; clients renew it with
+// their refresh token
+const AccessTokenTTL = 15 * time.Minute
+
 type Claims struct {
 	UserID   int64  `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	Purpose  string `json:"purpose,omitempty"`
+
+	// Set on impersonation tokens: the admin or reseller acting as the user
+	ActorID       int64  `json:"act_id,omitempty"`
+	ActorUsername string `json:"act_username,omitempty"`
+
+	// Set on sub-user tokens; the user fields name the account owner
+	SubUserID   int64  `json:"sub_id,omitempty"`
+	SubUserName string `json:"sub_name,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
@@ -34,18 +58,34 @@ func CheckPassword(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateToken creates a new JWT token for a user
-func GenerateToken(user *models.User, secret string) (string, error) {
+// GenerateToken creates a short-lived access token for a user. sessionID
+// becomes the token's jti; use CreateSession to issue a tracked session.
+func GenerateToken(user *models.User, sessionID, secret string) (string, error) {
+	return signSessionToken(user, nil, nil, sessionID, secret, AccessTokenTTL)
+}
+
+// signSessionToken signs a session JWT; actor is set for impersonation and
+// sub for a sub-user of the account
+func signSessionToken(user, actor *models.User, sub *SubUser, sessionID, secret string, ttl time.Duration) (string, error) {
 	claims := &Claims{
 		UserID:   user.ID,
 		Username: user.Username,
 		Role:     user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "serverpanel",
 		},
 	}
+	if actor != nil {
+		claims.ActorID = actor.ID
+		claims.ActorUsername = actor.Username
+	}
+	if sub != nil {
+		claims.SubUserID = sub.ID
+		claims.SubUserName = sub.Name
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secret))
@@ -61,7 +101,41 @@ func ValidateToken(tokenString, secret string) (*Claims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.Purpose == "" {
+		return claims, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// GeneratePreAuthToken creates a short-lived token for the second login step
+func GeneratePreAuthToken(user *models.User, purpose, secret string) (string, error) {
+	claims := &Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Purpose:  purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(preAuthTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "serverpanel",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ValidatePreAuthToken validates a pre-auth token issued for purpose
+func ValidatePreAuthToken(tokenString, purpose, secret string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.Purpose == purpose {
 		return claims, nil
 	}
 
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"strings"
+	"time"
+)
+
+// Failed login limits. Failures are counted per client IP, per username
+// from that IP and per username alone. The username|IP counter locks one
+// attacker out quickly without touching the owner's own address; the plain
+// username counter has a higher limit and catches guessing spread over
+// many addresses. Reaching a limit locks the key out, and every further
+// lockout doubles the lockout time.
+const (
+	loginMaxFailuresIP         = 10
+	loginMaxFailuresUsernameIP = 5
+	loginMaxFailuresUsername   = 30
+	loginFailureWindow         = 15 * time.Minute
+	loginBaseLockout           = time.Minute
+	loginMaxLockout            = 24 * time.Hour
+	// loginLockoutMemory is how long a key must stay quiet before its
+	// lockout count starts over
+	loginLockoutMemory = 24 * time.Hour
+)
+
+const (
+	attemptScopeIP         = "ip"
+	attemptScopeUsernameIP = "username_ip"
+	attemptScopeUsername   = "username"
+)
+
+// LoginFailure is the outcome of a counted failed login
+type LoginFailure struct {
+	// Lockout is the longest lockout the failure triggered, or 0
+	Lockout time.Duration
+	// UsernameLocked is set when the per-username counter locked the
+	// account for every address
+	UsernameLocked bool
+}
+
+// LoginLockout returns how long logins from ip, or for username, are still
+// locked; 0 means the attempt may proceed
+func LoginLockout(db DB, ip, username string) time.Duration {
+	now := time.Now().Unix()
+	var lockedUntil int64
+	db.QueryRow(`
+		SELECT COALESCE(MAX(locked_until), 0) FROM login_attempts
+		WHERE (scope = ? AND key = ?) OR (scope = ? AND key = ?) OR (scope = ? AND key = ?)
+	`, attemptScopeIP, ip, attemptScopeUsernameIP, usernameIPKey(ip, username),
+		attemptScopeUsername, normalizeLoginName(username)).Scan(&lockedUntil)
+
+	if lockedUntil <= now {
+		return 0
+	}
+	return time.Duration(lockedUntil-now) * time.Second
+}
+
+// RecordLoginFailure counts a failed login for ip and username and returns
+// the lockout it triggered
+func RecordLoginFailure(db DB, ip, username string) LoginFailure {
+	var f LoginFailure
+	f.Lockout = recordAttemptFailure(db, attemptScopeIP, ip, loginMaxFailuresIP)
+	if l := recordAttemptFailure(db, attemptScopeUsernameIP, usernameIPKey(ip, username), loginMaxFailuresUsernameIP); l > f.Lockout {
+		f.Lockout = l
+	}
+	if l := recordAttemptFailure(db, attemptScopeUsername, normalizeLoginName(username), loginMaxFailuresUsername); l > 0 {
+		f.UsernameLocked = true
+		if l > f.Lockout {
+			f.Lockout = l
+		}
+	}
+	return f
+}
+
+// ResetLoginFailures clears the username counter of ip after a successful
+// login and the failures, but not the lockout history, of the username.
+// The IP counter is left to expire so one valid account cannot be used to
+// keep guessing others from the same address.
+func ResetLoginFailures(db DB, ip, username string) {
+	db.Exec("DELETE FROM login_attempts WHERE scope = ? AND key = ?", attemptScopeUsernameIP, usernameIPKey(ip, username))
+	db.Exec("UPDATE login_attempts SET failures = 0 WHERE scope = ? AND key = ?", attemptScopeUsername, normalizeLoginName(username))
+}
+
+func recordAttemptFailure(db DB, scope, key string, maxFailures int) time.Duration {
+	if key == "" {
+		return 0
+	}
+	now := time.Now()
+
+	var failures, lockouts int
+	var lastFailure int64
+	db.QueryRow("SELECT failures, lockouts, last_failure_at FROM login_attempts WHERE scope = ? AND key = ?",
+		scope, key).Scan(&failures, &lockouts, &lastFailure)
+
+	last := time.Unix(lastFailure, 0)
+	if now.Sub(last) > loginFailureWindow {
+		failures = 0
+	}
+	if now.Sub(last) > loginLockoutMemory {
+		lockouts = 0
+	}
+	failures++
+
+	var lockout time.Duration
+	var lockedUntil int64
+	if failures >= maxFailures {
+		lockout = loginBaseLockout << uint(lockouts)
+		if lockout > loginMaxLockout || lockout <= 0 {
+			lockout = loginMaxLockout
+		}
+		lockedUntil = now.Add(lockout).Unix()
+		lockouts++
+		failures = 0
+	}
+
+	db.Exec(`
+		INSERT INTO login_attempts (scope, key, failures, lockouts, last_failure_at, locked_until)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(scope, key) DO UPDATE SET failures = excluded.failures, lockouts = excluded.lockouts,
+			last_failure_at = excluded.last_failure_at,
+			locked_until = MAX(login_attempts.locked_until, excluded.locked_until)
+	`, scope, key, failures, lockouts, now.Unix(), lockedUntil)
+
+	return lockout
+}
+
+func normalizeLoginName(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// usernameIPKey is the counter key of a username at one client IP
+func usernameIPKey(ip, username string) string {
+	name := normalizeLoginName(username)
+	if name == "" {
+		return ""
+	}
+	return name + "|" + ip
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+)
+
+// ErrRefreshTokenReused means an already rotated refresh token was presented
+// again. The token may have been stolen, so the whole session is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// TokenPair is what a login or refresh hands to the client
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // access token lifetime in seconds
+}
+
+// RefreshSession rotates a refresh token: the presented token is marked
+// used and a new access/refresh pair is issued for the same session. The
+// returned user is set whenever the token was recognised, also on reuse.
+func RefreshSession(db DB, refreshToken, secret, ip, userAgent string) (*TokenPair, *models.User, error) {
+	var tokenID int64
+	var usedAt, revokedAt sql.NullString
+	var sessionID string
+	var expired, subUserActive bool
+	var user models.User
+	var sub SubUser
+	err := db.QueryRow(`
+		SELECT r.id, r.used_at, s.id, s.revoked_at, s.expires_at <= datetime('now'),
+			u.id, u.username, u.email, u.role, u.parent_id, u.active, u.created_at, u.updated_at,
+			COALESCE(su.id, 0), COALESCE(su.name, ''), COALESCE(su.active, 1)
+		FROM refresh_tokens r
+		JOIN sessions s ON s.id = r.session_id
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN sub_users su ON su.id = s.subuser_id
+		WHERE r.token_hash = ?
+	`, hashAPIToken(refreshToken)).Scan(&tokenID, &usedAt, &sessionID, &revokedAt, &expired,
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.ParentID, &user.Active,
+		&user.CreatedAt, &user.UpdatedAt, &sub.ID, &sub.Name, &subUserActive)
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	if usedAt.Valid {
+		RevokeSession(db, sessionID, 0, RevokeRefreshReuse)
+		return nil, &user, ErrRefreshTokenReused
+	}
+	if revokedAt.Valid || expired || !user.Active || !subUserActive {
+		return nil, &user, ErrInvalidToken
+	}
+
+	// Two requests racing with the same token: only one may rotate it
+	result, err := db.Exec("UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", tokenID)
+	if err != nil {
+		return nil, &user, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		RevokeSession(db, sessionID, 0, RevokeRefreshReuse)
+		return nil, &user, ErrRefreshTokenReused
+	}
+
+	db.Exec(`
+		UPDATE sessions SET expires_at = ?, last_seen_at = CURRENT_TIMESTAMP, ip_address = ?, user_agent = ?
+		WHERE id = ?
+	`, sessionExpiry(), ip, userAgent, sessionID)
+
+	var subUser *SubUser
+	if sub.ID > 0 {
+		subUser = &sub
+	}
+	pair, err := issueTokens(db, &user, subUser, sessionID, secret)
+	if err != nil {
+		return nil, &user, err
+	}
+	return pair, &user, nil
+}
+
+// issueTokens signs an access token and stores a new refresh token for a
+// session. Only the SHA-256 of the refresh token is kept.
+func issueTokens(db DB, user *models.User, sub *SubUser, sessionID, secret string) (*TokenPair, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	refreshToken := hex.EncodeToString(b)
+
+	if _, err := db.Exec("INSERT INTO refresh_tokens (session_id, token_hash) VALUES (?, ?)",
+		sessionID, hashAPIToken(refreshToken)); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := signSessionToken(user, nil, sub, sessionID, secret, AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenTTL.Seconds()),
+	}, nil
+}
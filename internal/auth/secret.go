@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+)
+
+const secretKeyFile = "secret.key"
+
+var ErrInvalidSecret = errors.New("invalid encrypted secret")
+
+var secretKey struct {
+	sync.Mutex
+	key []byte
+}
+
+// loadSecretKey returns the AES-256 key used for credentials stored in the
+// panel DB. It lives next to panel.db and is created on first use.
+func loadSecretKey() ([]byte, error) {
+	secretKey.Lock()
+	defer secretKey.Unlock()
+
+	if secretKey.key != nil {
+		return secretKey.key, nil
+	}
+
+	path := filepath.Join(config.Get().DataDir, secretKeyFile)
+	key, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, key, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("secret key must be 32 bytes: " + path)
+	}
+
+	secretKey.key = key
+	return key, nil
+}
+
+// EncryptSecret encrypts a value with AES-GCM and returns it base64 encoded
+func EncryptSecret(plaintext string) (string, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret
+func DecryptSecret(encoded string) (string, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrInvalidSecret
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+	return string(plaintext), nil
+}
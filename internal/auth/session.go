@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/models"
+)
+
+// SessionTTL is how long a session survives without a refresh; every
+// refresh extends it
+const SessionTTL = 7 * 24 * time.Hour
+
+// ImpersonationTTL is the fixed lifetime of an impersonation session. It has
+// no refresh token.
+const ImpersonationTTL = time.Hour
+
+// Revocation reasons stored with a session
+const (
+	RevokeLogout         = "logout"
+	RevokeManual         = "revoked"
+	RevokePasswordChange = "password_change"
+	RevokeSuspended      = "suspended"
+	RevokeDeactivated    = "deactivated"
+	RevokeRefreshReuse   = "refresh_reuse"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written (SQLite
+// datetime modifier)
+const sessionTouchInterval = "-60 seconds"
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a logged-in panel session, keyed by the JWT ID (jti)
+type Session struct {
+	ID         string `json:"id"`
+	UserID     int64  `json:"user_id"`
+	IPAddress  string `json:"ip_address"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	ExpiresAt  string `json:"expires_at"`
+	ActorID    int64  `json:"actor_id,omitempty"`   // impersonating admin or reseller
+	SubUserID  int64  `json:"subuser_id,omitempty"` // sub-user of the account
+	Current    bool   `json:"current"`
+}
+
+// CreateSession records a new session and returns its first access and
+// refresh tokens
+func CreateSession(db DB, user *models.User, secret, ip, userAgent string) (*TokenPair, error) {
+	id, err := insertSession(db, user.ID, 0, 0, ip, userAgent, SessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	return issueTokens(db, user, nil, id, secret)
+}
+
+// SubUser identifies the sub-user a session belongs to
+type SubUser struct {
+	ID   int64
+	Name string
+}
+
+// CreateSubUserSession records a session for a sub-user of owner's account.
+// Its tokens name the owner, so handlers scope to the account, plus the
+// sub-user whose permissions apply.
+func CreateSubUserSession(db DB, owner *models.User, sub *SubUser, secret, ip, userAgent string) (*TokenPair, error) {
+	id, err := insertSession(db, owner.ID, 0, sub.ID, ip, userAgent, SessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	return issueTokens(db, owner, sub, id, secret)
+}
+
+// CreateImpersonationSession records a session in which actor acts as user
+// and returns its access token. The token carries both identities.
+func CreateImpersonationSession(db DB, user, actor *models.User, secret, ip, userAgent string) (string, error) {
+	id, err := insertSession(db, user.ID, actor.ID, 0, ip, userAgent, ImpersonationTTL)
+	if err != nil {
+		return "", err
+	}
+	return signSessionToken(user, actor, nil, id, secret, ImpersonationTTL)
+}
+
+func insertSession(db DB, userID, actorID, subUserID int64, ip, userAgent string, ttl time.Duration) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	// Expired sessions are kept for a week so recent logins stay visible
+	db.Exec("DELETE FROM sessions WHERE expires_at < datetime('now', '-7 days')")
+
+	var actor, subUser interface{}
+	if actorID > 0 {
+		actor = actorID
+	}
+	if subUserID > 0 {
+		subUser = subUserID
+	}
+	_, err := db.Exec(`
+		INSERT INTO sessions (id, user_id, actor_id, subuser_id, ip_address, user_agent, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, userID, actor, subUser, ip, userAgent, time.Now().Add(ttl).UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func sessionExpiry() string {
+	return time.Now().Add(SessionTTL).UTC().Format("2006-01-02 15:04:05")
+}
+
+// ValidateSession checks that a session exists, is not revoked or expired,
+// and records the activity
+func ValidateSession(db DB, id string) error {
+	if id == "" {
+		return ErrInvalidToken
+	}
+
+	var exists int
+	err := db.QueryRow(`
+		SELECT 1 FROM sessions
+		WHERE id = ? AND revoked_at IS NULL AND expires_at > datetime('now')
+	`, id).Scan(&exists)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	db.Exec("UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP WHERE id = ? AND last_seen_at < datetime('now', ?)",
+		id, sessionTouchInterval)
+	return nil
+}
+
+// ListSessions returns the active sessions of a user, most recent first.
+// currentID marks the caller's own session.
+func ListSessions(db DB, userID int64, currentID string) ([]Session, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at, last_seen_at, expires_at,
+			COALESCE(actor_id, 0), COALESCE(subuser_id, 0)
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > datetime('now')
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt,
+			&s.ActorID, &s.SubUserID); err != nil {
+			continue
+		}
+		s.Current = s.ID == currentID
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one session. userID limits the revoke to the owner's
+// sessions; 0 revokes any session.
+func RevokeSession(db DB, id string, userID int64, reason string) error {
+	query := "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = ? WHERE id = ? AND revoked_at IS NULL"
+	args := []interface{}{reason, id}
+	if userID > 0 {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions ends every session of a user except exceptID (which
+// may be empty) and returns how many were revoked
+func RevokeUserSessions(db DB, userID int64, reason, exceptID string) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = ?
+		WHERE user_id = ? AND id != ? AND revoked_at IS NULL
+	`, reason, userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RevokeSubUserSessions ends every session of a sub-user
+func RevokeSubUserSessions(db DB, subUserID int64, reason string) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = ?
+		WHERE subuser_id = ? AND revoked_at IS NULL
+	`, reason, subUserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
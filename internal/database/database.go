@@ -343,6 +343,20 @@ func (db *DB) migrate() error {
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
 
+		// Account backups - user_id hesap silinse bile yedek kaydı korunur
+		`CREATE TABLE IF NOT EXISTS backups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			username TEXT NOT NULL,
+			type TEXT DEFAULT 'full',
+			file_path TEXT NOT NULL,
+			size INTEGER DEFAULT 0,
+			status TEXT DEFAULT 'pending',
+			error_message TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+		)`,
+
 		// Create indexes
 		`CREATE INDEX IF NOT EXISTS idx_cron_jobs_user_id ON cron_jobs(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_dns_records_domain_id ON dns_records(domain_id)`,
@@ -359,6 +373,7 @@ func (db *DB) migrate() error {
 		`CREATE INDEX IF NOT EXISTS idx_mail_queue_scheduled_at ON mail_queue(scheduled_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_malware_scans_user_id ON malware_scans(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_malware_scans_status ON malware_scans(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_backups_username ON backups(username)`,
 	}
 
 	for _, migration := range migrations {
@@ -381,6 +396,19 @@ func (db *DB) migrate() error {
 	// Add mail rate limit columns to packages
 	db.Exec(`ALTER TABLE packages ADD COLUMN max_emails_per_hour INTEGER DEFAULT 100`)
 	db.Exec(`ALTER TABLE packages ADD COLUMN max_emails_per_day INTEGER DEFAULT 500`)
+	// Alan adı bazlı gönderim limitleri (paket limitinin altında tutulur)
+	db.Exec(`ALTER TABLE email_settings ADD COLUMN hourly_limit INTEGER DEFAULT 100`)
+	db.Exec(`ALTER TABLE email_settings ADD COLUMN daily_limit INTEGER DEFAULT 500`)
+
+	// Inode (dosya sayısı) limiti - 0 sınırsız
+	db.Exec(`ALTER TABLE packages ADD COLUMN max_inodes INTEGER DEFAULT 0`)
+
+	// Paketin içerdiği modüller (virgülle ayrılmış); mevcut paketlerde hepsi açık
+	db.Exec(`ALTER TABLE packages ADD COLUMN features TEXT DEFAULT 'files,email,ftp,dns,ssl,cron,ssh,malware'`)
+
+	// Incremental backup chains and scheduled backups
+	db.Exec(`ALTER TABLE backups ADD COLUMN parent_id INTEGER`)
+	db.Exec(`ALTER TABLE backups ADD COLUMN schedule_id INTEGER`)
 
 	// Create server_settings table for admin configuration
 	db.Exec(`CREATE TABLE IF NOT EXISTS server_settings (
@@ -397,6 +425,319 @@ func (db *DB) migrate() error {
 		('domain_based_php', 'true')
 	`)
 
+	// Backup schedules - Zamanlanmış yedekleme (günlük/haftalık/aylık)
+	db.Exec(`CREATE TABLE IF NOT EXISTS backup_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		frequency TEXT NOT NULL DEFAULT 'daily',
+		hour INTEGER DEFAULT 3,
+		minute INTEGER DEFAULT 0,
+		weekday INTEGER DEFAULT 0,
+		month_day INTEGER DEFAULT 1,
+		mode TEXT DEFAULT 'full',
+		full_every INTEGER DEFAULT 7,
+		retention INTEGER DEFAULT 7,
+		user_ids TEXT DEFAULT '',
+		skip_home INTEGER DEFAULT 0,
+		skip_databases INTEGER DEFAULT 0,
+		skip_mail INTEGER DEFAULT 0,
+		active INTEGER DEFAULT 1,
+		last_run DATETIME,
+		next_run DATETIME,
+		last_status TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	db.Exec(`ALTER TABLE backup_schedules ADD COLUMN destination_id INTEGER`)
+
+	// Backup destinations - Uzak yedek hedefleri (local, s3, sftp)
+	// credentials kolonu AES-GCM ile şifreli tutulur
+	db.Exec(`CREATE TABLE IF NOT EXISTS backup_destinations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		type TEXT NOT NULL,
+		config TEXT NOT NULL DEFAULT '{}',
+		credentials TEXT,
+		active INTEGER DEFAULT 1,
+		last_test_at DATETIME,
+		last_test_status TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	// Two-factor authentication (TOTP) - secret AES-GCM ile şifreli tutulur
+	db.Exec(`ALTER TABLE users ADD COLUMN totp_secret TEXT`)
+	db.Exec(`ALTER TABLE users ADD COLUMN totp_enabled INTEGER DEFAULT 0`)
+	db.Exec(`ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0`)
+
+	// Recovery codes - Tek kullanımlık, bcrypt hash olarak saklanır
+	db.Exec(`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	db.Exec(`INSERT OR IGNORE INTO server_settings (key, value) VALUES ('require_2fa_roles', '')`)
+
+	// API tokens - Otomasyon için uzun ömürlü, kapsamlı (scope) token'lar
+	// Token'ın kendisi değil SHA-256 özeti saklanır
+	db.Exec(`CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		token_prefix TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '',
+		allowed_ips TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		last_used_ip TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	// Sessions - Sunucu tarafı oturum takibi (JWT jti ile)
+	// Çıkış, şifre değişikliği veya askıya alma oturumu iptal eder
+	db.Exec(`CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		ip_address TEXT,
+		user_agent TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		revoked_reason TEXT,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)")
+	// Impersonation - "Kullanıcı olarak giriş" oturumlarında işlemi yapan admin/reseller
+	db.Exec(`ALTER TABLE sessions ADD COLUMN actor_id INTEGER REFERENCES users(id) ON DELETE CASCADE`)
+
+	// Refresh tokens - Her yenilemede döndürülür (rotation); kullanılmış bir
+	// token tekrar gelirse oturumun tamamı iptal edilir
+	db.Exec(`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+	)`)
+
+	// Login attempts - Brute-force koruması (IP, IP+kullanıcı adı ve kullanıcı adı bazlı)
+	// Zamanlar unix timestamp olarak saklanır
+	db.Exec(`CREATE TABLE IF NOT EXISTS login_attempts (
+		scope TEXT NOT NULL,
+		key TEXT NOT NULL,
+		failures INTEGER NOT NULL DEFAULT 0,
+		lockouts INTEGER NOT NULL DEFAULT 0,
+		last_failure_at INTEGER NOT NULL DEFAULT 0,
+		locked_until INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (scope, key)
+	)`)
+
+	// Transfer tokens - Sunucular arası hesap transferi
+	// Token'ın kendisi değil SHA-256 özeti saklanır
+	db.Exec(`CREATE TABLE IF NOT EXISTS transfer_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_by INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL,
+		last_used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	// Reseller - Kendi paketlerini tanımlayan bayiler
+	// owner_id NULL ise paket admin'e aittir
+	db.Exec(`ALTER TABLE packages ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL`)
+
+	// Reseller pools - Admin'in bayiye verdiği kaynak havuzu (0 = sınırsız)
+	db.Exec(`CREATE TABLE IF NOT EXISTS reseller_pools (
+		user_id INTEGER PRIMARY KEY,
+		max_accounts INTEGER NOT NULL DEFAULT 0,
+		disk_quota INTEGER NOT NULL DEFAULT 0,
+		max_domains INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	// Sub-users - Hosting hesabı altında yetkileri sınırlı kullanıcılar
+	// Giriş adı "isim@hesap"; permissions virgülle ayrılmış liste,
+	// file_root ev dizinine göre göreli (boş = tüm ev dizini)
+	db.Exec(`CREATE TABLE IF NOT EXISTS sub_users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		password TEXT NOT NULL,
+		permissions TEXT NOT NULL DEFAULT '',
+		file_root TEXT NOT NULL DEFAULT '',
+		active INTEGER NOT NULL DEFAULT 1,
+		last_login_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (owner_id, name),
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	db.Exec(`ALTER TABLE sessions ADD COLUMN subuser_id INTEGER REFERENCES sub_users(id) ON DELETE CASCADE`)
+
+	// SSO - LDAP / OIDC ile giriş yapan kullanıcılar (auth_source: local, ldap, oidc)
+	// external_id: LDAP DN veya OIDC "issuer|sub"
+	db.Exec(`ALTER TABLE users ADD COLUMN auth_source TEXT NOT NULL DEFAULT 'local'`)
+	db.Exec(`ALTER TABLE users ADD COLUMN external_id TEXT`)
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_users_external ON users(auth_source, external_id)")
+
+	// OIDC login state - state, nonce ve PKCE verifier (tek kullanımlık, 10 dk)
+	db.Exec(`CREATE TABLE IF NOT EXISTS oidc_states (
+		state TEXT PRIMARY KEY,
+		nonce TEXT NOT NULL,
+		verifier TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	// SSO handoff - OIDC callback'ten panele dönüşte token yerine verilen
+	// tek kullanımlık kod (1 dk); kodun SHA-256 özeti saklanır
+	db.Exec(`CREATE TABLE IF NOT EXISTS sso_handoffs (
+		code_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	// Askıya alınan hesaplar - sebep ve askıya almadan önceki durum (JSON:
+	// vhost'lar, FPM pool'ları, shell, Dovecot/FTP satırları, crontab);
+	// askı kaldırılınca birebir geri yüklenir
+	db.Exec(`CREATE TABLE IF NOT EXISTS account_suspensions (
+		user_id INTEGER PRIMARY KEY,
+		reason TEXT,
+		suspended_by INTEGER,
+		state TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	// Hesap oluşturma/silme günlüğü - her adım (useradd, vhost, FPM, DNS...)
+	// kaydedilir; başarısız işler geri alınabilir veya kaldığı adımdan devam
+	// ettirilebilir. user_id silinen hesaplarda da kalsın diye FK yok.
+	db.Exec(`CREATE TABLE IF NOT EXISTS provisioning_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		user_id INTEGER,
+		username TEXT NOT NULL,
+		params TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	db.Exec(`CREATE INDEX IF NOT EXISTS idx_provisioning_jobs_status ON provisioning_jobs(status)`)
+
+	db.Exec(`CREATE TABLE IF NOT EXISTS provisioning_steps (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id INTEGER NOT NULL,
+		seq INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		optional INTEGER DEFAULT 0,
+		status TEXT NOT NULL,
+		error TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(job_id, name),
+		FOREIGN KEY (job_id) REFERENCES provisioning_jobs(id) ON DELETE CASCADE
+	)`)
+
+	// Kapatılan hesaplar - servisler askıda, home dizini ve MySQL dökümleri
+	// arşivde bekler; purge_after geçince kalıcı olarak silinir, o zamana
+	// kadar geri yüklenebilir
+	db.Exec(`CREATE TABLE IF NOT EXISTS account_terminations (
+		user_id INTEGER PRIMARY KEY,
+		archive_path TEXT NOT NULL,
+		was_suspended INTEGER DEFAULT 0,
+		terminated_by INTEGER,
+		purge_after DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	db.Exec(`INSERT OR IGNORE INTO server_settings (key, value) VALUES ('termination_grace_days', '30')`)
+
+	// Toplu hesap işlemleri - satır bazında sonuçlar; kuyruk bulk_workers
+	// işçiyle ve dakikada en fazla bulk_rate_per_minute satırla çalışır
+	db.Exec(`CREATE TABLE IF NOT EXISTS bulk_operations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		actor_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		total INTEGER DEFAULT 0,
+		succeeded INTEGER DEFAULT 0,
+		failed INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	db.Exec(`CREATE TABLE IF NOT EXISTS bulk_operation_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		operation_id INTEGER NOT NULL,
+		row INTEGER NOT NULL,
+		account_id INTEGER,
+		username TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(operation_id, row),
+		FOREIGN KEY (operation_id) REFERENCES bulk_operations(id) ON DELETE CASCADE
+	)`)
+
+	db.Exec(`INSERT OR IGNORE INTO server_settings (key, value) VALUES ('bulk_workers', '2')`)
+	db.Exec(`INSERT OR IGNORE INTO server_settings (key, value) VALUES ('bulk_rate_per_minute', '30')`)
+
+	// Bant genişliği - web, FTP ve mail loglarından hesap ve gün bazında
+	// toplanır; loglar kaldıkları yerden (offset) okunur
+	db.Exec(`CREATE TABLE IF NOT EXISTS bandwidth_usage (
+		user_id INTEGER NOT NULL,
+		day TEXT NOT NULL,
+		source TEXT NOT NULL,
+		bytes INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (user_id, day, source),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	db.Exec(`CREATE TABLE IF NOT EXISTS bandwidth_log_offsets (
+		path TEXT PRIMARY KEY,
+		inode TEXT NOT NULL,
+		offset INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	// Aylık limiti aşan hesaplar ve uygulanan işlem (warn, throttle, suspend)
+	db.Exec(`CREATE TABLE IF NOT EXISTS bandwidth_overages (
+		user_id INTEGER PRIMARY KEY,
+		month TEXT NOT NULL,
+		action TEXT NOT NULL,
+		used_mb INTEGER NOT NULL,
+		limit_mb INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
+	db.Exec(`INSERT OR IGNORE INTO server_settings (key, value) VALUES ('bandwidth_action', 'warn')`)
+	db.Exec(`INSERT OR IGNORE INTO server_settings (key, value) VALUES ('bandwidth_throttle_kbps', '256')`)
+
+	// Hesapların son inode sayımı; level limite yaklaşan (warning) ve
+	// limitte olan (exceeded) hesapları işaretler
+	db.Exec(`CREATE TABLE IF NOT EXISTS account_inodes (
+		user_id INTEGER PRIMARY KEY,
+		used INTEGER NOT NULL DEFAULT 0,
+		max_inodes INTEGER NOT NULL DEFAULT 0,
+		level TEXT NOT NULL DEFAULT '',
+		checked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+
 	// Create default admin user if not exists
 	if err := db.createDefaultAdmin(); err != nil {
 		log.Printf("Warning: Could not create default admin: %v", err)
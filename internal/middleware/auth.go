@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/asergenalkan/serverpanel/internal/auth"
@@ -8,8 +9,10 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware(secret string) fiber.Handler {
+// AuthMiddleware validates JWT tokens against their server-side session and
+// personal API tokens. API tokens
+// are limited to their scopes and cannot manage credentials.
+func AuthMiddleware(secret string, db auth.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -29,7 +32,15 @@ func AuthMiddleware(secret string) fiber.Handler {
 		}
 
 		tokenString := parts[1]
+		if auth.IsAPIToken(tokenString) {
+			return apiTokenAuth(c, tokenString, db)
+		}
+
 		claims, err := auth.ValidateToken(tokenString, secret)
+		if err == nil {
+			// Logged out, revoked or expired sessions are refused
+			err = auth.ValidateSession(db, claims.ID)
+		}
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
 				Success: false,
@@ -41,11 +52,111 @@ func AuthMiddleware(secret string) fiber.Handler {
 		c.Locals("user_id", claims.UserID)
 		c.Locals("username", claims.Username)
 		c.Locals("role", claims.Role)
+		c.Locals("session_id", claims.ID)
+
+		if claims.SubUserID > 0 {
+			return subUserAuth(c, claims, db)
+		}
+		if claims.ActorID > 0 {
+			return impersonation(c, claims, db)
+		}
+
+		return c.Next()
+	}
+}
 
+// impersonationBlocked lists API paths (relative to /api/v1) an admin or
+// reseller acting as a user may not use: the user's own credentials stay
+// the user's
+var impersonationBlocked = []string{
+	"/auth/password",
+	"/auth/2fa",
+	"/auth/tokens",
+	"/auth/sessions",
+}
+
+// DenyImpersonation keeps admins and resellers acting as a user out of the
+// user's credentials (password, 2FA, API tokens, sessions) and out of
+// nested impersonation
+func DenyImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("actor_id") != nil {
+			return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Not allowed while impersonating a user",
+			})
+		}
 		return c.Next()
 	}
 }
 
+// impersonation handles requests made with an impersonation token. Every
+// request that changes something is recorded in activity_logs under the
+// real actor.
+func impersonation(c *fiber.Ctx, claims *auth.Claims, db auth.DB) error {
+	c.Locals("actor_id", claims.ActorID)
+	c.Locals("actor_username", claims.ActorUsername)
+
+	// Routes match case-insensitively, so must the blocklist
+	path := strings.TrimPrefix(strings.ToLower(c.Path()), "/api/v1")
+	blocked := strings.HasSuffix(path, "/impersonate") // no nested impersonation
+	for _, prefix := range impersonationBlocked {
+		if strings.HasPrefix(path, prefix) {
+			blocked = true
+		}
+	}
+	var err error
+	if blocked {
+		err = c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Not allowed while impersonating a user",
+		})
+	} else {
+		err = c.Next()
+	}
+
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+	default:
+		db.Exec(`
+			INSERT INTO activity_logs (user_id, action, details, ip_address)
+			VALUES (?, ?, ?, ?)
+		`, claims.ActorID, "impersonation_action", fmt.Sprintf("%s as %s: %s %s (%d)",
+			claims.ActorUsername, claims.Username, c.Method(), c.Path(), c.Response().StatusCode()), c.IP())
+	}
+
+	return err
+}
+
+func apiTokenAuth(c *fiber.Ctx, tokenString string, db auth.DB) error {
+	claims, err := auth.ValidateAPIToken(db, tokenString, c.IP())
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid or expired API token",
+		})
+	}
+
+	// Path relative to the API root, e.g. /dns/zones/1
+	// Routes match case-insensitively, so must the blocklist
+	path := strings.TrimPrefix(strings.ToLower(c.Path()), "/api/v1")
+	if path != "/auth/me" {
+		if strings.HasPrefix(path, "/auth/") || !auth.HasScope(claims.Scopes, c.Method(), path) {
+			return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+				Success: false,
+				Error:   "API token scope does not allow this request",
+			})
+		}
+	}
+
+	c.Locals("user_id", claims.UserID)
+	c.Locals("username", claims.Username)
+	c.Locals("role", claims.Role)
+	c.Locals("api_token_id", claims.TokenID)
+
+	return c.Next()
+}
+
 // RoleMiddleware checks if user has required role
 func RoleMiddleware(allowedRoles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
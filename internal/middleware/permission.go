@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+	"github.com/asergenalkan/serverpanel/internal/services/feature"
+	"github.com/asergenalkan/serverpanel/internal/services/subuser"
+	"github.com/gofiber/fiber/v2"
+)
+
+// subUserAuth loads the sub-user behind a session token. Permissions and the
+// file root are read on every request so the owner's changes apply at once.
+func subUserAuth(c *fiber.Ctx, claims *auth.Claims, db auth.DB) error {
+	sub, err := subuser.NewManager(db).Load(claims.SubUserID)
+	if err != nil || !sub.Active || sub.OwnerID != claims.UserID {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.APIResponse{
+			Success: false,
+			Error:   "Invalid or expired token",
+		})
+	}
+
+	c.Locals("subuser_id", sub.ID)
+	c.Locals("subuser_name", sub.Name)
+	c.Locals("subuser_permissions", sub.Permissions)
+	c.Locals("file_root", sub.FileRoot)
+
+	return c.Next()
+}
+
+// RequirePermission lets sub-users through only when their owner granted
+// them perm. The account owner and other users are not affected.
+func RequirePermission(perm string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("subuser_id") == nil {
+			return c.Next()
+		}
+
+		perms, _ := c.Locals("subuser_permissions").([]string)
+		if !subuser.Has(perms, perm) {
+			return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Sub-user does not have the %s permission", perm),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RequireFeature refuses hosting accounts whose package does not include
+// the feature. Admins and resellers are not limited by packages.
+func RequireFeature(db auth.DB, name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if role, _ := c.Locals("role").(string); role != models.RoleUser {
+			return c.Next()
+		}
+
+		userID, _ := c.Locals("user_id").(int64)
+		if !feature.Enabled(db, userID, name) {
+			return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+				Success: false,
+				Error:   fmt.Sprintf("The %s feature is not included in your hosting package", name),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// DenySubUsers keeps sub-users out of routes that belong to the account
+// owner: credentials, domains, PHP settings and sub-user management
+func DenySubUsers() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("subuser_id") != nil {
+			return c.Status(fiber.StatusForbidden).JSON(models.APIResponse{
+				Success: false,
+				Error:   "Not allowed for sub-users",
+			})
+		}
+		return c.Next()
+	}
+}
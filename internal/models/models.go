@@ -98,8 +98,47 @@ type LoginRequest struct {
 
 // LoginResponse represents login response
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"` // access token lifetime in seconds
+	User         User   `json:"user"`
+
+	// Set instead of Token when a second login step is needed
+	PreAuthToken           string `json:"pre_auth_token,omitempty"`
+	TwoFactorRequired      bool   `json:"two_factor_required,omitempty"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"`
+
+	// Returned once when 2FA is enrolled during login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+
+	// Set on impersonation logins: the admin or reseller acting as User
+	Impersonator *Impersonator `json:"impersonator,omitempty"`
+
+	// Set on sub-user logins; User is the account owner
+	SubUser *SubUserIdentity `json:"sub_user,omitempty"`
+}
+
+// CurrentUser is the /auth/me response
+type CurrentUser struct {
+	User
+	Impersonating bool             `json:"impersonating"`
+	Impersonator  *Impersonator    `json:"impersonator,omitempty"`
+	SubUser       *SubUserIdentity `json:"sub_user,omitempty"`
+}
+
+// SubUserIdentity describes a logged-in sub-user of the User account
+type SubUserIdentity struct {
+	ID          int64    `json:"id"`
+	Login       string   `json:"login"` // name@owner
+	Permissions []string `json:"permissions"`
+	FileRoot    string   `json:"file_root,omitempty"`
+}
+
+// Impersonator identifies who acts as another user
+type Impersonator struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
 }
 
 // APIResponse represents a standard API response
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/asergenalkan/serverpanel/internal/config"
 	"github.com/asergenalkan/serverpanel/internal/services/dns"
@@ -21,6 +23,7 @@ var (
 	ErrInvalidUsername = errors.New("invalid username format")
 	ErrUserExists      = errors.New("username already exists")
 	ErrInvalidDomain   = errors.New("invalid domain format")
+	ErrInvalidRedirect = errors.New("redirect URL must be an absolute http or https URL")
 	ErrDomainExists    = errors.New("domain already exists")
 	ErrPackageNotFound = errors.New("package not found")
 	ErrQuotaExceeded   = errors.New("quota exceeded")
@@ -35,8 +38,9 @@ type DB interface {
 }
 
 type Service struct {
-	db  DB
-	cfg *config.Config
+	db       DB
+	cfg      *config.Config
+	progress func(msg string) // receives step progress of journaled jobs (may be nil)
 }
 
 type CreateAccountRequest struct {
@@ -45,20 +49,31 @@ type CreateAccountRequest struct {
 	Password  string `json:"password"`
 	Domain    string `json:"domain"`
 	PackageID int64  `json:"package_id"`
+	ParentID  int64  `json:"-"` // owning reseller, 0 for admin accounts
 }
 
 type Account struct {
-	ID          int64  `json:"id"`
-	Username    string `json:"username"`
-	Email       string `json:"email"`
-	Domain      string `json:"domain"`
-	HomeDir     string `json:"home_dir"`
-	PackageID   int64  `json:"package_id"`
-	PackageName string `json:"package_name"`
-	DiskUsed    int64  `json:"disk_used"`
-	DiskQuota   int64  `json:"disk_quota"`
-	Active      bool   `json:"active"`
-	CreatedAt   string `json:"created_at"`
+	ID             int64  `json:"id"`
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	Domain         string `json:"domain"`
+	HomeDir        string `json:"home_dir"`
+	PackageID      int64  `json:"package_id"`
+	PackageName    string `json:"package_name"`
+	DiskUsed       int64  `json:"disk_used"`       // MB, from the filesystem quota
+	DiskQuota      int64  `json:"disk_quota"`      // MB
+	Inodes         int64  `json:"inodes"`          // files and directories in the home
+	MaxInodes      int64  `json:"max_inodes"`      // 0 means unlimited
+	BandwidthUsed  int64  `json:"bandwidth_used"`  // MB this month, from the traffic logs
+	BandwidthQuota int64  `json:"bandwidth_quota"` // MB per month
+	Active         bool   `json:"active"`
+	Suspended      bool   `json:"suspended"`
+	SuspendReason  string `json:"suspend_reason,omitempty"`
+	SuspendedAt    string `json:"suspended_at,omitempty"`
+	Terminated     bool   `json:"terminated"`
+	PurgeAfter     string `json:"purge_after,omitempty"`
+	ParentID       int64  `json:"parent_id,omitempty"`
+	CreatedAt      string `json:"created_at"`
 }
 
 func NewService(db DB) *Service {
@@ -68,6 +83,18 @@ func NewService(db DB) *Service {
 	}
 }
 
+// SetProgress sets the function that receives progress lines while a
+// journaled job runs
+func (s *Service) SetProgress(fn func(msg string)) {
+	s.progress = fn
+}
+
+func (s *Service) report(format string, args ...interface{}) {
+	if s.progress != nil {
+		s.progress(fmt.Sprintf(format, args...))
+	}
+}
+
 // ValidateUsername checks if username is valid
 func (s *Service) ValidateUsername(username string) error {
 	// Must be 3-32 characters, lowercase, alphanumeric, can contain underscore
@@ -104,6 +131,19 @@ func (s *Service) ValidateDomain(domain string) error {
 	return nil
 }
 
+// ValidateRedirectURL validates a redirect target. It is written into
+// Apache's Redirect directive, so whitespace and quotes are refused.
+func (s *Service) ValidateRedirectURL(redirectURL string) error {
+	if strings.ContainsAny(redirectURL, " \t\r\n\"'\\") {
+		return ErrInvalidRedirect
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidRedirect
+	}
+	return nil
+}
+
 // CreateAccount creates a new hosting account
 func (s *Service) CreateAccount(req CreateAccountRequest) (*Account, error) {
 	// Validate username
@@ -149,102 +189,216 @@ func (s *Service) CreateAccount(req CreateAccountRequest) (*Account, error) {
 		return nil, err
 	}
 
-	homeDir := filepath.Join(s.cfg.HomeBaseDir, req.Username)
-
-	// Start transaction
-	tx, err := s.db.Begin()
+	p := createParams{
+		Username:           req.Username,
+		Email:              req.Email,
+		PasswordHash:       string(hashedPassword),
+		Domain:             req.Domain,
+		PackageID:          req.PackageID,
+		ParentID:           req.ParentID,
+		ExistingSystemUser: s.systemUserExists(req.Username),
+	}
+	job, err := s.newJob(JobCreateAccount, req.Username, 0, p)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
-
-	// Create user in database
-	result, err := tx.Exec(`
-		INSERT INTO users (username, email, password, role, active, created_at, updated_at)
-		VALUES (?, ?, ?, 'user', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`, req.Username, req.Email, string(hashedPassword))
-	if err != nil {
+	// A failed required step rolls back the completed ones
+	if err := s.runJob(job, s.createSteps(job, &p), true); err != nil {
 		return nil, err
 	}
 
-	userID, _ := result.LastInsertId()
+	log.Printf("✅ Account created: %s (%s) - %s", req.Username, req.Email, req.Domain)
 
-	// Assign package to user
-	_, err = tx.Exec(`
-		INSERT INTO user_packages (user_id, package_id)
-		VALUES (?, ?)
-	`, userID, req.PackageID)
-	if err != nil {
-		return nil, err
-	}
+	return &Account{
+		ID:          job.UserID,
+		Username:    req.Username,
+		Email:       req.Email,
+		Domain:      req.Domain,
+		HomeDir:     filepath.Join(s.cfg.HomeBaseDir, req.Username),
+		PackageID:   req.PackageID,
+		PackageName: packageName,
+		DiskQuota:   diskQuota,
+		Active:      true,
+		ParentID:    req.ParentID,
+	}, nil
+}
+
+// createParams are the journaled inputs of an account creation
+type createParams struct {
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	Domain       string `json:"domain"`
+	PackageID    int64  `json:"package_id"`
+	ParentID     int64  `json:"parent_id,omitempty"`
+	// The system user (and its home) existed before the job; it is reused
+	// and kept on rollback
+	ExistingSystemUser bool `json:"existing_system_user,omitempty"`
+}
 
-	// Create domain entry
+// createSteps lists the side effects of creating an account, each with the
+// action that reverts it. DNS and mail setup stay optional as before.
+func (s *Service) createSteps(job *Job, p *createParams) []step {
+	homeDir := filepath.Join(s.cfg.HomeBaseDir, p.Username)
 	documentRoot := filepath.Join(homeDir, "public_html")
-	_, err = tx.Exec(`
-		INSERT INTO domains (user_id, name, document_root, active)
-		VALUES (?, ?, ?, 1)
-	`, userID, req.Domain, documentRoot)
-	if err != nil {
-		return nil, err
-	}
 
-	// Create system resources
-	if err := s.createSystemUser(req.Username, homeDir); err != nil {
-		return nil, fmt.Errorf("failed to create system user: %w", err)
+	// Only what the job created is removed on rollback
+	systemUser := step{
+		name: "system_user",
+		run:  func() error { return s.createSystemUser(p.Username, homeDir) },
 	}
-
-	if err := s.createDirectoryStructure(req.Username, homeDir); err != nil {
-		return nil, fmt.Errorf("failed to create directories: %w", err)
+	directories := step{
+		name: "directories",
+		run:  func() error { return s.createDirectoryStructure(p.Username, homeDir) },
 	}
-
-	if err := s.createWebServerVhost(req.Username, req.Domain, homeDir, documentRoot); err != nil {
-		return nil, fmt.Errorf("failed to create web server config: %w", err)
+	if !p.ExistingSystemUser {
+		systemUser.undo = func() error { return s.deleteSystemUser(p.Username) }
+		directories.undo = func() error { return os.RemoveAll(homeDir) }
 	}
 
-	if err := s.createPHPFPMPool(req.Username, homeDir); err != nil {
-		return nil, fmt.Errorf("failed to create PHP-FPM pool: %w", err)
+	return []step{
+		{
+			name: "database",
+			run: func() error {
+				userID, err := s.insertAccountRows(p, documentRoot)
+				if err != nil {
+					return err
+				}
+				job.UserID = userID
+				s.db.Exec("UPDATE provisioning_jobs SET user_id = ? WHERE id = ?", userID, job.ID)
+				return nil
+			},
+			undo: func() error {
+				if err := s.deleteAccountRows(job.UserID); err != nil {
+					return err
+				}
+				job.UserID = 0
+				return nil
+			},
+		},
+		systemUser,
+		directories,
+		{
+			name:     "disk_quota",
+			optional: true,
+			run:      func() error { return s.applyDiskQuota(p.Username, p.PackageID) },
+			undo:     func() error { return s.quotaManager().RemoveQuota(p.Username) },
+		},
+		{
+			name:     "shell",
+			optional: true,
+			run:      func() error { return s.applyShell(job.UserID, p.Username, p.PackageID) },
+		},
+		{
+			name: "vhost",
+			run:  func() error { return s.createWebServerVhost(p.Username, p.Domain, homeDir, documentRoot) },
+			undo: func() error { return s.webServerDriver().DeleteVhost(p.Domain) },
+		},
+		{
+			name: "php_fpm_pool",
+			run:  func() error { return s.createPHPFPMPool(p.Username, homeDir) },
+			undo: func() error { return s.phpFPMManager().DeletePool(p.Username) },
+		},
+		{
+			name:     "dns_zone",
+			optional: true,
+			run:      func() error { return s.createDNSZone(p.Domain) },
+			undo: func() error {
+				return dns.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath).DeleteZone(p.Domain)
+			},
+		},
+		{
+			name:     "webmail_vhost",
+			optional: true,
+			run:      func() error { return s.createWebmailVhost(p.Domain) },
+			undo: func() error {
+				if apacheDriver, ok := s.webServerDriver().(*webserver.ApacheDriver); ok {
+					return apacheDriver.DeleteWebmailVhost(p.Domain)
+				}
+				return nil
+			},
+		},
+		{
+			// Shared DKIM/Postfix tables, not reverted
+			name:     "mail",
+			optional: true,
+			run:      func() error { return s.setupMailForDomain(p.Domain) },
+		},
+		{
+			name:     "welcome_page",
+			optional: true,
+			run:      func() error { return s.createWelcomePage(p.Username, p.Domain, documentRoot) },
+			undo:     func() error { return nil }, // removed with the home directory
+		},
 	}
+}
 
-	// Create DNS zone
-	if err := s.createDNSZone(req.Domain); err != nil {
-		log.Printf("Warning: failed to create DNS zone: %v", err)
-		// Don't fail account creation if DNS fails
+// insertAccountRows creates the user, package and domain rows
+func (s *Service) insertAccountRows(p *createParams, documentRoot string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	// Create webmail subdomain vhost
-	if err := s.createWebmailVhost(req.Domain); err != nil {
-		log.Printf("Warning: failed to create webmail vhost: %v", err)
-		// Don't fail account creation if webmail vhost fails
+	var parentID sql.NullInt64
+	if p.ParentID > 0 {
+		parentID = sql.NullInt64{Int64: p.ParentID, Valid: true}
 	}
+	result, err := tx.Exec(`
+		INSERT INTO users (username, email, password, role, parent_id, active, created_at, updated_at)
+		VALUES (?, ?, ?, 'user', ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, p.Username, p.Email, p.PasswordHash, parentID)
+	if err != nil {
+		return 0, err
+	}
+	userID, _ := result.LastInsertId()
 
-	// Setup mail for domain (DKIM, Postfix virtual domain)
-	if err := s.setupMailForDomain(req.Domain); err != nil {
-		log.Printf("Warning: failed to setup mail for domain: %v", err)
-		// Don't fail account creation if mail setup fails
+	if _, err := tx.Exec("INSERT INTO user_packages (user_id, package_id) VALUES (?, ?)", userID, p.PackageID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO domains (user_id, name, document_root, php_version, active)
+		VALUES (?, ?, ?, ?, 1)
+	`, userID, p.Domain, documentRoot, s.cfg.PHPVersion); err != nil {
+		return 0, err
 	}
 
-	if err := s.createWelcomePage(req.Username, req.Domain, documentRoot); err != nil {
-		log.Printf("Warning: failed to create welcome page: %v", err)
+	return userID, tx.Commit()
+}
+
+// deleteAccountRows removes an account and its rows from the panel database
+func (s *Service) deleteAccountRows(userID int64) error {
+	if userID == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	tx.Exec("DELETE FROM database_users WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM user_packages WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM domains WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM databases WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM email_accounts WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM account_suspensions WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM account_terminations WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM bandwidth_usage WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM bandwidth_overages WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM account_inodes WHERE user_id = ?", userID)
+	tx.Exec("DELETE FROM activity_logs WHERE user_id = ?", userID)
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", userID); err != nil {
+		return err
 	}
 
-	log.Printf("✅ Account created: %s (%s) - %s", req.Username, req.Email, req.Domain)
+	return tx.Commit()
+}
 
-	return &Account{
-		ID:          userID,
-		Username:    req.Username,
-		Email:       req.Email,
-		Domain:      req.Domain,
-		HomeDir:     homeDir,
-		PackageID:   req.PackageID,
-		PackageName: packageName,
-		DiskQuota:   diskQuota,
-		Active:      true,
-	}, nil
+// phpFPMManager returns the PHP-FPM manager for the default PHP version
+func (s *Service) phpFPMManager() *webserver.PHPFPMManager {
+	return webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, s.cfg.PHPVersion)
 }
 
 // createSystemUser creates a Linux user (or simulates it)
@@ -282,6 +436,14 @@ func (s *Service) createSystemUser(username, homeDir string) error {
 	return nil
 }
 
+// systemUserExists reports whether a Linux user with this name exists
+func (s *Service) systemUserExists(username string) bool {
+	if config.IsDevelopment() || !s.cfg.IsLinux {
+		return false
+	}
+	return exec.Command("id", username).Run() == nil
+}
+
 // createDirectoryStructure creates the home directory structure
 func (s *Service) createDirectoryStructure(username, homeDir string) error {
 	dirs := []string{
@@ -349,15 +511,11 @@ func (s *Service) createWebServerVhost(username, domain, homeDir, documentRoot s
 	return nil
 }
 
-// createPHPFPMPool creates a PHP-FPM pool for the user
+// createPHPFPMPool creates a PHP-FPM pool for the user with its package's
+// PHP limits
 func (s *Service) createPHPFPMPool(username, homeDir string) error {
-	manager := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, s.cfg.PHPVersion)
-
-	poolConfig := webserver.PHPFPMConfig{
-		Username:   username,
-		HomeDir:    homeDir,
-		PHPVersion: s.cfg.PHPVersion,
-	}
+	poolConfig := s.phpPoolConfig(username, homeDir)
+	manager := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, poolConfig.PHPVersion)
 
 	if err := manager.CreatePool(poolConfig); err != nil {
 		return err
@@ -569,41 +727,69 @@ func (s *Service) createWelcomePage(username, domain, documentRoot string) error
 	return nil
 }
 
-// ListAccounts returns all hosting accounts
-func (s *Service) ListAccounts() ([]Account, error) {
-	rows, err := s.db.Query(`
-		SELECT u.id, u.username, u.email, u.active, u.created_at,
+// ListAccounts returns hosting accounts. parentID limits the list to one
+// reseller's accounts; 0 returns every account.
+func (s *Service) ListAccounts(parentID int64) ([]Account, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.active, u.created_at, COALESCE(u.parent_id, 0),
 			   COALESCE(d.name, '') as domain,
 			   COALESCE(p.id, 0) as package_id,
 			   COALESCE(p.name, 'No Package') as package_name,
-			   COALESCE(p.disk_quota, 0) as disk_quota
+			   COALESCE(p.disk_quota, 0) as disk_quota,
+			   COALESCE(p.max_inodes, 0) as max_inodes, COALESCE(ai.used, 0),
+			   COALESCE(p.bandwidth_quota, 0) as bandwidth_quota,
+			   COALESCE((SELECT SUM(b.bytes) FROM bandwidth_usage b WHERE b.user_id = u.id AND b.day >= ?), 0),
+			   s.user_id IS NOT NULL, COALESCE(s.reason, ''), COALESCE(s.created_at, ''),
+			   t.user_id IS NOT NULL, COALESCE(t.purge_after, '')
 		FROM users u
 		LEFT JOIN domains d ON d.user_id = u.id
 		LEFT JOIN user_packages up ON up.user_id = u.id
 		LEFT JOIN packages p ON p.id = up.package_id
-		WHERE u.role = 'user'
-		ORDER BY u.created_at DESC
-	`)
+		LEFT JOIN account_suspensions s ON s.user_id = u.id
+		LEFT JOIN account_terminations t ON t.user_id = u.id
+		LEFT JOIN account_inodes ai ON ai.user_id = u.id
+		WHERE u.role = 'user'`
+	args := []interface{}{time.Now().Format("2006-01") + "-01"}
+	if parentID > 0 {
+		query += " AND u.parent_id = ?"
+		args = append(args, parentID)
+	}
+	rows, err := s.db.Query(query+" ORDER BY u.created_at DESC", args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	// Usage comes from the quota files in one call instead of du per home
+	usage, err := s.quotaManager().Report()
+	if err != nil {
+		log.Printf("Warning: failed to read disk quotas: %v", err)
+	}
+
 	var accounts []Account
 	for rows.Next() {
 		var a Account
-		if err := rows.Scan(&a.ID, &a.Username, &a.Email, &a.Active, &a.CreatedAt,
-			&a.Domain, &a.PackageID, &a.PackageName, &a.DiskQuota); err != nil {
+		if err := rows.Scan(&a.ID, &a.Username, &a.Email, &a.Active, &a.CreatedAt, &a.ParentID,
+			&a.Domain, &a.PackageID, &a.PackageName, &a.DiskQuota, &a.MaxInodes, &a.Inodes, &a.BandwidthQuota, &a.BandwidthUsed,
+			&a.Suspended, &a.SuspendReason, &a.SuspendedAt,
+			&a.Terminated, &a.PurgeAfter); err != nil {
 			continue
 		}
 		a.HomeDir = filepath.Join(s.cfg.HomeBaseDir, a.Username)
+		a.DiskUsed = usage[a.Username].UsedMB
+		// Without quotas the last hourly count is shown
+		if files := usage[a.Username].Files; files > 0 {
+			a.Inodes = files
+		}
+		a.BandwidthUsed /= 1024 * 1024
 		accounts = append(accounts, a)
 	}
 
 	return accounts, nil
 }
 
-// DeleteAccount deletes a hosting account completely
+// DeleteAccount deletes a hosting account completely. Each step is
+// journaled; a failed delete stops there and can be resumed.
 func (s *Service) DeleteAccount(userID int64) error {
 	// Get username first
 	var username string
@@ -612,158 +798,209 @@ func (s *Service) DeleteAccount(userID int64) error {
 		return err
 	}
 
-	homeDir := filepath.Join(s.cfg.HomeBaseDir, username)
 	log.Printf("🗑️ Deleting account: %s (ID: %d)", username, userID)
 
-	// Get all domains BEFORE deleting from database
-	var domains []string
-	rows, err := s.db.Query("SELECT name FROM domains WHERE user_id = ?", userID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var domainName string
-			if rows.Scan(&domainName) == nil {
-				domains = append(domains, domainName)
-			}
-		}
-	}
-
-	// Get all MySQL databases for this user
-	var databases []string
-	dbRows, err := s.db.Query("SELECT name FROM databases WHERE user_id = ?", userID)
-	if err == nil {
-		defer dbRows.Close()
-		for dbRows.Next() {
-			var dbName string
-			if dbRows.Scan(&dbName) == nil {
-				databases = append(databases, dbName)
-			}
-		}
+	// Domains and databases are collected before the rows are deleted so a
+	// resumed job still knows them
+	p := deleteParams{
+		UserID:    userID,
+		Username:  username,
+		Domains:   s.accountLogins("domains", "name", userID),
+		Databases: s.accountLogins("databases", "name", userID),
 	}
-
-	// Delete web server configs for all domains
-	driverType := webserver.DriverApache
-	if s.cfg.WebServer == "nginx" {
-		driverType = webserver.DriverNginx
+	s.db.QueryRow("SELECT archive_path FROM account_terminations WHERE user_id = ?", userID).Scan(&p.ArchivePath)
+	job, err := s.newJob(JobDeleteAccount, username, userID, p)
+	if err != nil {
+		return err
 	}
-	driver := webserver.NewDriver(driverType, s.cfg.SimulateMode, s.cfg.SimulateBasePath)
-
-	for _, domainName := range domains {
-		if err := driver.DeleteVhost(domainName); err != nil {
-			log.Printf("Warning: failed to delete vhost for %s: %v", domainName, err)
-		}
-		// Delete DNS zone
-		dnsManager := dns.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath)
-		if err := dnsManager.DeleteZone(domainName); err != nil {
-			log.Printf("Warning: failed to delete DNS zone for %s: %v", domainName, err)
-		}
+	if err := s.runJob(job, s.deleteSteps(&p), false); err != nil {
+		return err
 	}
 
-	// Delete PHP-FPM pool first
-	phpfpm := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, s.cfg.PHPVersion)
-	if err := phpfpm.DeletePool(username); err != nil {
-		log.Printf("Warning: failed to delete PHP-FPM pool for %s: %v", username, err)
-	}
+	log.Printf("✅ Account deleted completely: %s", username)
+	return nil
+}
 
-	// Restart PHP-FPM to release the pool processes
-	if !config.IsDevelopment() && s.cfg.IsLinux {
-		log.Printf("🔄 Restarting PHP-FPM to release pool processes...")
-		restartCmd := exec.Command("systemctl", "restart", fmt.Sprintf("php%s-fpm", s.cfg.PHPVersion))
-		if output, err := restartCmd.CombinedOutput(); err != nil {
-			log.Printf("Warning: PHP-FPM restart failed: %v - %s", err, string(output))
-			// Try alternative restart
-			exec.Command("systemctl", "restart", "php-fpm").Run()
-		}
-		// Give PHP-FPM time to restart
-		exec.Command("sleep", "1").Run()
-	}
+// deleteParams are the journaled inputs of an account deletion
+type deleteParams struct {
+	UserID      int64    `json:"user_id"`
+	Username    string   `json:"username"`
+	Domains     []string `json:"domains"`
+	Databases   []string `json:"databases"`
+	ArchivePath string   `json:"archive_path,omitempty"` // set for terminated accounts
+}
 
-	// Kill all processes owned by the user
-	if !config.IsDevelopment() && s.cfg.IsLinux {
-		log.Printf("🔪 Killing all processes for user: %s", username)
-		killCmd := exec.Command("pkill", "-9", "-u", username)
-		killCmd.Run() // Ignore error - user might not have any processes
-		// Wait a moment for processes to die
-		exec.Command("sleep", "1").Run()
-	}
-
-	// Delete MySQL databases and users
-	if !config.IsDevelopment() {
-		mysqlRootPass := os.Getenv("MYSQL_ROOT_PASSWORD")
-		if mysqlRootPass != "" {
-			for _, dbName := range databases {
-				log.Printf("🗑️ Dropping MySQL database: %s", dbName)
-				// Drop database
-				dropDBCmd := exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e", fmt.Sprintf("DROP DATABASE IF EXISTS `%s`;", dbName))
-				dropDBCmd.Run()
-				// Drop user (same name as database)
-				dropUserCmd := exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e", fmt.Sprintf("DROP USER IF EXISTS '%s'@'localhost';", dbName))
-				dropUserCmd.Run()
-			}
-			// Also drop any database users with username prefix
-			dropPrefixUsersCmd := exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e",
-				fmt.Sprintf("SELECT CONCAT('DROP USER IF EXISTS \\'', user, '\\'@\\'', host, '\\';') FROM mysql.user WHERE user LIKE '%s\\_%%';", username))
-			if output, err := dropPrefixUsersCmd.Output(); err == nil {
-				for _, line := range strings.Split(string(output), "\n") {
-					if strings.HasPrefix(line, "DROP USER") {
-						exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e", line).Run()
+// deleteSteps lists the side effects of deleting an account. Removed data
+// cannot come back, so these steps have no undo.
+func (s *Service) deleteSteps(p *deleteParams) []step {
+	homeDir := filepath.Join(s.cfg.HomeBaseDir, p.Username)
+
+	return []step{
+		{
+			name: "vhosts",
+			run: func() error {
+				driver := s.webServerDriver()
+				var lastErr error
+				for _, domainName := range p.Domains {
+					if err := driver.DeleteVhost(domainName); err != nil {
+						lastErr = fmt.Errorf("%s: %w", domainName, err)
 					}
 				}
-			}
-		}
+				return lastErr
+			},
+		},
+		{
+			name:     "dns_zones",
+			optional: true,
+			run: func() error {
+				dnsManager := dns.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath)
+				var lastErr error
+				for _, domainName := range p.Domains {
+					if err := dnsManager.DeleteZone(domainName); err != nil {
+						lastErr = fmt.Errorf("%s: %w", domainName, err)
+					}
+				}
+				return lastErr
+			},
+		},
+		{
+			name: "php_fpm_pool",
+			run: func() error {
+				if err := s.phpFPMManager().DeletePool(p.Username); err != nil {
+					return err
+				}
+				s.restartPHPFPM()
+				return nil
+			},
+		},
+		{
+			name: "processes",
+			run: func() error {
+				s.killUserProcesses(p.Username)
+				return nil
+			},
+		},
+		{
+			name: "mysql",
+			run:  func() error { return s.dropMySQLDatabases(p.Username, p.Databases) },
+		},
+		{
+			name: "database",
+			run:  func() error { return s.deleteAccountRows(p.UserID) },
+		},
+		{
+			// Cleared while the user still exists, userdel leaves the
+			// quota record of the uid behind
+			name:     "disk_quota",
+			optional: true,
+			run:      func() error { return s.quotaManager().RemoveQuota(p.Username) },
+		},
+		{
+			name: "system_user",
+			run:  func() error { return s.deleteSystemUser(p.Username) },
+		},
+		{
+			// Also covers the case where userdel -r did not remove it
+			name: "home_dir",
+			run:  func() error { return os.RemoveAll(homeDir) },
+		},
+		{
+			name: "archive",
+			run: func() error {
+				if p.ArchivePath == "" {
+					return nil
+				}
+				return os.RemoveAll(p.ArchivePath)
+			},
+		},
 	}
+}
 
-	// Delete from panel database
-	tx, err := s.db.Begin()
-	if err != nil {
-		return err
+// restartPHPFPM restarts PHP-FPM to release the processes of a removed pool
+func (s *Service) restartPHPFPM() {
+	if config.IsDevelopment() || !s.cfg.IsLinux {
+		return
 	}
-	defer tx.Rollback()
 
-	tx.Exec("DELETE FROM database_users WHERE user_id = ?", userID)
-	tx.Exec("DELETE FROM user_packages WHERE user_id = ?", userID)
-	tx.Exec("DELETE FROM domains WHERE user_id = ?", userID)
-	tx.Exec("DELETE FROM databases WHERE user_id = ?", userID)
-	tx.Exec("DELETE FROM email_accounts WHERE user_id = ?", userID)
-	tx.Exec("DELETE FROM activity_logs WHERE user_id = ?", userID)
-	tx.Exec("DELETE FROM users WHERE id = ?", userID)
+	log.Printf("🔄 Restarting PHP-FPM to release pool processes...")
+	restartCmd := exec.Command("systemctl", "restart", fmt.Sprintf("php%s-fpm", s.cfg.PHPVersion))
+	if output, err := restartCmd.CombinedOutput(); err != nil {
+		log.Printf("Warning: PHP-FPM restart failed: %v - %s", err, string(output))
+		// Try alternative restart
+		exec.Command("systemctl", "restart", "php-fpm").Run()
+	}
+	// Give PHP-FPM time to restart
+	exec.Command("sleep", "1").Run()
+}
 
-	if err := tx.Commit(); err != nil {
-		return err
+// killUserProcesses kills all processes owned by the user
+func (s *Service) killUserProcesses(username string) {
+	if config.IsDevelopment() || !s.cfg.IsLinux {
+		return
 	}
 
-	// Delete system user
+	log.Printf("🔪 Killing all processes for user: %s", username)
+	exec.Command("pkill", "-9", "-u", username).Run() // Ignore error - user might not have any processes
+	// Wait a moment for processes to die
+	exec.Command("sleep", "1").Run()
+}
+
+// dropMySQLDatabases drops the account's MySQL databases and users
+func (s *Service) dropMySQLDatabases(username string, databases []string) error {
 	if config.IsDevelopment() {
-		log.Printf("🔧 [SIMÜLASYON] userdel -r %s", username)
-		log.Printf("🔧 [SIMÜLASYON] rm -rf %s", homeDir)
-	} else if s.cfg.IsLinux {
-		log.Printf("🗑️ Deleting system user: %s", username)
-		cmd := exec.Command("userdel", "-r", username)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			log.Printf("⚠️ userdel -r failed for %s: %v - %s", username, err, string(output))
-			// Try without -r flag
-			cmd2 := exec.Command("userdel", username)
-			if output2, err2 := cmd2.CombinedOutput(); err2 != nil {
-				log.Printf("⚠️ userdel also failed for %s: %v - %s", username, err2, string(output2))
+		return nil
+	}
+	mysqlRootPass := os.Getenv("MYSQL_ROOT_PASSWORD")
+	if mysqlRootPass == "" {
+		return nil
+	}
+
+	for _, dbName := range databases {
+		log.Printf("🗑️ Dropping MySQL database: %s", dbName)
+		// Drop database
+		dropDBCmd := exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e", fmt.Sprintf("DROP DATABASE IF EXISTS `%s`;", dbName))
+		if output, err := dropDBCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to drop database %s: %s - %w", dbName, strings.TrimSpace(string(output)), err)
+		}
+		// Drop user (same name as database)
+		dropUserCmd := exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e", fmt.Sprintf("DROP USER IF EXISTS '%s'@'localhost';", dbName))
+		dropUserCmd.Run()
+	}
+	// Also drop any database users with username prefix
+	dropPrefixUsersCmd := exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e",
+		fmt.Sprintf("SELECT CONCAT('DROP USER IF EXISTS \\'', user, '\\'@\\'', host, '\\';') FROM mysql.user WHERE user LIKE '%s\\_%%';", username))
+	if output, err := dropPrefixUsersCmd.Output(); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			if strings.HasPrefix(line, "DROP USER") {
+				exec.Command("mysql", "-uroot", "-p"+mysqlRootPass, "-e", line).Run()
 			}
 		}
 	}
-
-	// Always try to delete the home directory (in case userdel -r didn't work)
-	os.RemoveAll(homeDir)
-
-	log.Printf("✅ Account deleted completely: %s", username)
 	return nil
 }
 
-// SuspendAccount suspends an account
-func (s *Service) SuspendAccount(userID int64) error {
-	_, err := s.db.Exec("UPDATE users SET active = 0 WHERE id = ?", userID)
-	return err
-}
+// deleteSystemUser removes the Linux user and its home directory
+func (s *Service) deleteSystemUser(username string) error {
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] userdel -r %s", username)
+		return nil
+	}
+	if !s.cfg.IsLinux {
+		return nil
+	}
+	if exec.Command("id", username).Run() != nil {
+		return nil // already gone
+	}
 
-// UnsuspendAccount unsuspends an account
-func (s *Service) UnsuspendAccount(userID int64) error {
-	_, err := s.db.Exec("UPDATE users SET active = 1 WHERE id = ?", userID)
-	return err
+	log.Printf("🗑️ Deleting system user: %s", username)
+	cmd := exec.Command("userdel", "-r", username)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("⚠️ userdel -r failed for %s: %v - %s", username, err, string(output))
+		// Try without -r flag
+		cmd2 := exec.Command("userdel", username)
+		if output2, err2 := cmd2.CombinedOutput(); err2 != nil {
+			return fmt.Errorf("userdel failed: %s - %w", strings.TrimSpace(string(output2)), err2)
+		}
+	}
+	return nil
 }
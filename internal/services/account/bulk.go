@@ -0,0 +1,485 @@
+package account
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bulk operation actions
+const (
+	BulkCreate        = "create"
+	BulkSuspend       = "suspend"
+	BulkUnsuspend     = "unsuspend"
+	BulkChangePackage = "change_package"
+	BulkDelete        = "delete"
+)
+
+// MaxBulkRows is the most rows one bulk operation accepts
+const MaxBulkRows = 1000
+
+const (
+	defaultBulkWorkers    = 2
+	maxBulkWorkers        = 10
+	defaultBulkRatePerMin = 30
+)
+
+var (
+	ErrBulkEmpty    = errors.New("no accounts given")
+	ErrBulkTooLarge = fmt.Errorf("at most %d accounts can be processed at once", MaxBulkRows)
+	ErrBulkInvalid  = errors.New("some rows are invalid, nothing was processed")
+	ErrBulkNotFound = errors.New("bulk operation not found")
+)
+
+// BulkRow is one account of a bulk create request
+type BulkRow struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Domain    string `json:"domain"`
+	Package   string `json:"package"`              // package name or ID
+	PackageID int64  `json:"package_id,omitempty"` // alternative to package
+	Password  string `json:"password,omitempty"`   // generated by the caller when empty
+}
+
+// BulkRowError is a row rejected by validation. Rows are numbered from 1 in
+// the order they were given, without the CSV header.
+type BulkRowError struct {
+	Row      int    `json:"row"`
+	Username string `json:"username,omitempty"`
+	Error    string `json:"error"`
+}
+
+// BulkOperation is a batch of account operations worked through by the
+// bulk queue
+type BulkOperation struct {
+	ID        int64      `json:"id"`
+	Action    string     `json:"action"`
+	ActorID   int64      `json:"actor_id"`
+	Status    string     `json:"status"`
+	Total     int        `json:"total"`
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	CreatedAt string     `json:"created_at"`
+	UpdatedAt string     `json:"updated_at"`
+	Items     []BulkItem `json:"items,omitempty"`
+
+	mu sync.Mutex
+}
+
+// BulkItem is the per-row result of a bulk operation
+type BulkItem struct {
+	Row       int    `json:"row"`
+	AccountID int64  `json:"account_id,omitempty"`
+	Username  string `json:"username"`
+	Status    string `json:"status"` // pending, running, done, failed
+	Error     string `json:"error,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// ParseBulkRows reads bulk create rows from a CSV file or a JSON body. JSON
+// may be an array of rows or {"accounts": [...]}. CSV may start with a
+// header naming the columns, otherwise the columns are username, email,
+// domain, package and an optional password.
+func ParseBulkRows(data []byte, format string) ([]BulkRow, error) {
+	var rows []BulkRow
+	if format == "csv" {
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		r.Comment = '#'
+
+		columns := []string{"username", "email", "domain", "package", "password"}
+		first := true
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid CSV: %w", err)
+			}
+			if first {
+				first = false
+				if strings.EqualFold(strings.TrimSpace(record[0]), "username") {
+					columns = make([]string, len(record))
+					for i, name := range record {
+						columns[i] = strings.ToLower(strings.TrimSpace(name))
+					}
+					continue
+				}
+			}
+
+			var row BulkRow
+			for i, value := range record {
+				if i >= len(columns) {
+					break
+				}
+				value = strings.TrimSpace(value)
+				switch columns[i] {
+				case "username":
+					row.Username = value
+				case "email":
+					row.Email = value
+				case "domain":
+					row.Domain = value
+				case "package", "package_name":
+					row.Package = value
+				case "package_id":
+					row.PackageID, _ = strconv.ParseInt(value, 10, 64)
+				case "password":
+					row.Password = value
+				}
+			}
+			rows = append(rows, row)
+		}
+	} else {
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(trimmed, &rows); err != nil {
+				return nil, fmt.Errorf("invalid JSON: %w", err)
+			}
+		} else {
+			var body struct {
+				Accounts []BulkRow `json:"accounts"`
+			}
+			if err := json.Unmarshal(trimmed, &body); err != nil {
+				return nil, fmt.Errorf("invalid JSON: %w", err)
+			}
+			rows = body.Accounts
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrBulkEmpty
+	}
+	if len(rows) > MaxBulkRows {
+		return nil, ErrBulkTooLarge
+	}
+	return rows, nil
+}
+
+// ValidateBulkRows checks every row the way CreateAccount would before
+// anything is provisioned, including duplicates within the batch. Packages
+// are looked up by ID or name; resellers may only use their own packages.
+// Returns one request per row, or the rejected rows.
+func (s *Service) ValidateBulkRows(rows []BulkRow, parentID int64) ([]CreateAccountRequest, []BulkRowError) {
+	reqs := make([]CreateAccountRequest, len(rows))
+	var rowErrors []BulkRowError
+	usernames := map[string]int{}
+	domains := map[string]int{}
+
+	for i, row := range rows {
+		req := CreateAccountRequest{
+			Username: strings.ToLower(strings.TrimSpace(row.Username)),
+			Email:    strings.TrimSpace(row.Email),
+			Domain:   strings.ToLower(strings.TrimSpace(row.Domain)),
+			Password: row.Password,
+			ParentID: parentID,
+		}
+
+		fail := func(format string, args ...interface{}) {
+			rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Username: req.Username, Error: fmt.Sprintf(format, args...)})
+		}
+
+		if err := s.ValidateUsername(req.Username); err != nil {
+			fail("%v", err)
+			continue
+		}
+		if err := s.ValidateDomain(req.Domain); err != nil {
+			fail("%v", err)
+			continue
+		}
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			fail("invalid email address")
+			continue
+		}
+		if prev, ok := usernames[req.Username]; ok {
+			fail("username repeats row %d", prev)
+			continue
+		}
+		usernames[req.Username] = i + 1
+		if prev, ok := domains[req.Domain]; ok {
+			fail("domain repeats row %d", prev)
+			continue
+		}
+		domains[req.Domain] = i + 1
+
+		var count int
+		s.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", req.Username).Scan(&count)
+		if count > 0 {
+			fail("%v", ErrUserExists)
+			continue
+		}
+		s.db.QueryRow("SELECT COUNT(*) FROM domains WHERE name = ?", req.Domain).Scan(&count)
+		if count > 0 {
+			fail("%v", ErrDomainExists)
+			continue
+		}
+
+		packageID, err := s.resolvePackage(row, parentID)
+		if err != nil {
+			fail("%v", err)
+			continue
+		}
+		req.PackageID = packageID
+		reqs[i] = req
+	}
+
+	if len(rowErrors) > 0 {
+		return nil, rowErrors
+	}
+	return reqs, nil
+}
+
+// resolvePackage finds a row's package by ID or name. Admin packages win
+// over reseller packages of the same name.
+func (s *Service) resolvePackage(row BulkRow, parentID int64) (int64, error) {
+	ref := strings.TrimSpace(row.Package)
+	id := row.PackageID
+	if id == 0 {
+		if n, err := strconv.ParseInt(ref, 10, 64); err == nil {
+			id = n
+		}
+	}
+	if id == 0 && ref == "" {
+		return 0, errors.New("package is required")
+	}
+
+	var packageID int64
+	err := s.db.QueryRow(`
+		SELECT id FROM packages
+		WHERE (id = ? OR (? = 0 AND name = ?)) AND (? = 0 OR owner_id = ?)
+		ORDER BY COALESCE(owner_id, 0) LIMIT 1
+	`, id, id, ref, parentID, parentID).Scan(&packageID)
+	if err != nil {
+		return 0, ErrPackageNotFound
+	}
+	return packageID, nil
+}
+
+// NewBulkOperation records a bulk operation with its items pending
+func (s *Service) NewBulkOperation(action string, actorID int64, items []BulkItem) (*BulkOperation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO bulk_operations (action, actor_id, status, total) VALUES (?, ?, ?, ?)
+	`, action, actorID, JobRunning, len(items))
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	for i := range items {
+		items[i].Row = i + 1
+		items[i].Status = StepPending
+		if _, err := tx.Exec(`
+			INSERT INTO bulk_operation_items (operation_id, row, account_id, username, status) VALUES (?, ?, ?, ?, ?)
+		`, id, items[i].Row, items[i].AccountID, items[i].Username, StepPending); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &BulkOperation{ID: id, Action: action, ActorID: actorID, Status: JobRunning, Total: len(items), Items: items}, nil
+}
+
+// RunBulk works through the items of a bulk operation. A few workers run
+// in parallel and at most bulk_rate_per_minute items are started per
+// minute, so provisioning does not starve the server. run performs one
+// item; its error is recorded as the item's result.
+func (s *Service) RunBulk(op *BulkOperation, run func(item *BulkItem) error) {
+	workers, interval := s.bulkLimits()
+	queue := make(chan *BulkItem)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				s.runBulkItem(op, item, run)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := range op.Items {
+		if i > 0 {
+			<-ticker.C
+		}
+		queue <- &op.Items[i]
+	}
+	close(queue)
+	wg.Wait()
+
+	status := JobCompleted
+	if op.Failed > 0 {
+		status = JobFailed
+	}
+	op.Status = status
+	s.db.Exec("UPDATE bulk_operations SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", status, op.ID)
+	log.Printf("📦 Bulk %s #%d finished: %d succeeded, %d failed", op.Action, op.ID, op.Succeeded, op.Failed)
+}
+
+func (s *Service) runBulkItem(op *BulkOperation, item *BulkItem, run func(item *BulkItem) error) {
+	s.setBulkItem(op, item, JobRunning, nil)
+	err := run(item)
+
+	op.mu.Lock()
+	status := StepDone
+	if err != nil {
+		status = StepFailed
+		op.Failed++
+	} else {
+		op.Succeeded++
+	}
+	op.mu.Unlock()
+	s.setBulkItem(op, item, status, err)
+
+	if err != nil {
+		s.report("❌ [%d/%d] %s: %v", item.Row, op.Total, item.Username, err)
+	} else {
+		s.report("✅ [%d/%d] %s", item.Row, op.Total, item.Username)
+	}
+}
+
+func (s *Service) setBulkItem(op *BulkOperation, item *BulkItem, status string, runErr error) {
+	item.Status = status
+	if runErr != nil {
+		item.Error = runErr.Error()
+	}
+	if _, err := s.db.Exec(`
+		UPDATE bulk_operation_items SET status = ?, error = ?, account_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE operation_id = ? AND row = ?
+	`, status, item.Error, item.AccountID, op.ID, item.Row); err != nil {
+		log.Printf("Warning: failed to update bulk operation #%d row %d: %v", op.ID, item.Row, err)
+	}
+	switch status {
+	case StepDone:
+		s.db.Exec("UPDATE bulk_operations SET succeeded = succeeded + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?", op.ID)
+	case StepFailed:
+		s.db.Exec("UPDATE bulk_operations SET failed = failed + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?", op.ID)
+	}
+}
+
+// bulkLimits returns the worker count and the delay between item starts
+// from the bulk_workers and bulk_rate_per_minute server settings
+func (s *Service) bulkLimits() (int, time.Duration) {
+	workers, rate := defaultBulkWorkers, defaultBulkRatePerMin
+	var value string
+	if s.db.QueryRow("SELECT value FROM server_settings WHERE key = 'bulk_workers'").Scan(&value) == nil {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			workers = n
+		}
+	}
+	if s.db.QueryRow("SELECT value FROM server_settings WHERE key = 'bulk_rate_per_minute'").Scan(&value) == nil {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			rate = n
+		}
+	}
+	if workers > maxBulkWorkers {
+		workers = maxBulkWorkers
+	}
+	return workers, time.Minute / time.Duration(rate)
+}
+
+// GetBulkOperation returns a bulk operation with its per-row results.
+// actorID limits the lookup to operations started by that user (0: any).
+func (s *Service) GetBulkOperation(id, actorID int64) (*BulkOperation, error) {
+	op := &BulkOperation{}
+	err := s.db.QueryRow(`
+		SELECT id, action, actor_id, status, total, succeeded, failed, created_at, updated_at
+		FROM bulk_operations WHERE id = ? AND (? = 0 OR actor_id = ?)
+	`, id, actorID, actorID).Scan(&op.ID, &op.Action, &op.ActorID, &op.Status, &op.Total,
+		&op.Succeeded, &op.Failed, &op.CreatedAt, &op.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrBulkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT row, COALESCE(account_id, 0), username, status, COALESCE(error, ''), updated_at
+		FROM bulk_operation_items WHERE operation_id = ? ORDER BY row
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item BulkItem
+		if err := rows.Scan(&item.Row, &item.AccountID, &item.Username, &item.Status, &item.Error, &item.UpdatedAt); err != nil {
+			continue
+		}
+		op.Items = append(op.Items, item)
+	}
+	return op, nil
+}
+
+// ListBulkOperations returns the most recent bulk operations without their
+// items. actorID limits the list to operations started by that user (0: all).
+func (s *Service) ListBulkOperations(actorID int64, limit int) ([]*BulkOperation, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`
+		SELECT id, action, actor_id, status, total, succeeded, failed, created_at, updated_at
+		FROM bulk_operations WHERE ? = 0 OR actor_id = ?
+		ORDER BY id DESC LIMIT ?
+	`, actorID, actorID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ops := []*BulkOperation{}
+	for rows.Next() {
+		op := &BulkOperation{}
+		if err := rows.Scan(&op.ID, &op.Action, &op.ActorID, &op.Status, &op.Total,
+			&op.Succeeded, &op.Failed, &op.CreatedAt, &op.UpdatedAt); err != nil {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// MarkInterruptedBulkOperations fails the unfinished rows of bulk operations
+// left running by a previous process. Called once at startup; rows whose
+// provisioning job was cut short show up in the journal as well.
+func (s *Service) MarkInterruptedBulkOperations() {
+	result, err := s.db.Exec(`
+		UPDATE bulk_operation_items SET status = ?, error = 'interrupted by panel restart', updated_at = CURRENT_TIMESTAMP
+		WHERE status IN (?, ?) AND operation_id IN (SELECT id FROM bulk_operations WHERE status = ?)
+	`, StepFailed, StepPending, JobRunning, JobRunning)
+	if err != nil {
+		return
+	}
+	s.db.Exec(`
+		UPDATE bulk_operations SET status = ?, updated_at = CURRENT_TIMESTAMP,
+			succeeded = (SELECT COUNT(*) FROM bulk_operation_items WHERE operation_id = bulk_operations.id AND status = ?),
+			failed = (SELECT COUNT(*) FROM bulk_operation_items WHERE operation_id = bulk_operations.id AND status = ?)
+		WHERE status = ?
+	`, JobFailed, StepDone, StepFailed, JobRunning)
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("⚠️ %d bulk operation row(s) were interrupted", n)
+	}
+}
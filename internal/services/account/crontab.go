@@ -0,0 +1,105 @@
+package account
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// crontabEntries returns the account's active cron jobs as crontab lines
+func (s *Service) crontabEntries(userID int64) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT schedule, command FROM cron_jobs
+		WHERE user_id = ? AND active = 1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []string
+	for rows.Next() {
+		var schedule, command string
+		if err := rows.Scan(&schedule, &command); err != nil {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s %s", schedule, command))
+	}
+	return entries, nil
+}
+
+// renderCrontab builds the managed crontab file for a user
+func renderCrontab(username string, entries []string) string {
+	var content strings.Builder
+	content.WriteString("# ServerPanel managed crontab - DO NOT EDIT MANUALLY\n")
+	content.WriteString("# Changes will be overwritten by the panel\n")
+	content.WriteString(fmt.Sprintf("# User: %s\n\n", username))
+
+	// Add environment variables
+	content.WriteString(fmt.Sprintf("HOME=/home/%s\n", username))
+	content.WriteString("SHELL=/bin/bash\n")
+	content.WriteString("PATH=/usr/local/bin:/usr/bin:/bin\n\n")
+
+	for _, entry := range entries {
+		content.WriteString(entry + "\n")
+	}
+	return content.String()
+}
+
+// crontabJobLines returns the job lines of a crontab file, skipping comments
+// and environment assignments
+func crontabJobLines(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, "="); i > 0 && !strings.ContainsAny(line[:i], " \t") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// SyncCrontab writes the user's crontab from the active cron jobs in the DB.
+// Suspended accounts are left alone; unsuspend puts their crontab back.
+func (s *Service) SyncCrontab(userID int64, username string) error {
+	if s.IsSuspended(userID) {
+		return nil
+	}
+
+	entries, err := s.crontabEntries(userID)
+	if err != nil {
+		return err
+	}
+
+	// Ensure directory exists
+	os.MkdirAll(crontabDir, 0755)
+
+	// Write to temp file first
+	cronFile := filepath.Join(crontabDir, username)
+	tempFile := cronFile + ".tmp"
+	if err := os.WriteFile(tempFile, []byte(renderCrontab(username, entries)), 0600); err != nil {
+		return err
+	}
+
+	// Set proper ownership (crontab files need specific permissions)
+	exec.Command("chown", fmt.Sprintf("%s:crontab", username), tempFile).Run()
+	exec.Command("chmod", "600", tempFile).Run()
+
+	// Move to final location
+	if err := os.Rename(tempFile, cronFile); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+
+	// Reload cron daemon to pick up changes
+	exec.Command("systemctl", "reload", "cron").Run()
+
+	return nil
+}
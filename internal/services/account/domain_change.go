@@ -0,0 +1,478 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+	"github.com/asergenalkan/serverpanel/internal/services/dns"
+	"github.com/asergenalkan/serverpanel/internal/services/ssl"
+	"github.com/asergenalkan/serverpanel/internal/webserver"
+)
+
+var ErrSameDomain = errors.New("new domain is the same as the current one")
+
+const (
+	postfixVirtual  = "/etc/postfix/virtual"
+	postfixVdomains = "/etc/postfix/vdomains"
+	mailVhostsDir   = "/var/mail/vhosts"
+)
+
+// domainChangeParams are the journaled inputs of a primary domain change
+type domainChangeParams struct {
+	UserID     int64    `json:"user_id"`
+	Username   string   `json:"username"`
+	DomainID   int64    `json:"domain_id"`
+	OldDomain  string   `json:"old_domain"`
+	NewDomain  string   `json:"new_domain"`
+	Subdomains []string `json:"subdomains"` // old full names
+	Emails     []string `json:"emails"`     // old addresses
+	Forwarders []string `json:"forwarders"` // old source addresses
+}
+
+// StartDomainChange checks that an account's primary domain can be changed
+// and journals the change. RunJob carries it out.
+func (s *Service) StartDomainChange(userID int64, newDomain string) (*Job, error) {
+	newDomain = strings.ToLower(strings.TrimSpace(newDomain))
+	if err := s.ValidateDomain(newDomain); err != nil {
+		return nil, err
+	}
+
+	p := domainChangeParams{UserID: userID, NewDomain: newDomain}
+	err := s.db.QueryRow("SELECT username FROM users WHERE id = ? AND role = 'user'", userID).Scan(&p.Username)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.QueryRow(`
+		SELECT id, name FROM domains
+		WHERE user_id = ? AND COALESCE(domain_type, 'primary') = 'primary'
+		ORDER BY id LIMIT 1
+	`, userID).Scan(&p.DomainID, &p.OldDomain)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if newDomain == p.OldDomain {
+		return nil, ErrSameDomain
+	}
+	if err := s.checkChangeable(userID); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := s.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM domains WHERE name = ?) + (SELECT COUNT(*) FROM subdomains WHERE full_name = ?)
+	`, newDomain, newDomain).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrDomainExists
+	}
+
+	p.Subdomains = s.domainLogins("SELECT full_name FROM subdomains WHERE domain_id = ?", p.DomainID)
+	p.Emails = s.domainLogins("SELECT email FROM email_accounts WHERE domain_id = ?", p.DomainID)
+	p.Forwarders = s.domainLogins("SELECT source FROM email_forwarders WHERE domain_id = ?", p.DomainID)
+	for _, sub := range p.Subdomains {
+		s.db.QueryRow("SELECT COUNT(*) FROM domains WHERE name = ?", replaceDomain(sub, p.OldDomain, newDomain)).Scan(&count)
+		if count > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrDomainExists, replaceDomain(sub, p.OldDomain, newDomain))
+		}
+	}
+
+	return s.newJob(JobChangeDomain, p.Username, userID, p)
+}
+
+func (s *Service) domainLogins(query string, domainID int64) []string {
+	var names []string
+	rows, err := s.db.Query(query, domainID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// domainChangeSteps lists the side effects of a primary domain change. DNS,
+// DKIM and certificates stay optional as on account creation; a new
+// certificate usually needs the DNS change to propagate first, so the ssl
+// step can be resumed later.
+func (s *Service) domainChangeSteps(p *domainChangeParams) []step {
+	rename := func(name string) string { return replaceDomain(name, p.OldDomain, p.NewDomain) }
+
+	return []step{
+		{
+			name: "database",
+			run:  func() error { return s.changeDomainRows(p) },
+		},
+		{
+			name: "vhosts",
+			run: func() error {
+				a, err := s.loadArtifacts(p.UserID)
+				if err != nil {
+					return err
+				}
+				var errs []string
+				s.rebuildVhosts(a, func(kind, name string, err error) {
+					if err != nil {
+						errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+					}
+				})
+
+				// Redirect subdomains are not regenerated, so their config
+				// moves with the rename
+				redirects := make(map[string]bool)
+				for _, site := range a.sites {
+					redirects[site.name] = site.redirect
+				}
+				driver := s.webServerDriver()
+				for _, name := range append([]string{p.OldDomain}, p.Subdomains...) {
+					if redirects[rename(name)] {
+						if err := s.rewriteVhost(name, rename(name), rename); err != nil {
+							errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+						}
+						continue
+					}
+					if _, err := os.Stat(filepath.Join(driver.GetConfigPath(), name+".conf")); os.IsNotExist(err) {
+						continue
+					}
+					if err := driver.DeleteVhost(name); err != nil {
+						errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+					}
+				}
+				if len(errs) > 0 {
+					return errors.New(strings.Join(errs, "; "))
+				}
+				return nil
+			},
+		},
+		{
+			name:     "webmail_vhost",
+			optional: true,
+			run: func() error {
+				if apacheDriver, ok := s.webServerDriver().(*webserver.ApacheDriver); ok {
+					if err := apacheDriver.DeleteWebmailVhost(p.OldDomain); err != nil {
+						return err
+					}
+				}
+				return s.createWebmailVhost(p.NewDomain)
+			},
+		},
+		{
+			name:     "dns_zone",
+			optional: true,
+			run: func() error {
+				manager := dns.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath)
+				records, err := s.zoneRecords(p.NewDomain)
+				if err != nil {
+					return err
+				}
+				if len(records) == 0 {
+					err = s.createDNSZone(p.NewDomain)
+				} else if err = manager.WriteZone(p.NewDomain, records); err == nil {
+					err = manager.EnsureZoneEntry(p.NewDomain)
+				}
+				if err != nil {
+					return err
+				}
+				if err := manager.RemoveZoneEntry(p.OldDomain); err != nil {
+					return err
+				}
+				return manager.DeleteZone(p.OldDomain)
+			},
+		},
+		{
+			name: "mail",
+			run:  func() error { return s.changeMailDomain(p) },
+		},
+		{
+			// Shared DKIM tables, the old domain's entries are left
+			name:     "dkim",
+			optional: true,
+			run:      func() error { return s.setupMailForDomain(p.NewDomain) },
+		},
+		{
+			name:     "ssl",
+			optional: true,
+			run:      func() error { return s.changeSSLDomain(p) },
+		},
+	}
+}
+
+// changeDomainRows renames the domain and everything addressed under it in
+// one transaction
+func (s *Service) changeDomainRows(p *domainChangeParams) error {
+	var current string
+	if err := s.db.QueryRow("SELECT name FROM domains WHERE id = ?", p.DomainID).Scan(&current); err != nil {
+		return err
+	}
+	if current == p.NewDomain {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE domains SET name = ? WHERE id = ?", p.NewDomain, p.DomainID); err != nil {
+		return err
+	}
+
+	for _, t := range []struct{ table, columns string }{
+		{"subdomains", "full_name"},
+		{"email_accounts", "email"},
+		{"email_forwarders", "source, destination"},
+		{"email_autoresponders", "email"},
+		{"email_settings", "catch_all_email"},
+		{"dns_records", "name, content"},
+	} {
+		if err := rewriteDomainColumns(tx, t.table, t.columns, p); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// rewriteDomainColumns applies replaceDomain to text columns of the rows
+// that belong to the domain
+func rewriteDomainColumns(tx *sql.Tx, table, columns string, p *domainChangeParams) error {
+	names := strings.Split(columns, ", ")
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, %s FROM %s WHERE domain_id = ?", strings.Join(coalesced(names), ", "), table), p.DomainID)
+	if err != nil {
+		return err
+	}
+	type row struct {
+		id     int64
+		values []string
+	}
+	var changed []row
+	for rows.Next() {
+		r := row{values: make([]string, len(names))}
+		dest := []interface{}{&r.id}
+		for i := range r.values {
+			dest = append(dest, &r.values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return err
+		}
+		dirty := false
+		for i, v := range r.values {
+			r.values[i] = replaceDomain(v, p.OldDomain, p.NewDomain)
+			dirty = dirty || r.values[i] != v
+		}
+		if dirty {
+			changed = append(changed, r)
+		}
+	}
+	rows.Close()
+
+	var sets []string
+	for _, name := range names {
+		sets = append(sets, name+" = ?")
+	}
+	for _, r := range changed {
+		args := []interface{}{}
+		for _, v := range r.values {
+			args = append(args, v)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", table, strings.Join(sets, ", ")), append(args, r.id)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func coalesced(columns []string) []string {
+	out := make([]string, len(columns))
+	for i, c := range columns {
+		out[i] = fmt.Sprintf("COALESCE(%s, '')", c)
+	}
+	return out
+}
+
+// changeMailDomain moves the domain's mailboxes, aliases and maildirs to
+// the new domain. Passwords are kept.
+func (s *Service) changeMailDomain(p *domainChangeParams) error {
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] Mail maps moved: %s -> %s", p.OldDomain, p.NewDomain)
+		return nil
+	}
+
+	rename := func(line string) string { return replaceDomain(line, p.OldDomain, p.NewDomain) }
+	for _, file := range []struct {
+		path, sep string
+		keys      []string
+	}{
+		{postfixVmailbox, " ", p.Emails},
+		{postfixVirtual, " ", append(append([]string{}, p.Forwarders...), "@"+p.OldDomain)},
+		{dovecotUsersFile, ":", p.Emails},
+	} {
+		cut, err := cutLines(file.path, file.keys, file.sep)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.path, err)
+		}
+		if len(cut) == 0 {
+			continue
+		}
+		var lines []string
+		for _, line := range cut {
+			if file.sep == ":" {
+				// Only the address; the rest is the password hash
+				key, rest, _ := strings.Cut(line, ":")
+				lines = append(lines, rename(key)+":"+rest)
+				continue
+			}
+			lines = append(lines, rename(line))
+		}
+		if err := restoreLines(file.path, lines, file.sep); err != nil {
+			return fmt.Errorf("%s: %w", file.path, err)
+		}
+	}
+
+	if err := replaceVdomain(p.OldDomain, p.NewDomain); err != nil {
+		return err
+	}
+
+	oldDir := filepath.Join(mailVhostsDir, p.OldDomain)
+	newDir := filepath.Join(mailVhostsDir, p.NewDomain)
+	if _, err := os.Stat(oldDir); err == nil {
+		if err := moveDir(oldDir, newDir); err != nil {
+			return err
+		}
+	}
+
+	for _, email := range p.Emails {
+		exec.Command("doveadm", "kick", email).Run()
+	}
+	exec.Command("chown", "root:dovecot", dovecotUsersFile).Run()
+	for _, path := range []string{postfixVmailbox, postfixVirtual, postfixVdomains} {
+		exec.Command("postmap", path).Run()
+	}
+	exec.Command("postfix", "reload").Run()
+	exec.Command("doveadm", "reload").Run()
+
+	log.Printf("✅ Mail moved: %s -> %s", p.OldDomain, p.NewDomain)
+	return nil
+}
+
+// replaceVdomain swaps the domain's line in the Postfix virtual domains map
+func replaceVdomain(oldDomain, newDomain string) error {
+	content, err := os.ReadFile(postfixVdomains)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	found := false
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == oldDomain {
+			continue
+		}
+		found = found || (len(fields) > 0 && fields[0] == newDomain)
+		lines = append(lines, line)
+	}
+	if !found {
+		lines = append(lines, newDomain+" OK")
+	}
+	return os.WriteFile(postfixVdomains, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// changeSSLDomain issues certificates for the renamed sites that had one
+// and moves their SSL vhosts. Until it succeeds the old SSL vhosts keep
+// serving the old names.
+func (s *Service) changeSSLDomain(p *domainChangeParams) error {
+	driver := s.webServerDriver()
+	manager := ssl.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath)
+
+	var email string
+	s.db.QueryRow("SELECT email FROM users WHERE id = ?", p.UserID).Scan(&email)
+	documentRoots := make(map[string]string)
+	if a, err := s.loadArtifacts(p.UserID); err == nil {
+		for _, site := range a.sites {
+			documentRoots[site.name] = site.documentRoot
+		}
+	}
+
+	var errs []string
+	for i, oldName := range append([]string{p.OldDomain}, p.Subdomains...) {
+		if _, err := os.Stat(filepath.Join(driver.GetConfigPath(), oldName+"-ssl.conf")); os.IsNotExist(err) {
+			continue
+		}
+		newName := replaceDomain(oldName, p.OldDomain, p.NewDomain)
+		cert := ssl.CertConfig{Domain: newName, WebRoot: documentRoots[newName], Email: email}
+		if i == 0 {
+			cert.Aliases = []string{"www." + newName}
+		}
+		if _, err := manager.IssueCertificate(cert); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", newName, err))
+			continue
+		}
+
+		// The config also points at the old certificate paths, which the
+		// rewrite moves to the new certificate
+		if err := s.rewriteVhost(oldName+"-ssl", newName+"-ssl", func(content string) string {
+			return replaceDomain(content, p.OldDomain, p.NewDomain)
+		}); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", newName, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// replaceDomain replaces oldDomain in s wherever it is the whole name or the
+// parent of one (www.example.com, user@example.com, example.com.) but not
+// part of a longer name such as myexample.com or example.com.tr
+func replaceDomain(s, oldDomain, newDomain string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, oldDomain)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(oldDomain)
+		before := i == 0 || !isDomainChar(s[i-1])
+		// A trailing hyphen is taken as a file name suffix (example.com-ssl.conf)
+		after := end == len(s) || s[end] == '-' ||
+			!isDomainChar(s[end]) && !(s[end] == '.' && end+1 < len(s) && isDomainChar(s[end+1]))
+		b.WriteString(s[:i])
+		if before && after {
+			b.WriteString(newDomain)
+		} else {
+			b.WriteString(s[i:end])
+		}
+		s = s[end:]
+	}
+}
+
+func isDomainChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
@@ -0,0 +1,220 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/services/quota"
+)
+
+// Inode usage levels
+const (
+	InodesOK       = ""
+	InodesWarning  = "warning"  // at inodeWarnPercent of the limit
+	InodesExceeded = "exceeded" // at the limit, no new files
+)
+
+const inodeWarnPercent = 90
+
+var (
+	ErrInodeLimitReached = errors.New("inode limit reached, delete unused files (e.g. cache directories) first")
+	ErrInvalidPath       = errors.New("path is outside the home directory")
+)
+
+// InodeUsage is the number of files and directories an account holds
+// against its package's max_inodes
+type InodeUsage struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Used      int64  `json:"used"`
+	MaxInodes int64  `json:"max_inodes"` // 0 means unlimited
+	Level     string `json:"level,omitempty"`
+	CheckedAt string `json:"checked_at,omitempty"`
+}
+
+// InodeReport is an account's inode usage with the breakdown of one
+// directory of its home
+type InodeReport struct {
+	InodeUsage
+	Path        string            `json:"path"`
+	Total       int64             `json:"total"`
+	Directories []quota.DirInodes `json:"directories"`
+}
+
+// inodeLevel returns the usage level of used against max
+func inodeLevel(used, max int64) string {
+	switch {
+	case max <= 0:
+		return InodesOK
+	case used >= max:
+		return InodesExceeded
+	case used*100 >= max*inodeWarnPercent:
+		return InodesWarning
+	}
+	return InodesOK
+}
+
+// GetInodeUsage counts an account's inodes now and stores the result
+func (s *Service) GetInodeUsage(userID int64) (*InodeUsage, error) {
+	u := &InodeUsage{UserID: userID}
+	err := s.db.QueryRow(`
+		SELECT u.username, COALESCE(p.max_inodes, 0)
+		FROM users u
+		LEFT JOIN user_packages up ON up.user_id = u.id
+		LEFT JOIN packages p ON p.id = up.package_id
+		WHERE u.id = ? AND u.role = 'user'
+	`, userID).Scan(&u.Username, &u.MaxInodes)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.quotaManager().GetUsage(u.Username)
+	if err == nil && usage.Files > 0 {
+		u.Used = usage.Files
+	} else if u.Used, err = s.quotaManager().CountInodes(u.Username); err != nil {
+		return nil, err
+	}
+	s.recordInodes(u)
+	return u, nil
+}
+
+// GetInodeReport returns an account's inode usage and the per-directory
+// counts of path (relative to its home, "/" for the home itself)
+func (s *Service) GetInodeReport(userID int64, path string) (*InodeReport, error) {
+	usage, err := s.GetInodeUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	home := filepath.Join(s.cfg.HomeBaseDir, usage.Username)
+	dir := filepath.Clean(filepath.Join(home, path))
+	if dir != home && !strings.HasPrefix(dir, home+string(filepath.Separator)) {
+		return nil, ErrInvalidPath
+	}
+
+	dirs, total, err := s.quotaManager().InodeBreakdown(dir)
+	if err != nil {
+		return nil, err
+	}
+	rel, _ := filepath.Rel(home, dir)
+	return &InodeReport{
+		InodeUsage:  *usage,
+		Path:        "/" + strings.TrimPrefix(filepath.ToSlash(rel), "."),
+		Total:       total,
+		Directories: dirs,
+	}, nil
+}
+
+// InodeLimitReached reports whether an account is at its inode limit and
+// may not create files. The hourly check marks accounts over the limit;
+// those are counted again here so deleting files lifts the block at once.
+func (s *Service) InodeLimitReached(userID int64) bool {
+	var level string
+	s.db.QueryRow("SELECT level FROM account_inodes WHERE user_id = ?", userID).Scan(&level)
+	if level != InodesExceeded {
+		return false
+	}
+	usage, err := s.GetInodeUsage(userID)
+	if err != nil {
+		return false
+	}
+	return usage.Level == InodesExceeded
+}
+
+// CheckInodeLimits counts the inodes of every account whose package has a
+// max_inodes and warns about those near or at the limit. Usage comes from
+// the quota files in one call; homes are walked only where quotas are off.
+// Returns the accounts at the warning level or above.
+func (s *Service) CheckInodeLimits() ([]InodeUsage, error) {
+	rows, err := s.db.Query(`
+		SELECT u.id, u.username, p.max_inodes
+		FROM users u
+		JOIN user_packages up ON up.user_id = u.id
+		JOIN packages p ON p.id = up.package_id
+		WHERE u.role = 'user' AND p.max_inodes > 0
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []InodeUsage
+	for rows.Next() {
+		var u InodeUsage
+		if rows.Scan(&u.UserID, &u.Username, &u.MaxInodes) == nil {
+			accounts = append(accounts, u)
+		}
+	}
+	rows.Close()
+
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+
+	report, err := s.quotaManager().Report()
+	if err != nil {
+		log.Printf("Warning: failed to read quotas, counting inodes by walking homes: %v", err)
+	}
+
+	var flagged []InodeUsage
+	for i := range accounts {
+		u := &accounts[i]
+		if usage, ok := report[u.Username]; ok && usage.Files > 0 {
+			u.Used = usage.Files
+		} else if u.Used, err = s.quotaManager().CountInodes(u.Username); err != nil {
+			continue
+		}
+		s.recordInodes(u)
+		if u.Level != InodesOK {
+			flagged = append(flagged, *u)
+		}
+	}
+	return flagged, nil
+}
+
+// recordInodes stores an account's count and logs a warning when its level
+// rises
+func (s *Service) recordInodes(u *InodeUsage) {
+	u.Level = inodeLevel(u.Used, u.MaxInodes)
+	u.CheckedAt = time.Now().Format("2006-01-02 15:04:05")
+
+	var previous string
+	s.db.QueryRow("SELECT level FROM account_inodes WHERE user_id = ?", u.UserID).Scan(&previous)
+	s.db.Exec(`
+		INSERT INTO account_inodes (user_id, used, max_inodes, level, checked_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET used = excluded.used, max_inodes = excluded.max_inodes,
+			level = excluded.level, checked_at = CURRENT_TIMESTAMP
+	`, u.UserID, u.Used, u.MaxInodes, u.Level)
+
+	if u.Level == previous || u.Level == InodesOK || (u.Level == InodesWarning && previous == InodesExceeded) {
+		return
+	}
+	details := fmt.Sprintf("Inode usage %d of %d (%s)", u.Used, u.MaxInodes, u.Level)
+	s.db.Exec("INSERT INTO activity_logs (user_id, action, details, ip_address) VALUES (?, ?, ?, '')",
+		u.UserID, "inode_"+u.Level, details)
+	log.Printf("⚠️ %s: %s", u.Username, details)
+}
+
+// StartInodeScheduler checks inode limits every hour
+func StartInodeScheduler(db DB) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			flagged, err := NewService(db).CheckInodeLimits()
+			if err != nil {
+				log.Printf("⚠️ Failed to check inode limits: %v", err)
+			} else if len(flagged) > 0 {
+				log.Printf("📏 %d account(s) near or at their inode limit", len(flagged))
+			}
+			<-ticker.C
+		}
+	}()
+}
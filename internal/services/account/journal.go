@@ -0,0 +1,449 @@
+package account
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Provisioning job actions
+const (
+	JobCreateAccount = "create_account"
+	JobDeleteAccount = "delete_account"
+	JobRenameAccount = "rename_account"
+	JobChangeDomain  = "change_domain"
+)
+
+// Provisioning job states
+const (
+	JobRunning    = "running"
+	JobCompleted  = "completed"
+	JobFailed     = "failed"
+	JobRolledBack = "rolled_back"
+)
+
+// Provisioning step states
+const (
+	StepPending    = "pending"
+	StepDone       = "done"
+	StepFailed     = "failed"
+	StepSkipped    = "skipped" // optional step that failed
+	StepRolledBack = "rolled_back"
+)
+
+var (
+	ErrJobNotFound        = errors.New("provisioning job not found")
+	ErrJobRunning         = errors.New("provisioning job is already running")
+	ErrJobNotResumable    = errors.New("provisioning job has no steps left to run")
+	ErrJobNotRollbackable = errors.New("only failed create jobs can be rolled back")
+	ErrJobPending         = errors.New("account has an unfinished rename or domain change, resume it first")
+)
+
+// JobError is returned when a required provisioning step fails. The job
+// stays in the journal so it can be resumed or rolled back.
+type JobError struct {
+	JobID int64
+	Step  string
+	Err   error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("%s step failed: %v", e.Step, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// Job is a journaled provisioning run
+type Job struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+	Steps     []JobStep `json:"steps,omitempty"`
+
+	params string // JSON inputs the steps are rebuilt from on resume
+}
+
+// JobStep is the journal entry of one step
+type JobStep struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Optional  bool   `json:"optional"`
+	Error     string `json:"error,omitempty"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// step is one side effect of a job. undo is nil when it cannot be reverted;
+// a failing optional step is recorded but does not stop the job.
+type step struct {
+	name     string
+	run      func() error
+	undo     func() error
+	optional bool
+}
+
+// newJob records a job before its first step runs
+func (s *Service) newJob(action, username string, userID int64, params interface{}) (*Job, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO provisioning_jobs (action, user_id, username, params, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, action, userID, username, string(paramsJSON), JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return &Job{ID: id, Action: action, UserID: userID, Username: username, Status: JobRunning, params: string(paramsJSON)}, nil
+}
+
+func (s *Service) setJobStatus(job *Job, status, errMsg string) {
+	job.Status = status
+	job.Error = errMsg
+	if _, err := s.db.Exec(`
+		UPDATE provisioning_jobs SET status = ?, error = ?, user_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, status, errMsg, job.UserID, job.ID); err != nil {
+		log.Printf("Warning: failed to update provisioning job #%d: %v", job.ID, err)
+	}
+}
+
+func (s *Service) setStepStatus(job *Job, seq int, st step, status, errMsg string) {
+	if _, err := s.db.Exec(`
+		INSERT INTO provisioning_steps (job_id, seq, name, optional, status, error, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(job_id, name) DO UPDATE SET status = excluded.status, error = excluded.error,
+			updated_at = CURRENT_TIMESTAMP
+	`, job.ID, seq, st.name, st.optional, status, errMsg); err != nil {
+		log.Printf("Warning: failed to journal step %s of job #%d: %v", st.name, job.ID, err)
+	}
+}
+
+func (s *Service) stepStates(jobID int64) map[string]string {
+	states := map[string]string{}
+	rows, err := s.db.Query("SELECT name, status FROM provisioning_steps WHERE job_id = ?", jobID)
+	if err != nil {
+		return states
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, status string
+		if rows.Scan(&name, &status) == nil {
+			states[name] = status
+		}
+	}
+	return states
+}
+
+// runJob runs every step that is not done yet, in order. When a required
+// step fails and rollback is set, the completed steps are undone.
+func (s *Service) runJob(job *Job, steps []step, rollback bool) error {
+	states := s.stepStates(job.ID)
+	for i, st := range steps {
+		if _, ok := states[st.name]; !ok {
+			s.setStepStatus(job, i, st, StepPending, "")
+		}
+	}
+
+	for i, st := range steps {
+		if states[st.name] == StepDone {
+			continue
+		}
+
+		s.report("▶️ [%d/%d] %s", i+1, len(steps), st.name)
+		err := st.run()
+		if err == nil {
+			s.setStepStatus(job, i, st, StepDone, "")
+			states[st.name] = StepDone
+			continue
+		}
+
+		if st.optional {
+			log.Printf("Warning: %s #%d: %s failed: %v", job.Action, job.ID, st.name, err)
+			s.report("⚠️ %s atlandı: %v", st.name, err)
+			s.setStepStatus(job, i, st, StepSkipped, err.Error())
+			continue
+		}
+
+		log.Printf("❌ %s #%d (%s): %s failed: %v", job.Action, job.ID, job.Username, st.name, err)
+		s.report("❌ %s başarısız: %v", st.name, err)
+		s.setStepStatus(job, i, st, StepFailed, err.Error())
+		jobErr := &JobError{JobID: job.ID, Step: st.name, Err: err}
+		if rollback {
+			s.rollbackJob(job, steps, jobErr.Error())
+		} else {
+			s.setJobStatus(job, JobFailed, jobErr.Error())
+		}
+		return jobErr
+	}
+
+	s.setJobStatus(job, JobCompleted, "")
+	return nil
+}
+
+// rollbackJob undoes the completed steps in reverse order. The job ends up
+// rolled_back, or failed when an undo action failed.
+func (s *Service) rollbackJob(job *Job, steps []step, cause string) error {
+	states := s.stepStates(job.ID)
+	var undoErr error
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		st := steps[i]
+		if states[st.name] != StepDone || st.undo == nil {
+			continue
+		}
+		if err := st.undo(); err != nil {
+			log.Printf("⚠️ %s #%d: undo %s failed: %v", job.Action, job.ID, st.name, err)
+			s.setStepStatus(job, i, st, StepDone, "undo failed: "+err.Error())
+			if undoErr == nil {
+				undoErr = fmt.Errorf("undo %s failed: %w", st.name, err)
+			}
+			continue
+		}
+		s.setStepStatus(job, i, st, StepRolledBack, "")
+	}
+
+	if undoErr != nil {
+		s.setJobStatus(job, JobFailed, cause+"; "+undoErr.Error())
+		return undoErr
+	}
+	s.setJobStatus(job, JobRolledBack, cause)
+	log.Printf("↩️ %s #%d (%s) rolled back", job.Action, job.ID, job.Username)
+	return nil
+}
+
+// jobSteps rebuilds the steps of a journaled job from its parameters
+func (s *Service) jobSteps(job *Job) ([]step, error) {
+	switch job.Action {
+	case JobCreateAccount:
+		var p createParams
+		if err := json.Unmarshal([]byte(job.params), &p); err != nil {
+			return nil, err
+		}
+		return s.createSteps(job, &p), nil
+	case JobDeleteAccount:
+		var p deleteParams
+		if err := json.Unmarshal([]byte(job.params), &p); err != nil {
+			return nil, err
+		}
+		return s.deleteSteps(&p), nil
+	case JobRenameAccount:
+		var p renameParams
+		if err := json.Unmarshal([]byte(job.params), &p); err != nil {
+			return nil, err
+		}
+		return s.renameSteps(&p), nil
+	case JobChangeDomain:
+		var p domainChangeParams
+		if err := json.Unmarshal([]byte(job.params), &p); err != nil {
+			return nil, err
+		}
+		return s.domainChangeSteps(&p), nil
+	}
+	return nil, fmt.Errorf("unknown provisioning action %q", job.Action)
+}
+
+// RunJob runs a job recorded by StartRename or StartDomainChange. These
+// jobs are not rolled back; a failed one is resumed.
+func (s *Service) RunJob(job *Job) error {
+	steps, err := s.jobSteps(job)
+	if err != nil {
+		s.setJobStatus(job, JobFailed, err.Error())
+		return err
+	}
+	return s.runJob(job, steps, false)
+}
+
+// checkNoPendingJob refuses to start a rename or domain change while an
+// earlier one for the account is running or waiting to be resumed, since
+// its journaled names would no longer match
+func (s *Service) checkNoPendingJob(userID int64) error {
+	var count int
+	s.db.QueryRow(`
+		SELECT COUNT(*) FROM provisioning_jobs
+		WHERE user_id = ? AND action IN (?, ?) AND status IN (?, ?)
+	`, userID, JobRenameAccount, JobChangeDomain, JobRunning, JobFailed).Scan(&count)
+	if count > 0 {
+		return ErrJobPending
+	}
+	return nil
+}
+
+// claimJob moves a job to running unless it is already running
+func (s *Service) claimJob(id int64, from ...string) (*Job, error) {
+	job, err := s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == JobRunning {
+		return nil, ErrJobRunning
+	}
+
+	allowed := false
+	for _, status := range from {
+		allowed = allowed || job.Status == status
+	}
+	if !allowed {
+		return nil, nil
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE provisioning_jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?
+	`, JobRunning, id, job.Status)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrJobRunning
+	}
+	job.Status = JobRunning
+	return job, nil
+}
+
+// ResumeJob runs the steps of a job that are not done: the failed step and
+// everything after it, optional steps that were skipped, or all steps of a
+// rolled back create
+func (s *Service) ResumeJob(id int64) (*Job, error) {
+	job, err := s.claimJob(id, JobFailed, JobRolledBack, JobCompleted)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotResumable
+	}
+
+	steps, err := s.jobSteps(job)
+	if err != nil {
+		s.setJobStatus(job, JobFailed, err.Error())
+		return nil, err
+	}
+
+	pending := false
+	states := s.stepStates(job.ID)
+	for _, st := range steps {
+		pending = pending || states[st.name] != StepDone
+	}
+	if !pending {
+		s.setJobStatus(job, JobCompleted, "")
+		return nil, ErrJobNotResumable
+	}
+
+	log.Printf("🔁 Resuming %s #%d (%s)", job.Action, job.ID, job.Username)
+	runErr := s.runJob(job, steps, job.Action == JobCreateAccount)
+	job, err = s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	return job, runErr
+}
+
+// RollbackJob undoes what a failed create job completed
+func (s *Service) RollbackJob(id int64) (*Job, error) {
+	job, err := s.claimJob(id, JobFailed)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || job.Action != JobCreateAccount {
+		if job != nil {
+			s.setJobStatus(job, JobFailed, job.Error)
+		}
+		return nil, ErrJobNotRollbackable
+	}
+
+	steps, err := s.jobSteps(job)
+	if err != nil {
+		s.setJobStatus(job, JobFailed, err.Error())
+		return nil, err
+	}
+
+	undoErr := s.rollbackJob(job, steps, job.Error)
+	job, err = s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	return job, undoErr
+}
+
+// GetJob returns a job with its steps
+func (s *Service) GetJob(id int64) (*Job, error) {
+	var job Job
+	err := s.db.QueryRow(`
+		SELECT id, action, COALESCE(user_id, 0), username, params, status, COALESCE(error, ''), created_at, updated_at
+		FROM provisioning_jobs WHERE id = ?
+	`, id).Scan(&job.ID, &job.Action, &job.UserID, &job.Username, &job.params, &job.Status, &job.Error,
+		&job.CreatedAt, &job.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT name, status, optional, COALESCE(error, ''), updated_at
+		FROM provisioning_steps WHERE job_id = ? ORDER BY seq
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st JobStep
+		if err := rows.Scan(&st.Name, &st.Status, &st.Optional, &st.Error, &st.UpdatedAt); err != nil {
+			continue
+		}
+		job.Steps = append(job.Steps, st)
+	}
+	return &job, nil
+}
+
+// ListJobs returns the most recent jobs, optionally filtered by status
+func (s *Service) ListJobs(status string, limit int) ([]Job, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`
+		SELECT id, action, COALESCE(user_id, 0), username, status, COALESCE(error, ''), created_at, updated_at
+		FROM provisioning_jobs WHERE ? = '' OR status = ?
+		ORDER BY id DESC LIMIT ?
+	`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var job Job
+		if err := rows.Scan(&job.ID, &job.Action, &job.UserID, &job.Username, &job.Status, &job.Error,
+			&job.CreatedAt, &job.UpdatedAt); err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// MarkInterruptedJobs fails jobs left running by a previous process so they
+// can be resumed. Called once at startup.
+func (s *Service) MarkInterruptedJobs() {
+	result, err := s.db.Exec(`
+		UPDATE provisioning_jobs SET status = ?, error = 'interrupted by panel restart', updated_at = CURRENT_TIMESTAMP
+		WHERE status = ?
+	`, JobFailed, JobRunning)
+	if err != nil {
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("⚠️ %d provisioning job(s) were interrupted and can be resumed", n)
+	}
+}
@@ -0,0 +1,327 @@
+package account
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+	"github.com/asergenalkan/serverpanel/internal/services/feature"
+	"github.com/asergenalkan/serverpanel/internal/services/quota"
+	"github.com/asergenalkan/serverpanel/internal/webserver"
+)
+
+var ErrSamePackage = errors.New("account is already on this package")
+
+const (
+	loginShell   = "/bin/bash"
+	noLoginShell = "/usr/sbin/nologin"
+)
+
+// Limited resources of a package
+const (
+	ResourceDomains   = "domains"
+	ResourceDatabases = "databases"
+	ResourceEmails    = "email_accounts"
+	ResourceFTP       = "ftp_accounts"
+	ResourceDisk      = "disk_mb"
+	ResourceInodes    = "inodes"
+)
+
+// OverLimit is a resource an account uses more of than its package allows.
+// Nothing is removed; the account cannot add more until it is back under
+// the limit.
+type OverLimit struct {
+	Resource string `json:"resource"`
+	Used     int64  `json:"used"`
+	Limit    int64  `json:"limit"`
+}
+
+// PackageReport is the result of applying a package's limits to an account
+type PackageReport struct {
+	UserID    int64             `json:"user_id"`
+	Username  string            `json:"username"`
+	Applied   []string          `json:"applied"`
+	Failed    map[string]string `json:"failed,omitempty"`
+	OverLimit []OverLimit       `json:"over_limit,omitempty"`
+}
+
+// ChangePackage moves an account to another hosting package and applies
+// the new package's limits
+func (s *Service) ChangePackage(userID, packageID int64) (*PackageReport, error) {
+	var username string
+	var current int64
+	err := s.db.QueryRow(`
+		SELECT u.username, COALESCE(up.package_id, 0)
+		FROM users u LEFT JOIN user_packages up ON up.user_id = u.id
+		WHERE u.id = ? AND u.role = 'user'
+	`, userID).Scan(&username, &current)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.IsTerminated(userID) {
+		return nil, ErrAccountTerminated
+	}
+
+	var packageName string
+	if err := s.db.QueryRow("SELECT name FROM packages WHERE id = ?", packageID).Scan(&packageName); err != nil {
+		return nil, ErrPackageNotFound
+	}
+	if current == packageID {
+		return nil, ErrSamePackage
+	}
+
+	if _, err := s.db.Exec(`
+		INSERT INTO user_packages (user_id, package_id) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET package_id = excluded.package_id
+	`, userID, packageID); err != nil {
+		return nil, err
+	}
+
+	report := s.applyPackageLimits(userID, username, packageID, nil)
+	s.reportOverLimits(report, packageID, s.quotaReport())
+
+	log.Printf("📦 Package changed: %s -> %s", username, packageName)
+	return report, nil
+}
+
+// quotaManager returns the disk quota manager for the home directories
+func (s *Service) quotaManager() *quota.Manager {
+	return quota.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, s.cfg.HomeBaseDir)
+}
+
+// applyDiskQuota sets the account's filesystem quota (disk space and
+// inodes) from its package
+func (s *Service) applyDiskQuota(username string, packageID int64) error {
+	var diskQuota, maxInodes int64
+	if err := s.db.QueryRow("SELECT disk_quota, COALESCE(max_inodes, 0) FROM packages WHERE id = ?", packageID).Scan(&diskQuota, &maxInodes); err != nil {
+		return ErrPackageNotFound
+	}
+	return s.quotaManager().SetQuota(username, diskQuota, maxInodes)
+}
+
+// applyMailLimits sets the hourly and daily send limits of the account's
+// domains (email_settings) to the package's, so a raised package limit is
+// not held back by an older domain setting. The Postfix policy daemon
+// (cmd/policy-daemon) enforces the lower of the package and domain limits
+// on every message, so no configuration has to be rewritten.
+func (s *Service) applyMailLimits(userID, packageID int64) error {
+	var hourly, daily int64
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(max_emails_per_hour, 100), COALESCE(max_emails_per_day, 500) FROM packages WHERE id = ?
+	`, packageID).Scan(&hourly, &daily); err != nil {
+		return ErrPackageNotFound
+	}
+	_, err := s.db.Exec(`
+		UPDATE email_settings SET hourly_limit = ?, daily_limit = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE domain_id IN (SELECT id FROM domains WHERE user_id = ?)
+	`, hourly, daily, userID)
+	return err
+}
+
+// applyShell gives the account a login shell when its package includes
+// SSH and nologin otherwise. A suspended account keeps nologin; the shell
+// it gets back when unsuspended is changed instead.
+func (s *Service) applyShell(userID int64, username string, packageID int64) error {
+	var features sql.NullString
+	if err := s.db.QueryRow("SELECT features FROM packages WHERE id = ?", packageID).Scan(&features); err != nil {
+		return ErrPackageNotFound
+	}
+	shell := noLoginShell
+	if !features.Valid || feature.Has(feature.Parse(features.String), feature.SSH) {
+		shell = loginShell
+	}
+
+	var stateJSON string
+	if s.db.QueryRow("SELECT state FROM account_suspensions WHERE user_id = ?", userID).Scan(&stateJSON) == nil {
+		var state SuspendState
+		if json.Unmarshal([]byte(stateJSON), &state) == nil && state.ShellLocked {
+			state.Shell = shell
+			return s.saveSuspendState(userID, &state)
+		}
+		return nil
+	}
+
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] usermod -s %s %s", shell, username)
+		return nil
+	}
+	if !s.cfg.IsLinux {
+		return nil
+	}
+	if output, err := exec.Command("usermod", "-s", shell, username).CombinedOutput(); err != nil {
+		return fmt.Errorf("usermod failed: %s - %w", strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
+
+// limitBatch collects the PHP-FPM reloads of many accounts' limit
+// changes so that each PHP version is reloaded once
+type limitBatch struct {
+	phpVersions map[string]bool
+}
+
+// applyPackageLimits applies a package's disk quota, shell access and PHP
+// limits to an account. Like the optional steps of account creation, a
+// failing step (e.g. a filesystem without quota support) does not block
+// the others.
+func (s *Service) applyPackageLimits(userID int64, username string, packageID int64, batch *limitBatch) *PackageReport {
+	report := &PackageReport{UserID: userID, Username: username, Applied: []string{}}
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"disk_quota", func() error { return s.applyDiskQuota(username, packageID) }},
+		{"shell", func() error { return s.applyShell(userID, username, packageID) }},
+		{"php", func() error { return s.applyPHPLimits(userID, username, packageID, batch) }},
+		{"mail_limits", func() error { return s.applyMailLimits(userID, packageID) }},
+	}
+	for _, st := range steps {
+		if err := st.run(); err != nil {
+			log.Printf("⚠️ %s not applied for %s: %v", st.name, username, err)
+			if report.Failed == nil {
+				report.Failed = map[string]string{}
+			}
+			report.Failed[st.name] = err.Error()
+			continue
+		}
+		report.Applied = append(report.Applied, st.name)
+	}
+	return report
+}
+
+// quotaReport reads the quota usage of all accounts in one repquota pass.
+// It is nil when quotas cannot be read; disk and inodes are then not
+// compared.
+func (s *Service) quotaReport() map[string]quota.Usage {
+	usage, err := s.quotaManager().Report()
+	if err != nil {
+		log.Printf("⚠️ Quota usage not read: %v", err)
+		return nil
+	}
+	return usage
+}
+
+// reportOverLimits adds the resources an account uses above its package's
+// limits to its report and records them in the activity log
+func (s *Service) reportOverLimits(report *PackageReport, packageID int64, usage map[string]quota.Usage) {
+	report.OverLimit = s.overLimits(report.UserID, report.Username, packageID, usage)
+	if len(report.OverLimit) == 0 {
+		return
+	}
+	var parts []string
+	for _, o := range report.OverLimit {
+		parts = append(parts, fmt.Sprintf("%s %d/%d", o.Resource, o.Used, o.Limit))
+	}
+	details := "Over package limits: " + strings.Join(parts, ", ")
+	s.db.Exec("INSERT INTO activity_logs (user_id, action, details, ip_address) VALUES (?, ?, ?, '')",
+		report.UserID, "package_over_limit", details)
+	log.Printf("⚠️ %s: %s", report.Username, details)
+}
+
+// overLimits compares an account's usage with its package's limits
+func (s *Service) overLimits(userID int64, username string, packageID int64, usage map[string]quota.Usage) []OverLimit {
+	var maxDomains, maxDatabases, maxEmails, maxFTP int64
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(max_domains, 1), COALESCE(max_databases, 1), COALESCE(max_emails, 5), COALESCE(max_ftp, 1)
+		FROM packages WHERE id = ?
+	`, packageID).Scan(&maxDomains, &maxDatabases, &maxEmails, &maxFTP); err != nil {
+		return nil
+	}
+
+	counts := []struct {
+		resource string
+		table    string
+		limit    int64
+	}{
+		{ResourceDomains, "domains", maxDomains},
+		{ResourceDatabases, "databases", maxDatabases},
+		{ResourceEmails, "email_accounts", maxEmails},
+		{ResourceFTP, "ftp_accounts", maxFTP},
+	}
+	var over []OverLimit
+	for _, c := range counts {
+		var used int64
+		s.db.QueryRow("SELECT COUNT(*) FROM "+c.table+" WHERE user_id = ?", userID).Scan(&used)
+		if used > c.limit {
+			over = append(over, OverLimit{Resource: c.resource, Used: used, Limit: c.limit})
+		}
+	}
+
+	// Disk and inode limits of 0 are unlimited
+	if usage, ok := usage[username]; ok {
+		if usage.LimitMB > 0 && usage.UsedMB > usage.LimitMB {
+			over = append(over, OverLimit{Resource: ResourceDisk, Used: usage.UsedMB, Limit: usage.LimitMB})
+		}
+		if usage.MaxFiles > 0 && usage.Files > usage.MaxFiles {
+			over = append(over, OverLimit{Resource: ResourceInodes, Used: usage.Files, Limit: usage.MaxFiles})
+		}
+	}
+	return over
+}
+
+// ApplyPackageLimits re-applies the limits of every account on a package
+// after the package was edited and returns a report per account. PHP-FPM
+// is reloaded and quota usage read once for all accounts; each account's
+// result is sent to the progress function.
+func (s *Service) ApplyPackageLimits(packageID int64) []PackageReport {
+	rows, err := s.db.Query(`
+		SELECT u.id, u.username FROM users u
+		JOIN user_packages up ON up.user_id = u.id
+		WHERE up.package_id = ? AND u.role = 'user'
+	`, packageID)
+	if err != nil {
+		return nil
+	}
+	type member struct {
+		id       int64
+		username string
+	}
+	var members []member
+	for rows.Next() {
+		var m member
+		if rows.Scan(&m.id, &m.username) == nil {
+			members = append(members, m)
+		}
+	}
+	rows.Close()
+
+	batch := &limitBatch{phpVersions: map[string]bool{}}
+	reports := []PackageReport{}
+	for _, m := range members {
+		reports = append(reports, *s.applyPackageLimits(m.id, m.username, packageID, batch))
+	}
+
+	for version := range batch.phpVersions {
+		if err := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, version).Reload(); err != nil {
+			log.Printf("⚠️ PHP-FPM %s not reloaded: %v", version, err)
+		}
+	}
+
+	usage := s.quotaReport()
+	for i := range reports {
+		r := &reports[i]
+		s.reportOverLimits(r, packageID, usage)
+		s.report("%s: %s", r.Username, r.summary())
+	}
+	return reports
+}
+
+// summary is a one-line description of a report for task logs
+func (r *PackageReport) summary() string {
+	parts := []string{"applied " + strings.Join(r.Applied, ", ")}
+	for name, err := range r.Failed {
+		parts = append(parts, fmt.Sprintf("%s failed (%s)", name, err))
+	}
+	for _, o := range r.OverLimit {
+		parts = append(parts, fmt.Sprintf("over %s %d/%d", o.Resource, o.Used, o.Limit))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,147 @@
+package account
+
+import (
+	"path/filepath"
+
+	"github.com/asergenalkan/serverpanel/internal/webserver"
+)
+
+// phpLimits are a package's upper bounds for PHP settings
+type phpLimits struct {
+	memory   string
+	upload   string
+	execTime int
+}
+
+// packagePHPLimits reads a package's PHP limits
+func (s *Service) packagePHPLimits(packageID int64) (phpLimits, error) {
+	var l phpLimits
+	err := s.db.QueryRow(`
+		SELECT COALESCE(max_php_memory, '256M'), COALESCE(max_php_upload, '64M'),
+		       COALESCE(max_php_execution_time, 300)
+		FROM packages WHERE id = ?
+	`, packageID).Scan(&l.memory, &l.upload, &l.execTime)
+	if err != nil {
+		return l, ErrPackageNotFound
+	}
+	return l, nil
+}
+
+// clamp lowers settings above the limits to the limits. post_max_size is
+// bounded by the upload limit like upload_max_filesize; unlimited sizes
+// (-1 or 0) count as above the limit.
+func (l phpLimits) clamp(settings webserver.PHPSettings) webserver.PHPSettings {
+	settings = settings.WithDefaults()
+	if l.memory != "" && !webserver.PHPSizeWithin(settings.MemoryLimit, l.memory) {
+		settings.MemoryLimit = l.memory
+	}
+	if l.upload != "" && !webserver.PHPSizeWithin(settings.UploadMaxFilesize, l.upload) {
+		settings.UploadMaxFilesize = l.upload
+	}
+	if l.upload != "" && !webserver.PHPSizeWithin(settings.PostMaxSize, l.upload) {
+		settings.PostMaxSize = l.upload
+	}
+	if l.execTime > 0 && settings.MaxExecutionTime > l.execTime {
+		settings.MaxExecutionTime = l.execTime
+	}
+	return settings
+}
+
+// phpPoolConfig builds an account's pool from its primary domain's PHP
+// settings, within the limits of its package
+func (s *Service) phpPoolConfig(username, homeDir string) webserver.PHPFPMConfig {
+	pool := webserver.PHPFPMConfig{
+		Username:   username,
+		HomeDir:    homeDir,
+		PHPVersion: s.cfg.PHPVersion,
+	}
+
+	var domainID, packageID int64
+	var phpVersion string
+	s.db.QueryRow(`
+		SELECT COALESCE(up.package_id, 0) FROM users u
+		LEFT JOIN user_packages up ON up.user_id = u.id
+		WHERE u.username = ?
+	`, username).Scan(&packageID)
+	err := s.db.QueryRow(`
+		SELECT d.id, COALESCE(d.php_version, '') FROM domains d
+		JOIN users u ON u.id = d.user_id
+		WHERE u.username = ?
+		ORDER BY d.domain_type = 'primary' DESC, d.id LIMIT 1
+	`, username).Scan(&domainID, &phpVersion)
+	if err == nil {
+		if phpVersion != "" {
+			pool.PHPVersion = phpVersion
+		}
+		s.db.QueryRow(`
+			SELECT memory_limit, max_execution_time, max_input_time, post_max_size,
+			       upload_max_filesize, max_file_uploads, display_errors, error_reporting
+			FROM php_settings WHERE domain_id = ?
+		`, domainID).Scan(&pool.Settings.MemoryLimit, &pool.Settings.MaxExecutionTime,
+			&pool.Settings.MaxInputTime, &pool.Settings.PostMaxSize, &pool.Settings.UploadMaxFilesize,
+			&pool.Settings.MaxFileUploads, &pool.Settings.DisplayErrors, &pool.Settings.ErrorReporting)
+	}
+
+	limits, err := s.packagePHPLimits(packageID)
+	if err != nil {
+		pool.Settings = pool.Settings.WithDefaults()
+		return pool
+	}
+	pool.Settings = limits.clamp(pool.Settings)
+	return pool
+}
+
+// applyPHPLimits brings the PHP settings of an account's domains within
+// its package's limits and rewrites its PHP-FPM pool with them. With a
+// batch, the PHP-FPM reload is left to the batch.
+func (s *Service) applyPHPLimits(userID int64, username string, packageID int64, batch *limitBatch) error {
+	limits, err := s.packagePHPLimits(packageID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT ps.domain_id, ps.memory_limit, ps.max_execution_time, ps.post_max_size, ps.upload_max_filesize
+		FROM php_settings ps JOIN domains d ON d.id = ps.domain_id
+		WHERE d.user_id = ?
+	`, userID)
+	if err != nil {
+		return err
+	}
+	type domainSettings struct {
+		domainID int64
+		settings webserver.PHPSettings
+	}
+	var domains []domainSettings
+	for rows.Next() {
+		var d domainSettings
+		if rows.Scan(&d.domainID, &d.settings.MemoryLimit, &d.settings.MaxExecutionTime,
+			&d.settings.PostMaxSize, &d.settings.UploadMaxFilesize) == nil {
+			domains = append(domains, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range domains {
+		clamped := limits.clamp(d.settings)
+		if clamped == d.settings.WithDefaults() {
+			continue
+		}
+		if _, err := s.db.Exec(`
+			UPDATE php_settings SET memory_limit = ?, max_execution_time = ?, post_max_size = ?,
+				upload_max_filesize = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE domain_id = ?
+		`, clamped.MemoryLimit, clamped.MaxExecutionTime, clamped.PostMaxSize,
+			clamped.UploadMaxFilesize, d.domainID); err != nil {
+			return err
+		}
+	}
+
+	pool := s.phpPoolConfig(username, filepath.Join(s.cfg.HomeBaseDir, username))
+	fpm := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, pool.PHPVersion)
+	if batch == nil {
+		return fpm.UpdatePool(pool)
+	}
+	batch.phpVersions[pool.PHPVersion] = true
+	return fpm.WritePool(pool)
+}
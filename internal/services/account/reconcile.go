@@ -0,0 +1,750 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+	"github.com/asergenalkan/serverpanel/internal/services/dns"
+	"github.com/asergenalkan/serverpanel/internal/webserver"
+)
+
+var ErrRebuildSuspended = errors.New("suspended accounts cannot be rebuilt")
+
+// Artifact kinds checked by the reconciler
+const (
+	ArtifactVhost    = "vhost"
+	ArtifactDNSZone  = "dns_zone"
+	ArtifactPHPPool  = "php_pool"
+	ArtifactVmailbox = "vmailbox"
+	ArtifactDovecot  = "dovecot"
+	ArtifactFTP      = "ftp"
+	ArtifactCrontab  = "crontab"
+)
+
+// Drift problems
+const (
+	DriftMissing  = "missing"  // in the DB, not on the system
+	DriftExtra    = "extra"    // on the system, not in the DB
+	DriftMismatch = "mismatch" // on both, with different content
+)
+
+const postfixVmailbox = "/etc/postfix/vmailbox"
+
+// Artifact is a piece of system configuration generated from the DB
+type Artifact struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Drift is a difference between the DB and the system
+type Drift struct {
+	Artifact
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// DriftReport lists the drift found for one account and, after a rebuild,
+// what was regenerated or removed
+type DriftReport struct {
+	UserID   int64      `json:"user_id"`
+	Username string     `json:"username"`
+	Skipped  string     `json:"skipped,omitempty"`
+	Drift    []Drift    `json:"drift"`
+	Rebuilt  []Artifact `json:"rebuilt,omitempty"`
+	Removed  []Artifact `json:"removed,omitempty"`
+	Errors   []string   `json:"errors,omitempty"`
+}
+
+// ServerDriftReport covers every account plus system entries that belong to
+// no account. Orphans are only reported, never removed.
+type ServerDriftReport struct {
+	Accounts []DriftReport `json:"accounts"`
+	Orphans  []Drift       `json:"orphans"`
+}
+
+// accountArtifacts is what the DB says an account should have on disk
+type accountArtifacts struct {
+	userID   int64
+	username string
+	homeDir  string
+	sites    []siteArtifact
+	domains  []string
+	mailbox  []mailboxArtifact
+	ftp      []ftpArtifact
+}
+
+type siteArtifact struct {
+	name         string
+	aliases      []string
+	documentRoot string
+	phpVersion   string
+	redirect     bool
+	ssl          bool
+}
+
+type mailboxArtifact struct {
+	email        string
+	domain       string
+	passwordHash string
+}
+
+type ftpArtifact struct {
+	login        string
+	passwordHash string
+	homeDir      string
+	quotaMB      int
+	upload       int
+	download     int
+}
+
+// CheckAccount compares the DB with the system for one account
+func (s *Service) CheckAccount(userID int64) (*DriftReport, error) {
+	a, err := s.loadArtifacts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{UserID: a.userID, Username: a.username, Drift: []Drift{}}
+	if s.IsSuspended(userID) {
+		report.Skipped = "suspended"
+		return report, nil
+	}
+	report.Drift = s.checkArtifacts(a)
+	return report, nil
+}
+
+// CheckAll compares the DB with the system for every account
+func (s *Service) CheckAll() (*ServerDriftReport, error) {
+	ids, err := s.accountIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ServerDriftReport{Accounts: []DriftReport{}}
+	for _, id := range ids {
+		r, err := s.CheckAccount(id)
+		if err != nil {
+			return nil, err
+		}
+		report.Accounts = append(report.Accounts, *r)
+	}
+	report.Orphans = s.findOrphans()
+	return report, nil
+}
+
+// RebuildAccount regenerates every artifact of an account from the DB and
+// removes mail and FTP entries the DB no longer has. SSL vhosts and
+// redirect subdomains are left as they are since the DB cannot describe
+// them fully. The returned report holds the drift that remains.
+func (s *Service) RebuildAccount(userID int64) (*DriftReport, error) {
+	a, err := s.loadArtifacts(userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsSuspended(userID) {
+		return nil, ErrRebuildSuspended
+	}
+
+	report := &DriftReport{UserID: a.userID, Username: a.username}
+	record := func(kind, name string, err error) {
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s %s: %v", kind, name, err))
+			return
+		}
+		report.Rebuilt = append(report.Rebuilt, Artifact{Kind: kind, Name: name})
+	}
+	remove := func(kind string, names []string, err error) {
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s %s: %v", kind, strings.Join(names, ", "), err))
+			return
+		}
+		for _, name := range names {
+			report.Removed = append(report.Removed, Artifact{Kind: kind, Name: name})
+		}
+	}
+
+	s.rebuildVhosts(a, record)
+	s.rebuildZones(a, record)
+	record(ArtifactPHPPool, a.username, s.createPHPFPMPool(a.username, a.homeDir))
+
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] Mail, FTP and crontab entries rebuilt for: %s", a.username)
+	} else {
+		s.rebuildMailboxes(a, record, remove)
+		s.rebuildFTPAccounts(a, record, remove)
+		record(ArtifactCrontab, a.username, s.SyncCrontab(a.userID, a.username))
+	}
+
+	report.Drift = s.checkArtifacts(a)
+	log.Printf("🔁 Account rebuilt: %s (%d artifacts, %d errors)", a.username, len(report.Rebuilt), len(report.Errors))
+	return report, nil
+}
+
+// RebuildAll rebuilds every account that is not suspended
+func (s *Service) RebuildAll() (*ServerDriftReport, error) {
+	ids, err := s.accountIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ServerDriftReport{Accounts: []DriftReport{}}
+	for _, id := range ids {
+		r, err := s.RebuildAccount(id)
+		if err == ErrRebuildSuspended {
+			r, err = s.CheckAccount(id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.Accounts = append(report.Accounts, *r)
+	}
+	report.Orphans = s.findOrphans()
+	return report, nil
+}
+
+func (s *Service) accountIDs() ([]int64, error) {
+	rows, err := s.db.Query("SELECT id FROM users WHERE role = 'user' ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// loadArtifacts reads what an account should have on the system from the DB
+func (s *Service) loadArtifacts(userID int64) (*accountArtifacts, error) {
+	a := &accountArtifacts{userID: userID}
+	err := s.db.QueryRow("SELECT username FROM users WHERE id = ? AND role = 'user'", userID).Scan(&a.username)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.homeDir = filepath.Join(s.cfg.HomeBaseDir, a.username)
+
+	rows, err := s.db.Query(`
+		SELECT name, COALESCE(document_root, ''), COALESCE(php_version, ''), COALESCE(ssl_enabled, 0)
+		FROM domains WHERE user_id = ? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var site siteArtifact
+		if err := rows.Scan(&site.name, &site.documentRoot, &site.phpVersion, &site.ssl); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		site.aliases = []string{"www." + site.name}
+		a.sites = append(a.sites, site)
+		a.domains = append(a.domains, site.name)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`
+		SELECT s.full_name, COALESCE(s.document_root, ''), COALESCE(d.php_version, ''),
+			   COALESCE(s.redirect_url, '') != ''
+		FROM subdomains s JOIN domains d ON d.id = s.domain_id
+		WHERE s.user_id = ? ORDER BY s.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var site siteArtifact
+		if err := rows.Scan(&site.name, &site.documentRoot, &site.phpVersion, &site.redirect); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.sites = append(a.sites, site)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`
+		SELECT e.email, d.name, e.password_hash
+		FROM email_accounts e JOIN domains d ON d.id = e.domain_id
+		WHERE e.user_id = ? AND e.active = 1 ORDER BY e.email
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var m mailboxArtifact
+		if err := rows.Scan(&m.email, &m.domain, &m.passwordHash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.mailbox = append(a.mailbox, m)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`
+		SELECT username, password, home_directory, COALESCE(quota_mb, 0),
+			   COALESCE(upload_bandwidth, 0), COALESCE(download_bandwidth, 0)
+		FROM ftp_accounts WHERE user_id = ? AND active = 1 ORDER BY username
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f ftpArtifact
+		if err := rows.Scan(&f.login, &f.passwordHash, &f.homeDir, &f.quotaMB, &f.upload, &f.download); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.ftp = append(a.ftp, f)
+	}
+	rows.Close()
+
+	return a, nil
+}
+
+// checkArtifacts lists the differences between an account's DB state and
+// the system. Mail, FTP and cron files only exist on a real server.
+func (s *Service) checkArtifacts(a *accountArtifacts) []Drift {
+	drift := []Drift{}
+	drift = append(drift, s.checkVhosts(a)...)
+	drift = append(drift, s.checkZones(a)...)
+
+	if _, err := os.Stat(filepath.Join(s.phpFPMManager().GetPoolPath(), a.username+".conf")); os.IsNotExist(err) {
+		drift = append(drift, Drift{Artifact: Artifact{ArtifactPHPPool, a.username}, Problem: DriftMissing})
+	}
+
+	if !config.IsDevelopment() {
+		drift = append(drift, s.checkMailboxes(a)...)
+		drift = append(drift, s.checkFTPAccounts(a)...)
+		drift = append(drift, s.checkCrontab(a)...)
+	}
+	return drift
+}
+
+func (s *Service) checkVhosts(a *accountArtifacts) []Drift {
+	var drift []Drift
+	driver := s.webServerDriver()
+	configPath := driver.GetConfigPath()
+	enabledPath := filepath.Join(filepath.Dir(configPath), "sites-enabled")
+
+	check := func(name string) {
+		if _, err := os.Stat(filepath.Join(configPath, name+".conf")); os.IsNotExist(err) {
+			drift = append(drift, Drift{Artifact: Artifact{ArtifactVhost, name}, Problem: DriftMissing})
+			return
+		}
+		if _, err := os.Lstat(filepath.Join(enabledPath, name+".conf")); os.IsNotExist(err) {
+			drift = append(drift, Drift{Artifact: Artifact{ArtifactVhost, name}, Problem: DriftMismatch, Detail: "site is not enabled"})
+		}
+	}
+
+	for _, site := range a.sites {
+		check(site.name)
+		if site.ssl {
+			check(site.name + "-ssl")
+		}
+	}
+	return drift
+}
+
+func (s *Service) checkZones(a *accountArtifacts) []Drift {
+	var drift []Drift
+	manager := dns.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath)
+
+	for _, domain := range a.domains {
+		content, err := os.ReadFile(manager.ZoneFile(domain))
+		if err != nil {
+			drift = append(drift, Drift{Artifact: Artifact{ArtifactDNSZone, domain}, Problem: DriftMissing})
+			continue
+		}
+		if !manager.HasZoneEntry(domain) {
+			drift = append(drift, Drift{Artifact: Artifact{ArtifactDNSZone, domain}, Problem: DriftMismatch, Detail: "zone is not declared in named.conf.local"})
+		}
+
+		// Zones still on the default template have no rows to compare with
+		records, err := s.zoneRecords(domain)
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		if !equalLines(dns.ZoneBody(string(content)), dns.ZoneBody(dns.RenderZone(domain, records))) {
+			drift = append(drift, Drift{Artifact: Artifact{ArtifactDNSZone, domain}, Problem: DriftMismatch, Detail: "zone file differs from the DNS records"})
+		}
+	}
+	return drift
+}
+
+func (s *Service) zoneRecords(domain string) ([]dns.Record, error) {
+	rows, err := s.db.Query(`
+		SELECT name, type, content, ttl, priority
+		FROM dns_records
+		WHERE domain_id = (SELECT id FROM domains WHERE name = ?)
+		AND active = 1
+		ORDER BY type, name
+	`, domain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []dns.Record
+	for rows.Next() {
+		var r dns.Record
+		if err := rows.Scan(&r.Name, &r.Type, &r.Content, &r.TTL, &r.Priority); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func (s *Service) checkMailboxes(a *accountArtifacts) []Drift {
+	var drift []Drift
+	owned := make(map[string]bool, len(a.domains))
+	for _, d := range a.domains {
+		owned[d] = true
+	}
+
+	for _, file := range []struct {
+		kind, path, sep string
+	}{
+		{ArtifactVmailbox, postfixVmailbox, " "},
+		{ArtifactDovecot, dovecotUsersFile, ":"},
+	} {
+		entries := readEntries(file.path, file.sep)
+		expected := make(map[string]bool, len(a.mailbox))
+		for _, m := range a.mailbox {
+			expected[m.email] = true
+			if _, ok := entries[m.email]; !ok {
+				drift = append(drift, Drift{Artifact: Artifact{file.kind, m.email}, Problem: DriftMissing})
+			}
+		}
+		for email := range entries {
+			_, domain, _ := strings.Cut(email, "@")
+			if owned[domain] && !expected[email] {
+				drift = append(drift, Drift{Artifact: Artifact{file.kind, email}, Problem: DriftExtra})
+			}
+		}
+	}
+	sortDrift(drift)
+	return drift
+}
+
+func (s *Service) checkFTPAccounts(a *accountArtifacts) []Drift {
+	var drift []Drift
+	entries := readEntries(pureFTPdPasswd, ":")
+	expected := make(map[string]bool, len(a.ftp))
+	for _, f := range a.ftp {
+		expected[f.login] = true
+		if _, ok := entries[f.login]; !ok {
+			drift = append(drift, Drift{Artifact: Artifact{ArtifactFTP, f.login}, Problem: DriftMissing})
+		}
+	}
+
+	// Virtual users run as the account's system user
+	uid, err := exec.Command("id", "-u", a.username).Output()
+	if err == nil {
+		for login, line := range entries {
+			fields := strings.Split(line, ":")
+			if len(fields) > 2 && fields[2] == strings.TrimSpace(string(uid)) && !expected[login] {
+				drift = append(drift, Drift{Artifact: Artifact{ArtifactFTP, login}, Problem: DriftExtra})
+			}
+		}
+	}
+	sortDrift(drift)
+	return drift
+}
+
+func (s *Service) checkCrontab(a *accountArtifacts) []Drift {
+	entries, err := s.crontabEntries(a.userID)
+	if err != nil {
+		return nil
+	}
+	content, err := os.ReadFile(filepath.Join(crontabDir, a.username))
+	if err != nil && len(entries) > 0 {
+		return []Drift{{Artifact: Artifact{ArtifactCrontab, a.username}, Problem: DriftMissing}}
+	}
+	if !equalLines(crontabJobLines(string(content)), entries) {
+		return []Drift{{Artifact: Artifact{ArtifactCrontab, a.username}, Problem: DriftMismatch, Detail: "crontab differs from the cron jobs"}}
+	}
+	return nil
+}
+
+type (
+	recordFunc func(kind, name string, err error)
+	removeFunc func(kind string, names []string, err error)
+)
+
+func (s *Service) rebuildVhosts(a *accountArtifacts, record recordFunc) {
+	driver := s.webServerDriver()
+	for _, site := range a.sites {
+		if site.redirect {
+			continue
+		}
+		documentRoot := site.documentRoot
+		if documentRoot == "" {
+			documentRoot = filepath.Join(a.homeDir, "public_html")
+		}
+		phpVersion := site.phpVersion
+		if phpVersion == "" {
+			phpVersion = s.cfg.PHPVersion
+		}
+		record(ArtifactVhost, site.name, driver.CreateVhost(webserver.VhostConfig{
+			Domain:       site.name,
+			Aliases:      site.aliases,
+			Username:     a.username,
+			DocumentRoot: documentRoot,
+			HomeDir:      a.homeDir,
+			PHPVersion:   phpVersion,
+		}))
+	}
+}
+
+func (s *Service) rebuildZones(a *accountArtifacts, record recordFunc) {
+	manager := dns.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath)
+	for _, domain := range a.domains {
+		records, err := s.zoneRecords(domain)
+		if err != nil {
+			record(ArtifactDNSZone, domain, err)
+			continue
+		}
+		if len(records) == 0 {
+			// No custom records yet, so the default template is the zone
+			record(ArtifactDNSZone, domain, s.createDNSZone(domain))
+			continue
+		}
+		if err := manager.WriteZone(domain, records); err != nil {
+			record(ArtifactDNSZone, domain, err)
+			continue
+		}
+		record(ArtifactDNSZone, domain, manager.EnsureZoneEntry(domain))
+	}
+}
+
+// rebuildMailboxes rewrites the Postfix and Dovecot entries of the
+// account's mailboxes and drops entries for addresses the DB does not have
+func (s *Service) rebuildMailboxes(a *accountArtifacts, record recordFunc, remove removeFunc) {
+	extra := make(map[string][]string)
+	for _, d := range s.checkMailboxes(a) {
+		if d.Problem == DriftExtra {
+			extra[d.Kind] = append(extra[d.Kind], d.Name)
+		}
+	}
+	if emails := extra[ArtifactVmailbox]; len(emails) > 0 {
+		_, err := cutLines(postfixVmailbox, emails, " ")
+		remove(ArtifactVmailbox, emails, err)
+	}
+	if emails := extra[ArtifactDovecot]; len(emails) > 0 {
+		_, err := cutLines(dovecotUsersFile, emails, ":")
+		remove(ArtifactDovecot, emails, err)
+		for _, email := range emails {
+			exec.Command("doveadm", "kick", email).Run()
+		}
+	}
+
+	for _, m := range a.mailbox {
+		localPart, _, _ := strings.Cut(m.email, "@")
+		maildir := filepath.Join("/var/mail/vhosts", m.domain, localPart)
+		for _, sub := range []string{"cur", "new", "tmp"} {
+			os.MkdirAll(filepath.Join(maildir, sub), 0700)
+		}
+		exec.Command("chown", "-R", "vmail:vmail", maildir).Run()
+
+		record(ArtifactVmailbox, m.email, restoreLines(postfixVmailbox,
+			[]string{fmt.Sprintf("%s %s/%s/", m.email, m.domain, localPart)}, " "))
+		record(ArtifactDovecot, m.email, restoreLines(dovecotUsersFile,
+			[]string{fmt.Sprintf("%s:{BLF-CRYPT}%s", m.email, m.passwordHash)}, ":"))
+	}
+
+	exec.Command("chown", "root:dovecot", dovecotUsersFile).Run()
+	exec.Command("postmap", postfixVmailbox).Run()
+	exec.Command("postfix", "reload").Run()
+	exec.Command("doveadm", "reload").Run()
+}
+
+// rebuildFTPAccounts rewrites the pure-ftpd entries of the account's FTP
+// users and drops virtual users the DB does not have
+func (s *Service) rebuildFTPAccounts(a *accountArtifacts, record recordFunc, remove removeFunc) {
+	var extra []string
+	for _, d := range s.checkFTPAccounts(a) {
+		if d.Problem == DriftExtra {
+			extra = append(extra, d.Name)
+		}
+	}
+	if len(extra) > 0 {
+		_, err := cutLines(pureFTPdPasswd, extra, ":")
+		remove(ArtifactFTP, extra, err)
+	}
+
+	if len(a.ftp) > 0 {
+		uid, uidErr := exec.Command("id", "-u", a.username).Output()
+		gid, gidErr := exec.Command("id", "-g", a.username).Output()
+		for _, f := range a.ftp {
+			if uidErr != nil || gidErr != nil {
+				record(ArtifactFTP, f.login, fmt.Errorf("system user not found: %s", a.username))
+				continue
+			}
+			record(ArtifactFTP, f.login, restoreLines(pureFTPdPasswd, []string{
+				pureFTPdEntry(f, strings.TrimSpace(string(uid)), strings.TrimSpace(string(gid))),
+			}, ":"))
+		}
+	}
+
+	if output, err := exec.Command("pure-pw", "mkdb").CombinedOutput(); err != nil {
+		log.Printf("Warning: pure-pw mkdb failed: %s - %v", string(output), err)
+	}
+}
+
+// pureFTPdEntry builds a pureftpd.passwd line. Bandwidth is in KB/s and the
+// size quota in bytes; the trailing /./ chroots the user to the home.
+func pureFTPdEntry(f ftpArtifact, uid, gid string) string {
+	fields := make([]string, 18)
+	fields[0] = f.login
+	fields[1] = f.passwordHash
+	fields[2] = uid
+	fields[3] = gid
+	fields[5] = strings.TrimSuffix(f.homeDir, "/") + "/./"
+	if f.upload > 0 {
+		fields[6] = strconv.Itoa(f.upload)
+	}
+	if f.download > 0 {
+		fields[7] = strconv.Itoa(f.download)
+	}
+	if f.quotaMB > 0 {
+		fields[12] = strconv.FormatInt(int64(f.quotaMB)*1024*1024, 10)
+	}
+	return strings.Join(fields, ":")
+}
+
+// findOrphans lists zone files, mail and FTP entries that no account owns
+func (s *Service) findOrphans() []Drift {
+	orphans := []Drift{}
+	known := make(map[string]bool)
+	rows, err := s.db.Query("SELECT name FROM domains")
+	if err != nil {
+		return orphans
+	}
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			known[name] = true
+		}
+	}
+	rows.Close()
+
+	manager := dns.NewManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath)
+	if files, err := os.ReadDir(manager.GetZonePath()); err == nil {
+		for _, f := range files {
+			domain, ok := strings.CutPrefix(f.Name(), "db.")
+			if ok && !f.IsDir() && !known[domain] {
+				orphans = append(orphans, Drift{Artifact: Artifact{ArtifactDNSZone, domain}, Problem: DriftExtra})
+			}
+		}
+	}
+
+	if config.IsDevelopment() {
+		return orphans
+	}
+
+	for _, file := range []struct {
+		kind, path, sep string
+	}{
+		{ArtifactVmailbox, postfixVmailbox, " "},
+		{ArtifactDovecot, dovecotUsersFile, ":"},
+	} {
+		for email := range readEntries(file.path, file.sep) {
+			if _, domain, _ := strings.Cut(email, "@"); !known[domain] {
+				orphans = append(orphans, Drift{Artifact: Artifact{file.kind, email}, Problem: DriftExtra})
+			}
+		}
+	}
+
+	logins := make(map[string]bool)
+	for _, login := range s.allFTPLogins() {
+		logins[login] = true
+	}
+	for login := range readEntries(pureFTPdPasswd, ":") {
+		if !logins[login] {
+			orphans = append(orphans, Drift{Artifact: Artifact{ArtifactFTP, login}, Problem: DriftExtra})
+		}
+	}
+
+	sortDrift(orphans)
+	return orphans
+}
+
+func (s *Service) allFTPLogins() []string {
+	rows, err := s.db.Query("SELECT username FROM ftp_accounts")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var logins []string
+	for rows.Next() {
+		var login string
+		if rows.Scan(&login) == nil {
+			logins = append(logins, login)
+		}
+	}
+	return logins
+}
+
+// readEntries maps the first field of each line of a passwd style file to
+// the whole line
+func readEntries(path, sep string) map[string]string {
+	entries := make(map[string]string)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return entries
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, _, ok := strings.Cut(line, sep); ok && key != "" {
+			entries[key] = line
+		}
+	}
+	return entries
+}
+
+// equalLines compares two line sets ignoring order
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortDrift(drift []Drift) {
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].Kind != drift[j].Kind {
+			return drift[i].Kind < drift[j].Kind
+		}
+		return drift[i].Name < drift[j].Name
+	})
+}
@@ -0,0 +1,574 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+	"github.com/asergenalkan/serverpanel/internal/webserver"
+)
+
+var (
+	ErrSameUsername   = errors.New("new username is the same as the current one")
+	ErrRenameConflict = errors.New("a database, database user or FTP login with the new prefix already exists")
+	ErrHomeDirExists  = errors.New("home directory for the new username already exists")
+	ErrSuspended      = errors.New("account is suspended, unsuspend it first")
+	ErrRenameTriggers = errors.New("databases with triggers cannot be moved to the new prefix, drop the triggers first")
+)
+
+// renameParams are the journaled inputs of a username change. Names are
+// recorded before anything changes so a resumed job still knows them.
+type renameParams struct {
+	UserID      int64               `json:"user_id"`
+	OldUsername string              `json:"old_username"`
+	NewUsername string              `json:"new_username"`
+	PHPVersions []string            `json:"php_versions"`
+	Databases   []string            `json:"databases"`
+	DBUsers     map[string][]string `json:"db_users"` // database user -> databases
+	FTPLogins   []string            `json:"ftp_logins"`
+}
+
+// StartRename checks that an account can take a new username and journals
+// the rename. RunJob carries it out; a failed rename is resumed, not rolled
+// back.
+func (s *Service) StartRename(userID int64, newUsername string) (*Job, error) {
+	newUsername = strings.ToLower(strings.TrimSpace(newUsername))
+	if err := s.ValidateUsername(newUsername); err != nil {
+		return nil, err
+	}
+
+	var oldUsername string
+	err := s.db.QueryRow("SELECT username FROM users WHERE id = ? AND role = 'user'", userID).Scan(&oldUsername)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if newUsername == oldUsername {
+		return nil, ErrSameUsername
+	}
+	if err := s.checkChangeable(userID); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", newUsername).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrUserExists
+	}
+	if !config.IsDevelopment() && s.cfg.IsLinux && exec.Command("id", newUsername).Run() == nil {
+		return nil, fmt.Errorf("%w: system user %s exists", ErrUserExists, newUsername)
+	}
+	if _, err := os.Stat(filepath.Join(s.cfg.HomeBaseDir, newUsername)); err == nil {
+		return nil, ErrHomeDirExists
+	}
+
+	p := renameParams{
+		UserID:      userID,
+		OldUsername: oldUsername,
+		NewUsername: newUsername,
+		PHPVersions: s.accountPHPVersions(userID),
+		Databases:   s.accountLogins("databases", "name", userID),
+		DBUsers:     map[string][]string{},
+		FTPLogins:   s.accountLogins("ftp_accounts", "username", userID),
+	}
+	rows, err := s.db.Query(`
+		SELECT du.db_username, d.name FROM database_users du
+		JOIN databases d ON d.id = du.database_id
+		WHERE du.user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var user, database string
+		if rows.Scan(&user, &database) == nil {
+			p.DBUsers[user] = append(p.DBUsers[user], database)
+		}
+	}
+	rows.Close()
+
+	for _, check := range []struct {
+		table, column string
+		names         []string
+	}{
+		{"databases", "name", p.Databases},
+		{"database_users", "db_username", mapKeys(p.DBUsers)},
+		{"ftp_accounts", "username", p.FTPLogins},
+	} {
+		for _, name := range check.names {
+			renamed := renamePrefix(name, oldUsername, newUsername)
+			if renamed == name {
+				continue
+			}
+			s.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", check.table, check.column), renamed).Scan(&count)
+			if count > 0 {
+				return nil, fmt.Errorf("%w: %s", ErrRenameConflict, renamed)
+			}
+		}
+	}
+
+	// MySQL cannot move a table with triggers to another database
+	if withTriggers, err := s.databasesWithTriggers(p.Databases); err != nil {
+		return nil, err
+	} else if len(withTriggers) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRenameTriggers, strings.Join(withTriggers, ", "))
+	}
+
+	return s.newJob(JobRenameAccount, oldUsername, userID, p)
+}
+
+// checkChangeable refuses renames and domain changes for accounts whose
+// services are switched off or that already have one in progress
+func (s *Service) checkChangeable(userID int64) error {
+	if s.IsTerminated(userID) {
+		return ErrAccountTerminated
+	}
+	if s.IsSuspended(userID) {
+		return ErrSuspended
+	}
+	return s.checkNoPendingJob(userID)
+}
+
+// renameSteps lists the side effects of a username change. Each step checks
+// what is already done so a resumed job can run it again.
+func (s *Service) renameSteps(p *renameParams) []step {
+	oldHome := filepath.Join(s.cfg.HomeBaseDir, p.OldUsername)
+	newHome := filepath.Join(s.cfg.HomeBaseDir, p.NewUsername)
+
+	return []step{
+		{
+			// usermod refuses to rename a user with running processes
+			name: "processes",
+			run: func() error {
+				s.killUserProcesses(p.OldUsername)
+				return nil
+			},
+		},
+		{
+			name: "system_user",
+			run:  func() error { return s.renameSystemUser(p.OldUsername, p.NewUsername, newHome) },
+		},
+		{
+			name: "home_dir",
+			run: func() error {
+				if _, err := os.Stat(oldHome); os.IsNotExist(err) {
+					return nil
+				}
+				if _, err := os.Stat(newHome); err == nil {
+					return ErrHomeDirExists
+				}
+				return moveDir(oldHome, newHome)
+			},
+		},
+		{
+			name: "database",
+			run:  func() error { return s.renameAccountRows(p, oldHome, newHome) },
+		},
+		{
+			name: "backups",
+			run:  func() error { return s.renameBackups(p) },
+		},
+		{
+			name: "php_fpm_pool",
+			run: func() error {
+				for _, version := range p.PHPVersions {
+					manager := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, version)
+					_, err := os.Stat(filepath.Join(manager.GetPoolPath(), p.OldUsername+".conf"))
+					if os.IsNotExist(err) && version != s.cfg.PHPVersion {
+						continue
+					}
+					if err := manager.CreatePool(webserver.PHPFPMConfig{
+						Username:   p.NewUsername,
+						HomeDir:    newHome,
+						PHPVersion: version,
+					}); err != nil {
+						return err
+					}
+					if err := manager.DeletePool(p.OldUsername); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name: "vhosts",
+			run:  func() error { return s.renameVhosts(p, oldHome, newHome) },
+		},
+		{
+			name: "mysql",
+			run:  func() error { return s.renameMySQL(p) },
+		},
+		{
+			name: "crontab",
+			run: func() error {
+				if config.IsDevelopment() {
+					log.Printf("🔧 [SIMÜLASYON] crontab %s -> %s", p.OldUsername, p.NewUsername)
+					return nil
+				}
+				if err := os.Remove(filepath.Join(crontabDir, p.OldUsername)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				return s.SyncCrontab(p.UserID, p.NewUsername)
+			},
+		},
+		{
+			name: "ftp",
+			run:  func() error { return s.renameFTPAccounts(p, oldHome, newHome) },
+		},
+	}
+}
+
+// renameSystemUser renames the Linux user and its group and points the user
+// at the new home directory, which the home_dir step moves
+func (s *Service) renameSystemUser(oldUsername, newUsername, newHome string) error {
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] usermod -l %s -d %s %s && groupmod -n %s %s", newUsername, newHome, oldUsername, newUsername, oldUsername)
+		return nil
+	}
+	if !s.cfg.IsLinux {
+		return nil
+	}
+
+	if exec.Command("id", oldUsername).Run() == nil {
+		if output, err := exec.Command("usermod", "-l", newUsername, oldUsername).CombinedOutput(); err != nil {
+			return fmt.Errorf("usermod failed: %s - %w", strings.TrimSpace(string(output)), err)
+		}
+	} else if exec.Command("id", newUsername).Run() != nil {
+		return fmt.Errorf("system user %s not found", oldUsername)
+	}
+
+	if exec.Command("getent", "group", oldUsername).Run() == nil {
+		if output, err := exec.Command("groupmod", "-n", newUsername, oldUsername).CombinedOutput(); err != nil {
+			return fmt.Errorf("groupmod failed: %s - %w", strings.TrimSpace(string(output)), err)
+		}
+	}
+
+	if output, err := exec.Command("usermod", "-d", newHome, newUsername).CombinedOutput(); err != nil {
+		return fmt.Errorf("usermod failed: %s - %w", strings.TrimSpace(string(output)), err)
+	}
+
+	log.Printf("✅ System user renamed: %s -> %s", oldUsername, newUsername)
+	return nil
+}
+
+// renameAccountRows moves the panel's rows to the new username, database
+// prefix and home directory in one transaction
+func (s *Service) renameAccountRows(p *renameParams, oldHome, newHome string) error {
+	var current string
+	if err := s.db.QueryRow("SELECT username FROM users WHERE id = ?", p.UserID).Scan(&current); err != nil {
+		return err
+	}
+	if current == p.NewUsername {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET username = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", p.NewUsername, p.UserID); err != nil {
+		return err
+	}
+	for _, name := range p.Databases {
+		if _, err := tx.Exec("UPDATE databases SET name = ? WHERE user_id = ? AND name = ?",
+			renamePrefix(name, p.OldUsername, p.NewUsername), p.UserID, name); err != nil {
+			return err
+		}
+	}
+	for user := range p.DBUsers {
+		if _, err := tx.Exec("UPDATE database_users SET db_username = ? WHERE user_id = ? AND db_username = ?",
+			renamePrefix(user, p.OldUsername, p.NewUsername), p.UserID, user); err != nil {
+			return err
+		}
+	}
+	for _, login := range p.FTPLogins {
+		if _, err := tx.Exec("UPDATE ftp_accounts SET username = ? WHERE user_id = ? AND username = ?",
+			renamePrefix(login, p.OldUsername, p.NewUsername), p.UserID, login); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range []struct{ table, column string }{
+		{"domains", "document_root"},
+		{"subdomains", "document_root"},
+		{"ftp_accounts", "home_directory"},
+	} {
+		if _, err := tx.Exec(fmt.Sprintf(`
+			UPDATE %[1]s SET %[2]s = ? || substr(%[2]s, ?)
+			WHERE user_id = ? AND (%[2]s = ? OR substr(%[2]s, 1, ?) = ?)
+		`, column.table, column.column), newHome, len(oldHome)+1, p.UserID, oldHome, len(oldHome)+1, oldHome+"/"); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE cron_jobs SET command = replace(command, ?, ?) WHERE user_id = ?",
+		oldHome+"/", newHome+"/", p.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// renameBackups moves the account's local backup archives to the backup
+// directory of the new username and points their rows at it
+func (s *Service) renameBackups(p *renameParams) error {
+	oldDir := filepath.Join(s.cfg.DataDir, "backups", p.OldUsername)
+	newDir := filepath.Join(s.cfg.DataDir, "backups", p.NewUsername)
+	if _, err := os.Stat(oldDir); err == nil {
+		if _, err := os.Stat(newDir); err == nil {
+			return fmt.Errorf("backup directory %s already exists", newDir)
+		}
+		if err := moveDir(oldDir, newDir); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE backups SET username = ?,
+			file_path = CASE WHEN substr(file_path, 1, ?) = ? THEN ? || substr(file_path, ?) ELSE file_path END
+		WHERE user_id = ?
+	`, p.NewUsername, len(oldDir)+1, oldDir+"/", newDir, len(oldDir)+1, p.UserID)
+	return err
+}
+
+// renameVhosts regenerates the account's vhosts for the new user and
+// rewrites the SSL and redirect configs the DB cannot regenerate
+func (s *Service) renameVhosts(p *renameParams, oldHome, newHome string) error {
+	a, err := s.loadArtifacts(p.UserID)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	s.rebuildVhosts(a, func(kind, name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	})
+
+	replacer := strings.NewReplacer(
+		oldHome+"/", newHome+"/",
+		"-fpm-"+p.OldUsername+".sock", "-fpm-"+p.NewUsername+".sock",
+		"/php-fpm/"+p.OldUsername+".sock", "/php-fpm/"+p.NewUsername+".sock",
+		"# User: "+p.OldUsername+"\n", "# User: "+p.NewUsername+"\n",
+	)
+	for _, site := range a.sites {
+		names := []string{site.name + "-ssl"}
+		if site.redirect {
+			names = append(names, site.name)
+		}
+		for _, name := range names {
+			if err := s.rewriteVhost(name, name, replacer.Replace); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// renameMySQL moves each database to its new name table by table, renames
+// the database users and grants them every moved database they had
+func (s *Service) renameMySQL(p *renameParams) error {
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] MySQL databases and users renamed: %s_* -> %s_*", p.OldUsername, p.NewUsername)
+		return nil
+	}
+	if os.Getenv("MYSQL_ROOT_PASSWORD") == "" {
+		return nil
+	}
+	mysql := mysqlQuery
+
+	for _, oldDB := range p.Databases {
+		newDB := renamePrefix(oldDB, p.OldUsername, p.NewUsername)
+		exists, err := mysql(fmt.Sprintf("SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = '%s'", oldDB))
+		if err != nil {
+			return err
+		}
+		if exists == "0" {
+			continue // moved by an earlier run
+		}
+
+		// Triggers added after the rename was started
+		triggers, err := mysql(fmt.Sprintf("SELECT COUNT(*) FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = '%s'", oldDB))
+		if err != nil {
+			return err
+		}
+		if triggers != "0" {
+			return fmt.Errorf("%w: %s", ErrRenameTriggers, oldDB)
+		}
+
+		log.Printf("🔁 Renaming MySQL database: %s -> %s", oldDB, newDB)
+		if _, err := mysql(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;", newDB)); err != nil {
+			return fmt.Errorf("failed to create database %s: %w", newDB, err)
+		}
+		tables, err := mysql(fmt.Sprintf("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = '%s' AND TABLE_TYPE = 'BASE TABLE'", oldDB))
+		if err != nil {
+			return err
+		}
+		var renames []string
+		for _, table := range strings.Fields(tables) {
+			renames = append(renames, fmt.Sprintf("`%s`.`%s` TO `%s`.`%s`", oldDB, table, newDB, table))
+		}
+		if len(renames) > 0 {
+			if _, err := mysql("RENAME TABLE " + strings.Join(renames, ", ") + ";"); err != nil {
+				return fmt.Errorf("failed to move tables of %s: %w", oldDB, err)
+			}
+		}
+
+		// Views and routines do not move with RENAME TABLE; keep the old
+		// database rather than lose them
+		left, err := mysql(fmt.Sprintf("SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = '%s'", oldDB))
+		if err == nil && left == "0" {
+			mysql(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`;", oldDB))
+		} else {
+			log.Printf("⚠️ %s still holds views, left in place next to %s", oldDB, newDB)
+		}
+	}
+
+	for oldUser, oldDBs := range p.DBUsers {
+		newUser := renamePrefix(oldUser, p.OldUsername, p.NewUsername)
+		exists, err := mysql(fmt.Sprintf("SELECT COUNT(*) FROM mysql.user WHERE user = '%s' AND host = 'localhost'", oldUser))
+		if err != nil {
+			return err
+		}
+		if exists != "0" {
+			if _, err := mysql(fmt.Sprintf("RENAME USER '%s'@'localhost' TO '%s'@'localhost';", oldUser, newUser)); err != nil {
+				return fmt.Errorf("failed to rename database user %s: %w", oldUser, err)
+			}
+		}
+		for _, oldDB := range oldDBs {
+			newDB := renamePrefix(oldDB, p.OldUsername, p.NewUsername)
+			if _, err := mysql(fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'localhost';", newDB, newUser)); err != nil {
+				return fmt.Errorf("failed to grant %s on %s: %w", newUser, newDB, err)
+			}
+			mysql(fmt.Sprintf("REVOKE ALL PRIVILEGES ON `%s`.* FROM '%s'@'localhost';", oldDB, newUser))
+		}
+	}
+	mysql("FLUSH PRIVILEGES;")
+	return nil
+}
+
+// databasesWithTriggers returns the databases that hold triggers. Without
+// MySQL credentials (or in development) nothing is checked.
+func (s *Service) databasesWithTriggers(databases []string) ([]string, error) {
+	if config.IsDevelopment() || os.Getenv("MYSQL_ROOT_PASSWORD") == "" || len(databases) == 0 {
+		return nil, nil
+	}
+	quoted := make([]string, len(databases))
+	for i, name := range databases {
+		quoted[i] = "'" + name + "'"
+	}
+	output, err := mysqlQuery(fmt.Sprintf(
+		"SELECT DISTINCT TRIGGER_SCHEMA FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA IN (%s)",
+		strings.Join(quoted, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+// mysqlQuery runs a query as the MySQL root user and returns its
+// tab-separated output without column names
+func mysqlQuery(query string) (string, error) {
+	output, err := exec.Command("mysql", "-uroot", "-p"+os.Getenv("MYSQL_ROOT_PASSWORD"), "-N", "-B", "-e", query).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s - %w", strings.TrimSpace(string(output)), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// renameFTPAccounts renames the pure-ftpd virtual users and moves their home
+// paths. The system uid is unchanged, so the rest of each entry is kept.
+func (s *Service) renameFTPAccounts(p *renameParams, oldHome, newHome string) error {
+	if len(p.FTPLogins) == 0 {
+		return nil
+	}
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] pure-ftpd users renamed: %s", strings.Join(p.FTPLogins, ", "))
+		return nil
+	}
+
+	cut, err := cutLines(pureFTPdPasswd, p.FTPLogins, ":")
+	if err != nil {
+		return err
+	}
+	if len(cut) > 0 {
+		var lines []string
+		for _, line := range cut {
+			fields := strings.Split(line, ":")
+			fields[0] = renamePrefix(fields[0], p.OldUsername, p.NewUsername)
+			if len(fields) > 5 && (fields[5] == oldHome || strings.HasPrefix(fields[5], oldHome+"/")) {
+				fields[5] = newHome + strings.TrimPrefix(fields[5], oldHome)
+			}
+			lines = append(lines, strings.Join(fields, ":"))
+		}
+		if err := restoreLines(pureFTPdPasswd, lines, ":"); err != nil {
+			return err
+		}
+	}
+
+	if output, err := exec.Command("pure-pw", "mkdb").CombinedOutput(); err != nil {
+		return fmt.Errorf("pure-pw mkdb failed: %s - %w", strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
+
+// rewriteVhost writes a vhost config under a new name with its content
+// rewritten, enables it and removes the old one. A config that is already
+// gone was moved by an earlier run.
+func (s *Service) rewriteVhost(oldName, newName string, rewrite func(string) string) error {
+	driver := s.webServerDriver()
+	oldFile := filepath.Join(driver.GetConfigPath(), oldName+".conf")
+	content, err := os.ReadFile(oldFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	newFile := filepath.Join(driver.GetConfigPath(), newName+".conf")
+	if err := os.WriteFile(newFile, []byte(rewrite(string(content))), 0644); err != nil {
+		return err
+	}
+	if oldName == newName {
+		return driver.Reload()
+	}
+	if err := driver.EnableSite(newName); err != nil {
+		return err
+	}
+	return driver.DeleteVhost(oldName)
+}
+
+// renamePrefix swaps the "<username>_" prefix of a database, database user
+// or FTP login
+func renamePrefix(name, oldUsername, newUsername string) string {
+	if rest, ok := strings.CutPrefix(name, oldUsername+"_"); ok {
+		return newUsername + "_" + rest
+	}
+	return name
+}
+
+func mapKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,594 @@
+package account
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/config"
+	"github.com/asergenalkan/serverpanel/internal/webserver"
+)
+
+var (
+	ErrAccountNotFound  = errors.New("account not found")
+	ErrAlreadySuspended = errors.New("account is already suspended")
+	ErrNotSuspended     = errors.New("account is not suspended")
+	ErrNotSuspender     = errors.New("account was suspended by an administrator or a limit, only an administrator can unsuspend it")
+)
+
+const (
+	dovecotUsersFile = "/etc/dovecot/users"
+	pureFTPdPasswd   = "/etc/pure-ftpd/pureftpd.passwd"
+	crontabDir       = "/var/spool/cron/crontabs"
+	suspendedShell   = "/usr/sbin/nologin"
+)
+
+// SuspendState records what suspension changed so unsuspension can put
+// each piece back exactly as it was
+type SuspendState struct {
+	Vhosts         []string `json:"vhosts,omitempty"`    // vhost configs swapped for the suspended page
+	PHPPools       []string `json:"php_pools,omitempty"` // PHP versions whose pool was disabled
+	ShellLocked    bool     `json:"shell_locked"`
+	Shell          string   `json:"shell,omitempty"` // login shell before suspension
+	PasswordLocked bool     `json:"password_locked"` // password was already locked
+	DovecotEntries []string `json:"dovecot_entries,omitempty"`
+	FTPEntries     []string `json:"ftp_entries,omitempty"`
+	Crontab        *string  `json:"crontab,omitempty"`
+}
+
+// Suspension describes a suspended account
+type Suspension struct {
+	UserID      int64  `json:"user_id"`
+	Reason      string `json:"reason"`
+	SuspendedBy int64  `json:"suspended_by,omitempty"`
+	SuspendedAt string `json:"suspended_at"`
+}
+
+// IsSuspended reports whether an account is suspended
+func (s *Service) IsSuspended(userID int64) bool {
+	var count int
+	s.db.QueryRow("SELECT COUNT(*) FROM account_suspensions WHERE user_id = ?", userID).Scan(&count)
+	return count > 0
+}
+
+// GetSuspension returns the suspension of an account
+func (s *Service) GetSuspension(userID int64) (*Suspension, error) {
+	var susp Suspension
+	var by sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT user_id, COALESCE(reason, ''), suspended_by, created_at
+		FROM account_suspensions WHERE user_id = ?
+	`, userID).Scan(&susp.UserID, &susp.Reason, &by, &susp.SuspendedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotSuspended
+	}
+	if err != nil {
+		return nil, err
+	}
+	susp.SuspendedBy = by.Int64
+	return &susp, nil
+}
+
+// CheckSuspender makes sure an account was suspended by actorID. Resellers
+// may only lift their own suspensions, not ones set by an admin or by the
+// bandwidth enforcer (SuspendedBy 0).
+func (s *Service) CheckSuspender(userID, actorID int64) error {
+	susp, err := s.GetSuspension(userID)
+	if err != nil {
+		return err
+	}
+	if susp.SuspendedBy != actorID {
+		return ErrNotSuspender
+	}
+	return nil
+}
+
+// SuspendAccount takes an account offline: its sites show the suspended
+// page, PHP-FPM, shell, mail, FTP and cron are disabled and panel sessions
+// end. What was changed is stored with the reason for UnsuspendAccount.
+func (s *Service) SuspendAccount(userID int64, reason string, suspendedBy int64) error {
+	var username string
+	err := s.db.QueryRow("SELECT username FROM users WHERE id = ? AND role = 'user'", userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		return ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var by sql.NullInt64
+	if suspendedBy > 0 {
+		by = sql.NullInt64{Int64: suspendedBy, Valid: true}
+	}
+	// The row is written first so a second suspend cannot run concurrently
+	if _, err := s.db.Exec(`
+		INSERT INTO account_suspensions (user_id, reason, suspended_by, state) VALUES (?, ?, ?, '{}')
+	`, userID, reason, by); err != nil {
+		if s.IsSuspended(userID) {
+			return ErrAlreadySuspended
+		}
+		return err
+	}
+
+	if _, err := s.db.Exec("UPDATE users SET active = 0 WHERE id = ?", userID); err != nil {
+		s.db.Exec("DELETE FROM account_suspensions WHERE user_id = ?", userID)
+		return err
+	}
+	if _, err := auth.RevokeUserSessions(s.db, userID, auth.RevokeSuspended, ""); err != nil {
+		log.Printf("Warning: failed to revoke sessions of %s: %v", username, err)
+	}
+
+	state := &SuspendState{}
+	s.suspendVhosts(userID, state)
+	s.disablePHPPools(userID, username, state)
+	s.lockSystemUser(username, state)
+	s.disableMailboxes(userID, state)
+	s.disableFTPAccounts(userID, state)
+	s.suspendCrontab(username, state)
+
+	if err := s.saveSuspendState(userID, state); err != nil {
+		return err
+	}
+
+	log.Printf("⏸️ Account suspended: %s (%s)", username, reason)
+	return nil
+}
+
+// UnsuspendAccount restores everything SuspendAccount changed. When a piece
+// cannot be restored the account stays suspended with only the remaining
+// pieces recorded, so the call can be retried.
+func (s *Service) UnsuspendAccount(userID int64) error {
+	var username string
+	var active bool
+	err := s.db.QueryRow("SELECT username, active FROM users WHERE id = ? AND role = 'user'", userID).Scan(&username, &active)
+	if err == sql.ErrNoRows {
+		return ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.IsTerminated(userID) {
+		return ErrAccountTerminated
+	}
+
+	var stateJSON string
+	err = s.db.QueryRow("SELECT state FROM account_suspensions WHERE user_id = ?", userID).Scan(&stateJSON)
+	if err == sql.ErrNoRows {
+		// Deactivated without a suspension record
+		if active {
+			return ErrNotSuspended
+		}
+		_, err = s.db.Exec("UPDATE users SET active = 1 WHERE id = ?", userID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	state := &SuspendState{}
+	if err := json.Unmarshal([]byte(stateJSON), state); err != nil {
+		return fmt.Errorf("invalid suspension state: %w", err)
+	}
+
+	var failed []string
+	if err := s.restoreVhosts(state); err != nil {
+		failed = append(failed, "vhosts: "+err.Error())
+	}
+	if err := s.enablePHPPools(username, state); err != nil {
+		failed = append(failed, "PHP-FPM: "+err.Error())
+	}
+	if err := s.unlockSystemUser(username, state); err != nil {
+		failed = append(failed, "system user: "+err.Error())
+	}
+	if err := s.restoreMailboxes(state); err != nil {
+		failed = append(failed, "mailboxes: "+err.Error())
+	}
+	if err := s.restoreFTPAccounts(state); err != nil {
+		failed = append(failed, "FTP: "+err.Error())
+	}
+	if err := s.restoreCrontab(username, state); err != nil {
+		failed = append(failed, "crontab: "+err.Error())
+	}
+
+	if len(failed) > 0 {
+		if err := s.saveSuspendState(userID, state); err != nil {
+			log.Printf("Warning: failed to save suspension state of %s: %v", username, err)
+		}
+		return fmt.Errorf("failed to restore %s", strings.Join(failed, "; "))
+	}
+
+	if _, err := s.db.Exec("UPDATE users SET active = 1 WHERE id = ?", userID); err != nil {
+		return err
+	}
+	s.db.Exec("DELETE FROM account_suspensions WHERE user_id = ?", userID)
+
+	log.Printf("▶️ Account unsuspended: %s", username)
+	return nil
+}
+
+func (s *Service) saveSuspendState(userID int64, state *SuspendState) error {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("UPDATE account_suspensions SET state = ? WHERE user_id = ?", string(stateJSON), userID)
+	return err
+}
+
+// webServerDriver returns the configured web server driver
+func (s *Service) webServerDriver() webserver.Driver {
+	driverType := webserver.DriverApache
+	if s.cfg.WebServer == "nginx" {
+		driverType = webserver.DriverNginx
+	}
+	return webserver.NewDriver(driverType, s.cfg.SimulateMode, s.cfg.SimulateBasePath)
+}
+
+// accountVhosts returns the vhost config names an account may have: one per
+// domain and subdomain plus the separate -ssl configs
+func (s *Service) accountVhosts(userID int64) []string {
+	var names []string
+	rows, err := s.db.Query(`
+		SELECT name FROM domains WHERE user_id = ?
+		UNION SELECT full_name FROM subdomains WHERE user_id = ?
+	`, userID, userID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			names = append(names, name, name+"-ssl")
+		}
+	}
+	return names
+}
+
+func (s *Service) suspendVhosts(userID int64, state *SuspendState) {
+	driver := s.webServerDriver()
+	for _, name := range s.accountVhosts(userID) {
+		err := driver.SuspendVhost(name)
+		if errors.Is(err, webserver.ErrVhostNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Warning: failed to suspend vhost %s: %v", name, err)
+			continue
+		}
+		state.Vhosts = append(state.Vhosts, name)
+	}
+	if len(state.Vhosts) > 0 {
+		if err := driver.Reload(); err != nil {
+			log.Printf("Warning: %s reload failed: %v", driver.Name(), err)
+		}
+	}
+}
+
+func (s *Service) restoreVhosts(state *SuspendState) error {
+	if len(state.Vhosts) == 0 {
+		return nil
+	}
+	driver := s.webServerDriver()
+	var remaining []string
+	var lastErr error
+	for _, name := range state.Vhosts {
+		// A config removed while suspended has nothing to restore
+		if err := driver.UnsuspendVhost(name); err != nil && !errors.Is(err, webserver.ErrVhostNotFound) {
+			remaining = append(remaining, name)
+			lastErr = err
+		}
+	}
+	state.Vhosts = remaining
+	if err := driver.Reload(); err != nil {
+		log.Printf("Warning: %s reload failed: %v", driver.Name(), err)
+	}
+	return lastErr
+}
+
+// accountPHPVersions returns every PHP version the account may have a pool for
+func (s *Service) accountPHPVersions(userID int64) []string {
+	versions := []string{s.cfg.PHPVersion}
+	rows, err := s.db.Query("SELECT DISTINCT php_version FROM domains WHERE user_id = ? AND php_version IS NOT NULL", userID)
+	if err != nil {
+		return versions
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if rows.Scan(&v) == nil && v != "" && v != s.cfg.PHPVersion {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+func (s *Service) disablePHPPools(userID int64, username string, state *SuspendState) {
+	for _, version := range s.accountPHPVersions(userID) {
+		manager := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, version)
+		err := manager.DisablePool(username)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Warning: failed to disable PHP %s pool for %s: %v", version, username, err)
+			// A failed reload still leaves the pool renamed
+			if _, statErr := os.Stat(filepath.Join(manager.GetPoolPath(), username+".conf")); !os.IsNotExist(statErr) {
+				continue
+			}
+		}
+		state.PHPPools = append(state.PHPPools, version)
+	}
+}
+
+func (s *Service) enablePHPPools(username string, state *SuspendState) error {
+	var remaining []string
+	var lastErr error
+	for _, version := range state.PHPPools {
+		manager := webserver.NewPHPFPMManager(s.cfg.SimulateMode, s.cfg.SimulateBasePath, version)
+		if err := manager.EnablePool(username); err != nil && !os.IsNotExist(err) {
+			remaining = append(remaining, version)
+			lastErr = err
+		}
+	}
+	state.PHPPools = remaining
+	return lastErr
+}
+
+// lockSystemUser locks the password, switches the shell to nologin and ends
+// the user's running processes
+func (s *Service) lockSystemUser(username string, state *SuspendState) {
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] usermod -L -s %s %s", suspendedShell, username)
+		state.ShellLocked = true
+		state.Shell = "/bin/bash"
+		return
+	}
+	if !s.cfg.IsLinux {
+		return
+	}
+
+	out, err := exec.Command("getent", "passwd", username).Output()
+	if err != nil {
+		log.Printf("Warning: system user %s not found: %v", username, err)
+		return
+	}
+	fields := strings.Split(strings.TrimSpace(string(out)), ":")
+	if len(fields) < 7 {
+		return
+	}
+	shell := fields[6]
+
+	passwordLocked := false
+	if out, err := exec.Command("passwd", "-S", username).Output(); err == nil {
+		status := strings.Fields(string(out))
+		passwordLocked = len(status) > 1 && status[1] == "L"
+	}
+
+	if output, err := exec.Command("usermod", "-L", "-s", suspendedShell, username).CombinedOutput(); err != nil {
+		log.Printf("Warning: failed to lock system user %s: %s - %v", username, string(output), err)
+		return
+	}
+	state.ShellLocked = true
+	state.Shell = shell
+	state.PasswordLocked = passwordLocked
+
+	exec.Command("pkill", "-KILL", "-u", username).Run()
+}
+
+func (s *Service) unlockSystemUser(username string, state *SuspendState) error {
+	if !state.ShellLocked {
+		return nil
+	}
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] usermod -U -s %s %s", state.Shell, username)
+		state.ShellLocked = false
+		return nil
+	}
+
+	args := []string{"-s", state.Shell}
+	if !state.PasswordLocked {
+		args = append(args, "-U")
+	}
+	if output, err := exec.Command("usermod", append(args, username)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("usermod failed: %s - %w", strings.TrimSpace(string(output)), err)
+	}
+	state.ShellLocked = false
+	return nil
+}
+
+// accountLogins returns the values of column in table for an account
+func (s *Service) accountLogins(table, column string, userID int64) []string {
+	var logins []string
+	rows, err := s.db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE user_id = ?", column, table), userID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var login string
+		if rows.Scan(&login) == nil {
+			logins = append(logins, login)
+		}
+	}
+	return logins
+}
+
+// disableMailboxes removes the account's mailboxes from the Dovecot passwd
+// file so IMAP/POP3 logins and delivery stop
+func (s *Service) disableMailboxes(userID int64, state *SuspendState) {
+	emails := s.accountLogins("email_accounts", "email", userID)
+	if len(emails) == 0 {
+		return
+	}
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] Dovecot mailboxes disabled: %s", strings.Join(emails, ", "))
+		return
+	}
+
+	entries, err := cutLines(dovecotUsersFile, emails, ":")
+	if err != nil {
+		log.Printf("Warning: failed to disable mailboxes: %v", err)
+		return
+	}
+	state.DovecotEntries = entries
+	for _, email := range emails {
+		exec.Command("doveadm", "kick", email).Run()
+	}
+	exec.Command("doveadm", "reload").Run()
+}
+
+func (s *Service) restoreMailboxes(state *SuspendState) error {
+	if len(state.DovecotEntries) == 0 {
+		return nil
+	}
+	if err := restoreLines(dovecotUsersFile, state.DovecotEntries, ":"); err != nil {
+		return err
+	}
+	state.DovecotEntries = nil
+	exec.Command("doveadm", "reload").Run()
+	return nil
+}
+
+// disableFTPAccounts removes the account's virtual users from pure-ftpd
+func (s *Service) disableFTPAccounts(userID int64, state *SuspendState) {
+	logins := s.accountLogins("ftp_accounts", "username", userID)
+	if len(logins) == 0 {
+		return
+	}
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] FTP accounts disabled: %s", strings.Join(logins, ", "))
+		return
+	}
+
+	entries, err := cutLines(pureFTPdPasswd, logins, ":")
+	if err != nil {
+		log.Printf("Warning: failed to disable FTP accounts: %v", err)
+		return
+	}
+	state.FTPEntries = entries
+	exec.Command("pure-pw", "mkdb").Run()
+}
+
+func (s *Service) restoreFTPAccounts(state *SuspendState) error {
+	if len(state.FTPEntries) == 0 {
+		return nil
+	}
+	if err := restoreLines(pureFTPdPasswd, state.FTPEntries, ":"); err != nil {
+		return err
+	}
+	state.FTPEntries = nil
+	if output, err := exec.Command("pure-pw", "mkdb").CombinedOutput(); err != nil {
+		log.Printf("Warning: pure-pw mkdb failed: %s - %v", string(output), err)
+	}
+	return nil
+}
+
+// suspendCrontab removes the user's crontab, keeping its content
+func (s *Service) suspendCrontab(username string, state *SuspendState) {
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] crontab -r -u %s", username)
+		return
+	}
+
+	cronFile := filepath.Join(crontabDir, username)
+	content, err := os.ReadFile(cronFile)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(cronFile); err != nil {
+		log.Printf("Warning: failed to remove crontab of %s: %v", username, err)
+		return
+	}
+	crontab := string(content)
+	state.Crontab = &crontab
+	exec.Command("systemctl", "reload", "cron").Run()
+}
+
+func (s *Service) restoreCrontab(username string, state *SuspendState) error {
+	if state.Crontab == nil {
+		return nil
+	}
+
+	cronFile := filepath.Join(crontabDir, username)
+	tempFile := cronFile + ".tmp"
+	if err := os.WriteFile(tempFile, []byte(*state.Crontab), 0600); err != nil {
+		return err
+	}
+	exec.Command("chown", fmt.Sprintf("%s:crontab", username), tempFile).Run()
+	if err := os.Rename(tempFile, cronFile); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	state.Crontab = nil
+	exec.Command("systemctl", "reload", "cron").Run()
+	return nil
+}
+
+// cutLines removes the lines of a passwd style file whose first field is one
+// of keys and returns them
+func cutLines(path string, keys []string, sep string) ([]string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+
+	var kept, cut []string
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		if key, _, ok := strings.Cut(line, sep); ok && wanted[key] {
+			cut = append(cut, line)
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if len(cut) == 0 {
+		return nil, nil
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Join(kept, "\n")+"\n"), info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	return cut, nil
+}
+
+// restoreLines adds lines removed by cutLines back, replacing any line that
+// was created for the same key in the meantime
+func restoreLines(path string, lines []string, sep string) error {
+	var keys []string
+	for _, line := range lines {
+		if key, _, ok := strings.Cut(line, sep); ok {
+			keys = append(keys, key)
+		}
+	}
+	if _, err := cutLines(path, keys, sep); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	return err
+}
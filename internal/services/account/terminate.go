@@ -0,0 +1,373 @@
+package account
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+)
+
+var (
+	ErrAlreadyTerminated = errors.New("account is already terminated")
+	ErrNotTerminated     = errors.New("account is not terminated")
+	ErrAccountTerminated = errors.New("account is terminated, restore it instead")
+)
+
+const (
+	defaultGraceDays = 30
+	terminatedDir    = ".terminated"
+	sqliteTimeFormat = "2006-01-02 15:04:05"
+)
+
+// Termination describes an account waiting to be purged
+type Termination struct {
+	UserID       int64  `json:"user_id"`
+	Username     string `json:"username"`
+	ArchivePath  string `json:"archive_path"`
+	WasSuspended bool   `json:"was_suspended"`
+	TerminatedBy int64  `json:"terminated_by,omitempty"`
+	PurgeAfter   string `json:"purge_after"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// GracePeriod returns how long terminated accounts are kept before purge,
+// from the termination_grace_days server setting
+func (s *Service) GracePeriod() time.Duration {
+	days := defaultGraceDays
+	var value string
+	if s.db.QueryRow("SELECT value FROM server_settings WHERE key = 'termination_grace_days'").Scan(&value) == nil {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// IsTerminated reports whether an account is terminated
+func (s *Service) IsTerminated(userID int64) bool {
+	var count int
+	s.db.QueryRow("SELECT COUNT(*) FROM account_terminations WHERE user_id = ?", userID).Scan(&count)
+	return count > 0
+}
+
+// GetTermination returns the termination of an account
+func (s *Service) GetTermination(userID int64) (*Termination, error) {
+	var t Termination
+	var by sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT t.user_id, u.username, t.archive_path, t.was_suspended, t.terminated_by, t.purge_after, t.created_at
+		FROM account_terminations t JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = ?
+	`, userID).Scan(&t.UserID, &t.Username, &t.ArchivePath, &t.WasSuspended, &by, &t.PurgeAfter, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotTerminated
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.TerminatedBy = by.Int64
+	return &t, nil
+}
+
+// ListTerminations returns terminated accounts, soonest purge first. A
+// non-zero parentID limits the list to a reseller's accounts.
+func (s *Service) ListTerminations(parentID int64) ([]Termination, error) {
+	rows, err := s.db.Query(`
+		SELECT t.user_id, u.username, t.archive_path, t.was_suspended, t.terminated_by, t.purge_after, t.created_at
+		FROM account_terminations t JOIN users u ON u.id = t.user_id
+		WHERE (? = 0 OR u.parent_id = ?)
+		ORDER BY t.purge_after
+	`, parentID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terminations := []Termination{}
+	for rows.Next() {
+		var t Termination
+		var by sql.NullInt64
+		if err := rows.Scan(&t.UserID, &t.Username, &t.ArchivePath, &t.WasSuspended, &by, &t.PurgeAfter, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.TerminatedBy = by.Int64
+		terminations = append(terminations, t)
+	}
+	return terminations, rows.Err()
+}
+
+// TerminateAccount is the soft delete: the account is suspended, its home
+// directory moved and its MySQL databases dumped to a holding area, its
+// MySQL users locked, and it is purged once the grace period ends. RestoreAccount undoes it until then.
+func (s *Service) TerminateAccount(userID int64, terminatedBy int64) (*Termination, error) {
+	var username string
+	err := s.db.QueryRow("SELECT username FROM users WHERE id = ? AND role = 'user'", userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	archivePath := filepath.Join(s.cfg.HomeBaseDir, terminatedDir, username)
+	purgeAfter := time.Now().UTC().Add(s.GracePeriod()).Format(sqliteTimeFormat)
+	wasSuspended := s.IsSuspended(userID)
+
+	var by sql.NullInt64
+	if terminatedBy > 0 {
+		by = sql.NullInt64{Int64: terminatedBy, Valid: true}
+	}
+	// The row is written first so a second terminate cannot run concurrently
+	if _, err := s.db.Exec(`
+		INSERT INTO account_terminations (user_id, archive_path, was_suspended, terminated_by, purge_after)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, archivePath, wasSuspended, by, purgeAfter); err != nil {
+		if s.IsTerminated(userID) {
+			return nil, ErrAlreadyTerminated
+		}
+		return nil, err
+	}
+
+	if !wasSuspended {
+		if err := s.SuspendAccount(userID, "Account terminated", terminatedBy); err != nil {
+			s.db.Exec("DELETE FROM account_terminations WHERE user_id = ?", userID)
+			return nil, err
+		}
+	}
+
+	if err := s.archiveAccount(userID, username, archivePath); err != nil {
+		// Put back whatever was moved so the account is left as it was
+		s.unarchiveAccount(userID, username, archivePath)
+		s.db.Exec("DELETE FROM account_terminations WHERE user_id = ?", userID)
+		if !wasSuspended {
+			if uerr := s.UnsuspendAccount(userID); uerr != nil {
+				log.Printf("Warning: failed to unsuspend %s after a failed termination: %v", username, uerr)
+			}
+		}
+		return nil, fmt.Errorf("failed to archive account: %w", err)
+	}
+
+	log.Printf("🗄️ Account terminated: %s (purge after %s UTC)", username, purgeAfter)
+	return s.GetTermination(userID)
+}
+
+// RestoreAccount brings a terminated account back before it is purged. An
+// account that was suspended before termination stays suspended.
+func (s *Service) RestoreAccount(userID int64) error {
+	t, err := s.GetTermination(userID)
+	if err != nil {
+		if err == ErrNotTerminated {
+			var count int
+			s.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ? AND role = 'user'", userID).Scan(&count)
+			if count == 0 {
+				return ErrAccountNotFound
+			}
+		}
+		return err
+	}
+
+	if err := s.unarchiveAccount(userID, t.Username, t.ArchivePath); err != nil {
+		return fmt.Errorf("failed to restore archived data: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM account_terminations WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	os.RemoveAll(t.ArchivePath)
+
+	if !t.WasSuspended {
+		if err := s.UnsuspendAccount(userID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("↩️ Account restored: %s", t.Username)
+	return nil
+}
+
+// PurgeExpiredAccounts permanently deletes terminated accounts whose grace
+// period has ended and returns how many were purged. Accounts with an
+// unfinished delete job are left for an admin to resume.
+func (s *Service) PurgeExpiredAccounts() (int, error) {
+	rows, err := s.db.Query(`
+		SELECT user_id FROM account_terminations t
+		WHERE purge_after <= ? AND NOT EXISTS (
+			SELECT 1 FROM provisioning_jobs j
+			WHERE j.user_id = t.user_id AND j.action = ? AND j.status IN (?, ?)
+		)
+	`, time.Now().UTC().Format(sqliteTimeFormat), JobDeleteAccount, JobRunning, JobFailed)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	purged := 0
+	for _, id := range ids {
+		if err := s.DeleteAccount(id); err != nil {
+			log.Printf("⚠️ Failed to purge terminated account %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// archiveAccount moves the home directory into the holding area, dumps
+// the account's MySQL databases next to it and locks its MySQL users
+func (s *Service) archiveAccount(userID int64, username, archivePath string) error {
+	if err := os.MkdirAll(archivePath, 0700); err != nil {
+		return err
+	}
+
+	homeDir := filepath.Join(s.cfg.HomeBaseDir, username)
+	if _, err := os.Stat(homeDir); err == nil {
+		if err := moveDir(homeDir, filepath.Join(archivePath, "home")); err != nil {
+			return err
+		}
+	}
+
+	if err := s.dumpMySQLDatabases(s.accountLogins("databases", "name", userID), filepath.Join(archivePath, "mysql")); err != nil {
+		return err
+	}
+	return s.lockMySQLUsers(userID, true)
+}
+
+// unarchiveAccount moves the archived home directory back and unlocks the
+// MySQL users. The databases were only dumped, so there is nothing to
+// import.
+func (s *Service) unarchiveAccount(userID int64, username, archivePath string) error {
+	archivedHome := filepath.Join(archivePath, "home")
+	if _, err := os.Stat(archivedHome); err == nil {
+		if err := moveDir(archivedHome, filepath.Join(s.cfg.HomeBaseDir, username)); err != nil {
+			return err
+		}
+	}
+	return s.lockMySQLUsers(userID, false)
+}
+
+// lockMySQLUsers locks or unlocks the account's MySQL users (the database
+// users and the per-database users named after each database). Locking
+// also ends their open connections.
+func (s *Service) lockMySQLUsers(userID int64, lock bool) error {
+	users := s.accountLogins("database_users", "db_username", userID)
+	users = append(users, s.accountLogins("databases", "name", userID)...)
+	if len(users) == 0 {
+		return nil
+	}
+	action := "UNLOCK"
+	if lock {
+		action = "LOCK"
+	}
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] ALTER USER ... ACCOUNT %s: %v", action, users)
+		return nil
+	}
+	if os.Getenv("MYSQL_ROOT_PASSWORD") == "" {
+		return errors.New("MYSQL_ROOT_PASSWORD is not set, MySQL users cannot be locked")
+	}
+
+	var quoted []string
+	for _, user := range users {
+		quoted = append(quoted, "'"+user+"'")
+		if _, err := mysqlQuery(fmt.Sprintf("ALTER USER IF EXISTS '%s'@'localhost' ACCOUNT %s;", user, action)); err != nil {
+			return fmt.Errorf("failed to %s MySQL user %s: %w", strings.ToLower(action), user, err)
+		}
+	}
+	if !lock {
+		return nil
+	}
+
+	ids, err := mysqlQuery(fmt.Sprintf("SELECT ID FROM information_schema.PROCESSLIST WHERE USER IN (%s)", strings.Join(quoted, ", ")))
+	if err != nil {
+		return err
+	}
+	for _, id := range strings.Fields(ids) {
+		mysqlQuery("KILL " + id)
+	}
+	return nil
+}
+
+// dumpMySQLDatabases writes a mysqldump of each database into dir
+func (s *Service) dumpMySQLDatabases(databases []string, dir string) error {
+	if len(databases) == 0 {
+		return nil
+	}
+	if config.IsDevelopment() {
+		log.Printf("🔧 [SIMÜLASYON] mysqldump %v > %s", databases, dir)
+		return nil
+	}
+	// The dumps are all that is left of the databases once the account is
+	// purged, so termination fails without them
+	mysqlRootPass := os.Getenv("MYSQL_ROOT_PASSWORD")
+	if mysqlRootPass == "" {
+		return errors.New("MYSQL_ROOT_PASSWORD is not set, databases cannot be dumped")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, dbName := range databases {
+		out, err := os.OpenFile(filepath.Join(dir, dbName+".sql"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command("mysqldump", "-uroot", "-p"+mysqlRootPass, "--single-transaction", "--routines", "--triggers", dbName)
+		cmd.Stdout = out
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		out.Close()
+		if err != nil {
+			return fmt.Errorf("failed to dump database %s: %s - %w", dbName, strings.TrimSpace(stderr.String()), err)
+		}
+	}
+	return nil
+}
+
+// moveDir renames a directory, falling back to mv when the holding area is
+// on another filesystem
+func moveDir(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if output, err := exec.Command("mv", src, dst).CombinedOutput(); err != nil {
+		return fmt.Errorf("mv %s: %s - %w", src, string(output), err)
+	}
+	return nil
+}
+
+// StartPurgeScheduler purges expired terminated accounts every hour
+func StartPurgeScheduler(db DB) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			purged, err := NewService(db).PurgeExpiredAccounts()
+			if err != nil {
+				log.Printf("⚠️ Failed to read terminated accounts: %v", err)
+			} else if purged > 0 {
+				log.Printf("🗑️ Purged %d terminated account(s)", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,327 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	manifestName = "manifest.json"
+	metadataName = "metadata.json"
+	indexName    = "index.json"
+)
+
+// FileState is the size and modification time of an archived file
+type FileState struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+}
+
+// FileIndex maps archive paths (home/..., mail/...) of every file present at
+// backup time to their state. Incremental backups compare against the index
+// of their parent and only store files that differ.
+type FileIndex map[string]FileState
+
+// writeAccountArchive writes manifest, metadata, home directory, MySQL dumps
+// and mail directories into a single tar.gz and returns its size. When parent
+// is set only files that changed since the parent's index are stored.
+func (m *Manager) writeAccountArchive(filePath string, data *AccountData, opts Options, parent *archiveParent) (int64, error) {
+	homeDir := filepath.Join(m.cfg.HomeBaseDir, data.User.Username)
+
+	manifest := Manifest{
+		Version:   ArchiveVersion,
+		Type:      "account",
+		Username:  data.User.Username,
+		HomeDir:   homeDir,
+		CreatedAt: time.Now(),
+	}
+	if parent != nil {
+		manifest.Incremental = true
+		manifest.Parent = filepath.Base(parent.FilePath)
+	}
+	manifest.Hostname, _ = os.Hostname()
+	if !opts.SkipHome {
+		manifest.Contents = append(manifest.Contents, "home")
+	}
+	if !opts.SkipDatabases && len(data.Databases) > 0 {
+		manifest.Contents = append(manifest.Contents, "mysql")
+	}
+	if !opts.SkipMail {
+		manifest.Contents = append(manifest.Contents, "mail")
+	}
+	if len(data.FTPEntries) > 0 {
+		manifest.Contents = append(manifest.Contents, "ftp")
+	}
+
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	// Index of every file that is part of this backup, taken before writing
+	// so it can be stored right after the metadata
+	index := FileIndex{}
+	mailDirs := map[string]string{}
+	if !opts.SkipHome {
+		if err := index.scan(homeDir, "home"); err != nil {
+			return 0, fmt.Errorf("failed to scan home directory: %w", err)
+		}
+	}
+	if !opts.SkipMail {
+		for _, domain := range data.Domains {
+			mailDir := filepath.Join(m.mailRoot(), domain.Name)
+			if _, err := os.Stat(mailDir); err != nil {
+				continue
+			}
+			mailDirs["mail/"+domain.Name] = mailDir
+			if err := index.scan(mailDir, "mail/"+domain.Name); err != nil {
+				return 0, fmt.Errorf("failed to scan mail for %s: %w", domain.Name, err)
+			}
+		}
+	}
+
+	// Directories are always stored, files only when new or changed
+	include := func(name string) bool { return true }
+	if parent != nil {
+		include = func(name string) bool {
+			state, ok := index[name]
+			return !ok || parent.Index[name] != state
+		}
+	}
+
+	// Manifest, metadata and index always come first so restore can validate
+	// the archive before touching anything on disk
+	if err := addJSON(tw, manifestName, manifest); err != nil {
+		return 0, err
+	}
+	if err := addJSON(tw, metadataName, data); err != nil {
+		return 0, err
+	}
+	if err := addJSON(tw, indexName, index); err != nil {
+		return 0, err
+	}
+
+	if !opts.SkipHome {
+		m.progress(opts, "Ev dizini arşivleniyor: %s", homeDir)
+		if err := addTree(tw, homeDir, "home", include); err != nil {
+			return 0, fmt.Errorf("failed to archive home directory: %w", err)
+		}
+	}
+
+	if !opts.SkipDatabases {
+		for _, database := range data.Databases {
+			m.progress(opts, "Veritabanı yedekleniyor: %s", database.Name)
+			if err := m.addDatabaseDump(tw, database.Name); err != nil {
+				return 0, fmt.Errorf("failed to dump database %s: %w", database.Name, err)
+			}
+		}
+	}
+
+	for _, domain := range data.Domains {
+		prefix := "mail/" + domain.Name
+		mailDir, ok := mailDirs[prefix]
+		if !ok {
+			continue
+		}
+		m.progress(opts, "Mail kutuları arşivleniyor: %s", domain.Name)
+		if err := addTree(tw, mailDir, prefix, include); err != nil {
+			return 0, fmt.Errorf("failed to archive mail for %s: %w", domain.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// addDatabaseDump writes mysql/<name>.sql into the archive
+func (m *Manager) addDatabaseDump(tw *tar.Writer, name string) error {
+	entry := "mysql/" + name + ".sql"
+
+	if m.cfg.SimulateMode {
+		// The simulated MySQL manager keeps the CREATE statements on disk
+		simFile := filepath.Join(m.cfg.SimulateBasePath, "mysql", name+".sql")
+		content, err := os.ReadFile(simFile)
+		if err != nil {
+			content = []byte(fmt.Sprintf("-- [SIMÜLASYON] mysqldump %s\n", name))
+		}
+		return addBytes(tw, entry, content, 0600)
+	}
+
+	tmp, err := os.CreateTemp("", "serverpanel-dump-*.sql")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	cmd := exec.Command("mysqldump", "-u", "root", "-p"+os.Getenv("MYSQL_ROOT_PASSWORD"),
+		"--single-transaction", "--routines", "--triggers", "--databases", name)
+	cmd.Stdout = tmp
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s - %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    entry,
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, tmp)
+	return err
+}
+
+func addJSON(tw *tar.Writer, name string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return addBytes(tw, name, content, 0600)
+}
+
+func addBytes(tw *tar.Writer, name string, content []byte, mode int64) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    mode,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// scan records every regular file and symlink below root under prefix
+func (idx FileIndex) scan(root, prefix string) error {
+	if _, err := os.Lstat(root); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		idx[prefix+"/"+filepath.ToSlash(rel)] = FileState{Size: info.Size(), ModTime: info.ModTime().Unix()}
+		return nil
+	})
+}
+
+// addTree adds a directory recursively under prefix. Missing directories are
+// skipped, sockets and devices are ignored. Files for which include returns
+// false are left out; directories are always written. The tree belongs to
+// the account and can change while it is read as root, so the walk goes
+// through an os.Root and files are opened without following symlinks.
+func addTree(tw *tar.Writer, root, prefix string, include func(name string) bool) error {
+	if _, err := os.Lstat(root); os.IsNotExist(err) {
+		return nil
+	}
+	dir, err := os.OpenRoot(root)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return fs.WalkDir(dir.FS(), ".", func(rel string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := prefix
+		if rel != "." {
+			name = prefix + "/" + rel
+		}
+		if !entry.IsDir() && !include(name) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		var file *os.File
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = dir.Readlink(rel); err != nil {
+				return err
+			}
+		case info.IsDir():
+		case info.Mode().IsRegular():
+			// The header is built from the opened file, so a file swapped
+			// for a link or a device after the walk saw it is left out
+			file, err = dir.OpenFile(rel, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+			if err != nil {
+				return nil
+			}
+			defer file.Close()
+			if info, err = file.Stat(); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		default:
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if file == nil {
+			return nil
+		}
+		_, err = io.CopyN(tw, file, hdr.Size)
+		return err
+	})
+}
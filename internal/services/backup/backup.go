@@ -0,0 +1,351 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+)
+
+// ArchiveVersion is written to every manifest. Restore refuses archives with a
+// newer version than this build understands.
+const ArchiveVersion = 1
+
+var (
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrBackupNotFound      = errors.New("backup not found")
+	ErrInvalidArchive      = errors.New("invalid backup archive")
+	ErrUnsupportedVersion  = errors.New("unsupported backup archive version")
+	ErrNotHostingAccount   = errors.New("target user is not a hosting account")
+	ErrNoPackageForRestore = errors.New("no package available for restored account")
+	ErrIncompleteChain     = errors.New("parent of incremental backup is missing")
+	ErrBackupInUse         = errors.New("backup is the base of an incremental backup")
+)
+
+// DB interface for database operations
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Begin() (*sql.Tx, error)
+}
+
+// Manager creates, lists and restores account backups
+type Manager struct {
+	db  DB
+	cfg *config.Config
+}
+
+// Options controls what goes into an account backup
+type Options struct {
+	SkipHome      bool
+	SkipDatabases bool
+	SkipMail      bool
+	// Incremental stores only files changed since the previous backup of the
+	// same schedule. A full backup is taken when there is none or the chain
+	// already holds FullEvery archives.
+	Incremental bool
+	FullEvery   int
+	ScheduleID  int64
+	// Progress receives human readable progress lines (may be nil)
+	Progress func(msg string)
+}
+
+// Record is a row of the backups table
+type Record struct {
+	ID           int64  `json:"id"`
+	UserID       *int64 `json:"user_id,omitempty"`
+	Username     string `json:"username"`
+	Type         string `json:"type"` // full, incremental
+	ParentID     *int64 `json:"parent_id,omitempty"`
+	ScheduleID   *int64 `json:"schedule_id,omitempty"`
+	FilePath     string `json:"file_path"`
+	Size         int64  `json:"size"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// Manifest describes the contents of a backup archive
+type Manifest struct {
+	Version     int       `json:"version"`
+	Type        string    `json:"type"`
+	Incremental bool      `json:"incremental,omitempty"`
+	Parent      string    `json:"parent,omitempty"` // file name of the parent archive
+	Username    string    `json:"username"`
+	HomeDir     string    `json:"home_dir"`
+	Hostname    string    `json:"hostname"`
+	CreatedAt   time.Time `json:"created_at"`
+	Contents    []string  `json:"contents"` // home, mysql, mail, ftp
+}
+
+func NewManager(db DB) *Manager {
+	return &Manager{
+		db:  db,
+		cfg: config.Get(),
+	}
+}
+
+// BackupDir returns the directory where local backup archives are stored
+func (m *Manager) BackupDir() string {
+	return filepath.Join(m.cfg.DataDir, "backups")
+}
+
+// mailRoot returns the virtual mailbox root (simulated in development)
+func (m *Manager) mailRoot() string {
+	if m.cfg.SimulateMode {
+		return filepath.Join(m.cfg.SimulateBasePath, "mail", "vhosts")
+	}
+	return "/var/mail/vhosts"
+}
+
+func (m *Manager) progress(opts Options, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if opts.Progress != nil {
+		opts.Progress(msg)
+	}
+	log.Printf("💾 %s", msg)
+}
+
+// CreateAccountBackup archives a hosting account into a single versioned tar.gz
+func (m *Manager) CreateAccountBackup(userID int64, opts Options) (*Record, error) {
+	data, err := m.loadAccountData(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	username := data.User.Username
+	dir := filepath.Join(m.BackupDir(), username)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	var parent *archiveParent
+	if opts.Incremental {
+		parent = m.findParent(userID, opts)
+	}
+
+	backupType := "full"
+	var parentID, scheduleID interface{}
+	if parent != nil {
+		backupType = "incremental"
+		parentID = parent.ID
+	}
+	if opts.ScheduleID > 0 {
+		scheduleID = opts.ScheduleID
+	}
+
+	suffix := ""
+	if parent != nil {
+		suffix = "-inc"
+	}
+	// Several backups can be taken within the same second (e.g. a schedule
+	// and a manual run), never overwrite an existing archive
+	base := fmt.Sprintf("backup-%s-%s", username, time.Now().Format("20060102-150405"))
+	filePath := filepath.Join(dir, base+suffix+".tar.gz")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			break
+		}
+		filePath = filepath.Join(dir, fmt.Sprintf("%s-%d%s.tar.gz", base, i, suffix))
+	}
+
+	result, err := m.db.Exec(`
+		INSERT INTO backups (user_id, username, type, parent_id, schedule_id, file_path, status)
+		VALUES (?, ?, ?, ?, ?, ?, 'running')
+	`, userID, username, backupType, parentID, scheduleID, filePath)
+	if err != nil {
+		return nil, err
+	}
+	backupID, _ := result.LastInsertId()
+
+	if parent != nil {
+		m.progress(opts, "Artımlı yedekleme başlatıldı: %s (temel: #%d)", username, parent.ID)
+	} else {
+		m.progress(opts, "Yedekleme başlatıldı: %s", username)
+	}
+
+	size, err := m.writeAccountArchive(filePath, data, opts, parent)
+	if err != nil {
+		os.Remove(filePath)
+		m.db.Exec("UPDATE backups SET status = 'failed', error_message = ? WHERE id = ?", err.Error(), backupID)
+		return nil, err
+	}
+
+	m.db.Exec("UPDATE backups SET status = 'completed', size = ? WHERE id = ?", size, backupID)
+	m.progress(opts, "Yedek oluşturuldu: %s (%d bayt)", filePath, size)
+
+	return m.GetBackup(backupID)
+}
+
+// archiveParent is the backup an incremental archive is based on
+type archiveParent struct {
+	ID       int64
+	FilePath string
+	Index    FileIndex
+}
+
+// findParent returns the latest completed backup of the same schedule, or nil
+// when a new full backup should be taken instead
+func (m *Manager) findParent(userID int64, opts Options) *archiveParent {
+	var p archiveParent
+	err := m.db.QueryRow(`
+		SELECT id, file_path FROM backups
+		WHERE user_id = ? AND COALESCE(schedule_id, 0) = ? AND status = 'completed'
+		ORDER BY id DESC LIMIT 1
+	`, userID, opts.ScheduleID).Scan(&p.ID, &p.FilePath)
+	if err != nil {
+		return nil
+	}
+
+	chain, err := m.chain(p.ID)
+	if err != nil || (opts.FullEvery > 0 && len(chain) >= opts.FullEvery) {
+		return nil
+	}
+
+	if p.Index, err = ReadIndex(p.FilePath); err != nil {
+		return nil
+	}
+	return &p
+}
+
+// chain returns the backups needed to restore id, starting with the full backup
+func (m *Manager) chain(id int64) ([]Record, error) {
+	var records []Record
+	for {
+		r, err := m.GetBackup(id)
+		if err == ErrBackupNotFound && len(records) > 0 {
+			return nil, ErrIncompleteChain
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append([]Record{*r}, records...)
+		if r.ParentID == nil {
+			return records, nil
+		}
+		id = *r.ParentID
+	}
+}
+
+const recordColumns = "id, user_id, username, type, parent_id, schedule_id, file_path, size, status, error_message, created_at"
+
+func scanRecord(scanner interface{ Scan(...interface{}) error }) (*Record, error) {
+	var r Record
+	var userID, parentID, scheduleID sql.NullInt64
+	var errMsg sql.NullString
+	err := scanner.Scan(&r.ID, &userID, &r.Username, &r.Type, &parentID, &scheduleID,
+		&r.FilePath, &r.Size, &r.Status, &errMsg, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		r.UserID = &userID.Int64
+	}
+	if parentID.Valid {
+		r.ParentID = &parentID.Int64
+	}
+	if scheduleID.Valid {
+		r.ScheduleID = &scheduleID.Int64
+	}
+	r.ErrorMessage = errMsg.String
+	return &r, nil
+}
+
+// GetBackup returns a single backup record
+func (m *Manager) GetBackup(id int64) (*Record, error) {
+	r, err := scanRecord(m.db.QueryRow("SELECT "+recordColumns+" FROM backups WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrBackupNotFound
+	}
+	return r, err
+}
+
+// ListBackups returns backup records, optionally filtered by username
+func (m *Manager) ListBackups(username string) ([]Record, error) {
+	query := "SELECT " + recordColumns + " FROM backups"
+	var args []interface{}
+	if username != "" {
+		query += " WHERE username = ?"
+		args = append(args, username)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		r, err := scanRecord(rows)
+		if err != nil {
+			continue
+		}
+		records = append(records, *r)
+	}
+
+	return records, nil
+}
+
+// DeleteBackup removes the archive file and its record
+func (m *Manager) DeleteBackup(id int64) error {
+	r, err := m.GetBackup(id)
+	if err != nil {
+		return err
+	}
+
+	var children int
+	m.db.QueryRow("SELECT COUNT(*) FROM backups WHERE parent_id = ?", id).Scan(&children)
+	if children > 0 {
+		return ErrBackupInUse
+	}
+
+	if err := os.Remove(r.FilePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove backup file: %w", err)
+	}
+
+	_, err = m.db.Exec("DELETE FROM backups WHERE id = ?", id)
+	return err
+}
+
+// ImportArchive validates an archive that was copied onto this server and
+// registers it in the backups table
+func (m *Manager) ImportArchive(filePath string) (*Record, error) {
+	manifest, err := ReadManifest(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version < 1 || manifest.Version > ArchiveVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	if manifest.Incremental {
+		// The parent chain only exists on the server that made the backup
+		return nil, ErrIncompleteChain
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var userID sql.NullInt64
+	m.db.QueryRow("SELECT id FROM users WHERE username = ?", manifest.Username).Scan(&userID)
+
+	result, err := m.db.Exec(`
+		INSERT INTO backups (user_id, username, type, file_path, size, status)
+		VALUES (?, ?, 'full', ?, ?, 'completed')
+	`, userID, manifest.Username, filePath, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	return m.GetBackup(id)
+}
@@ -0,0 +1,1039 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+)
+
+var (
+	ErrInvalidCpmove  = errors.New("not a cPanel cpmove archive")
+	ErrImportConflict = errors.New("cPanel import has conflicts")
+)
+
+// CpmoveOptions controls how a cpmove archive is mapped to a panel account
+type CpmoveOptions struct {
+	// Password is the panel password of the imported account. cPanel only
+	// stores a crypt hash of it, which the panel cannot use.
+	Password string
+	// Package overrides the cPanel plan name when looking up the package
+	Package  string
+	Progress func(msg string)
+}
+
+// ImportReport describes what an import creates and what it cannot map
+type ImportReport struct {
+	Username      string                 `json:"username"`
+	Email         string                 `json:"email"`
+	Plan          string                 `json:"plan"`
+	PrimaryDomain string                 `json:"primary_domain"`
+	Domains       []DomainRecord         `json:"domains"`
+	Subdomains    []SubdomainRecord      `json:"subdomains"`
+	Databases     []DatabaseRecord       `json:"databases"`
+	EmailAccounts []string               `json:"email_accounts"`
+	Forwarders    []EmailForwarderRecord `json:"forwarders"`
+	DNSRecords    map[string]int         `json:"dns_records"` // domain -> record count
+	CronJobs      []CronJobRecord        `json:"cron_jobs"`
+	FTPAccounts   map[string]string      `json:"ftp_accounts"` // cPanel name -> panel name
+	HomeFiles     int                    `json:"home_files"`
+	HomeSize      int64                  `json:"home_size"`
+	MailFiles     int                    `json:"mail_files"`
+	// Unmapped lists cPanel items that are left out of the import
+	Unmapped []string `json:"unmapped"`
+	// Conflicts block the import (existing account, domain or database)
+	Conflicts []string `json:"conflicts"`
+}
+
+func (r *ImportReport) unmapped(format string, args ...interface{}) {
+	r.Unmapped = append(r.Unmapped, fmt.Sprintf(format, args...))
+}
+
+// cpmoveSource holds the small metadata files of a cpmove archive
+type cpmoveSource struct {
+	username     string
+	cpUser       map[string]string // cp/<user>: KEY=VALUE
+	userdataMain string
+	userdata     map[string]map[string]string // userdata/<domain>: top-level scalars
+	zones        map[string]string            // dnszones/<domain>.db
+	mysqlGrants  string                       // mysql.sql
+	dumps        []string                     // mysql/<db>.sql
+	mailPasswd   map[string][]string          // homedir/etc/<domain>/passwd users
+	mailShadow   map[string]map[string]string // homedir/etc/<domain>/shadow hashes
+	mailQuota    map[string]map[string]int64  // homedir/etc/<domain>/quota bytes
+	valiases     map[string]string            // va/<domain>
+	crontab      string                       // cron/<user>
+	ftpPasswd    string                       // proftpdpasswd
+	hasPsql      bool
+	hasSSL       bool
+	homeFiles    int
+	homeSize     int64
+	mailEntries  map[string]int // homedir/mail/<domain> -> file count
+}
+
+// walkCpmove calls fn for every entry of a cpmove archive with the leading
+// cpmove-<user>/ directory removed. An old style homedir.tar is descended
+// into, its entries are reported under homedir/.
+func walkCpmove(archivePath string, fn func(name, root string, hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	br := bufio.NewReader(f)
+	r = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return ErrInvalidCpmove
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCpmove, err)
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+		root, rest, _ := strings.Cut(name, "/")
+		if root == "" {
+			continue
+		}
+
+		if rest == "homedir.tar" {
+			inner := tar.NewReader(tr)
+			for {
+				ihdr, err := inner.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return fmt.Errorf("%w: homedir.tar: %v", ErrInvalidCpmove, err)
+				}
+				iname := strings.TrimPrefix(strings.TrimPrefix(ihdr.Name, "./"), "/")
+				if iname == "" || iname == "." {
+					iname = ""
+				}
+				if err := fn(path.Join("homedir", iname), root, ihdr, inner); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := fn(rest, root, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// readCpmove collects the metadata of a cpmove archive in a single pass
+func readCpmove(archivePath string) (*cpmoveSource, error) {
+	src := &cpmoveSource{
+		cpUser:      map[string]string{},
+		userdata:    map[string]map[string]string{},
+		zones:       map[string]string{},
+		mailPasswd:  map[string][]string{},
+		mailShadow:  map[string]map[string]string{},
+		mailQuota:   map[string]map[string]int64{},
+		valiases:    map[string]string{},
+		mailEntries: map[string]int{},
+	}
+	seenRoot := ""
+
+	read := func(r io.Reader) string {
+		content, _ := io.ReadAll(io.LimitReader(r, 16<<20))
+		return string(content)
+	}
+
+	err := walkCpmove(archivePath, func(name, root string, hdr *tar.Header, r io.Reader) error {
+		if seenRoot == "" {
+			seenRoot = root
+		}
+		isFile := hdr.Typeflag == tar.TypeReg
+		dir, base := path.Split(name)
+
+		switch {
+		case strings.HasPrefix(name, "cp/") && isFile && base != "":
+			src.username = base
+			for _, line := range strings.Split(read(r), "\n") {
+				if key, value, ok := strings.Cut(line, "="); ok {
+					src.cpUser[strings.TrimSpace(key)] = strings.TrimSpace(value)
+				}
+			}
+		case name == "userdata/main" && isFile:
+			src.userdataMain = read(r)
+		case dir == "userdata/" && isFile && !strings.Contains(base, "_SSL") && !strings.HasSuffix(base, ".cache"):
+			src.userdata[strings.ToLower(base)] = parseYAMLScalars(read(r))
+		case dir == "dnszones/" && strings.HasSuffix(base, ".db") && isFile:
+			src.zones[strings.ToLower(strings.TrimSuffix(base, ".db"))] = read(r)
+		case name == "mysql.sql" && isFile:
+			src.mysqlGrants = read(r)
+		case dir == "mysql/" && strings.HasSuffix(base, ".sql") && isFile:
+			src.dumps = append(src.dumps, strings.TrimSuffix(base, ".sql"))
+		case dir == "va/" && isFile && base != "":
+			src.valiases[strings.ToLower(base)] = read(r)
+		case dir == "cron/" && isFile && base != "":
+			src.crontab = read(r)
+		case name == "proftpdpasswd" && isFile:
+			src.ftpPasswd = read(r)
+		case strings.HasPrefix(name, "psql/") && isFile:
+			src.hasPsql = true
+		case (strings.HasPrefix(name, "sslkeys/") || strings.HasPrefix(name, "sslcerts/") || strings.HasPrefix(name, "ssl/")) && isFile:
+			src.hasSSL = true
+
+		case strings.HasPrefix(name, "homedir/etc/") && isFile:
+			// homedir/etc/<domain>/{passwd,shadow,quota}
+			parts := strings.Split(strings.TrimPrefix(name, "homedir/etc/"), "/")
+			if len(parts) == 2 {
+				domain := strings.ToLower(parts[0])
+				content := read(r)
+				switch parts[1] {
+				case "passwd":
+					for _, line := range strings.Split(content, "\n") {
+						if user, _, ok := strings.Cut(line, ":"); ok && user != "" {
+							src.mailPasswd[domain] = append(src.mailPasswd[domain], user)
+						}
+					}
+				case "shadow":
+					src.mailShadow[domain] = map[string]string{}
+					for _, line := range strings.Split(content, "\n") {
+						fields := strings.Split(line, ":")
+						if len(fields) >= 2 && fields[0] != "" {
+							src.mailShadow[domain][fields[0]] = fields[1]
+						}
+					}
+				case "quota":
+					src.mailQuota[domain] = map[string]int64{}
+					for _, line := range strings.Split(content, "\n") {
+						if user, quota, ok := strings.Cut(line, ":"); ok {
+							n, _ := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+							src.mailQuota[domain][user] = n
+						}
+					}
+				}
+			}
+			src.homeFiles++
+			src.homeSize += hdr.Size
+
+		case strings.HasPrefix(name, "homedir/"):
+			if isFile {
+				parts := strings.SplitN(strings.TrimPrefix(name, "homedir/"), "/", 3)
+				if len(parts) == 3 && parts[0] == "mail" {
+					src.mailEntries[strings.ToLower(parts[1])]++
+				}
+				src.homeFiles++
+				src.homeSize += hdr.Size
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if src.username == "" {
+		src.username = strings.TrimPrefix(seenRoot, "cpmove-")
+	}
+	if src.username == "" || (src.userdataMain == "" && src.cpUser["DNS"] == "") {
+		return nil, ErrInvalidCpmove
+	}
+
+	// Names from the archive end up in paths and system configuration
+	validator := account.NewService(nil)
+	if err := validator.ValidateUsername(src.username); err != nil {
+		return nil, fmt.Errorf("%w: username %q: %v", ErrInvalidCpmove, src.username, err)
+	}
+	for domain := range src.userdata {
+		if validator.ValidateDomain(domain) != nil {
+			delete(src.userdata, domain)
+		}
+	}
+	if err := validator.ValidateDomain(src.mainDomain()); err != nil {
+		return nil, fmt.Errorf("%w: main domain %q: %v", ErrInvalidCpmove, src.mainDomain(), err)
+	}
+	return src, nil
+}
+
+// homeDir returns the cPanel home directory of the account
+func (s *cpmoveSource) homeDir() string {
+	if main, ok := s.userdata[s.mainDomain()]; ok && main["homedir"] != "" {
+		return main["homedir"]
+	}
+	return "/home/" + s.username
+}
+
+func (s *cpmoveSource) mainDomain() string {
+	if d := yamlScalar(s.userdataMain, "main_domain"); d != "" {
+		return strings.ToLower(d)
+	}
+	return strings.ToLower(s.cpUser["DNS"])
+}
+
+// buildCpmoveData maps the cPanel metadata onto panel rows. Conflicts with
+// existing panel data and unmappable items are recorded in the report.
+func (m *Manager) buildCpmoveData(src *cpmoveSource, opts CpmoveOptions) (*AccountData, *ImportReport) {
+	oldHome := src.homeDir()
+	username := src.username
+	mainDomain := src.mainDomain()
+
+	report := &ImportReport{
+		Username:      username,
+		Email:         src.cpUser["CONTACTEMAIL"],
+		Plan:          src.cpUser["PLAN"],
+		PrimaryDomain: mainDomain,
+		DNSRecords:    map[string]int{},
+		FTPAccounts:   map[string]string{},
+		HomeFiles:     src.homeFiles,
+		HomeSize:      src.homeSize,
+		Unmapped:      []string{},
+		Conflicts:     []string{},
+	}
+
+	data := &AccountData{
+		User: UserRecord{
+			Username: username,
+			Email:    report.Email,
+			Active:   src.cpUser["SUSPENDED"] != "1",
+		},
+		MailPasswords: map[string]string{},
+	}
+	if data.User.Email == "" {
+		data.User.Email = username + "@" + mainDomain
+	}
+	plan := report.Plan
+	if opts.Package != "" {
+		plan = opts.Package
+	}
+	if plan != "" {
+		data.Package = &PackageRecord{Name: plan}
+		var count int
+		if m.db.QueryRow("SELECT COUNT(*) FROM packages WHERE name = ?", plan).Scan(&count); count == 0 {
+			report.unmapped("package %s: not found, the first panel package will be used", plan)
+		}
+	}
+
+	// Domains: main, addon (with their backing subdomain) and parked
+	docRoot := func(name, fallback string) string {
+		if u, ok := src.userdata[name]; ok && u["documentroot"] != "" {
+			return u["documentroot"]
+		}
+		return fallback
+	}
+	mainRoot := docRoot(mainDomain, oldHome+"/public_html")
+	data.Domains = append(data.Domains, DomainRecord{
+		Name: mainDomain, DomainType: "primary", DocumentRoot: mainRoot, PHPVersion: m.cfg.PHPVersion, Active: true,
+	})
+
+	validator := account.NewService(nil)
+	addons := yamlMap(src.userdataMain, "addon_domains")
+	backing := map[string]bool{}
+	for _, addon := range sortedKeys(addons) {
+		sub := strings.ToLower(addons[addon])
+		backing[sub] = true
+		if validator.ValidateDomain(addon) != nil {
+			report.unmapped("addon domain %s: invalid name", addon)
+			continue
+		}
+		root := docRoot(sub, docRoot(addon, oldHome+"/public_html/"+addon))
+		data.Domains = append(data.Domains, DomainRecord{
+			Name: strings.ToLower(addon), DomainType: "addon", DocumentRoot: root, PHPVersion: m.cfg.PHPVersion, Active: true,
+		})
+	}
+	for _, parked := range yamlList(src.userdataMain, "parked_domains") {
+		if validator.ValidateDomain(parked) != nil {
+			report.unmapped("parked domain %s: invalid name", parked)
+			continue
+		}
+		data.Domains = append(data.Domains, DomainRecord{
+			Name: strings.ToLower(parked), DomainType: "alias", ParentDomain: mainDomain,
+			DocumentRoot: mainRoot, PHPVersion: m.cfg.PHPVersion, Active: true,
+		})
+	}
+
+	domainNames := map[string]bool{}
+	for _, d := range data.Domains {
+		domainNames[d.Name] = true
+	}
+
+	for _, sub := range yamlList(src.userdataMain, "sub_domains") {
+		sub = strings.ToLower(sub)
+		if backing[sub] {
+			continue
+		}
+		if validator.ValidateDomain(sub) != nil {
+			report.unmapped("subdomain %s: invalid name", sub)
+			continue
+		}
+		parent := ""
+		for name := range domainNames {
+			if strings.HasSuffix(sub, "."+name) && len(name) > len(parent) {
+				parent = name
+			}
+		}
+		if parent == "" {
+			report.unmapped("subdomain %s: parent domain not part of the account", sub)
+			continue
+		}
+		label := strings.TrimSuffix(sub, "."+parent)
+		data.Subdomains = append(data.Subdomains, SubdomainRecord{
+			Domain: parent, Name: label, FullName: sub,
+			DocumentRoot: docRoot(sub, oldHome+"/public_html/"+label), Active: true,
+		})
+	}
+
+	m.checkCpmoveDomains(data, report, oldHome)
+	for name := range domainNames {
+		if !data.hasDomain(name) {
+			delete(domainNames, name)
+		}
+	}
+
+	m.mapCpmoveDNS(src, data, report)
+	m.mapCpmoveDatabases(src, data, report)
+	mapCpmoveMail(src, data, report, domainNames)
+	mapCpmoveCron(src, data, report)
+	mapCpmoveFTP(src, data, report, oldHome)
+
+	if src.hasPsql {
+		report.unmapped("PostgreSQL databases: not supported by the panel")
+	}
+	if src.hasSSL {
+		report.unmapped("SSL certificates: request new certificates after the import")
+	}
+	report.unmapped("system (SSH) password: the account gets the panel password only")
+
+	report.Domains = data.Domains
+	report.Subdomains = data.Subdomains
+	report.Databases = data.Databases
+	report.CronJobs = data.CronJobs
+	report.Forwarders = data.EmailForwarders
+	for _, e := range data.EmailAccounts {
+		report.EmailAccounts = append(report.EmailAccounts, e.Email)
+	}
+	for domain, count := range src.mailEntries {
+		if domainNames[domain] {
+			report.MailFiles += count
+		}
+	}
+
+	m.checkCpmoveConflicts(data, report)
+	return data, report
+}
+
+// checkCpmoveDomains applies the checks restore runs on archived domains,
+// so document roots outside the cPanel home show up in the report instead
+// of being dropped silently during the restore. A main domain that fails
+// them blocks the import.
+func (m *Manager) checkCpmoveDomains(data *AccountData, report *ImportReport, oldHome string) {
+	newHome := filepath.Join(m.cfg.HomeBaseDir, data.User.Username)
+	moved := AccountData{
+		Domains:    append([]DomainRecord(nil), data.Domains...),
+		Subdomains: append([]SubdomainRecord(nil), data.Subdomains...),
+	}
+	moved.rewriteHome(oldHome, newHome)
+
+	var domains []DomainRecord
+	for i, d := range data.Domains {
+		if err := checkDomain(moved.Domains[i], newHome); err != nil {
+			if d.DomainType == "primary" {
+				report.Conflicts = append(report.Conflicts, fmt.Sprintf("main domain %s: %v", d.Name, err))
+			} else {
+				report.unmapped("domain %s: %v", d.Name, err)
+			}
+			continue
+		}
+		domains = append(domains, d)
+	}
+	data.Domains = domains
+
+	var subdomains []SubdomainRecord
+	for i, s := range data.Subdomains {
+		if !data.hasDomain(s.Domain) {
+			report.unmapped("subdomain %s: parent domain left out", s.FullName)
+			continue
+		}
+		if err := checkSubdomain(moved.Subdomains[i], newHome); err != nil {
+			report.unmapped("subdomain %s: %v", s.FullName, err)
+			continue
+		}
+		subdomains = append(subdomains, s)
+	}
+	data.Subdomains = subdomains
+}
+
+func (m *Manager) mapCpmoveDNS(src *cpmoveSource, data *AccountData, report *ImportReport) {
+	oldIP := src.cpUser["IP"]
+	newIP := m.cfg.ServerIP
+	moved := 0
+
+	for _, d := range data.Domains {
+		content, ok := src.zones[d.Name]
+		if !ok {
+			report.unmapped("DNS zone of %s: not found in archive, default records will be used", d.Name)
+			continue
+		}
+		records, errs := parseZoneFile(content, d.Name)
+		for _, err := range errs {
+			report.unmapped("DNS %s: %v", d.Name, err)
+		}
+
+		count := 0
+		for _, r := range records {
+			switch r.Type {
+			case "SOA":
+				// The panel writes its own SOA record
+				continue
+			case "A", "AAAA", "CNAME", "MX", "TXT", "NS", "SRV", "CAA":
+			default:
+				report.unmapped("DNS %s: %s record %s not supported", d.Name, r.Type, r.Name)
+				continue
+			}
+			if r.Type == "A" && oldIP != "" && r.Content == oldIP {
+				r.Content = newIP
+				moved++
+			}
+			data.DNSRecords = append(data.DNSRecords, DNSRecord{
+				Domain: d.Name, Name: r.Name, Type: r.Type, Content: r.Content,
+				TTL: r.TTL, Priority: r.Priority, Active: true,
+			})
+			count++
+		}
+		report.DNSRecords[d.Name] = count
+	}
+
+	if moved > 0 {
+		report.unmapped("DNS: %d A records pointed to the old server IP %s and were changed to %s", moved, oldIP, newIP)
+	}
+}
+
+var (
+	// GRANT USAGE ON *.* TO 'u'@'localhost' IDENTIFIED BY PASSWORD '*HASH'
+	grantPasswordRe = regexp.MustCompile(`(?i)TO\s+'([^']+)'@'([^']+)'\s+IDENTIFIED\s+BY\s+PASSWORD\s+'([^']*)'`)
+	// CREATE USER 'u'@'localhost' IDENTIFIED WITH 'mysql_native_password' AS '*HASH'
+	createUserRe = regexp.MustCompile(`(?i)(?:CREATE|ALTER)\s+USER\s+(?:IF\s+NOT\s+EXISTS\s+)?'([^']+)'@'([^']+)'\s+IDENTIFIED\s+(?:WITH|VIA)\s+'?(\w+)'?\s+(?:AS|USING)\s+'([^']*)'`)
+	// GRANT ALL PRIVILEGES ON `db`.* TO 'u'@'localhost'
+	grantDatabaseRe = regexp.MustCompile("(?i)GRANT\\s+.+?\\s+ON\\s+`([^`]+)`\\.\\*\\s+TO\\s+'([^']+)'@'([^']+)'")
+	nativeHashRe    = regexp.MustCompile(`^\*[0-9A-Fa-f]{40}$`)
+)
+
+func (m *Manager) mapCpmoveDatabases(src *cpmoveSource, data *AccountData, report *ImportReport) {
+	hashes := map[string]string{}
+	for _, match := range grantPasswordRe.FindAllStringSubmatch(src.mysqlGrants, -1) {
+		if match[2] == "localhost" {
+			hashes[match[1]] = match[3]
+		}
+	}
+	for _, match := range createUserRe.FindAllStringSubmatch(src.mysqlGrants, -1) {
+		if match[2] != "localhost" {
+			continue
+		}
+		if strings.EqualFold(match[3], "mysql_native_password") {
+			hashes[match[1]] = match[4]
+		} else {
+			hashes[match[1]] = ""
+		}
+	}
+
+	dumps := map[string]bool{}
+	for _, name := range src.dumps {
+		dumps[name] = true
+	}
+
+	grants := map[string][]string{}
+	remote := map[string]bool{}
+	for _, match := range grantDatabaseRe.FindAllStringSubmatch(src.mysqlGrants, -1) {
+		db := strings.NewReplacer(`\_`, "_", `\%`, "%").Replace(match[1])
+		user, host := match[2], match[3]
+		if strings.ContainsAny(db, "%*") || user == src.username {
+			// Wildcard grants belong to the cPanel account user itself
+			continue
+		}
+		if host != "localhost" {
+			if !remote[user+"@"+host] {
+				report.unmapped("MySQL user %s@%s: only localhost users are supported", user, host)
+				remote[user+"@"+host] = true
+			}
+			continue
+		}
+		grants[db] = append(grants[db], user)
+	}
+
+	generated := map[string]string{}
+	for _, name := range src.dumps {
+		if !validMySQLName(name, src.username) {
+			report.unmapped("MySQL database %s: invalid name or not prefixed with %s_", name, src.username)
+			continue
+		}
+		d := DatabaseRecord{Name: name, Type: "mysql"}
+		for _, user := range grants[name] {
+			if !validMySQLName(user, src.username) {
+				report.unmapped("MySQL user %s: invalid name or not prefixed with %s_", user, src.username)
+				continue
+			}
+			u := DatabaseUserRecord{Username: user, Host: "localhost"}
+			hash := hashes[user]
+			switch {
+			case nativeHashRe.MatchString(hash):
+				u.PasswordHash = hash
+			default:
+				// Other plugins store binary hashes that cannot be moved
+				if generated[user] == "" {
+					generated[user] = randomPassword()
+					report.unmapped("MySQL user %s: password hash not portable, a new password was generated", user)
+				}
+				u.Password = generated[user]
+			}
+			d.Users = append(d.Users, u)
+		}
+		data.Databases = append(data.Databases, d)
+	}
+
+	for db := range grants {
+		if !dumps[db] {
+			report.unmapped("MySQL database %s: grant found but no dump in archive", db)
+		}
+	}
+}
+
+func mapCpmoveMail(src *cpmoveSource, data *AccountData, report *ImportReport, domainNames map[string]bool) {
+	for _, domain := range sortedKeys(src.mailPasswd) {
+		if !domainNames[domain] {
+			report.unmapped("mail accounts of %s: domain not part of the account", domain)
+			continue
+		}
+		for _, user := range src.mailPasswd[domain] {
+			email := strings.ToLower(user + "@" + domain)
+			quotaMB := int(src.mailQuota[domain][user] / (1024 * 1024))
+			if quotaMB == 0 {
+				quotaMB = 1024
+			}
+
+			// Dovecot verifies crypt(3) hashes ($1$, $5$, $6$) with {CRYPT}; a
+			// bcrypt hash of a random password falls back to BLF-CRYPT
+			hash := src.mailShadow[domain][user]
+			if strings.HasPrefix(hash, "$") {
+				data.MailPasswords[email] = "{CRYPT}" + hash
+			} else {
+				report.unmapped("mail %s: no usable password hash, set a new password", email)
+				hash, _ = auth.HashPassword(randomPassword())
+			}
+
+			data.EmailAccounts = append(data.EmailAccounts, EmailAccountRecord{
+				Domain: domain, Email: email, PasswordHash: hash, QuotaMB: quotaMB, Active: true,
+			})
+		}
+	}
+
+	for _, domain := range sortedKeys(src.valiases) {
+		if !domainNames[domain] {
+			continue
+		}
+		for _, line := range strings.Split(src.valiases[domain], "\n") {
+			source, targets, ok := strings.Cut(line, ":")
+			source = strings.ToLower(strings.TrimSpace(source))
+			if !ok || source == "" {
+				continue
+			}
+			if source == "*" {
+				report.unmapped("default address (catch-all) of %s: not supported", domain)
+				continue
+			}
+			for _, target := range strings.Split(targets, ",") {
+				target = strings.TrimSpace(target)
+				switch {
+				case target == "":
+				case strings.HasPrefix(target, "|"), strings.HasPrefix(target, ":"), strings.HasPrefix(target, "/"):
+					report.unmapped("forwarder %s -> %s: pipes, files and :fail: are not supported", source, target)
+				default:
+					data.EmailForwarders = append(data.EmailForwarders, EmailForwarderRecord{
+						Domain: domain, Source: source, Destination: strings.ToLower(target), Active: true,
+					})
+				}
+			}
+		}
+	}
+}
+
+var cronSpecials = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func mapCpmoveCron(src *cpmoveSource, data *AccountData, report *ImportReport) {
+	for _, line := range strings.Split(src.crontab, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		var schedule []string
+		var command string
+		switch {
+		case strings.HasPrefix(fields[0], "@"):
+			spec, ok := cronSpecials[fields[0]]
+			if !ok || len(fields) < 2 {
+				report.unmapped("cron: %s", line)
+				continue
+			}
+			schedule = strings.Fields(spec)
+			command = strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		case len(fields) >= 6:
+			schedule = fields[:5]
+			command = strings.Join(fields[5:], " ")
+		default:
+			// Environment lines (MAILTO=, SHELL=) and anything unparsable
+			report.unmapped("cron: %s", line)
+			continue
+		}
+
+		data.CronJobs = append(data.CronJobs, CronJobRecord{
+			Name:     fmt.Sprintf("cPanel cron #%d", len(data.CronJobs)+1),
+			Command:  command,
+			Schedule: strings.Join(schedule, " "),
+			Minute:   schedule[0],
+			Hour:     schedule[1],
+			Day:      schedule[2],
+			Month:    schedule[3],
+			Weekday:  schedule[4],
+			Active:   true,
+		})
+	}
+}
+
+// mapCpmoveFTP converts proftpdpasswd lines into panel FTP accounts named
+// <user>_<login> and the matching pureftpd.passwd entries. cPanel stores
+// crypt(3) hashes which Pure-FTPd accepts as they are.
+func mapCpmoveFTP(src *cpmoveSource, data *AccountData, report *ImportReport, oldHome string) {
+	for _, line := range strings.Split(src.ftpPasswd, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 6 || fields[0] == "" {
+			continue
+		}
+		login, hash, home := fields[0], fields[1], fields[5]
+
+		// The account user, its log user and anonymous FTP are cPanel internals
+		if login == src.username || login == src.username+"_logs" || login == "ftp" || login == "anonymous" {
+			continue
+		}
+		if home != oldHome && !strings.HasPrefix(home, oldHome+"/") {
+			report.unmapped("FTP %s: home directory %s is outside the account", login, home)
+			continue
+		}
+
+		name, _, _ := strings.Cut(login, "@")
+		panelName := src.username + "_" + name
+		if _, exists := report.FTPAccounts[login]; exists {
+			continue
+		}
+		report.FTPAccounts[login] = panelName
+
+		data.FTPAccounts = append(data.FTPAccounts, FTPAccountRecord{
+			Username: panelName, PasswordHash: hash, HomeDirectory: home, Active: true,
+		})
+		if strings.HasPrefix(hash, "$") {
+			// uid and gid are remapped to the system user when restored
+			entry := []string{panelName, hash, "0", "0", "", home + "/./"}
+			entry = append(entry, make([]string, 12)...)
+			data.FTPEntries = append(data.FTPEntries, strings.Join(entry, ":"))
+		} else {
+			report.unmapped("FTP %s: no usable password hash, set a new password", login)
+		}
+	}
+}
+
+// checkCpmoveConflicts records panel data that would clash with the import
+func (m *Manager) checkCpmoveConflicts(data *AccountData, report *ImportReport) {
+	var count int
+	if m.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", data.User.Username).Scan(&count); count > 0 {
+		report.Conflicts = append(report.Conflicts, fmt.Sprintf("username %s already exists", data.User.Username))
+	}
+	for _, d := range data.Domains {
+		if m.db.QueryRow("SELECT COUNT(*) FROM domains WHERE name = ?", d.Name).Scan(&count); count > 0 {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("domain %s already exists", d.Name))
+		}
+	}
+	for _, d := range data.Databases {
+		if m.db.QueryRow("SELECT COUNT(*) FROM databases WHERE name = ?", d.Name).Scan(&count); count > 0 {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("database %s already exists", d.Name))
+		}
+		for _, u := range d.Users {
+			if m.db.QueryRow("SELECT COUNT(*) FROM database_users WHERE db_username = ?", u.Username).Scan(&count); count > 0 {
+				report.Conflicts = append(report.Conflicts, fmt.Sprintf("database user %s already exists", u.Username))
+			}
+		}
+	}
+	for _, e := range data.EmailAccounts {
+		if m.db.QueryRow("SELECT COUNT(*) FROM email_accounts WHERE email = ?", e.Email).Scan(&count); count > 0 {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("email account %s already exists", e.Email))
+		}
+	}
+	for _, f := range data.FTPAccounts {
+		if m.db.QueryRow("SELECT COUNT(*) FROM ftp_accounts WHERE username = ?", f.Username).Scan(&count); count > 0 {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("FTP account %s already exists", f.Username))
+		}
+	}
+}
+
+// InspectCpmove returns the dry-run report of a cpmove archive without
+// changing anything
+func (m *Manager) InspectCpmove(archivePath string, opts CpmoveOptions) (*ImportReport, error) {
+	src, err := readCpmove(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	_, report := m.buildCpmoveData(src, opts)
+	return report, nil
+}
+
+// ConvertCpmove rewrites a cpmove archive into a panel backup archive and
+// registers it as a backup, ready to be restored. The import is refused while
+// the report lists conflicts.
+func (m *Manager) ConvertCpmove(archivePath string, opts CpmoveOptions) (*Record, *ImportReport, error) {
+	progressOpts := Options{Progress: opts.Progress}
+
+	m.progress(progressOpts, "cPanel arşivi inceleniyor: %s", filepath.Base(archivePath))
+	src, err := readCpmove(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, report := m.buildCpmoveData(src, opts)
+	if len(report.Conflicts) > 0 {
+		return nil, report, fmt.Errorf("%w: %s", ErrImportConflict, strings.Join(report.Conflicts, ", "))
+	}
+
+	if opts.Password == "" {
+		return nil, report, errors.New("password is required")
+	}
+	hash, err := auth.HashPassword(opts.Password)
+	if err != nil {
+		return nil, report, err
+	}
+	data.User.PasswordHash = hash
+
+	dir := filepath.Join(m.BackupDir(), src.username)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, report, err
+	}
+	filePath := filepath.Join(dir, fmt.Sprintf("cpmove-%s-%s.tar.gz", src.username, time.Now().Format("20060102-150405")))
+
+	m.progress(progressOpts, "Panel arşivine dönüştürülüyor: %s", filepath.Base(filePath))
+	if err := m.writeCpmoveArchive(archivePath, filePath, src, data); err != nil {
+		os.Remove(filePath)
+		return nil, report, err
+	}
+
+	record, err := m.ImportArchive(filePath)
+	if err != nil {
+		os.Remove(filePath)
+		return nil, report, err
+	}
+	return record, report, nil
+}
+
+// writeCpmoveArchive streams the home directory, maildirs and MySQL dumps of
+// the cpmove archive into a panel archive next to the mapped metadata
+func (m *Manager) writeCpmoveArchive(archivePath, filePath string, src *cpmoveSource, data *AccountData) error {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	manifest := Manifest{
+		Version:   ArchiveVersion,
+		Type:      "account",
+		Username:  data.User.Username,
+		HomeDir:   src.homeDir(),
+		CreatedAt: time.Now(),
+		Contents:  []string{"home", "mysql", "mail"},
+	}
+	manifest.Hostname = "cpanel:" + src.cpUser["IP"]
+	if len(data.FTPEntries) > 0 {
+		manifest.Contents = append(manifest.Contents, "ftp")
+	}
+	if err := addJSON(tw, manifestName, manifest); err != nil {
+		return err
+	}
+	if err := addJSON(tw, metadataName, data); err != nil {
+		return err
+	}
+
+	mailDomains := map[string]bool{}
+	for _, d := range data.Domains {
+		mailDomains[d.Name] = true
+	}
+	databases := map[string]bool{}
+	for _, d := range data.Databases {
+		databases[d.Name] = true
+	}
+
+	err = walkCpmove(archivePath, func(name, root string, hdr *tar.Header, r io.Reader) error {
+		var target string
+		switch {
+		case name == "homedir" || strings.HasPrefix(name, "homedir/"):
+			rel := strings.TrimPrefix(strings.TrimPrefix(name, "homedir"), "/")
+			target = path.Join("home", rel)
+			// homedir/mail/<domain>/<user>/ holds the maildirs of the
+			// virtual mailboxes, everything else stays in the home directory
+			if parts := strings.SplitN(rel, "/", 3); len(parts) >= 2 && parts[0] == "mail" && mailDomains[strings.ToLower(parts[1])] {
+				target = path.Join("mail", strings.ToLower(parts[1]))
+				if len(parts) == 3 {
+					target = path.Join(target, parts[2])
+				}
+			}
+		case strings.HasPrefix(name, "mysql/") && strings.HasSuffix(name, ".sql"):
+			if !databases[strings.TrimSuffix(strings.TrimPrefix(name, "mysql/"), ".sql")] {
+				return nil
+			}
+			target = name
+		default:
+			return nil
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+		default:
+			return nil
+		}
+
+		out := *hdr
+		out.Name = target
+		if hdr.Typeflag == tar.TypeDir {
+			out.Name += "/"
+		}
+		out.Uname, out.Gname = "", ""
+		if err := tw.WriteHeader(&out); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(tw, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// parseYAMLScalars returns the top-level "key: value" pairs of a cPanel
+// userdata file. Nested structures are ignored.
+func parseYAMLScalars(content string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" || line[0] == ' ' || line[0] == '-' || line[0] == '#' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(key)] = unquoteYAML(value)
+	}
+	return values
+}
+
+func yamlScalar(content, key string) string {
+	return parseYAMLScalars(content)[key]
+}
+
+// yamlBlock returns the indented lines below a top-level key
+func yamlBlock(content, key string) []string {
+	var block []string
+	inBlock := false
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '-' {
+			k, value, _ := strings.Cut(line, ":")
+			inBlock = strings.TrimSpace(k) == key
+			// Flow style: key: [] or key: {}
+			if inBlock && strings.TrimSpace(value) != "" {
+				return nil
+			}
+			continue
+		}
+		if inBlock {
+			block = append(block, strings.TrimSpace(line))
+		}
+	}
+	return block
+}
+
+// yamlList reads a block sequence ("  - item") below a top-level key
+func yamlList(content, key string) []string {
+	var items []string
+	for _, line := range yamlBlock(content, key) {
+		if strings.HasPrefix(line, "- ") {
+			items = append(items, unquoteYAML(strings.TrimPrefix(line, "- ")))
+		}
+	}
+	return items
+}
+
+// yamlMap reads a block mapping ("  key: value") below a top-level key
+func yamlMap(content, key string) map[string]string {
+	items := map[string]string{}
+	for _, line := range yamlBlock(content, key) {
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			items[unquoteYAML(k)] = unquoteYAML(v)
+		}
+	}
+	return items
+}
+
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
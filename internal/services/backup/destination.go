@@ -0,0 +1,644 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+)
+
+const (
+	DestinationLocal = "local"
+	DestinationS3    = "s3"
+	DestinationSFTP  = "sftp"
+)
+
+// checksumSuffix is the sidecar written next to every uploaded archive. It
+// uses the sha256sum format so archives can be verified by hand as well.
+const checksumSuffix = ".sha256"
+
+var (
+	ErrDestinationNotFound = errors.New("backup destination not found")
+	ErrInvalidDestination  = errors.New("invalid backup destination")
+	ErrRemoteNotFound      = errors.New("remote archive not found")
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+)
+
+// Destination is an offsite location archives are copied to. Names are
+// slash separated paths relative to the destination root.
+type Destination interface {
+	// Test checks that the destination is reachable and writable
+	Test() error
+	// Put stores size bytes from r under name. checksum is the hex SHA-256
+	// of the content.
+	Put(name string, r io.Reader, size int64, checksum string) error
+	// Get opens a stored file for reading
+	Get(name string) (io.ReadCloser, error)
+	// List returns every stored file
+	List() ([]RemoteFile, error)
+	// Delete removes a stored file
+	Delete(name string) error
+}
+
+// verifiedDestination is implemented by destinations that check the
+// checksum passed to Put on the server side, so reading the upload back is
+// not needed
+type verifiedDestination interface {
+	verifiesChecksum() bool
+}
+
+// RemoteFile is an archive stored on a destination
+type RemoteFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"checksum,omitempty"`
+}
+
+// DestinationConfig holds the non-secret settings of every destination type
+type DestinationConfig struct {
+	// local
+	Path string `json:"path,omitempty"`
+
+	// s3
+	Endpoint    string `json:"endpoint,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	VirtualHost bool   `json:"virtual_host,omitempty"` // bucket.endpoint instead of endpoint/bucket
+
+	// sftp (Path is the remote directory)
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	HostKey  string `json:"host_key,omitempty"` // SHA256 fingerprint, public key or known_hosts line
+}
+
+// DestinationCredentials are encrypted with auth.EncryptSecret before storage
+type DestinationCredentials struct {
+	AccessKey  string `json:"access_key,omitempty"`
+	SecretKey  string `json:"secret_key,omitempty"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+func (c DestinationCredentials) empty() bool {
+	return c == DestinationCredentials{}
+}
+
+// DestinationRecord is a row of the backup_destinations table
+type DestinationRecord struct {
+	ID             int64             `json:"id"`
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	Config         DestinationConfig `json:"config"`
+	HasCredentials bool              `json:"has_credentials"`
+	Active         bool              `json:"active"`
+	LastTestAt     string            `json:"last_test_at,omitempty"`
+	LastTestStatus string            `json:"last_test_status,omitempty"`
+	CreatedAt      string            `json:"created_at"`
+
+	credentials DestinationCredentials
+}
+
+// Validate checks the required settings of the destination type
+func (d *DestinationRecord) Validate() error {
+	d.Name = strings.TrimSpace(d.Name)
+	if d.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDestination)
+	}
+
+	c := &d.Config
+	switch d.Type {
+	case DestinationLocal:
+		if !filepath.IsAbs(c.Path) {
+			return fmt.Errorf("%w: path must be absolute", ErrInvalidDestination)
+		}
+	case DestinationS3:
+		if c.Endpoint == "" || c.Bucket == "" {
+			return fmt.Errorf("%w: endpoint and bucket are required", ErrInvalidDestination)
+		}
+		if !strings.HasPrefix(c.Endpoint, "http://") && !strings.HasPrefix(c.Endpoint, "https://") {
+			c.Endpoint = "https://" + c.Endpoint
+		}
+		c.Endpoint = strings.TrimRight(c.Endpoint, "/")
+		if u, err := url.Parse(c.Endpoint); err != nil || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("%w: endpoint must be a scheme and host without a path", ErrInvalidDestination)
+		}
+		if c.Region == "" {
+			c.Region = "us-east-1"
+		}
+		c.Prefix = strings.Trim(c.Prefix, "/")
+		if d.credentials.AccessKey == "" || d.credentials.SecretKey == "" {
+			return fmt.Errorf("%w: access_key and secret_key are required", ErrInvalidDestination)
+		}
+	case DestinationSFTP:
+		if c.Host == "" || c.Username == "" {
+			return fmt.Errorf("%w: host and username are required", ErrInvalidDestination)
+		}
+		if c.Port == 0 {
+			c.Port = 22
+		}
+		if c.Path == "" {
+			c.Path = "."
+		}
+		if d.credentials.Password == "" && d.credentials.PrivateKey == "" {
+			return fmt.Errorf("%w: password or private_key is required", ErrInvalidDestination)
+		}
+		if c.HostKey == "" {
+			return fmt.Errorf("%w: host_key is required", ErrInvalidDestination)
+		}
+		fingerprint, err := parseHostKey(c.HostKey)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDestination, err)
+		}
+		c.HostKey = fingerprint
+	default:
+		return fmt.Errorf("%w: type must be local, s3 or sftp", ErrInvalidDestination)
+	}
+	return nil
+}
+
+// Open returns the Destination implementation for the record
+func (d *DestinationRecord) Open() (Destination, error) {
+	switch d.Type {
+	case DestinationLocal:
+		return &localDestination{root: d.Config.Path}, nil
+	case DestinationS3:
+		return newS3Destination(d.Config, d.credentials)
+	case DestinationSFTP:
+		return &sftpDestination{config: d.Config, credentials: d.credentials}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown type %s", ErrInvalidDestination, d.Type)
+}
+
+const destinationColumns = `id, name, type, config, COALESCE(credentials, ''), active,
+	COALESCE(last_test_at, ''), COALESCE(last_test_status, ''), created_at`
+
+func scanDestination(scanner interface{ Scan(...interface{}) error }) (*DestinationRecord, error) {
+	var d DestinationRecord
+	var configJSON, credentials string
+	err := scanner.Scan(&d.ID, &d.Name, &d.Type, &configJSON, &credentials, &d.Active,
+		&d.LastTestAt, &d.LastTestStatus, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(configJSON), &d.Config)
+
+	if credentials != "" {
+		plain, err := auth.DecryptSecret(credentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt credentials of destination %s: %w", d.Name, err)
+		}
+		json.Unmarshal([]byte(plain), &d.credentials)
+	}
+	d.HasCredentials = !d.credentials.empty()
+	return &d, nil
+}
+
+// ListDestinations returns all configured destinations without credentials
+func (m *Manager) ListDestinations() ([]DestinationRecord, error) {
+	rows, err := m.db.Query("SELECT " + destinationColumns + " FROM backup_destinations ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	destinations := []DestinationRecord{}
+	for rows.Next() {
+		d, err := scanDestination(rows)
+		if err != nil {
+			continue
+		}
+		destinations = append(destinations, *d)
+	}
+	return destinations, nil
+}
+
+// GetDestination returns a single destination
+func (m *Manager) GetDestination(id int64) (*DestinationRecord, error) {
+	d, err := scanDestination(m.db.QueryRow("SELECT "+destinationColumns+" FROM backup_destinations WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrDestinationNotFound
+	}
+	return d, err
+}
+
+// CreateDestination validates and stores a destination with its credentials
+func (m *Manager) CreateDestination(d *DestinationRecord, creds DestinationCredentials) (*DestinationRecord, error) {
+	d.credentials = creds
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	configJSON, credentials, err := encodeDestination(d)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := m.db.Exec(`
+		INSERT INTO backup_destinations (name, type, config, credentials, active)
+		VALUES (?, ?, ?, ?, ?)
+	`, d.Name, d.Type, configJSON, credentials, d.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := result.LastInsertId()
+	return m.GetDestination(id)
+}
+
+// UpdateDestination overwrites a destination. Empty credentials keep the
+// stored ones so the API never has to send them back to the client.
+func (m *Manager) UpdateDestination(id int64, d *DestinationRecord, creds DestinationCredentials) (*DestinationRecord, error) {
+	current, err := m.GetDestination(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.credentials = creds
+	if creds.empty() {
+		d.credentials = current.credentials
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	configJSON, credentials, err := encodeDestination(d)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.db.Exec(`
+		UPDATE backup_destinations SET name = ?, type = ?, config = ?, credentials = ?, active = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, d.Name, d.Type, configJSON, credentials, d.Active, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetDestination(id)
+}
+
+// DeleteDestination removes a destination. Remote archives are left alone.
+func (m *Manager) DeleteDestination(id int64) error {
+	result, err := m.db.Exec("DELETE FROM backup_destinations WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrDestinationNotFound
+	}
+	m.db.Exec("UPDATE backup_schedules SET destination_id = NULL WHERE destination_id = ?", id)
+	return nil
+}
+
+func encodeDestination(d *DestinationRecord) (string, string, error) {
+	configJSON, err := json.Marshal(d.Config)
+	if err != nil {
+		return "", "", err
+	}
+	credsJSON, err := json.Marshal(d.credentials)
+	if err != nil {
+		return "", "", err
+	}
+	credentials, err := auth.EncryptSecret(string(credsJSON))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	return string(configJSON), credentials, nil
+}
+
+// TestDestination connects to the destination, writes, reads back and
+// removes a small file and records the outcome
+func (m *Manager) TestDestination(id int64) error {
+	d, err := m.GetDestination(id)
+	if err != nil {
+		return err
+	}
+
+	testErr := m.testDestination(d)
+
+	status := "ok"
+	if testErr != nil {
+		status = testErr.Error()
+	}
+	m.db.Exec("UPDATE backup_destinations SET last_test_at = CURRENT_TIMESTAMP, last_test_status = ? WHERE id = ?",
+		status, id)
+	return testErr
+}
+
+func (m *Manager) testDestination(d *DestinationRecord) error {
+	dest, err := d.Open()
+	if err != nil {
+		return err
+	}
+	defer closeDestination(dest)
+
+	if err := dest.Test(); err != nil {
+		return err
+	}
+
+	content := []byte(fmt.Sprintf("serverpanel connection test %d\n", time.Now().UnixNano()))
+	sum := sha256.Sum256(content)
+	name := fmt.Sprintf(".serverpanel-test-%d", time.Now().UnixNano())
+
+	if err := dest.Put(name, strings.NewReader(string(content)), int64(len(content)), hex.EncodeToString(sum[:])); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	defer dest.Delete(name)
+
+	r, err := dest.Get(name)
+	if err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	defer r.Close()
+	readBack, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	if string(readBack) != string(content) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// Upload copies a local file to the destination under name, writes the
+// checksum sidecar and verifies the stored copy
+func (m *Manager) Upload(destinationID int64, localPath, name string, progress func(msg string)) (*RemoteFile, error) {
+	opts := Options{Progress: progress}
+
+	d, err := m.GetDestination(destinationID)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := d.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeDestination(dest)
+
+	sum, size, err := fileChecksum(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m.progress(opts, "☁️ %s hedefine yükleniyor: %s (%d bayt)", d.Name, name, size)
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := dest.Put(name, f, size, sum); err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+
+	sidecar := fmt.Sprintf("%s  %s\n", sum, path.Base(name))
+	if err := dest.Put(name+checksumSuffix, strings.NewReader(sidecar), int64(len(sidecar)), sha256Hex([]byte(sidecar))); err != nil {
+		return nil, fmt.Errorf("failed to write checksum: %w", err)
+	}
+
+	if v, ok := dest.(verifiedDestination); !ok || !v.verifiesChecksum() {
+		m.progress(opts, "🔍 Yüklenen arşiv doğrulanıyor: %s", name)
+		remoteSum, err := readChecksum(dest, name)
+		if err != nil {
+			return nil, fmt.Errorf("verification failed: %w", err)
+		}
+		if remoteSum != sum {
+			dest.Delete(name)
+			dest.Delete(name + checksumSuffix)
+			return nil, fmt.Errorf("verification failed: %w", ErrChecksumMismatch)
+		}
+	}
+
+	m.progress(opts, "✅ Yükleme doğrulandı (sha256 %s)", sum)
+	return &RemoteFile{Name: name, Size: size, ModTime: time.Now(), Checksum: sum}, nil
+}
+
+// UploadBackup uploads a local backup archive as <username>/<file>
+func (m *Manager) UploadBackup(destinationID, backupID int64, progress func(msg string)) (*RemoteFile, error) {
+	record, err := m.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status != "completed" {
+		return nil, fmt.Errorf("backup #%d is not completed", backupID)
+	}
+	return m.Upload(destinationID, record.FilePath, record.Username+"/"+filepath.Base(record.FilePath), progress)
+}
+
+// UploadPanelDatabase uploads a consistent snapshot of panel.db as
+// panel/panel-<timestamp>.db
+func (m *Manager) UploadPanelDatabase(destinationID int64, progress func(msg string)) (*RemoteFile, error) {
+	dir := filepath.Join(m.BackupDir(), "panel")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("panel-%s.db", time.Now().Format("20060102-150405"))
+	snapshot := filepath.Join(dir, name)
+	// VACUUM INTO produces a consistent copy while the panel keeps writing
+	if _, err := m.db.Exec("VACUUM INTO ?", snapshot); err != nil {
+		return nil, fmt.Errorf("failed to snapshot panel database: %w", err)
+	}
+	defer os.Remove(snapshot)
+	os.Chmod(snapshot, 0600)
+
+	return m.Upload(destinationID, snapshot, "panel/"+name, progress)
+}
+
+// ListRemote returns the archives stored on a destination with their
+// recorded checksums
+func (m *Manager) ListRemote(destinationID int64) ([]RemoteFile, error) {
+	d, err := m.GetDestination(destinationID)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := d.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeDestination(dest)
+
+	files, err := dest.List()
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[string]bool{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, checksumSuffix) {
+			sums[strings.TrimSuffix(f.Name, checksumSuffix)] = true
+		}
+	}
+
+	archives := []RemoteFile{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, checksumSuffix) || path.Base(f.Name)[0] == '.' {
+			continue
+		}
+		if sums[f.Name] {
+			f.Checksum, _ = readSidecar(dest, f.Name)
+		}
+		archives = append(archives, f)
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Name < archives[j].Name })
+	return archives, nil
+}
+
+// Fetch downloads a remote archive into localPath and verifies it against
+// the checksum sidecar written at upload time
+func (m *Manager) Fetch(destinationID int64, name, localPath string, progress func(msg string)) error {
+	opts := Options{Progress: progress}
+
+	d, err := m.GetDestination(destinationID)
+	if err != nil {
+		return err
+	}
+	dest, err := d.Open()
+	if err != nil {
+		return err
+	}
+	defer closeDestination(dest)
+
+	expected, err := readSidecar(dest, name)
+	if err != nil {
+		return fmt.Errorf("no checksum for %s: %w", name, err)
+	}
+
+	m.progress(opts, "⬇️ %s hedefinden indiriliyor: %s", d.Name, name)
+	r, err := dest.Get(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		f.Close()
+		os.Remove(localPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(localPath)
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != expected {
+		os.Remove(localPath)
+		return ErrChecksumMismatch
+	}
+	m.progress(opts, "✅ Checksum doğrulandı (sha256 %s)", expected)
+	return nil
+}
+
+// DeleteRemote removes an archive and its checksum from a destination
+func (m *Manager) DeleteRemote(destinationID int64, name string) error {
+	d, err := m.GetDestination(destinationID)
+	if err != nil {
+		return err
+	}
+	dest, err := d.Open()
+	if err != nil {
+		return err
+	}
+	defer closeDestination(dest)
+
+	if err := dest.Delete(name); err != nil {
+		return err
+	}
+	dest.Delete(name + checksumSuffix)
+	return nil
+}
+
+// ValidRemoteName rejects names that could escape the destination root
+func ValidRemoteName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// closeDestination releases connections held by a destination
+func closeDestination(dest Destination) {
+	if c, ok := dest.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// readChecksum streams a stored file and returns its SHA-256
+func readChecksum(dest Destination, name string) (string, error) {
+	r, err := dest.Get(name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readSidecar returns the checksum recorded for name at upload time
+func readSidecar(dest Destination, name string) (string, error) {
+	r, err := dest.Get(name + checksumSuffix)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(io.LimitReader(r, 1024))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 || len(fields[0]) != 64 {
+		return "", ErrInvalidArchive
+	}
+	return fields[0], nil
+}
+
+func fileChecksum(filePath string) (string, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localDestination stores archives in a directory, typically a mounted
+// network share or a second disk
+type localDestination struct {
+	root string
+}
+
+func (d *localDestination) path(name string) (string, error) {
+	if !ValidRemoteName(name) {
+		return "", fmt.Errorf("invalid name: %s", name)
+	}
+	return filepath.Join(d.root, filepath.FromSlash(name)), nil
+}
+
+func (d *localDestination) Test() error {
+	if err := os.MkdirAll(d.root, 0700); err != nil {
+		return err
+	}
+	info, err := os.Stat(d.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", d.root)
+	}
+	return nil
+}
+
+func (d *localDestination) Put(name string, r io.Reader, size int64, checksum string) error {
+	target, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a partial copy never looks complete
+	tmp := target + ".part"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("wrote %d of %d bytes", written, size)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+func (d *localDestination) Get(name string) (io.ReadCloser, error) {
+	target, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(target)
+	if os.IsNotExist(err) {
+		return nil, ErrRemoteNotFound
+	}
+	return f, err
+}
+
+func (d *localDestination) List() ([]RemoteFile, error) {
+	files := []RemoteFile{}
+	if _, err := os.Stat(d.root); os.IsNotExist(err) {
+		return files, nil
+	}
+
+	err := filepath.Walk(d.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(p, ".part") {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, RemoteFile{
+			Name:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+func (d *localDestination) Delete(name string) error {
+	target, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil {
+		if os.IsNotExist(err) {
+			return ErrRemoteNotFound
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+package backup
+
+import (
+	"bufio"
+	"database/sql"
+	"os"
+	"strings"
+)
+
+// AccountData is the panel metadata stored as metadata.json inside an archive.
+// Rows reference each other by name (domain, database) instead of ID so they
+// can be re-inserted on a different panel.
+type AccountData struct {
+	User                UserRecord             `json:"user"`
+	Package             *PackageRecord         `json:"package,omitempty"`
+	Domains             []DomainRecord         `json:"domains"`
+	Subdomains          []SubdomainRecord      `json:"subdomains"`
+	PHPSettings         []PHPSettingsRecord    `json:"php_settings"`
+	Databases           []DatabaseRecord       `json:"databases"`
+	EmailAccounts       []EmailAccountRecord   `json:"email_accounts"`
+	EmailForwarders     []EmailForwarderRecord `json:"email_forwarders"`
+	EmailAutoresponders []AutoresponderRecord  `json:"email_autoresponders"`
+	DNSRecords          []DNSRecord            `json:"dns_records"`
+	CronJobs            []CronJobRecord        `json:"cron_jobs"`
+	FTPAccounts         []FTPAccountRecord     `json:"ftp_accounts"`
+	FTPEntries          []string               `json:"ftp_entries"`    // raw pureftpd.passwd lines
+	MailPasswords       map[string]string      `json:"mail_passwords"` // email -> Dovecot hash
+}
+
+type UserRecord struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	Active       bool   `json:"active"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type PackageRecord struct {
+	Name                string `json:"name"`
+	DiskQuota           int64  `json:"disk_quota"`
+	BandwidthQuota      int64  `json:"bandwidth_quota"`
+	MaxDomains          int    `json:"max_domains"`
+	MaxDatabases        int    `json:"max_databases"`
+	MaxEmails           int    `json:"max_emails"`
+	MaxFTP              int    `json:"max_ftp"`
+	MaxPHPMemory        string `json:"max_php_memory"`
+	MaxPHPUpload        string `json:"max_php_upload"`
+	MaxPHPExecutionTime int    `json:"max_php_execution_time"`
+}
+
+type DomainRecord struct {
+	Name         string `json:"name"`
+	DomainType   string `json:"domain_type"`
+	ParentDomain string `json:"parent_domain,omitempty"`
+	DocumentRoot string `json:"document_root"`
+	PHPVersion   string `json:"php_version"`
+	SSLEnabled   bool   `json:"ssl_enabled"`
+	Active       bool   `json:"active"`
+}
+
+type SubdomainRecord struct {
+	Domain       string `json:"domain"`
+	Name         string `json:"name"`
+	FullName     string `json:"full_name"`
+	DocumentRoot string `json:"document_root"`
+	RedirectURL  string `json:"redirect_url,omitempty"`
+	RedirectType string `json:"redirect_type,omitempty"`
+	Active       bool   `json:"active"`
+}
+
+type PHPSettingsRecord struct {
+	Domain            string `json:"domain"`
+	MemoryLimit       string `json:"memory_limit"`
+	MaxExecutionTime  int    `json:"max_execution_time"`
+	MaxInputTime      int    `json:"max_input_time"`
+	PostMaxSize       string `json:"post_max_size"`
+	UploadMaxFilesize string `json:"upload_max_filesize"`
+	MaxFileUploads    int    `json:"max_file_uploads"`
+	DisplayErrors     bool   `json:"display_errors"`
+	ErrorReporting    string `json:"error_reporting"`
+}
+
+type DatabaseRecord struct {
+	Name  string               `json:"name"`
+	Type  string               `json:"type"`
+	Users []DatabaseUserRecord `json:"users"`
+}
+
+type DatabaseUserRecord struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// PasswordHash is a mysql_native_password hash used when the plain
+	// password is unknown (imported from another panel)
+	PasswordHash string `json:"password_hash,omitempty"`
+	Host         string `json:"host"`
+}
+
+type EmailAccountRecord struct {
+	Domain       string `json:"domain"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	QuotaMB      int    `json:"quota_mb"`
+	Active       bool   `json:"active"`
+}
+
+type EmailForwarderRecord struct {
+	Domain      string `json:"domain"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Active      bool   `json:"active"`
+}
+
+type AutoresponderRecord struct {
+	Domain    string `json:"domain"`
+	Email     string `json:"email"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+	Active    bool   `json:"active"`
+}
+
+type DNSRecord struct {
+	Domain   string `json:"domain"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority"`
+	Active   bool   `json:"active"`
+}
+
+type CronJobRecord struct {
+	Name     string `json:"name"`
+	Command  string `json:"command"`
+	Schedule string `json:"schedule"`
+	Minute   string `json:"minute"`
+	Hour     string `json:"hour"`
+	Day      string `json:"day"`
+	Month    string `json:"month"`
+	Weekday  string `json:"weekday"`
+	Active   bool   `json:"active"`
+}
+
+type FTPAccountRecord struct {
+	Username          string `json:"username"`
+	PasswordHash      string `json:"password_hash"`
+	HomeDirectory     string `json:"home_directory"`
+	QuotaMB           int    `json:"quota_mb"`
+	UploadBandwidth   int    `json:"upload_bandwidth"`
+	DownloadBandwidth int    `json:"download_bandwidth"`
+	Active            bool   `json:"active"`
+}
+
+const (
+	// pureFTPdPasswdFile is the Pure-FTPd virtual user file managed by pure-pw
+	pureFTPdPasswdFile = "/etc/pure-ftpd/pureftpd.passwd"
+	// dovecotUsersFile holds the Dovecot password hashes of virtual mailboxes
+	dovecotUsersFile = "/etc/dovecot/users"
+)
+
+// loadAccountData collects every panel row that belongs to a hosting account
+func (m *Manager) loadAccountData(userID int64) (*AccountData, error) {
+	data := &AccountData{}
+
+	var role string
+	err := m.db.QueryRow(`
+		SELECT id, username, email, password, role, active, created_at
+		FROM users WHERE id = ?
+	`, userID).Scan(&data.User.ID, &data.User.Username, &data.User.Email, &data.User.PasswordHash,
+		&role, &data.User.Active, &data.User.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if role != "user" {
+		return nil, ErrNotHostingAccount
+	}
+
+	var pkg PackageRecord
+	err = m.db.QueryRow(`
+		SELECT p.name, p.disk_quota, p.bandwidth_quota, p.max_domains, p.max_databases,
+		       p.max_emails, p.max_ftp, COALESCE(p.max_php_memory, '256M'),
+		       COALESCE(p.max_php_upload, '64M'), COALESCE(p.max_php_execution_time, 300)
+		FROM user_packages up
+		JOIN packages p ON p.id = up.package_id
+		WHERE up.user_id = ?
+	`, userID).Scan(&pkg.Name, &pkg.DiskQuota, &pkg.BandwidthQuota, &pkg.MaxDomains, &pkg.MaxDatabases,
+		&pkg.MaxEmails, &pkg.MaxFTP, &pkg.MaxPHPMemory, &pkg.MaxPHPUpload, &pkg.MaxPHPExecutionTime)
+	if err == nil {
+		data.Package = &pkg
+	}
+
+	// Domains
+	rows, err := m.db.Query(`
+		SELECT d.name, COALESCE(d.domain_type, 'primary'), COALESCE(p.name, ''),
+		       COALESCE(d.document_root, ''), COALESCE(d.php_version, ''), d.ssl_enabled, d.active
+		FROM domains d
+		LEFT JOIN domains p ON p.id = d.parent_domain_id
+		WHERE d.user_id = ?
+		ORDER BY d.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d DomainRecord
+		if rows.Scan(&d.Name, &d.DomainType, &d.ParentDomain, &d.DocumentRoot, &d.PHPVersion, &d.SSLEnabled, &d.Active) == nil {
+			data.Domains = append(data.Domains, d)
+		}
+	}
+	rows.Close()
+
+	// Subdomains
+	rows, err = m.db.Query(`
+		SELECT d.name, s.name, s.full_name, COALESCE(s.document_root, ''),
+		       COALESCE(s.redirect_url, ''), COALESCE(s.redirect_type, ''), s.active
+		FROM subdomains s
+		JOIN domains d ON d.id = s.domain_id
+		WHERE s.user_id = ?
+		ORDER BY s.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s SubdomainRecord
+		if rows.Scan(&s.Domain, &s.Name, &s.FullName, &s.DocumentRoot, &s.RedirectURL, &s.RedirectType, &s.Active) == nil {
+			data.Subdomains = append(data.Subdomains, s)
+		}
+	}
+	rows.Close()
+
+	// PHP settings
+	rows, err = m.db.Query(`
+		SELECT d.name, ps.memory_limit, ps.max_execution_time, ps.max_input_time, ps.post_max_size,
+		       ps.upload_max_filesize, ps.max_file_uploads, ps.display_errors, ps.error_reporting
+		FROM php_settings ps
+		JOIN domains d ON d.id = ps.domain_id
+		WHERE d.user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p PHPSettingsRecord
+		if rows.Scan(&p.Domain, &p.MemoryLimit, &p.MaxExecutionTime, &p.MaxInputTime, &p.PostMaxSize,
+			&p.UploadMaxFilesize, &p.MaxFileUploads, &p.DisplayErrors, &p.ErrorReporting) == nil {
+			data.PHPSettings = append(data.PHPSettings, p)
+		}
+	}
+	rows.Close()
+
+	// MySQL databases and their users
+	rows, err = m.db.Query("SELECT id, name, COALESCE(type, 'mysql') FROM databases WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	var dbIDs []int64
+	for rows.Next() {
+		var id int64
+		var d DatabaseRecord
+		if rows.Scan(&id, &d.Name, &d.Type) == nil {
+			dbIDs = append(dbIDs, id)
+			data.Databases = append(data.Databases, d)
+		}
+	}
+	rows.Close()
+	for i, id := range dbIDs {
+		userRows, err := m.db.Query(`
+			SELECT db_username, COALESCE(password, ''), COALESCE(host, 'localhost')
+			FROM database_users WHERE database_id = ?
+		`, id)
+		if err != nil {
+			continue
+		}
+		for userRows.Next() {
+			var u DatabaseUserRecord
+			if userRows.Scan(&u.Username, &u.Password, &u.Host) == nil {
+				data.Databases[i].Users = append(data.Databases[i].Users, u)
+			}
+		}
+		userRows.Close()
+	}
+
+	// Email accounts
+	rows, err = m.db.Query(`
+		SELECT d.name, e.email, e.password_hash, e.quota_mb, e.active
+		FROM email_accounts e
+		JOIN domains d ON d.id = e.domain_id
+		WHERE e.user_id = ?
+		ORDER BY e.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var e EmailAccountRecord
+		if rows.Scan(&e.Domain, &e.Email, &e.PasswordHash, &e.QuotaMB, &e.Active) == nil {
+			data.EmailAccounts = append(data.EmailAccounts, e)
+		}
+	}
+	rows.Close()
+
+	// Email forwarders
+	rows, err = m.db.Query(`
+		SELECT d.name, f.source, f.destination, f.active
+		FROM email_forwarders f
+		JOIN domains d ON d.id = f.domain_id
+		WHERE f.user_id = ?
+		ORDER BY f.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f EmailForwarderRecord
+		if rows.Scan(&f.Domain, &f.Source, &f.Destination, &f.Active) == nil {
+			data.EmailForwarders = append(data.EmailForwarders, f)
+		}
+	}
+	rows.Close()
+
+	// Autoresponders
+	rows, err = m.db.Query(`
+		SELECT d.name, a.email, a.subject, a.body, COALESCE(a.start_date, ''), COALESCE(a.end_date, ''), a.active
+		FROM email_autoresponders a
+		JOIN domains d ON d.id = a.domain_id
+		WHERE a.user_id = ?
+		ORDER BY a.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a AutoresponderRecord
+		if rows.Scan(&a.Domain, &a.Email, &a.Subject, &a.Body, &a.StartDate, &a.EndDate, &a.Active) == nil {
+			data.EmailAutoresponders = append(data.EmailAutoresponders, a)
+		}
+	}
+	rows.Close()
+
+	// DNS records
+	rows, err = m.db.Query(`
+		SELECT d.name, r.name, r.type, r.content, r.ttl, r.priority, r.active
+		FROM dns_records r
+		JOIN domains d ON d.id = r.domain_id
+		WHERE d.user_id = ?
+		ORDER BY r.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var r DNSRecord
+		if rows.Scan(&r.Domain, &r.Name, &r.Type, &r.Content, &r.TTL, &r.Priority, &r.Active) == nil {
+			data.DNSRecords = append(data.DNSRecords, r)
+		}
+	}
+	rows.Close()
+
+	// Cron jobs
+	rows, err = m.db.Query(`
+		SELECT name, command, schedule, minute, hour, day, month, weekday, active
+		FROM cron_jobs WHERE user_id = ? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c CronJobRecord
+		if rows.Scan(&c.Name, &c.Command, &c.Schedule, &c.Minute, &c.Hour, &c.Day, &c.Month, &c.Weekday, &c.Active) == nil {
+			data.CronJobs = append(data.CronJobs, c)
+		}
+	}
+	rows.Close()
+
+	// FTP accounts
+	rows, err = m.db.Query(`
+		SELECT username, password, home_directory, quota_mb, upload_bandwidth, download_bandwidth, active
+		FROM ftp_accounts WHERE user_id = ? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	ftpUsers := map[string]bool{}
+	for rows.Next() {
+		var f FTPAccountRecord
+		if rows.Scan(&f.Username, &f.PasswordHash, &f.HomeDirectory, &f.QuotaMB, &f.UploadBandwidth, &f.DownloadBandwidth, &f.Active) == nil {
+			data.FTPAccounts = append(data.FTPAccounts, f)
+			ftpUsers[f.Username] = true
+		}
+	}
+	rows.Close()
+
+	// Pure-FTPd stores its own password hashes; keep the raw lines so FTP
+	// logins survive a restore without knowing the plain passwords.
+	if len(ftpUsers) > 0 && !m.cfg.SimulateMode {
+		if f, err := os.Open(pureFTPdPasswdFile); err == nil {
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if login := strings.SplitN(line, ":", 2)[0]; ftpUsers[login] {
+					data.FTPEntries = append(data.FTPEntries, line)
+				}
+			}
+			f.Close()
+		}
+	}
+
+	// Dovecot hashes are generated by doveadm and differ from the bcrypt hash
+	// stored in email_accounts, so they are carried over verbatim as well.
+	data.MailPasswords = map[string]string{}
+	if len(data.EmailAccounts) > 0 && !m.cfg.SimulateMode {
+		emails := map[string]bool{}
+		for _, e := range data.EmailAccounts {
+			emails[e.Email] = true
+		}
+		if content, err := os.ReadFile(dovecotUsersFile); err == nil {
+			for _, line := range strings.Split(string(content), "\n") {
+				parts := strings.SplitN(line, ":", 2)
+				if len(parts) == 2 && emails[parts[0]] {
+					data.MailPasswords[parts[0]] = parts[1]
+				}
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// PrimaryDomain returns the account's primary domain name
+func (d *AccountData) PrimaryDomain() string {
+	for _, domain := range d.Domains {
+		if domain.DomainType == "primary" {
+			return domain.Name
+		}
+	}
+	if len(d.Domains) > 0 {
+		return d.Domains[0].Name
+	}
+	return ""
+}
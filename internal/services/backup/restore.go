@@ -0,0 +1,1080 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/asergenalkan/serverpanel/internal/services/mysql"
+)
+
+// RestoreResult describes what a restore changed. System configuration that
+// lives outside the account (vhosts for extra domains, zone files, Postfix,
+// Dovecot, Pure-FTPd, crontab) is rebuilt by the caller from Data.
+type RestoreResult struct {
+	UserID            int64        `json:"user_id"`
+	Username          string       `json:"username"`
+	Created           bool         `json:"created"`
+	CreatedDomains    []string     `json:"created_domains"`
+	CreatedSubdomains []string     `json:"created_subdomains"`
+	Warnings          []string     `json:"warnings"`
+	Data              *AccountData `json:"-"`
+}
+
+func (r *RestoreResult) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// ReadManifest returns the manifest of an archive without extracting it
+func ReadManifest(archivePath string) (*Manifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	defer gz.Close()
+
+	var manifest Manifest
+	if err := readJSON(tar.NewReader(gz), manifestName, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// ReadMetadata returns the manifest and account data of an archive without
+// extracting its files
+func ReadMetadata(archivePath string) (*Manifest, *AccountData, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, ErrInvalidArchive
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var manifest Manifest
+	if err := readJSON(tr, manifestName, &manifest); err != nil {
+		return nil, nil, err
+	}
+	var data AccountData
+	if err := readJSON(tr, metadataName, &data); err != nil {
+		return nil, nil, err
+	}
+	return &manifest, &data, nil
+}
+
+// CheckMetadata runs the checks restore applies item by item on the whole
+// archive metadata and returns every item that would be refused. Archives
+// from outside the panel, such as received transfers, are rejected as a
+// whole when anything is listed.
+func (m *Manager) CheckMetadata(manifest *Manifest, data *AccountData) []string {
+	problems := []string{}
+	username := data.User.Username
+	if username != manifest.Username || account.NewService(nil).ValidateUsername(username) != nil {
+		return append(problems, fmt.Sprintf("username %q: invalid", username))
+	}
+
+	homeDir := filepath.Join(m.cfg.HomeBaseDir, username)
+	moved := *data
+	moved.Domains = append([]DomainRecord(nil), data.Domains...)
+	moved.Subdomains = append([]SubdomainRecord(nil), data.Subdomains...)
+	moved.FTPAccounts = append([]FTPAccountRecord(nil), data.FTPAccounts...)
+	moved.FTPEntries = append([]string(nil), data.FTPEntries...)
+	moved.CronJobs = nil
+	moved.rewriteHome(manifest.HomeDir, homeDir)
+
+	for _, d := range moved.Domains {
+		if err := checkDomain(d, homeDir); err != nil {
+			problems = append(problems, fmt.Sprintf("domain %s: %v", d.Name, err))
+		}
+	}
+	for _, s := range moved.Subdomains {
+		if err := checkSubdomain(s, homeDir); err != nil {
+			problems = append(problems, fmt.Sprintf("subdomain %s: %v", s.FullName, err))
+		}
+	}
+	for _, d := range moved.Databases {
+		if !validMySQLName(d.Name, username) {
+			problems = append(problems, fmt.Sprintf("database %s: invalid name", d.Name))
+		}
+		for _, u := range d.Users {
+			if !validMySQLName(u.Username, username) {
+				problems = append(problems, fmt.Sprintf("database user %s: invalid name", u.Username))
+			}
+		}
+	}
+	for _, f := range moved.FTPAccounts {
+		if !withinDir(f.HomeDirectory, homeDir) {
+			problems = append(problems, fmt.Sprintf("FTP account %s: home directory outside the account", f.Username))
+		}
+	}
+	for _, entry := range moved.FTPEntries {
+		if fields := strings.Split(entry, ":"); len(fields) < 6 || !withinDir(fields[5], homeDir) {
+			problems = append(problems, fmt.Sprintf("FTP entry %s: home directory outside the account", fields[0]))
+		}
+	}
+	return problems
+}
+
+// ReadIndex returns the file index stored after the metadata of an archive
+func ReadIndex(archivePath string) (FileIndex, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var manifest Manifest
+	if err := readJSON(tr, manifestName, &manifest); err != nil {
+		return nil, err
+	}
+	if _, err := tr.Next(); err != nil {
+		return nil, ErrInvalidArchive
+	}
+	index := FileIndex{}
+	if err := readJSON(tr, indexName, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Restore restores an account archive. If the account no longer exists it is
+// recreated through account.Service with the archived package and password.
+// Incremental archives are restored together with their parent chain.
+func (m *Manager) Restore(archivePath string, opts Options) (*RestoreResult, error) {
+	manifest, err := ReadManifest(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var earlier []string
+	if manifest.Incremental {
+		var id int64
+		if err := m.db.QueryRow("SELECT id FROM backups WHERE file_path = ?", archivePath).Scan(&id); err != nil {
+			return nil, ErrIncompleteChain
+		}
+		chain, err := m.chain(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range chain[:len(chain)-1] {
+			earlier = append(earlier, r.FilePath)
+		}
+	}
+
+	return m.restore(archivePath, earlier, opts)
+}
+
+// restore restores archivePath after overlaying the files of the earlier
+// archives of its incremental chain
+func (m *Manager) restore(archivePath string, earlier []string, opts Options) (*RestoreResult, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var manifest Manifest
+	if err := readJSON(tr, manifestName, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version < 1 || manifest.Version > ArchiveVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	if manifest.Type != "account" {
+		return nil, ErrInvalidArchive
+	}
+
+	var data AccountData
+	if err := readJSON(tr, metadataName, &data); err != nil {
+		return nil, err
+	}
+	if data.User.Username != manifest.Username {
+		return nil, ErrInvalidArchive
+	}
+
+	username := data.User.Username
+	homeDir := filepath.Join(m.cfg.HomeBaseDir, username)
+	data.rewriteHome(manifest.HomeDir, homeDir)
+
+	result := &RestoreResult{Username: username, Data: &data}
+
+	m.progress(opts, "Geri yükleme başlatıldı: %s", username)
+
+	if err := m.prepareAccount(&data, result); err != nil {
+		return nil, err
+	}
+
+	if err := m.restoreRows(&data, result); err != nil {
+		return nil, fmt.Errorf("failed to restore panel data: %w", err)
+	}
+
+	if !opts.SkipDatabases {
+		m.createDatabases(&data, result)
+	}
+
+	// A recreated account starts with the welcome page, which would shadow an
+	// archived index.php; the archived index.html comes back with the files
+	if result.Created && !opts.SkipHome {
+		os.Remove(filepath.Join(homeDir, "public_html", "index.html"))
+	}
+
+	roots := restoreRoots{}
+	defer roots.close()
+
+	// Files of the parent chain first, oldest to newest
+	seen := map[string]bool{}
+	for _, path := range earlier {
+		m.progress(opts, "Temel yedek uygulanıyor: %s", filepath.Base(path))
+		index, err := m.extractArchiveFiles(path, homeDir, roots, opts, result)
+		if err != nil {
+			return nil, err
+		}
+		for name := range index {
+			seen[name] = true
+		}
+	}
+
+	index, err := m.extractFiles(tr, homeDir, roots, opts, result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files that existed in an earlier run but are gone from the final index
+	// were deleted between backups
+	if index != nil {
+		for name := range seen {
+			if _, ok := index[name]; ok {
+				continue
+			}
+			dir, rel := m.entryTarget(name, homeDir, opts, &data)
+			if dir == "" {
+				continue
+			}
+			if root, err := roots.open(dir); err == nil {
+				root.Remove(rel)
+			}
+		}
+	}
+
+	m.fixOwnership(&data, opts)
+
+	m.progress(opts, "Geri yükleme tamamlandı: %s", username)
+	return result, nil
+}
+
+// extractArchiveFiles extracts only the home and mail entries of an archive
+func (m *Manager) extractArchiveFiles(archivePath, homeDir string, roots restoreRoots, opts Options, result *RestoreResult) (FileIndex, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var manifest Manifest
+	if err := readJSON(tr, manifestName, &manifest); err != nil {
+		return nil, err
+	}
+
+	opts.SkipDatabases = true
+	return m.extractFiles(tr, homeDir, roots, opts, result)
+}
+
+// extractFiles consumes the remaining entries of an archive: the file index,
+// home and mail files and MySQL dumps
+func (m *Manager) extractFiles(tr *tar.Reader, homeDir string, roots restoreRoots, opts Options, result *RestoreResult) (FileIndex, error) {
+	var index FileIndex
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+		switch {
+		case name == indexName:
+			index = FileIndex{}
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+			}
+
+		case name == "home/" || strings.HasPrefix(name, "home/"), strings.HasPrefix(name, "mail/"):
+			dir, rel := m.entryTarget(name, homeDir, opts, result.Data)
+			if dir == "" {
+				continue
+			}
+			root, err := roots.open(dir)
+			if err != nil {
+				return nil, err
+			}
+			if err := extractEntry(tr, hdr, root, rel); err != nil {
+				// Also refuses paths leading through a symlink out of the
+				// account, e.g. one planted by the user before the restore
+				result.warn("%s: %v", name, err)
+			}
+
+		case strings.HasPrefix(name, "mysql/") && strings.HasSuffix(name, ".sql"):
+			if opts.SkipDatabases {
+				continue
+			}
+			dbName := strings.TrimSuffix(strings.TrimPrefix(name, "mysql/"), ".sql")
+			if !validMySQLName(dbName, result.Username) {
+				result.warn("database %s: invalid name, dump skipped", dbName)
+				continue
+			}
+			if !result.Data.hasDatabase(dbName) {
+				// Not accepted by restoreRows, e.g. owned by another account
+				continue
+			}
+			m.progress(opts, "Veritabanı içe aktarılıyor: %s", dbName)
+			if err := m.importDatabase(tr, dbName, result.Username); err != nil {
+				result.warn("database %s: %v", dbName, err)
+			}
+		}
+	}
+	return index, nil
+}
+
+// entryTarget maps an archive path to its location on disk, refusing paths
+// that would escape the home directory or the maildirs of the account's own
+// domains. Returns "" for skipped entries.
+func (m *Manager) entryTarget(name, homeDir string, opts Options, data *AccountData) (root, rel string) {
+	switch {
+	case name == "home/" || strings.HasPrefix(name, "home/"):
+		if opts.SkipHome {
+			return "", ""
+		}
+		root, rel = homeDir, strings.TrimPrefix(name, "home/")
+	case strings.HasPrefix(name, "mail/"):
+		if opts.SkipMail {
+			return "", ""
+		}
+		// data holds only the domains restoreRows kept for the account
+		domain, rest, _ := strings.Cut(strings.TrimPrefix(name, "mail/"), "/")
+		if account.NewService(nil).ValidateDomain(domain) != nil || !data.hasDomain(domain) {
+			return "", ""
+		}
+		root, rel = filepath.Join(m.mailRoot(), domain), rest
+	default:
+		return "", ""
+	}
+
+	rel = filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", ""
+	}
+	return root, rel
+}
+
+// restoreRoots keeps one os.Root per restore target directory. The restore
+// runs as root inside directories the account user can write to, so every
+// file operation goes through an os.Root, which refuses symlinks leading
+// outside the directory.
+type restoreRoots map[string]*os.Root
+
+// open returns the root of dir, creating the directory when missing
+func (r restoreRoots) open(dir string) (*os.Root, error) {
+	if root, ok := r[dir]; ok {
+		return root, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	r[dir] = root
+	return root, nil
+}
+
+func (r restoreRoots) close() {
+	for _, root := range r {
+		root.Close()
+	}
+}
+
+// prepareAccount resolves the target account, recreating it when missing
+func (m *Manager) prepareAccount(data *AccountData, result *RestoreResult) error {
+	var userID int64
+	var role string
+	err := m.db.QueryRow("SELECT id, role FROM users WHERE username = ?", data.User.Username).Scan(&userID, &role)
+	if err == nil {
+		if role != "user" {
+			return ErrNotHostingAccount
+		}
+		result.UserID = userID
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	domain := data.PrimaryDomain()
+	if domain == "" {
+		return ErrInvalidArchive
+	}
+
+	packageID, err := m.resolvePackage(data.Package)
+	if err != nil {
+		return err
+	}
+
+	// The account is created with a throwaway password and the archived hash
+	// is written back afterwards so the original password keeps working
+	acc, err := account.NewService(m.db).CreateAccount(account.CreateAccountRequest{
+		Username:  data.User.Username,
+		Email:     data.User.Email,
+		Password:  randomPassword(),
+		Domain:    domain,
+		PackageID: packageID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to recreate account: %w", err)
+	}
+
+	m.db.Exec("UPDATE users SET password = ?, active = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		data.User.PasswordHash, data.User.Active, acc.ID)
+
+	result.UserID = acc.ID
+	result.Created = true
+	return nil
+}
+
+// resolvePackage finds the archived package by name, falling back to the first package
+func (m *Manager) resolvePackage(pkg *PackageRecord) (int64, error) {
+	var id int64
+	if pkg != nil {
+		if err := m.db.QueryRow("SELECT id FROM packages WHERE name = ?", pkg.Name).Scan(&id); err == nil {
+			return id, nil
+		}
+	}
+	if err := m.db.QueryRow("SELECT id FROM packages ORDER BY id LIMIT 1").Scan(&id); err != nil {
+		return 0, ErrNoPackageForRestore
+	}
+	return id, nil
+}
+
+// restoreRows writes the archived panel rows for the account. Rows with a
+// natural key are upserted, the rest are replaced. Items that belong to
+// another account are skipped and dropped from data, so the steps that
+// follow (databases, maildirs, Dovecot and Pure-FTPd entries) only touch
+// what was accepted for this account.
+func (m *Manager) restoreRows(data *AccountData, result *RestoreResult) error {
+	userID := result.UserID
+	homeDir := filepath.Join(m.cfg.HomeBaseDir, data.User.Username)
+	kept := AccountData{User: data.User, Package: data.Package, CronJobs: data.CronJobs, MailPasswords: map[string]string{}}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Domains - parents are archived before their children
+	domainIDs := map[string]int64{}
+	for _, d := range data.Domains {
+		if err := checkDomain(d, homeDir); err != nil {
+			result.warn("domain %s: %v, skipped", d.Name, err)
+			continue
+		}
+		var id, owner int64
+		err := tx.QueryRow("SELECT id, user_id FROM domains WHERE name = ?", d.Name).Scan(&id, &owner)
+		if err == nil && owner != userID {
+			result.warn("domain %s belongs to another account, skipped", d.Name)
+			continue
+		}
+
+		var parentID interface{}
+		if pid, ok := domainIDs[d.ParentDomain]; ok && d.ParentDomain != "" {
+			parentID = pid
+		}
+
+		if err == nil {
+			_, err = tx.Exec(`
+				UPDATE domains SET domain_type = ?, parent_domain_id = ?, document_root = ?, php_version = ?,
+				       ssl_enabled = ?, active = ?
+				WHERE id = ?
+			`, d.DomainType, parentID, d.DocumentRoot, d.PHPVersion, d.SSLEnabled, d.Active, id)
+			if err != nil {
+				return err
+			}
+			domainIDs[d.Name] = id
+			kept.Domains = append(kept.Domains, d)
+			continue
+		}
+
+		res, err := tx.Exec(`
+			INSERT INTO domains (user_id, name, domain_type, parent_domain_id, document_root, php_version, ssl_enabled, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, d.Name, d.DomainType, parentID, d.DocumentRoot, d.PHPVersion, d.SSLEnabled, d.Active)
+		if err != nil {
+			return err
+		}
+		domainIDs[d.Name], _ = res.LastInsertId()
+		kept.Domains = append(kept.Domains, d)
+		result.CreatedDomains = append(result.CreatedDomains, d.Name)
+	}
+
+	// Subdomains
+	for _, s := range data.Subdomains {
+		domainID, ok := domainIDs[s.Domain]
+		if !ok {
+			continue
+		}
+		if err := checkSubdomain(s, homeDir); err != nil {
+			result.warn("subdomain %s: %v, skipped", s.FullName, err)
+			continue
+		}
+		var owner int64
+		exists := tx.QueryRow("SELECT user_id FROM subdomains WHERE full_name = ?", s.FullName).Scan(&owner) == nil
+		if exists && owner != userID {
+			result.warn("subdomain %s belongs to another account, skipped", s.FullName)
+			continue
+		}
+		if exists {
+			_, err = tx.Exec(`
+				UPDATE subdomains SET document_root = ?, redirect_url = ?, redirect_type = ?, active = ?
+				WHERE full_name = ? AND user_id = ?
+			`, s.DocumentRoot, nullString(s.RedirectURL), nullString(s.RedirectType), s.Active, s.FullName, userID)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO subdomains (user_id, domain_id, name, full_name, document_root, redirect_url, redirect_type, active)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, userID, domainID, s.Name, s.FullName, s.DocumentRoot, nullString(s.RedirectURL), nullString(s.RedirectType), s.Active)
+			result.CreatedSubdomains = append(result.CreatedSubdomains, s.FullName)
+		}
+		if err != nil {
+			return err
+		}
+		kept.Subdomains = append(kept.Subdomains, s)
+	}
+
+	// PHP settings
+	for _, p := range data.PHPSettings {
+		domainID, ok := domainIDs[p.Domain]
+		if !ok {
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT OR REPLACE INTO php_settings (domain_id, memory_limit, max_execution_time, max_input_time,
+				post_max_size, upload_max_filesize, max_file_uploads, display_errors, error_reporting)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, domainID, p.MemoryLimit, p.MaxExecutionTime, p.MaxInputTime, p.PostMaxSize,
+			p.UploadMaxFilesize, p.MaxFileUploads, p.DisplayErrors, p.ErrorReporting)
+		if err != nil {
+			return err
+		}
+		kept.PHPSettings = append(kept.PHPSettings, p)
+	}
+
+	// Databases and database users
+	for _, d := range data.Databases {
+		if !validMySQLName(d.Name, data.User.Username) {
+			result.warn("database %s: invalid name, skipped", d.Name)
+			continue
+		}
+		var dbID, owner int64
+		err := tx.QueryRow("SELECT id, user_id FROM databases WHERE name = ?", d.Name).Scan(&dbID, &owner)
+		if err == nil && owner != userID {
+			result.warn("database %s belongs to another account, skipped", d.Name)
+			continue
+		}
+		if err != nil {
+			res, err := tx.Exec("INSERT INTO databases (user_id, name, type, size) VALUES (?, ?, ?, 0)", userID, d.Name, d.Type)
+			if err != nil {
+				return err
+			}
+			dbID, _ = res.LastInsertId()
+		}
+		users := d.Users
+		d.Users = nil
+		for _, u := range users {
+			if !validMySQLName(u.Username, data.User.Username) {
+				result.warn("database user %s: invalid name, skipped", u.Username)
+				continue
+			}
+			if tx.QueryRow("SELECT user_id FROM database_users WHERE db_username = ?", u.Username).Scan(&owner) == nil && owner != userID {
+				result.warn("database user %s belongs to another account, skipped", u.Username)
+				continue
+			}
+			_, err = tx.Exec(`
+				INSERT INTO database_users (user_id, database_id, db_username, password, host)
+				VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT(db_username) DO UPDATE SET password = excluded.password, host = excluded.host
+			`, userID, dbID, u.Username, u.Password, u.Host)
+			if err != nil {
+				return err
+			}
+			d.Users = append(d.Users, u)
+		}
+		kept.Databases = append(kept.Databases, d)
+	}
+
+	// Email accounts
+	for _, e := range data.EmailAccounts {
+		domainID, ok := domainIDs[e.Domain]
+		if !ok || !strings.HasSuffix(strings.ToLower(e.Email), "@"+e.Domain) {
+			continue
+		}
+		var owner int64
+		if tx.QueryRow("SELECT user_id FROM email_accounts WHERE email = ?", e.Email).Scan(&owner) == nil && owner != userID {
+			result.warn("email account %s belongs to another account, skipped", e.Email)
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO email_accounts (user_id, domain_id, email, password_hash, quota_mb, active)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(email) DO UPDATE SET password_hash = excluded.password_hash,
+				quota_mb = excluded.quota_mb, active = excluded.active
+		`, userID, domainID, e.Email, e.PasswordHash, e.QuotaMB, e.Active)
+		if err != nil {
+			return err
+		}
+		kept.EmailAccounts = append(kept.EmailAccounts, e)
+		if hash, ok := data.MailPasswords[e.Email]; ok {
+			kept.MailPasswords[e.Email] = hash
+		}
+	}
+
+	// Forwarders, autoresponders and DNS records have no natural key, so the
+	// rows of every restored domain are replaced
+	for _, id := range domainIDs {
+		for _, table := range []string{"email_forwarders", "email_autoresponders", "dns_records"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE domain_id = ?", id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range data.EmailForwarders {
+		domainID, ok := domainIDs[f.Domain]
+		if !ok || !strings.HasSuffix(strings.ToLower(f.Source), "@"+f.Domain) {
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO email_forwarders (user_id, domain_id, source, destination, active)
+			VALUES (?, ?, ?, ?, ?)
+		`, userID, domainID, f.Source, f.Destination, f.Active)
+		if err != nil {
+			return err
+		}
+		kept.EmailForwarders = append(kept.EmailForwarders, f)
+	}
+	for _, a := range data.EmailAutoresponders {
+		domainID, ok := domainIDs[a.Domain]
+		if !ok || !strings.HasSuffix(strings.ToLower(a.Email), "@"+a.Domain) {
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO email_autoresponders (user_id, domain_id, email, subject, body, start_date, end_date, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, domainID, a.Email, a.Subject, a.Body, nullString(a.StartDate), nullString(a.EndDate), a.Active)
+		if err != nil {
+			return err
+		}
+		kept.EmailAutoresponders = append(kept.EmailAutoresponders, a)
+	}
+	for _, r := range data.DNSRecords {
+		domainID, ok := domainIDs[r.Domain]
+		if !ok {
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO dns_records (domain_id, name, type, content, ttl, priority, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, domainID, r.Name, r.Type, r.Content, r.TTL, r.Priority, r.Active)
+		if err != nil {
+			return err
+		}
+		kept.DNSRecords = append(kept.DNSRecords, r)
+	}
+
+	// Cron jobs
+	if _, err := tx.Exec("DELETE FROM cron_jobs WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, c := range data.CronJobs {
+		_, err = tx.Exec(`
+			INSERT INTO cron_jobs (user_id, name, command, schedule, minute, hour, day, month, weekday, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, c.Name, c.Command, c.Schedule, c.Minute, c.Hour, c.Day, c.Month, c.Weekday, c.Active)
+		if err != nil {
+			return err
+		}
+	}
+
+	// FTP accounts
+	for _, f := range data.FTPAccounts {
+		var owner int64
+		if tx.QueryRow("SELECT user_id FROM ftp_accounts WHERE username = ?", f.Username).Scan(&owner) == nil && owner != userID {
+			result.warn("FTP account %s belongs to another account, skipped", f.Username)
+			continue
+		}
+		if !withinDir(f.HomeDirectory, homeDir) {
+			result.warn("FTP account %s: home directory outside the account, skipped", f.Username)
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO ftp_accounts (user_id, username, password, home_directory, quota_mb, upload_bandwidth, download_bandwidth, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(username) DO UPDATE SET password = excluded.password, home_directory = excluded.home_directory,
+				quota_mb = excluded.quota_mb, upload_bandwidth = excluded.upload_bandwidth,
+				download_bandwidth = excluded.download_bandwidth, active = excluded.active
+		`, userID, f.Username, f.PasswordHash, f.HomeDirectory, f.QuotaMB, f.UploadBandwidth, f.DownloadBandwidth, f.Active)
+		if err != nil {
+			return err
+		}
+		kept.FTPAccounts = append(kept.FTPAccounts, f)
+	}
+	for _, entry := range data.FTPEntries {
+		// login:password:uid:gid:gecos:home:...
+		fields := strings.Split(entry, ":")
+		if len(fields) < 6 || !withinDir(fields[5], homeDir) {
+			continue
+		}
+		for _, f := range kept.FTPAccounts {
+			if f.Username == fields[0] {
+				kept.FTPEntries = append(kept.FTPEntries, entry)
+				break
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*data = kept
+	return nil
+}
+
+var phpVersionRe = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// checkDomain validates an archived domain. Its name, document root and
+// PHP version end up in vhosts, zone files, pool paths and chown calls
+// run as root.
+func checkDomain(d DomainRecord, homeDir string) error {
+	if account.NewService(nil).ValidateDomain(d.Name) != nil {
+		return errors.New("invalid name")
+	}
+	if !withinDir(d.DocumentRoot, homeDir) {
+		return errors.New("document root outside the account")
+	}
+	if d.PHPVersion != "" && !phpVersionRe.MatchString(d.PHPVersion) {
+		return errors.New("invalid PHP version")
+	}
+	return nil
+}
+
+// checkSubdomain validates an archived subdomain like checkDomain; the
+// redirect URL gets the check the subdomain handler applies
+func checkSubdomain(s SubdomainRecord, homeDir string) error {
+	validator := account.NewService(nil)
+	if s.FullName != s.Name+"."+s.Domain || validator.ValidateDomain(s.FullName) != nil {
+		return errors.New("invalid name")
+	}
+	if s.RedirectURL != "" && validator.ValidateRedirectURL(s.RedirectURL) != nil {
+		return errors.New("invalid redirect URL")
+	}
+	if (s.DocumentRoot != "" || s.RedirectURL == "") && !withinDir(s.DocumentRoot, homeDir) {
+		return errors.New("document root outside the account")
+	}
+	return nil
+}
+
+// hasDomain reports whether the account data holds domain
+func (d *AccountData) hasDomain(name string) bool {
+	for _, domain := range d.Domains {
+		if domain.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDatabase reports whether the account data holds database name
+func (d *AccountData) hasDatabase(name string) bool {
+	for _, db := range d.Databases {
+		if db.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withinDir reports whether path is dir or below it
+func withinDir(path, dir string) bool {
+	path = filepath.Clean(path)
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+var (
+	mysqlNameRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+	// MySQL's own schemas, never created or imported from an archive
+	systemSchemas = map[string]bool{"mysql": true, "information_schema": true, "performance_schema": true, "sys": true}
+)
+
+// validMySQLName reports whether an archived database or MySQL user name
+// may belong to the account: lowercase, prefixed with "<username>_" and not
+// a system schema. Archives are untrusted, so anything else is refused
+// before it reaches a root MySQL statement.
+func validMySQLName(name, username string) bool {
+	return mysqlNameRe.MatchString(name) && strings.HasPrefix(name, username+"_") && !systemSchemas[name]
+}
+
+// mysqlQuote escapes a value for a single-quoted MySQL string literal
+func mysqlQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// createDatabases creates the archived MySQL databases and users before dumps are imported
+func (m *Manager) createDatabases(data *AccountData, result *RestoreResult) {
+	mysqlManager := mysql.NewManager(m.cfg.SimulateMode, m.cfg.SimulateBasePath)
+	username := data.User.Username
+
+	for _, d := range data.Databases {
+		if !validMySQLName(d.Name, username) {
+			result.warn("database %s: invalid name, skipped", d.Name)
+			continue
+		}
+		if len(d.Users) == 0 {
+			d.Users = []DatabaseUserRecord{{Username: d.Name, Password: mysql.GeneratePassword(16)}}
+		}
+		for _, u := range d.Users {
+			if !validMySQLName(u.Username, username) {
+				result.warn("database user %s: invalid name, skipped", u.Username)
+				continue
+			}
+			if m.cfg.SimulateMode {
+				mysqlManager.CreateDatabase(mysql.DatabaseConfig{Name: d.Name, Username: u.Username, Password: u.Password})
+				continue
+			}
+			identified := fmt.Sprintf("IDENTIFIED BY '%s'", mysqlQuote(u.Password))
+			if u.Password == "" && nativeHashRe.MatchString(u.PasswordHash) {
+				identified = fmt.Sprintf("IDENTIFIED WITH mysql_native_password AS '%s'", u.PasswordHash)
+			}
+			// ALTER USER keeps the archived password when the user already exists
+			stmt := fmt.Sprintf(
+				"CREATE DATABASE IF NOT EXISTS `%s` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci; "+
+					"CREATE USER IF NOT EXISTS '%s'@'localhost' %s; "+
+					"ALTER USER '%s'@'localhost' %s; "+
+					"GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'localhost'; FLUSH PRIVILEGES;",
+				d.Name, u.Username, identified, u.Username, identified, d.Name, u.Username)
+			if output, err := mysqlCommand("-e", stmt).CombinedOutput(); err != nil {
+				result.warn("database %s: %s", d.Name, strings.TrimSpace(string(output)))
+			}
+		}
+	}
+}
+
+// importDatabase loads a dump from the archive stream into MySQL. The dump
+// is untrusted, so it runs as a temporary MySQL user granted only on this
+// database, and the mysql client runs as the account's system user so
+// client commands in the dump (system, source) get no root access either.
+func (m *Manager) importDatabase(r io.Reader, name, username string) error {
+	if systemSchemas[name] || !mysqlNameRe.MatchString(name) {
+		return fmt.Errorf("invalid database name")
+	}
+	if m.cfg.SimulateMode {
+		io.Copy(io.Discard, r)
+		return nil
+	}
+
+	sysUser, err := user.Lookup(username)
+	if err != nil {
+		return fmt.Errorf("system user %s not found: %w", username, err)
+	}
+	uid, _ := strconv.ParseUint(sysUser.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(sysUser.Gid, 10, 32)
+
+	importUser := "sp_import_" + randomPassword()[:12]
+	password := randomPassword()
+	grant := fmt.Sprintf("CREATE USER '%s'@'localhost' IDENTIFIED BY '%s'; "+
+		"GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'localhost';", importUser, password, name, importUser)
+	if output, err := mysqlCommand("-e", grant).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create import user: %s", strings.TrimSpace(string(output)))
+	}
+	defer mysqlCommand("-e", fmt.Sprintf("DROP USER IF EXISTS '%s'@'localhost';", importUser)).Run()
+
+	cmd := exec.Command("mysql", "--no-defaults", "-u", importUser, name)
+	cmd.Env = []string{"MYSQL_PWD=" + password, "HOME=" + sysUser.HomeDir, "PATH=/usr/sbin:/usr/bin:/sbin:/bin"}
+	cmd.Dir = "/"
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}}
+	cmd.Stdin = r
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s - %w", strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
+
+func mysqlCommand(args ...string) *exec.Cmd {
+	return exec.Command("mysql", append([]string{"-u", "root", "-p" + os.Getenv("MYSQL_ROOT_PASSWORD")}, args...)...)
+}
+
+// fixOwnership hands restored files back to the account and mail users
+func (m *Manager) fixOwnership(data *AccountData, opts Options) {
+	if m.cfg.SimulateMode {
+		return
+	}
+	username := data.User.Username
+	if !opts.SkipHome {
+		exec.Command("chown", "-R", username+":"+username, filepath.Join(m.cfg.HomeBaseDir, username)).Run()
+		os.Chmod(filepath.Join(m.cfg.HomeBaseDir, username), 0711)
+	}
+	if !opts.SkipMail {
+		for _, d := range data.Domains {
+			mailDir := filepath.Join(m.mailRoot(), d.Name)
+			if _, err := os.Stat(mailDir); err == nil {
+				exec.Command("chown", "-R", "vmail:vmail", mailDir).Run()
+			}
+		}
+	}
+}
+
+// rewriteHome moves archived paths to the home directory on this server
+func (d *AccountData) rewriteHome(oldHome, newHome string) {
+	if oldHome == "" || oldHome == newHome {
+		return
+	}
+	rewrite := func(path string) string {
+		if path == oldHome || strings.HasPrefix(path, oldHome+"/") {
+			return newHome + strings.TrimPrefix(path, oldHome)
+		}
+		return path
+	}
+	for i := range d.Domains {
+		d.Domains[i].DocumentRoot = rewrite(d.Domains[i].DocumentRoot)
+	}
+	for i := range d.Subdomains {
+		d.Subdomains[i].DocumentRoot = rewrite(d.Subdomains[i].DocumentRoot)
+	}
+	for i := range d.FTPAccounts {
+		d.FTPAccounts[i].HomeDirectory = rewrite(d.FTPAccounts[i].HomeDirectory)
+	}
+	for i := range d.CronJobs {
+		d.CronJobs[i].Command = strings.ReplaceAll(d.CronJobs[i].Command, oldHome+"/", newHome+"/")
+	}
+	for i, line := range d.FTPEntries {
+		d.FTPEntries[i] = strings.Replace(line, ":"+oldHome+"/", ":"+newHome+"/", 1)
+	}
+}
+
+func readJSON(tr *tar.Reader, name string, v interface{}) error {
+	hdr, err := tr.Next()
+	if err != nil || strings.TrimPrefix(hdr.Name, "./") != name {
+		return ErrInvalidArchive
+	}
+	if err := json.NewDecoder(tr).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	return nil
+}
+
+// extractEntry writes a single tar entry to rel inside root. Whatever is
+// at rel on disk is replaced rather than written through, so an existing
+// symlink or hard link cannot redirect the write.
+func extractEntry(tr *tar.Reader, hdr *tar.Header, root *os.Root, rel string) error {
+	mode := os.FileMode(hdr.Mode).Perm()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := root.MkdirAll(rel, 0755); err != nil {
+			return err
+		}
+		root.Chmod(rel, mode)
+
+	case tar.TypeReg:
+		if err := root.MkdirAll(filepath.Dir(rel), 0755); err != nil {
+			return err
+		}
+		if err := root.Remove(rel); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f, err := root.OpenFile(rel, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		f.Chmod(mode)
+		f.Close()
+		root.Chtimes(rel, hdr.ModTime, hdr.ModTime)
+
+	case tar.TypeSymlink:
+		if filepath.IsAbs(hdr.Linkname) || strings.HasPrefix(filepath.Clean(hdr.Linkname), "..") {
+			// Links pointing outside the account would give access to foreign files
+			return nil
+		}
+		if err := root.MkdirAll(filepath.Dir(rel), 0755); err != nil {
+			return err
+		}
+		root.Remove(rel)
+		if err := root.Symlink(hdr.Linkname, rel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	if s == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: s, Valid: true}
+}
+
+func randomPassword() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
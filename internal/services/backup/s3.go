@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Destination stores archives on Amazon S3 or any S3-compatible service
+// (MinIO, Ceph RGW, Wasabi...)
+type s3Destination struct {
+	config DestinationConfig
+	client *minio.Client
+}
+
+func newS3Destination(config DestinationConfig, creds DestinationCredentials) (*s3Destination, error) {
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid endpoint: %v", ErrInvalidDestination, err)
+	}
+
+	// Path-style addressing is the default since MinIO and most self-hosted
+	// services do not have a wildcard DNS record for buckets
+	lookup := minio.BucketLookupPath
+	if config.VirtualHost {
+		lookup = minio.BucketLookupDNS
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(creds.AccessKey, creds.SecretKey, ""),
+		Secure:       u.Scheme == "https",
+		Region:       config.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Destination{config: config, client: client}, nil
+}
+
+// Every part is sent with Content-MD5, S3 rejects uploads whose content does
+// not match it
+func (d *s3Destination) verifiesChecksum() bool { return true }
+
+func (d *s3Destination) key(name string) string {
+	if d.config.Prefix == "" {
+		return name
+	}
+	return d.config.Prefix + "/" + name
+}
+
+func (d *s3Destination) Test() error {
+	// Checks endpoint, credentials and bucket at once
+	exists, err := d.client.BucketExists(context.Background(), d.config.Bucket)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "AccessDenied" {
+			return fmt.Errorf("access denied to bucket %s", d.config.Bucket)
+		}
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", d.config.Bucket)
+	}
+	return nil
+}
+
+func (d *s3Destination) Put(name string, r io.Reader, size int64, checksum string) error {
+	if !ValidRemoteName(name) {
+		return fmt.Errorf("invalid name: %s", name)
+	}
+
+	// Large archives are uploaded in parts, an aborted upload leaves no object
+	_, err := d.client.PutObject(context.Background(), d.config.Bucket, d.key(name), r, size, minio.PutObjectOptions{
+		ContentType:    "application/octet-stream",
+		SendContentMd5: true,
+	})
+	return err
+}
+
+func (d *s3Destination) Get(name string) (io.ReadCloser, error) {
+	if !ValidRemoteName(name) {
+		return nil, fmt.Errorf("invalid name: %s", name)
+	}
+
+	obj, err := d.client.GetObject(context.Background(), d.config.Bucket, d.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, Stat sends the request and surfaces a missing key
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrRemoteNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (d *s3Destination) List() ([]RemoteFile, error) {
+	prefix := ""
+	if d.config.Prefix != "" {
+		prefix = d.config.Prefix + "/"
+	}
+
+	files := []RemoteFile{}
+	objects := d.client.ListObjects(context.Background(), d.config.Bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+	for obj := range objects {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		files = append(files, RemoteFile{
+			Name:    strings.TrimPrefix(obj.Key, prefix),
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+	return files, nil
+}
+
+func (d *s3Destination) Delete(name string) error {
+	if !ValidRemoteName(name) {
+		return fmt.Errorf("invalid name: %s", name)
+	}
+	return d.client.RemoveObject(context.Background(), d.config.Bucket, d.key(name), minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,403 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+
+	ModeFull        = "full"
+	ModeIncremental = "incremental"
+)
+
+const scheduleTimeFormat = "2006-01-02 15:04:05"
+
+var (
+	ErrScheduleNotFound = errors.New("backup schedule not found")
+	ErrInvalidSchedule  = errors.New("invalid backup schedule")
+)
+
+// Schedule is a row of the backup_schedules table
+type Schedule struct {
+	ID            int64   `json:"id"`
+	Name          string  `json:"name"`
+	Frequency     string  `json:"frequency"` // daily, weekly, monthly
+	Hour          int     `json:"hour"`
+	Minute        int     `json:"minute"`
+	Weekday       int     `json:"weekday"`   // 0 = Sunday, weekly only
+	MonthDay      int     `json:"month_day"` // 1-28, monthly only
+	Mode          string  `json:"mode"`      // full, incremental
+	FullEvery     int     `json:"full_every"`
+	Retention     int     `json:"retention"`
+	UserIDs       []int64 `json:"user_ids"` // empty = all accounts
+	SkipHome      bool    `json:"skip_home"`
+	SkipDatabases bool    `json:"skip_databases"`
+	SkipMail      bool    `json:"skip_mail"`
+	DestinationID int64   `json:"destination_id"` // 0 = keep backups local only
+	Active        bool    `json:"active"`
+	LastRun       string  `json:"last_run,omitempty"`
+	NextRun       string  `json:"next_run,omitempty"`
+	LastStatus    string  `json:"last_status,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+// Validate normalizes defaults and checks the schedule fields
+func (s *Schedule) Validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSchedule)
+	}
+	switch s.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+	default:
+		return fmt.Errorf("%w: frequency must be daily, weekly or monthly", ErrInvalidSchedule)
+	}
+	if s.Mode == "" {
+		s.Mode = ModeFull
+	}
+	if s.Mode != ModeFull && s.Mode != ModeIncremental {
+		return fmt.Errorf("%w: mode must be full or incremental", ErrInvalidSchedule)
+	}
+	if s.Hour < 0 || s.Hour > 23 || s.Minute < 0 || s.Minute > 59 {
+		return fmt.Errorf("%w: invalid time", ErrInvalidSchedule)
+	}
+	if s.Weekday < 0 || s.Weekday > 6 {
+		return fmt.Errorf("%w: weekday must be 0-6", ErrInvalidSchedule)
+	}
+	if s.MonthDay == 0 {
+		s.MonthDay = 1
+	}
+	// Days after the 28th do not exist in every month
+	if s.MonthDay < 1 || s.MonthDay > 28 {
+		return fmt.Errorf("%w: month_day must be 1-28", ErrInvalidSchedule)
+	}
+	if s.Retention < 1 {
+		return fmt.Errorf("%w: retention must be at least 1", ErrInvalidSchedule)
+	}
+	if s.FullEvery < 1 {
+		s.FullEvery = 7
+	}
+	return nil
+}
+
+// Next returns the first run time strictly after the given time
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := time.Date(after.Year(), after.Month(), after.Day(), s.Hour, s.Minute, 0, 0, after.Location())
+
+	switch s.Frequency {
+	case FrequencyWeekly:
+		t = t.AddDate(0, 0, (s.Weekday-int(t.Weekday())+7)%7)
+		if !t.After(after) {
+			t = t.AddDate(0, 0, 7)
+		}
+	case FrequencyMonthly:
+		t = time.Date(after.Year(), after.Month(), s.MonthDay, s.Hour, s.Minute, 0, 0, after.Location())
+		if !t.After(after) {
+			t = t.AddDate(0, 1, 0)
+		}
+	default:
+		if !t.After(after) {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return t
+}
+
+const scheduleColumns = `id, name, frequency, hour, minute, weekday, month_day, mode, full_every, retention,
+	COALESCE(user_ids, ''), skip_home, skip_databases, skip_mail, COALESCE(destination_id, 0), active,
+	COALESCE(last_run, ''), COALESCE(next_run, ''), COALESCE(last_status, ''), created_at`
+
+func scanSchedule(scanner interface{ Scan(...interface{}) error }) (*Schedule, error) {
+	var s Schedule
+	var userIDs string
+	err := scanner.Scan(&s.ID, &s.Name, &s.Frequency, &s.Hour, &s.Minute, &s.Weekday, &s.MonthDay,
+		&s.Mode, &s.FullEvery, &s.Retention, &userIDs, &s.SkipHome, &s.SkipDatabases, &s.SkipMail,
+		&s.DestinationID, &s.Active, &s.LastRun, &s.NextRun, &s.LastStatus, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.UserIDs = []int64{}
+	for _, part := range strings.Split(userIDs, ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil {
+			s.UserIDs = append(s.UserIDs, id)
+		}
+	}
+	return &s, nil
+}
+
+// validateSchedule validates the fields and checks the destination exists
+func (m *Manager) validateSchedule(s *Schedule) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if s.DestinationID > 0 {
+		if _, err := m.GetDestination(s.DestinationID); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+	return nil
+}
+
+func nullID(id int64) interface{} {
+	if id <= 0 {
+		return nil
+	}
+	return id
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ListSchedules returns all backup schedules
+func (m *Manager) ListSchedules() ([]Schedule, error) {
+	rows, err := m.db.Query("SELECT " + scheduleColumns + " FROM backup_schedules ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			continue
+		}
+		schedules = append(schedules, *s)
+	}
+	return schedules, nil
+}
+
+// GetSchedule returns a single backup schedule
+func (m *Manager) GetSchedule(id int64) (*Schedule, error) {
+	s, err := scanSchedule(m.db.QueryRow("SELECT "+scheduleColumns+" FROM backup_schedules WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduleNotFound
+	}
+	return s, err
+}
+
+// CreateSchedule validates and stores a new schedule
+func (m *Manager) CreateSchedule(s *Schedule) (*Schedule, error) {
+	if err := m.validateSchedule(s); err != nil {
+		return nil, err
+	}
+
+	result, err := m.db.Exec(`
+		INSERT INTO backup_schedules (name, frequency, hour, minute, weekday, month_day, mode, full_every,
+			retention, user_ids, skip_home, skip_databases, skip_mail, destination_id, active, next_run)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.Name, s.Frequency, s.Hour, s.Minute, s.Weekday, s.MonthDay, s.Mode, s.FullEvery,
+		s.Retention, joinIDs(s.UserIDs), s.SkipHome, s.SkipDatabases, s.SkipMail, nullID(s.DestinationID), s.Active,
+		s.Next(time.Now()).Format(scheduleTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := result.LastInsertId()
+	return m.GetSchedule(id)
+}
+
+// UpdateSchedule overwrites an existing schedule and recalculates its next run
+func (m *Manager) UpdateSchedule(id int64, s *Schedule) (*Schedule, error) {
+	if _, err := m.GetSchedule(id); err != nil {
+		return nil, err
+	}
+	if err := m.validateSchedule(s); err != nil {
+		return nil, err
+	}
+
+	_, err := m.db.Exec(`
+		UPDATE backup_schedules SET name = ?, frequency = ?, hour = ?, minute = ?, weekday = ?, month_day = ?,
+			mode = ?, full_every = ?, retention = ?, user_ids = ?, skip_home = ?, skip_databases = ?,
+			skip_mail = ?, destination_id = ?, active = ?, next_run = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, s.Name, s.Frequency, s.Hour, s.Minute, s.Weekday, s.MonthDay, s.Mode, s.FullEvery,
+		s.Retention, joinIDs(s.UserIDs), s.SkipHome, s.SkipDatabases, s.SkipMail, nullID(s.DestinationID), s.Active,
+		s.Next(time.Now()).Format(scheduleTimeFormat), id)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetSchedule(id)
+}
+
+// DeleteSchedule removes a schedule. Its backups are kept as manual backups.
+func (m *Manager) DeleteSchedule(id int64) error {
+	result, err := m.db.Exec("DELETE FROM backup_schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// DueSchedules returns active schedules whose next run is not after now
+func (m *Manager) DueSchedules(now time.Time) ([]Schedule, error) {
+	schedules, err := m.ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	var due []Schedule
+	for _, s := range schedules {
+		if !s.Active {
+			continue
+		}
+		next, err := time.ParseInLocation(scheduleTimeFormat, s.NextRun, now.Location())
+		if err != nil || !next.After(now) {
+			due = append(due, s)
+		}
+	}
+	return due, nil
+}
+
+// RunSchedule backs up every account of the schedule and applies retention.
+// It returns the number of accounts that failed.
+func (m *Manager) RunSchedule(s *Schedule, progress func(msg string)) (int, error) {
+	now := time.Now()
+	m.db.Exec("UPDATE backup_schedules SET last_run = ?, next_run = ?, last_status = 'running' WHERE id = ?",
+		now.Format(scheduleTimeFormat), s.Next(now).Format(scheduleTimeFormat), s.ID)
+
+	userIDs := s.UserIDs
+	if len(userIDs) == 0 {
+		rows, err := m.db.Query("SELECT id FROM users WHERE role = 'user' ORDER BY id")
+		if err != nil {
+			m.db.Exec("UPDATE backup_schedules SET last_status = 'failed' WHERE id = ?", s.ID)
+			return 0, err
+		}
+		for rows.Next() {
+			var id int64
+			if rows.Scan(&id) == nil {
+				userIDs = append(userIDs, id)
+			}
+		}
+		rows.Close()
+	}
+
+	opts := Options{
+		SkipHome:      s.SkipHome,
+		SkipDatabases: s.SkipDatabases,
+		SkipMail:      s.SkipMail,
+		Incremental:   s.Mode == ModeIncremental,
+		FullEvery:     s.FullEvery,
+		ScheduleID:    s.ID,
+		Progress:      progress,
+	}
+
+	failed := 0
+	for _, userID := range userIDs {
+		record, err := m.CreateAccountBackup(userID, opts)
+		if err != nil {
+			failed++
+			m.progress(opts, "❌ Hesap #%d yedeklenemedi: %v", userID, err)
+			continue
+		}
+		if s.DestinationID > 0 {
+			if _, err := m.UploadBackup(s.DestinationID, record.ID, progress); err != nil {
+				failed++
+				m.progress(opts, "❌ Yedek #%d uzak hedefe yüklenemedi: %v", record.ID, err)
+			}
+		}
+		if removed, err := m.ApplyRetention(s.ID, userID, s.Retention); err != nil {
+			m.progress(opts, "⚠️ Eski yedekler silinemedi: %v", err)
+		} else if removed > 0 {
+			m.progress(opts, "🗑️ %d eski yedek silindi", removed)
+		}
+	}
+
+	status := "completed"
+	if failed > 0 {
+		status = fmt.Sprintf("%d/%d failed", failed, len(userIDs))
+	}
+	m.db.Exec("UPDATE backup_schedules SET last_status = ? WHERE id = ?", status, s.ID)
+
+	return failed, nil
+}
+
+// ApplyRetention keeps the newest keep completed backups of a schedule for
+// an account. Full backups that kept incrementals depend on are never
+// removed. Failed runs are pruned on their own to the newest keep, so they
+// neither count toward nor push out completed backups.
+func (m *Manager) ApplyRetention(scheduleID, userID int64, keep int) (int, error) {
+	ids, err := m.scheduleBackups(scheduleID, userID, "completed")
+	if err != nil {
+		return 0, err
+	}
+	failed, err := m.scheduleBackups(scheduleID, userID, "failed")
+	if err != nil {
+		return 0, err
+	}
+
+	var prune []int64
+	if len(ids) > keep {
+		needed := map[int64]bool{}
+		for _, id := range ids[:keep] {
+			chain, err := m.chain(id)
+			if err != nil {
+				needed[id] = true
+				continue
+			}
+			for _, r := range chain {
+				needed[r.ID] = true
+			}
+		}
+		for _, id := range ids[keep:] {
+			if !needed[id] {
+				prune = append(prune, id)
+			}
+		}
+	}
+	if len(failed) > keep {
+		prune = append(prune, failed[keep:]...)
+	}
+
+	// Newest first, so incrementals go before the backup they are based on
+	removed := 0
+	for _, id := range prune {
+		if err := m.DeleteBackup(id); err != nil {
+			if err == ErrBackupInUse {
+				continue
+			}
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// scheduleBackups returns the IDs of a schedule's backups of an account
+// with the given status, newest first
+func (m *Manager) scheduleBackups(scheduleID, userID int64, status string) ([]int64, error) {
+	rows, err := m.db.Query(`
+		SELECT id FROM backups
+		WHERE schedule_id = ? AND user_id = ? AND status = ?
+		ORDER BY id DESC
+	`, scheduleID, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
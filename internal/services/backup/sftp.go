@@ -0,0 +1,270 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpDestination stores archives on a remote host over SFTP. The server
+// must present the host key configured on the destination.
+type sftpDestination struct {
+	config      DestinationConfig
+	credentials DestinationCredentials
+
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// parseHostKey accepts a SHA256 fingerprint, an authorized_keys style public
+// key or a known_hosts line and returns the SHA256 fingerprint
+func parseHostKey(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "SHA256:") {
+		return value, nil
+	}
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(value)); err == nil {
+		return ssh.FingerprintSHA256(key), nil
+	}
+	if _, _, key, _, _, err := ssh.ParseKnownHosts([]byte(value)); err == nil {
+		return ssh.FingerprintSHA256(key), nil
+	}
+	return "", errors.New("host_key must be a SHA256 fingerprint, a public key or a known_hosts line")
+}
+
+func (d *sftpDestination) connect() (*sftp.Client, error) {
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if d.credentials.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(d.credentials.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if d.credentials.Password != "" {
+		password := d.credentials.Password
+		methods = append(methods, ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}))
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User: d.config.Username,
+		Auth: methods,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if d.config.HostKey == "" {
+				return errors.New("host key fingerprint is not configured")
+			}
+			if fingerprint := ssh.FingerprintSHA256(key); fingerprint != d.config.HostKey {
+				return fmt.Errorf("host key mismatch: expected %s, got %s", d.config.HostKey, fingerprint)
+			}
+			return nil
+		},
+		Timeout: 30 * time.Second,
+	}
+
+	addr := net.JoinHostPort(d.config.Host, strconv.Itoa(d.config.Port))
+	conn, err := ssh.Dial("tcp", addr, sshConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	d.conn = conn
+	d.client = client
+	return client, nil
+}
+
+// Close ends the SSH connection
+func (d *sftpDestination) Close() error {
+	if d.conn == nil {
+		return nil
+	}
+	d.client.Close()
+	err := d.conn.Close()
+	d.conn, d.client = nil, nil
+	return err
+}
+
+func (d *sftpDestination) path(name string) (string, error) {
+	if !ValidRemoteName(name) {
+		return "", fmt.Errorf("invalid name: %s", name)
+	}
+	return path.Join(d.config.Path, name), nil
+}
+
+func (d *sftpDestination) Test() error {
+	client, err := d.connect()
+	if err != nil {
+		return err
+	}
+	if err := client.MkdirAll(d.config.Path); err != nil {
+		return err
+	}
+	info, err := client.Stat(d.config.Path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", d.config.Path)
+	}
+	return nil
+}
+
+func (d *sftpDestination) Put(name string, r io.Reader, size int64, checksum string) error {
+	target, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	client, err := d.connect()
+	if err != nil {
+		return err
+	}
+	if err := client.MkdirAll(path.Dir(target)); err != nil {
+		return err
+	}
+
+	// Upload under a temporary name so a partial copy never looks complete
+	tmp := target + ".part"
+	if err := writeRemote(client, tmp, r, size); err != nil {
+		client.Remove(tmp)
+		return err
+	}
+
+	// posix-rename overwrites an existing archive atomically; servers
+	// without the extension need the target removed first
+	if err := client.PosixRename(tmp, target); err == nil {
+		return nil
+	}
+	if err := client.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		client.Remove(tmp)
+		return err
+	}
+	return client.Rename(tmp, target)
+}
+
+// writeRemote copies r to a new remote file and checks the stored size
+func writeRemote(client *sftp.Client, name string, r io.Reader, size int64) error {
+	f, err := client.Create(name)
+	if err != nil {
+		return err
+	}
+	written, err := f.ReadFrom(r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("wrote %d of %d bytes", written, size)
+	}
+
+	info, err := client.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return fmt.Errorf("remote size %d does not match %d", info.Size(), size)
+	}
+	return nil
+}
+
+func (d *sftpDestination) Get(name string) (io.ReadCloser, error) {
+	target, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	f, err := client.Open(target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrRemoteNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d *sftpDestination) List() ([]RemoteFile, error) {
+	client, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk joins with path.Join, so names below "." carry no prefix
+	prefix := path.Clean(d.config.Path)
+	switch prefix {
+	case ".":
+		prefix = ""
+	case "/":
+	default:
+		prefix += "/"
+	}
+
+	files := []RemoteFile{}
+	walker := client.Walk(d.config.Path)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == d.config.Path && errors.Is(err, os.ErrNotExist) {
+				return files, nil
+			}
+			return nil, err
+		}
+
+		info := walker.Stat()
+		if !info.Mode().IsRegular() || path.Ext(info.Name()) == ".part" {
+			continue
+		}
+		files = append(files, RemoteFile{
+			Name:    strings.TrimPrefix(walker.Path(), prefix),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return files, nil
+}
+
+func (d *sftpDestination) Delete(name string) error {
+	target, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	client, err := d.connect()
+	if err != nil {
+		return err
+	}
+	if err := client.Remove(target); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrRemoteNotFound
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// zoneRecord is a resource record read from a BIND zone file
+type zoneRecord struct {
+	Name     string // relative to the zone origin, "@" for the apex
+	Type     string
+	TTL      int
+	Priority int
+	Content  string
+}
+
+// parseZoneFile reads the records of a BIND zone file. Directives ($TTL,
+// $ORIGIN), multi-line parentheses, comments, blank owners and relative names
+// are handled; $INCLUDE and $GENERATE are reported as errors per line.
+func parseZoneFile(content, origin string) ([]zoneRecord, []error) {
+	origin = strings.TrimSuffix(strings.ToLower(origin), ".") + "."
+	zone := origin
+	defaultTTL := 3600
+	lastOwner := "@"
+
+	var records []zoneRecord
+	var errs []error
+
+	for _, line := range joinZoneLines(content) {
+		ownerBlank := line != "" && (line[0] == ' ' || line[0] == '\t')
+		fields := splitZoneFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "$TTL":
+			if len(fields) > 1 {
+				if ttl, err := parseTTL(fields[1]); err == nil {
+					defaultTTL = ttl
+				}
+			}
+			continue
+		case "$ORIGIN":
+			if len(fields) > 1 {
+				origin = absoluteName(fields[1], origin)
+			}
+			continue
+		}
+		if strings.HasPrefix(fields[0], "$") {
+			errs = append(errs, fmt.Errorf("unsupported directive %s", fields[0]))
+			continue
+		}
+
+		owner := lastOwner
+		if !ownerBlank {
+			owner = absoluteName(fields[0], origin)
+			fields = fields[1:]
+		}
+		lastOwner = owner
+
+		// TTL and class may come in either order before the type
+		ttl := defaultTTL
+		for len(fields) > 0 {
+			if t, err := parseTTL(fields[0]); err == nil {
+				ttl = t
+				fields = fields[1:]
+				continue
+			}
+			if strings.EqualFold(fields[0], "IN") {
+				fields = fields[1:]
+				continue
+			}
+			break
+		}
+		if len(fields) < 2 {
+			errs = append(errs, fmt.Errorf("malformed record: %s", strings.TrimSpace(line)))
+			continue
+		}
+
+		rrType := strings.ToUpper(fields[0])
+		data := fields[1:]
+		r := zoneRecord{Name: relativeName(owner, zone), Type: rrType, TTL: ttl}
+
+		switch rrType {
+		case "A", "AAAA":
+			r.Content = data[0]
+		case "CNAME", "NS", "PTR":
+			r.Content = absoluteName(data[0], origin)
+		case "MX":
+			if len(data) < 2 {
+				errs = append(errs, fmt.Errorf("malformed MX record: %s", strings.TrimSpace(line)))
+				continue
+			}
+			r.Priority, _ = strconv.Atoi(data[0])
+			r.Content = absoluteName(data[1], origin)
+		case "SRV":
+			if len(data) < 4 {
+				errs = append(errs, fmt.Errorf("malformed SRV record: %s", strings.TrimSpace(line)))
+				continue
+			}
+			r.Priority, _ = strconv.Atoi(data[0])
+			r.Content = fmt.Sprintf("%s %s %s", data[1], data[2], absoluteName(data[3], origin))
+		case "TXT", "SPF":
+			// A single string is stored unquoted, the zone generator adds the
+			// quotes back; long records split in several strings stay quoted
+			if len(data) == 1 {
+				r.Content = strings.Trim(data[0], `"`)
+			} else {
+				r.Content = strings.Join(data, " ")
+			}
+			if rrType == "SPF" {
+				r.Type = "TXT"
+			}
+		default:
+			r.Content = strings.Join(data, " ")
+		}
+		records = append(records, r)
+	}
+	return records, errs
+}
+
+// joinZoneLines strips comments and merges records spanning parentheses
+func joinZoneLines(content string) []string {
+	var lines []string
+	var pending strings.Builder
+	depth := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := stripZoneComment(scanner.Text())
+		inQuote := false
+		for _, c := range line {
+			switch {
+			case c == '"':
+				inQuote = !inQuote
+			case c == '(' && !inQuote:
+				depth++
+			case c == ')' && !inQuote:
+				depth--
+			}
+		}
+
+		if pending.Len() > 0 {
+			pending.WriteString(" ")
+		}
+		pending.WriteString(line)
+		if depth <= 0 {
+			joined := strings.NewReplacer("(", " ", ")", " ").Replace(pending.String())
+			if strings.TrimSpace(joined) != "" {
+				lines = append(lines, joined)
+			}
+			pending.Reset()
+			depth = 0
+		}
+	}
+	return lines
+}
+
+func stripZoneComment(line string) string {
+	inQuote := false
+	for i, c := range line {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+		case c == ';' && !inQuote:
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitZoneFields splits on whitespace, keeping quoted strings together
+func splitZoneFields(line string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuote := false
+
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			current.WriteRune(c)
+		case (c == ' ' || c == '\t') && !inQuote:
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(c)
+		}
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// parseTTL accepts plain seconds and BIND units (1h, 2d, 1w)
+func parseTTL(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	total, num := 0, ""
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if s[i] >= '0' && s[i] <= '9' {
+			num += string(s[i])
+			continue
+		}
+		mult, ok := units[c]
+		if !ok || num == "" {
+			return 0, fmt.Errorf("invalid ttl %s", s)
+		}
+		n, _ := strconv.Atoi(num)
+		total += n * mult
+		num = ""
+	}
+	if num != "" {
+		return 0, fmt.Errorf("invalid ttl %s", s)
+	}
+	return total, nil
+}
+
+func absoluteName(name, origin string) string {
+	if name == "@" {
+		return origin
+	}
+	if strings.HasSuffix(name, ".") {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name) + "." + origin
+}
+
+// relativeName turns an absolute owner into the form used by dns_records
+func relativeName(name, zone string) string {
+	if name == zone {
+		return "@"
+	}
+	if strings.HasSuffix(name, "."+zone) {
+		return strings.TrimSuffix(name, "."+zone)
+	}
+	return name
+}
@@ -0,0 +1,701 @@
+package bandwidth
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+	"github.com/asergenalkan/serverpanel/internal/services/account"
+	"github.com/asergenalkan/serverpanel/internal/webserver"
+)
+
+// Traffic sources
+const (
+	SourceWeb  = "web"
+	SourceFTP  = "ftp"
+	SourceMail = "mail"
+)
+
+// Actions taken when an account goes over its monthly bandwidth
+const (
+	ActionWarn     = "warn"
+	ActionThrottle = "throttle"
+	ActionSuspend  = "suspend"
+)
+
+// SuspendReason marks suspensions made by the bandwidth check; only these
+// are lifted automatically when the account is back under its limit
+const SuspendReason = "Bandwidth limit exceeded"
+
+const (
+	collectInterval     = 15 * time.Minute
+	defaultThrottleKBps = 256
+	maxQueuedMails      = 100000
+	ftpTransferLog      = "/var/log/pure-ftpd/transfer.log"
+	postfixLog          = "/var/log/mail.log"
+)
+
+// DB interface for database operations
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Begin() (*sql.Tx, error)
+}
+
+// Collector reads web, FTP and mail logs incrementally and adds the
+// transferred bytes to bandwidth_usage per account and day. File offsets
+// are stored so each line is counted once, across restarts and rotation.
+type Collector struct {
+	db  DB
+	cfg *config.Config
+
+	mu    sync.Mutex
+	queue map[string]queuedMail // Postfix queue ID -> message, spans runs
+}
+
+// queuedMail is a message qmgr picked up whose deliveries are still to come
+type queuedMail struct {
+	from string
+	size int64
+}
+
+// Result summarises one collection run
+type Result struct {
+	Files    int       `json:"files"`
+	Lines    int       `json:"lines"`
+	Bytes    int64     `json:"bytes"`
+	Exceeded []Overage `json:"exceeded,omitempty"` // accounts that went over in this run
+}
+
+// Overage is an account over its monthly bandwidth limit
+type Overage struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Month     string `json:"month"`
+	Action    string `json:"action"`
+	UsedMB    int64  `json:"used_mb"`
+	LimitMB   int64  `json:"limit_mb"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// DailyUsage is one day of an account's traffic
+type DailyUsage struct {
+	Day   string `json:"day"`
+	Web   int64  `json:"web"`
+	FTP   int64  `json:"ftp"`
+	Mail  int64  `json:"mail"`
+	Total int64  `json:"total"`
+}
+
+// Report is an account's traffic in one month, in bytes
+type Report struct {
+	UserID  int64        `json:"user_id"`
+	Month   string       `json:"month"`
+	Total   int64        `json:"total"`
+	LimitMB int64        `json:"limit_mb"` // 0 means unlimited
+	Days    []DailyUsage `json:"days"`
+	Overage *Overage     `json:"overage,omitempty"`
+}
+
+var ErrInvalidMonth = errors.New("month must be in YYYY-MM format")
+
+var (
+	collector     *Collector
+	collectorOnce sync.Once
+)
+
+// NewCollector returns the shared collector. A single instance keeps the
+// Postfix queue between runs and prevents overlapping runs.
+func NewCollector(db DB) *Collector {
+	collectorOnce.Do(func() {
+		collector = &Collector{
+			db:    db,
+			cfg:   config.Get(),
+			queue: map[string]queuedMail{},
+		}
+	})
+	return collector
+}
+
+// StartCollector collects bandwidth every 15 minutes
+func StartCollector(db DB) {
+	go func() {
+		ticker := time.NewTicker(collectInterval)
+		defer ticker.Stop()
+
+		for {
+			result, err := NewCollector(db).Collect()
+			if err != nil {
+				log.Printf("⚠️ Bandwidth collection failed: %v", err)
+			} else if result.Lines > 0 {
+				log.Printf("📊 Bandwidth collected: %d line(s) from %d file(s), %d bytes", result.Lines, result.Files, result.Bytes)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+type usageKey struct {
+	userID int64
+	day    string
+	source string
+}
+
+type logOffset struct {
+	path   string
+	inode  uint64
+	offset int64
+}
+
+// Collect reads what was appended to the logs since the last run, stores
+// it and applies the over-limit action to accounts past their limit
+func (c *Collector) Collect() (*Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	result := &Result{}
+	usage := map[usageKey]int64{}
+	var offsets []logOffset
+
+	add := func(userID int64, t time.Time, source string, bytes int64) {
+		if bytes <= 0 {
+			return
+		}
+		usage[usageKey{userID, t.Format("2006-01-02"), source}] += bytes
+		result.Bytes += bytes
+	}
+	read := func(path string, handle func(line string)) {
+		offset, lines, err := c.readLog(path, handle)
+		if err != nil {
+			log.Printf("Warning: failed to read %s: %v", path, err)
+		}
+		if offset != nil {
+			offsets = append(offsets, *offset)
+			result.Files++
+			result.Lines += lines
+		}
+	}
+
+	accounts := c.owners("SELECT username, id FROM users WHERE role = 'user'")
+	domains := c.owners("SELECT name, user_id FROM domains")
+	ftpLogins := c.owners("SELECT username, user_id FROM ftp_accounts")
+
+	// Web: the per-domain access logs in the web server's log directory
+	for _, driver := range []webserver.DriverType{webserver.DriverApache, webserver.DriverNginx} {
+		dir := webserver.AccessLogDir(driver, c.cfg.SimulateMode, c.cfg.SimulateBasePath)
+		files, _ := filepath.Glob(filepath.Join(dir, "*-access.log"))
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), "-access.log")
+			userID, ok := domains[strings.TrimSuffix(name, "-ssl")]
+			if !ok {
+				continue
+			}
+			read(file, func(line string) {
+				if e, ok := parseCLF(line); ok {
+					add(userID, e.time, SourceWeb, e.bytes)
+				}
+			})
+		}
+	}
+	// Vhosts written before access logs moved out of the home directory
+	// still log to <home>/logs until they are rebuilt
+	for username, userID := range accounts {
+		files, _ := filepath.Glob(filepath.Join(c.cfg.HomeBaseDir, username, "logs", "*access.log"))
+		for _, file := range files {
+			read(file, func(line string) {
+				if e, ok := parseCLF(line); ok {
+					add(userID, e.time, SourceWeb, e.bytes)
+				}
+			})
+		}
+	}
+
+	// FTP: pure-ftpd clf transfer log, by virtual login or system user
+	read(c.logPath(ftpTransferLog), func(line string) {
+		e, ok := parseCLF(line)
+		if !ok {
+			return
+		}
+		userID, ok := ftpLogins[e.user]
+		if !ok {
+			userID, ok = accounts[e.user]
+		}
+		if ok {
+			add(userID, e.time, SourceFTP, e.bytes)
+		}
+	})
+
+	// Mail: local deliveries count for the recipient, relayed mail for the sender
+	read(c.logPath(postfixLog), func(line string) {
+		e, ok := parsePostfix(line, now)
+		if !ok {
+			return
+		}
+		switch {
+		case e.removed:
+			delete(c.queue, e.queueID)
+		case e.size > 0 && e.to == "":
+			if len(c.queue) >= maxQueuedMails {
+				c.queue = map[string]queuedMail{}
+			}
+			c.queue[e.queueID] = queuedMail{from: e.from, size: e.size}
+		case e.to != "" && e.sent:
+			msg, ok := c.queue[e.queueID]
+			if !ok {
+				return
+			}
+			domain := mailDomain(msg.from)
+			if isLocalDelivery(e.relay) {
+				domain = mailDomain(e.to)
+			}
+			if userID, ok := domains[domain]; ok {
+				add(userID, e.time, SourceMail, msg.size)
+			}
+		}
+	})
+
+	if err := c.save(usage, offsets); err != nil {
+		return nil, err
+	}
+
+	exceeded, err := c.Enforce(now)
+	if err != nil {
+		return result, err
+	}
+	result.Exceeded = exceeded
+	return result, nil
+}
+
+// save stores the new usage together with the offsets it was read up to,
+// so a failed run is read again instead of being counted twice
+func (c *Collector) save(usage map[usageKey]int64, offsets []logOffset) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, bytes := range usage {
+		if _, err := tx.Exec(`
+			INSERT INTO bandwidth_usage (user_id, day, source, bytes) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id, day, source) DO UPDATE SET bytes = bytes + excluded.bytes
+		`, key.userID, key.day, key.source, bytes); err != nil {
+			return err
+		}
+	}
+	for _, o := range offsets {
+		if _, err := tx.Exec(`
+			INSERT INTO bandwidth_log_offsets (path, inode, offset, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(path) DO UPDATE SET inode = excluded.inode, offset = excluded.offset, updated_at = CURRENT_TIMESTAMP
+		`, o.path, strconv.FormatUint(o.inode, 10), o.offset); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// readLog passes the complete lines appended to path since the stored
+// offset to handle. When the file was rotated since the last run, the rest
+// of the old file is read first; logrotate keeps it as <path>.1 with
+// delaycompress. A file shorter than the offset was truncated and is read
+// from the start. Returns nil when the file does not exist.
+func (c *Collector) readLog(path string, handle func(line string)) (*logOffset, int, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, 0, nil
+	}
+	if !info.Mode().IsRegular() {
+		return nil, 0, errNotRegular
+	}
+	inode := fileInode(info)
+
+	var savedInode string
+	var offset int64
+	c.db.QueryRow("SELECT inode, offset FROM bandwidth_log_offsets WHERE path = ?", path).Scan(&savedInode, &offset)
+
+	lines := 0
+	if savedInode != "" && savedInode != strconv.FormatUint(inode, 10) {
+		if old, err := os.Lstat(path + ".1"); err == nil && old.Mode().IsRegular() && strconv.FormatUint(fileInode(old), 10) == savedInode {
+			_, n, err := readFrom(path+".1", offset, handle)
+			if err != nil {
+				return nil, 0, err
+			}
+			lines += n
+		}
+		offset = 0
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+
+	offset, n, err := readFrom(path, offset, handle)
+	if err != nil {
+		return nil, lines, err
+	}
+	return &logOffset{path: path, inode: inode, offset: offset}, lines + n, nil
+}
+
+// maxLogLine is the longest log line read; longer lines are skipped
+const maxLogLine = 64 * 1024
+
+var errNotRegular = errors.New("not a regular file")
+
+// openLog opens a log for reading. Legacy access logs live in a directory
+// the account owns, so anything but a regular file is refused (a symlink
+// to /dev/zero, a FIFO) and the open neither follows links nor blocks.
+func openLog(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, errNotRegular
+	}
+	return f, nil
+}
+
+// readFrom reads the complete lines of a file from offset on. A trailing
+// partial line is left for the next run. Returns the new offset.
+func readFrom(path string, offset int64, handle func(line string)) (int64, int, error) {
+	f, err := openLog(path)
+	if err != nil {
+		return offset, 0, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, 0, err
+	}
+
+	// Only newline terminated lines are tokens, so a partial line at the
+	// end stays unread. The offset advances with what was consumed.
+	skipping := false
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxLogLine)
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			offset += int64(i + 1)
+			if skipping {
+				skipping = false
+				return i + 1, nil, nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if len(data) >= maxLogLine {
+			skipping = true
+			offset += int64(len(data))
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	})
+
+	lines := 0
+	for sc.Scan() {
+		lines++
+		handle(strings.TrimRight(sc.Text(), "\r"))
+	}
+	return offset, lines, sc.Err()
+}
+
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
+
+// isLocalDelivery reports whether a Postfix relay delivered to a mailbox
+// on this server
+func isLocalDelivery(relay string) bool {
+	return strings.HasPrefix(relay, "virtual") || strings.HasPrefix(relay, "local") ||
+		strings.HasPrefix(relay, "dovecot") || strings.Contains(relay, "lmtp")
+}
+
+// logPath maps a system log to the simulate directory in simulate mode
+func (c *Collector) logPath(path string) string {
+	if c.cfg.SimulateMode {
+		return filepath.Join(c.cfg.SimulateBasePath, "log", strings.TrimPrefix(path, "/var/log/"))
+	}
+	return path
+}
+
+// owners maps a name column to the owning account ID
+func (c *Collector) owners(query string) map[string]int64 {
+	owners := map[string]int64{}
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return owners
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var userID int64
+		if rows.Scan(&name, &userID) == nil {
+			owners[strings.ToLower(name)] = userID
+		}
+	}
+	return owners
+}
+
+// Enforce compares each account's traffic this month with its package's
+// bandwidth_quota. Accounts going over get the bandwidth_action (warn,
+// throttle or suspend); accounts back under their limit, or in a new month,
+// have it lifted. Returns the accounts that went over now.
+func (c *Collector) Enforce(now time.Time) ([]Overage, error) {
+	month := now.Format("2006-01")
+	rows, err := c.db.Query(`
+		SELECT u.id, u.username, COALESCE(p.bandwidth_quota, 0),
+			COALESCE((SELECT SUM(b.bytes) FROM bandwidth_usage b WHERE b.user_id = u.id AND b.day >= ?), 0)
+		FROM users u
+		LEFT JOIN user_packages up ON up.user_id = u.id
+		LEFT JOIN packages p ON p.id = up.package_id
+		WHERE u.role = 'user'
+	`, month+"-01")
+	if err != nil {
+		return nil, err
+	}
+	var current []Overage
+	for rows.Next() {
+		var o Overage
+		var used int64
+		if rows.Scan(&o.UserID, &o.Username, &o.LimitMB, &used) != nil {
+			continue
+		}
+		o.UsedMB = used / (1024 * 1024)
+		o.Month = month
+		if o.LimitMB > 0 && used > o.LimitMB*1024*1024 {
+			current = append(current, o)
+		}
+	}
+	rows.Close()
+
+	recorded, err := c.ListOverages()
+	if err != nil {
+		return nil, err
+	}
+	over := map[int64]bool{}
+	for _, o := range current {
+		over[o.UserID] = true
+	}
+	known := map[int64]bool{}
+	for _, o := range recorded {
+		if o.Month != month || !over[o.UserID] {
+			c.lift(o)
+			continue
+		}
+		known[o.UserID] = true
+	}
+
+	action := c.action()
+	var exceeded []Overage
+	for _, o := range current {
+		if known[o.UserID] {
+			continue
+		}
+		o.Action = action
+		c.apply(o)
+		exceeded = append(exceeded, o)
+	}
+
+	if err := c.syncThrottles(); err != nil {
+		log.Printf("⚠️ Failed to update bandwidth throttles: %v", err)
+	}
+	return exceeded, nil
+}
+
+// apply records an overage and takes its action
+func (c *Collector) apply(o Overage) {
+	if _, err := c.db.Exec(`
+		INSERT INTO bandwidth_overages (user_id, month, action, used_mb, limit_mb) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET month = excluded.month, action = excluded.action,
+			used_mb = excluded.used_mb, limit_mb = excluded.limit_mb, created_at = CURRENT_TIMESTAMP
+	`, o.UserID, o.Month, o.Action, o.UsedMB, o.LimitMB); err != nil {
+		log.Printf("Warning: failed to record bandwidth overage of %s: %v", o.Username, err)
+		return
+	}
+
+	details := fmt.Sprintf("Bandwidth limit exceeded: %d of %d MB in %s (%s)", o.UsedMB, o.LimitMB, o.Month, o.Action)
+	c.db.Exec("INSERT INTO activity_logs (user_id, action, details, ip_address) VALUES (?, 'bandwidth_exceeded', ?, '')",
+		o.UserID, details)
+	log.Printf("⚠️ %s: %s", o.Username, details)
+
+	if o.Action == ActionSuspend {
+		err := account.NewService(c.db).SuspendAccount(o.UserID, SuspendReason, 0)
+		if err != nil && !errors.Is(err, account.ErrAlreadySuspended) {
+			log.Printf("⚠️ Failed to suspend %s over bandwidth: %v", o.Username, err)
+		}
+	}
+}
+
+// lift removes an overage, unsuspending the account if the bandwidth check
+// suspended it
+func (c *Collector) lift(o Overage) {
+	c.db.Exec("DELETE FROM bandwidth_overages WHERE user_id = ?", o.UserID)
+
+	if o.Action == ActionSuspend {
+		svc := account.NewService(c.db)
+		if susp, err := svc.GetSuspension(o.UserID); err == nil && susp.Reason == SuspendReason && susp.SuspendedBy == 0 {
+			if err := svc.UnsuspendAccount(o.UserID); err != nil {
+				log.Printf("⚠️ Failed to unsuspend %s after bandwidth reset: %v", o.Username, err)
+			}
+		}
+	}
+
+	c.db.Exec("INSERT INTO activity_logs (user_id, action, details, ip_address) VALUES (?, 'bandwidth_restored', ?, '')",
+		o.UserID, fmt.Sprintf("Bandwidth back under the limit, %s lifted", o.Action))
+	log.Printf("✅ %s is back under the bandwidth limit (%s lifted)", o.Username, o.Action)
+}
+
+// syncThrottles writes the rate limits of throttled accounts' sites and
+// reloads the web server when the set changed
+func (c *Collector) syncThrottles() error {
+	rate := c.setting("bandwidth_throttle_kbps", defaultThrottleKBps)
+	rows, err := c.db.Query(`
+		SELECT d.name FROM domains d
+		JOIN bandwidth_overages o ON o.user_id = d.user_id
+		WHERE o.action = ?
+		UNION
+		SELECT s.full_name FROM subdomains s
+		JOIN bandwidth_overages o ON o.user_id = s.user_id
+		WHERE o.action = ?
+	`, ActionThrottle, ActionThrottle)
+	if err != nil {
+		return err
+	}
+	limits := map[string]int{}
+	for rows.Next() {
+		var host string
+		if rows.Scan(&host) == nil {
+			limits[host] = rate
+			limits["www."+host] = rate
+		}
+	}
+	rows.Close()
+
+	driverType := webserver.DriverApache
+	if c.cfg.WebServer == "nginx" {
+		driverType = webserver.DriverNginx
+	}
+	driver := webserver.NewDriver(driverType, c.cfg.SimulateMode, c.cfg.SimulateBasePath)
+	changed, err := driver.SetThrottles(limits)
+	if err != nil || !changed {
+		return err
+	}
+	return driver.Reload()
+}
+
+// action returns the bandwidth_action server setting
+func (c *Collector) action() string {
+	var value string
+	c.db.QueryRow("SELECT value FROM server_settings WHERE key = 'bandwidth_action'").Scan(&value)
+	switch value {
+	case ActionThrottle, ActionSuspend:
+		return value
+	}
+	return ActionWarn
+}
+
+func (c *Collector) setting(key string, def int) int {
+	var value string
+	if c.db.QueryRow("SELECT value FROM server_settings WHERE key = ?", key).Scan(&value) == nil {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// ListOverages returns the accounts currently over their bandwidth limit
+func (c *Collector) ListOverages() ([]Overage, error) {
+	rows, err := c.db.Query(`
+		SELECT o.user_id, COALESCE(u.username, ''), o.month, o.action, o.used_mb, o.limit_mb, o.created_at
+		FROM bandwidth_overages o LEFT JOIN users u ON u.id = o.user_id
+		ORDER BY o.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overages := []Overage{}
+	for rows.Next() {
+		var o Overage
+		if rows.Scan(&o.UserID, &o.Username, &o.Month, &o.Action, &o.UsedMB, &o.LimitMB, &o.CreatedAt) == nil {
+			overages = append(overages, o)
+		}
+	}
+	return overages, nil
+}
+
+// GetReport returns an account's daily traffic in a month (YYYY-MM, empty
+// for the current month)
+func (c *Collector) GetReport(userID int64, month string) (*Report, error) {
+	if month == "" {
+		month = time.Now().Format("2006-01")
+	}
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return nil, ErrInvalidMonth
+	}
+
+	report := &Report{UserID: userID, Month: month, Days: []DailyUsage{}}
+	c.db.QueryRow(`
+		SELECT COALESCE(p.bandwidth_quota, 0) FROM user_packages up
+		JOIN packages p ON p.id = up.package_id WHERE up.user_id = ?
+	`, userID).Scan(&report.LimitMB)
+
+	rows, err := c.db.Query(`
+		SELECT day, source, bytes FROM bandwidth_usage
+		WHERE user_id = ? AND day LIKE ? ORDER BY day
+	`, userID, month+"-%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day, source string
+		var bytes int64
+		if rows.Scan(&day, &source, &bytes) != nil {
+			continue
+		}
+		if n := len(report.Days); n == 0 || report.Days[n-1].Day != day {
+			report.Days = append(report.Days, DailyUsage{Day: day})
+		}
+		d := &report.Days[len(report.Days)-1]
+		switch source {
+		case SourceWeb:
+			d.Web += bytes
+		case SourceFTP:
+			d.FTP += bytes
+		case SourceMail:
+			d.Mail += bytes
+		}
+		d.Total += bytes
+		report.Total += bytes
+	}
+
+	var o Overage
+	err = c.db.QueryRow(`
+		SELECT user_id, month, action, used_mb, limit_mb, created_at FROM bandwidth_overages
+		WHERE user_id = ? AND month = ?
+	`, userID, month).Scan(&o.UserID, &o.Month, &o.Action, &o.UsedMB, &o.LimitMB, &o.CreatedAt)
+	if err == nil {
+		report.Overage = &o
+	}
+	return report, nil
+}
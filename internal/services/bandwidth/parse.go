@@ -0,0 +1,145 @@
+package bandwidth
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clfEntry is one line of a Common/Combined Log Format file
+type clfEntry struct {
+	user  string
+	time  time.Time
+	bytes int64
+}
+
+// parseCLF reads the user, time and response size of a CLF line, as
+// written by Apache/Nginx access logs and the pure-ftpd clf: AltLog:
+//
+//	host ident user [02/Jan/2006:15:04:05 -0700] "GET / HTTP/1.1" 200 1234 ...
+func parseCLF(line string) (clfEntry, bool) {
+	lb := strings.IndexByte(line, '[')
+	rb := strings.IndexByte(line, ']')
+	if lb < 0 || rb < lb {
+		return clfEntry{}, false
+	}
+
+	prefix := strings.Fields(line[:lb])
+	if len(prefix) < 3 {
+		return clfEntry{}, false
+	}
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", line[lb+1:rb])
+	if err != nil {
+		return clfEntry{}, false
+	}
+
+	// Status and size follow the quoted request
+	rest := line[rb+1:]
+	if q := strings.IndexByte(rest, '"'); q >= 0 {
+		end := strings.IndexByte(rest[q+1:], '"')
+		if end < 0 {
+			return clfEntry{}, false
+		}
+		rest = rest[q+1+end+1:]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 2 {
+		return clfEntry{}, false
+	}
+	size, _ := strconv.ParseInt(fields[1], 10, 64) // "-" counts as 0
+
+	return clfEntry{user: prefix[2], time: t, bytes: size}, true
+}
+
+// postfixEntry is the part of a Postfix log line the collector needs
+type postfixEntry struct {
+	time    time.Time
+	queueID string
+	from    string
+	to      string
+	relay   string
+	size    int64
+	sent    bool
+	removed bool
+}
+
+// parsePostfix reads a Postfix delivery log line. qmgr lines give a
+// message's sender and size, delivery agent lines one recipient each:
+//
+//	Oct 17 07:00:00 host postfix/qmgr[1]: 3F2A1: from=<a@x.com>, size=1234, nrcpt=1 (queue active)
+//	Oct 17 07:00:01 host postfix/virtual[2]: 3F2A1: to=<b@y.com>, relay=virtual, ... status=sent (...)
+func parsePostfix(line string, now time.Time) (postfixEntry, bool) {
+	idx := strings.Index(line, " postfix")
+	if idx < 0 {
+		return postfixEntry{}, false
+	}
+	t, ok := parseSyslogTime(line[:idx], now)
+	if !ok {
+		return postfixEntry{}, false
+	}
+
+	// "<host> postfix/qmgr[1]: 3F2A1: from=<...>, ..."
+	parts := strings.SplitN(line[idx+1:], ": ", 3)
+	if len(parts) < 3 {
+		return postfixEntry{}, false
+	}
+	e := postfixEntry{time: t, queueID: parts[1]}
+	msg := parts[2]
+
+	if msg == "removed" {
+		e.removed = true
+		return e, true
+	}
+	for _, field := range strings.Split(msg, ", ") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "from":
+			e.from = strings.Trim(value, "<>")
+		case "to":
+			e.to = strings.Trim(value, "<>")
+		case "relay":
+			e.relay = value
+		case "size":
+			e.size, _ = strconv.ParseInt(value, 10, 64)
+		case "status":
+			e.sent = strings.HasPrefix(value, "sent")
+		}
+	}
+	return e, true
+}
+
+// parseSyslogTime reads the timestamp at the start of a syslog line, either
+// RFC 3339 (newer rsyslog) or the classic "Oct 17 07:00:00" without a year
+func parseSyslogTime(prefix string, now time.Time) (time.Time, bool) {
+	fields := strings.Fields(prefix)
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		return t.Local(), true
+	}
+	if len(fields) < 3 {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("Jan 2 15:04:05", strings.Join(fields[:3], " "), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// A December line read in January belongs to last year
+	year := now.Year()
+	if t.Month() > now.Month() {
+		year--
+	}
+	return t.AddDate(year, 0, 0), true
+}
+
+// mailDomain returns the domain part of an address
+func mailDomain(address string) string {
+	if at := strings.LastIndexByte(address, '@'); at >= 0 {
+		return strings.ToLower(address[at+1:])
+	}
+	return ""
+}
@@ -79,7 +79,7 @@ func (m *Manager) CreateZone(config ZoneConfig) error {
 	log.Printf("📝 DNS zone created: %s", zoneFile)
 
 	// Add zone to named.conf.local
-	if err := m.addZoneToConfig(config.Domain, zoneFile); err != nil {
+	if err := m.EnsureZoneEntry(config.Domain); err != nil {
 		return err
 	}
 
@@ -146,6 +146,29 @@ _dmarc  IN      TXT     "v=DMARC1; p=none; rua=mailto:postmaster@%s"
 	return zone
 }
 
+// ZoneFile returns the path of a domain's zone file
+func (m *Manager) ZoneFile(domain string) string {
+	return filepath.Join(m.GetZonePath(), "db."+domain)
+}
+
+// HasZoneEntry reports whether named.conf.local declares the domain's zone
+func (m *Manager) HasZoneEntry(domain string) bool {
+	content, err := os.ReadFile(filepath.Join(m.GetConfigPath(), "named.conf.local"))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(content), fmt.Sprintf("zone \"%s\"", domain))
+}
+
+// EnsureZoneEntry adds the domain's zone to named.conf.local unless it is
+// already declared there
+func (m *Manager) EnsureZoneEntry(domain string) error {
+	if m.HasZoneEntry(domain) {
+		return nil
+	}
+	return m.addZoneToConfig(domain, m.ZoneFile(domain))
+}
+
 func (m *Manager) addZoneToConfig(domain, zoneFile string) error {
 	zoneEntry := fmt.Sprintf(`
 zone "%s" {
@@ -172,6 +195,45 @@ zone "%s" {
 	return nil
 }
 
+// RemoveZoneEntry drops the domain's zone block from named.conf.local
+func (m *Manager) RemoveZoneEntry(domain string) error {
+	configPath := filepath.Join(m.GetConfigPath(), "named.conf.local")
+	content, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read named.conf.local: %w", err)
+	}
+
+	text := string(content)
+	start := strings.Index(text, fmt.Sprintf("zone \"%s\"", domain))
+	if start < 0 {
+		return nil
+	}
+	end := strings.Index(text[start:], "\n};")
+	if end < 0 {
+		return fmt.Errorf("unterminated zone entry for %s in named.conf.local", domain)
+	}
+	end += start + len("\n};")
+	if end < len(text) && text[end] == '\n' {
+		end++
+	}
+	// addZoneToConfig writes a blank line before each block
+	if before := strings.TrimRight(text[:start], "\n"); before != "" {
+		start = len(before) + 1
+	} else {
+		start = 0
+	}
+
+	if err := os.WriteFile(configPath, []byte(text[:start]+text[end:]), 0644); err != nil {
+		return fmt.Errorf("failed to write named.conf.local: %w", err)
+	}
+
+	log.Printf("🗑️ Zone removed from named.conf.local: %s", domain)
+	return nil
+}
+
 // DeleteZone removes a DNS zone
 func (m *Manager) DeleteZone(domain string) error {
 	zoneFile := filepath.Join(m.GetZonePath(), "db."+domain)
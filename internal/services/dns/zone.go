@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Record is a single resource record as stored in dns_records
+type Record struct {
+	Name     string
+	Type     string
+	Content  string
+	TTL      int
+	Priority int
+}
+
+// RenderZone builds the zone file for a domain from its records
+func RenderZone(domain string, records []Record) string {
+	serial := time.Now().Format("2006010215")
+
+	zone := fmt.Sprintf(`; Zone file for %s
+; Generated by ServerPanel
+; Last updated: %s
+$TTL 3600
+@       IN      SOA     ns1.serverpanel.local. hostmaster.%s. (
+                        %s      ; Serial
+                        3600            ; Refresh
+                        1800            ; Retry
+                        604800          ; Expire
+                        86400 )         ; Minimum TTL
+
+`, domain, time.Now().Format("2006-01-02 15:04:05"), domain, serial)
+
+	// Group records by type
+	recordsByType := make(map[string][]Record)
+	for _, r := range records {
+		recordsByType[r.Type] = append(recordsByType[r.Type], r)
+	}
+
+	// Write records in order: NS, A, AAAA, CNAME, MX, TXT, SRV, CAA
+	typeOrder := []string{"NS", "A", "AAAA", "CNAME", "MX", "TXT", "SRV", "CAA"}
+
+	for _, recordType := range typeOrder {
+		recs, ok := recordsByType[recordType]
+		if !ok || len(recs) == 0 {
+			continue
+		}
+
+		zone += fmt.Sprintf("; %s Records\n", recordType)
+		for _, r := range recs {
+			name := r.Name
+			if name == "" {
+				name = "@"
+			}
+
+			switch r.Type {
+			case "MX":
+				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%d\t%s\n", name, r.TTL, r.Type, r.Priority, r.Content)
+			case "SRV":
+				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%d\t%s\n", name, r.TTL, r.Type, r.Priority, r.Content)
+			case "TXT":
+				// Ensure TXT content is quoted
+				content := r.Content
+				if !strings.HasPrefix(content, "\"") {
+					content = "\"" + content + "\""
+				}
+				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%s\n", name, r.TTL, r.Type, content)
+			default:
+				zone += fmt.Sprintf("%-8s%d\tIN\t%s\t%s\n", name, r.TTL, r.Type, r.Content)
+			}
+		}
+		zone += "\n"
+	}
+
+	return zone
+}
+
+// ZoneBody returns the lines of a zone file that carry records, leaving out
+// comments and the serial so two renderings of the same records compare equal
+func ZoneBody(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasSuffix(line, "; Serial") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// WriteZone replaces a domain's zone file with one rendered from records
+// and reloads BIND
+func (m *Manager) WriteZone(domain string, records []Record) error {
+	if err := os.MkdirAll(m.GetZonePath(), 0755); err != nil {
+		return fmt.Errorf("failed to create zone directory: %w", err)
+	}
+
+	zoneFile := m.ZoneFile(domain)
+	if err := os.WriteFile(zoneFile, []byte(RenderZone(domain, records)), 0644); err != nil {
+		return fmt.Errorf("failed to write zone file: %w", err)
+	}
+
+	log.Printf("📝 DNS zone written: %s", zoneFile)
+	return m.Reload()
+}
@@ -0,0 +1,97 @@
+package feature
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Features a hosting package can include. The names shared with sub-user
+// permissions (files, email, ftp, dns, ssl, cron) are the same modules.
+const (
+	Files   = "files"
+	Email   = "email"
+	FTP     = "ftp"
+	DNS     = "dns"
+	SSL     = "ssl"
+	Cron    = "cron"
+	SSH     = "ssh"
+	Malware = "malware"
+)
+
+// All lists every feature in display order
+var All = []string{Files, Email, FTP, DNS, SSL, Cron, SSH, Malware}
+
+var ErrInvalidFeature = errors.New("invalid feature")
+
+// DB interface for database operations
+type DB interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Has reports whether features includes name
+func Has(features []string, name string) bool {
+	for _, f := range features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks feature names
+func Validate(features []string) error {
+	for _, f := range features {
+		if !Has(All, f) {
+			return fmt.Errorf("%w: %s", ErrInvalidFeature, f)
+		}
+	}
+	return nil
+}
+
+// Parse reads the comma separated features column of a package
+func Parse(value string) []string {
+	features := []string{}
+	for _, f := range strings.Split(value, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			features = append(features, f)
+		}
+	}
+	return features
+}
+
+// Join formats features for the packages table, in display order and
+// without duplicates
+func Join(features []string) string {
+	var ordered []string
+	for _, f := range All {
+		if Has(features, f) {
+			ordered = append(ordered, f)
+		}
+	}
+	return strings.Join(ordered, ",")
+}
+
+// ForUser returns the features a user may use. Hosting accounts get their
+// package's features; admins, resellers and accounts without a package are
+// not limited.
+func ForUser(db DB, userID int64) []string {
+	var role string
+	var features sql.NullString
+	err := db.QueryRow(`
+		SELECT u.role, p.features FROM users u
+		LEFT JOIN user_packages up ON up.user_id = u.id
+		LEFT JOIN packages p ON p.id = up.package_id
+		WHERE u.id = ?
+	`, userID).Scan(&role, &features)
+	if err != nil || role != "user" || !features.Valid {
+		return append([]string{}, All...)
+	}
+	return Parse(features.String)
+}
+
+// Enabled reports whether a user's package includes a feature
+func Enabled(db DB, userID int64, name string) bool {
+	return Has(ForUser(db, userID), name)
+}
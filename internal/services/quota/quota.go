@@ -0,0 +1,289 @@
+package quota
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Manager applies and reads Linux user disk and inode quotas (usrquota on
+// ext4, uquota on XFS) on the filesystem holding the home directories. In
+// simulate mode limits are kept in a JSON file and usage is counted from
+// the simulated home directories.
+type Manager struct {
+	simulateMode bool
+	basePath     string
+	homeBaseDir  string
+}
+
+// Usage is a user's quota as reported by the filesystem
+type Usage struct {
+	Username string `json:"username"`
+	UsedMB   int64  `json:"used_mb"`
+	LimitMB  int64  `json:"limit_mb"`  // 0 means unlimited
+	Files    int64  `json:"files"`     // inodes in use
+	MaxFiles int64  `json:"max_files"` // inode limit, 0 means unlimited
+}
+
+// Limits are the quotas applied to a user
+type Limits struct {
+	DiskMB int64 `json:"disk_mb"`
+	Inodes int64 `json:"inodes,omitempty"`
+}
+
+// DirInodes is the number of inodes under one directory
+type DirInodes struct {
+	Path   string `json:"path"`
+	Inodes int64  `json:"inodes"` // the directory itself and everything below it
+}
+
+var simulateMu sync.Mutex
+
+// NewManager creates a new quota manager
+func NewManager(simulateMode bool, basePath, homeBaseDir string) *Manager {
+	return &Manager{
+		simulateMode: simulateMode,
+		basePath:     basePath,
+		homeBaseDir:  homeBaseDir,
+	}
+}
+
+// SetQuota limits a user's disk usage to limitMB and the number of files
+// and directories to maxInodes; 0 removes a limit
+func (m *Manager) SetQuota(username string, limitMB, maxInodes int64) error {
+	if limitMB < 0 {
+		limitMB = 0
+	}
+	if maxInodes < 0 {
+		maxInodes = 0
+	}
+
+	if m.simulateMode {
+		simulateMu.Lock()
+		defer simulateMu.Unlock()
+		limits := m.loadSimulated()
+		if limitMB == 0 && maxInodes == 0 {
+			delete(limits, username)
+		} else {
+			limits[username] = Limits{DiskMB: limitMB, Inodes: maxInodes}
+		}
+		log.Printf("🔧 [SIMÜLASYON] setquota -u %s %d %d %d %d %s", username, limitMB*1024, limitMB*1024, maxInodes, maxInodes, m.homeBaseDir)
+		return m.saveSimulated(limits)
+	}
+
+	mount, err := m.mountPoint()
+	if err != nil {
+		return err
+	}
+	blocks := strconv.FormatInt(limitMB*1024, 10) // 1K blocks
+	inodes := strconv.FormatInt(maxInodes, 10)
+	cmd := exec.Command("setquota", "-u", username, blocks, blocks, inodes, inodes, mount)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("setquota failed: %s - %w", strings.TrimSpace(string(output)), err)
+	}
+
+	log.Printf("📏 Disk quota set: %s = %d MB, %d inodes", username, limitMB, maxInodes)
+	return nil
+}
+
+// RemoveQuota lifts a user's disk and inode limits
+func (m *Manager) RemoveQuota(username string) error {
+	return m.SetQuota(username, 0, 0)
+}
+
+// Report returns the usage of every user with quota records, read in one
+// pass from the quota files instead of walking the home directories
+func (m *Manager) Report() (map[string]Usage, error) {
+	if m.simulateMode {
+		return m.simulatedReport()
+	}
+
+	mount, err := m.mountPoint()
+	if err != nil {
+		return nil, err
+	}
+	output, err := exec.Command("repquota", "-u", "-O", "csv", mount).Output()
+	if err != nil {
+		return nil, fmt.Errorf("repquota failed: %w", err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(output)).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, fmt.Errorf("unexpected repquota output: %v", err)
+	}
+
+	column := map[string]int{}
+	for i, name := range records[0] {
+		column[strings.TrimSpace(name)] = i
+	}
+	field := func(record []string, name string) int64 {
+		i, ok := column[name]
+		if !ok || i >= len(record) {
+			return 0
+		}
+		n, _ := strconv.ParseInt(strings.TrimSpace(record[i]), 10, 64)
+		return n
+	}
+
+	report := map[string]Usage{}
+	for _, record := range records[1:] {
+		username := strings.TrimSpace(record[column["User"]])
+		if username == "" || strings.HasPrefix(username, "#") {
+			continue // uid without a passwd entry
+		}
+		report[username] = Usage{
+			Username: username,
+			UsedMB:   field(record, "BlockUsed") / 1024,
+			LimitMB:  field(record, "BlockHardLimit") / 1024,
+			Files:    field(record, "FileUsed"),
+			MaxFiles: field(record, "FileHardLimit"),
+		}
+	}
+	return report, nil
+}
+
+// GetUsage returns one user's quota usage
+func (m *Manager) GetUsage(username string) (*Usage, error) {
+	report, err := m.Report()
+	if err != nil {
+		return nil, err
+	}
+	usage, ok := report[username]
+	if !ok {
+		usage = Usage{Username: username}
+	}
+	return &usage, nil
+}
+
+// CountInodes counts the files and directories in a user's home by walking
+// it; used where quotas are not enabled on the filesystem
+func (m *Manager) CountInodes(username string) (int64, error) {
+	home := filepath.Join(m.homeBaseDir, username)
+	if _, err := os.Stat(home); err != nil {
+		return 0, err
+	}
+	return countInodes(home), nil
+}
+
+// InodeBreakdown returns the inode count of each directory directly under
+// dir, largest first, and the total of dir itself, so the directory holding
+// most of an account's files (typically a cache) can be found and drilled
+// into. Paths are relative to dir.
+func (m *Manager) InodeBreakdown(dir string) ([]DirInodes, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := int64(1)
+	dirs := []DirInodes{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			total++
+			continue
+		}
+		n := countInodes(filepath.Join(dir, entry.Name()))
+		dirs = append(dirs, DirInodes{Path: entry.Name(), Inodes: n})
+		total += n
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Inodes > dirs[j].Inodes })
+	return dirs, total, nil
+}
+
+// countInodes counts path and every entry below it without following links
+func countInodes(path string) int64 {
+	var n int64
+	filepath.WalkDir(path, func(_ string, _ fs.DirEntry, err error) error {
+		if err == nil {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// mountPoint returns the mount point of the filesystem holding the homes
+func (m *Manager) mountPoint() (string, error) {
+	output, err := exec.Command("df", "--output=target", m.homeBaseDir).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find mount point of %s: %w", m.homeBaseDir, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1]), nil
+}
+
+func (m *Manager) simulatedFile() string {
+	return filepath.Join(m.basePath, "quota", "quotas.json")
+}
+
+func (m *Manager) loadSimulated() map[string]Limits {
+	limits := map[string]Limits{}
+	data, err := os.ReadFile(m.simulatedFile())
+	if err != nil {
+		return limits
+	}
+	if json.Unmarshal(data, &limits) != nil {
+		// Files written before inode limits hold only the MB value
+		var diskOnly map[string]int64
+		json.Unmarshal(data, &diskOnly)
+		for username, mb := range diskOnly {
+			limits[username] = Limits{DiskMB: mb}
+		}
+	}
+	return limits
+}
+
+func (m *Manager) saveSimulated(limits map[string]Limits) error {
+	if err := os.MkdirAll(filepath.Dir(m.simulatedFile()), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(limits, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.simulatedFile(), data, 0644)
+}
+
+// simulatedReport counts the simulated home directories of users with a
+// recorded limit
+func (m *Manager) simulatedReport() (map[string]Usage, error) {
+	simulateMu.Lock()
+	limits := m.loadSimulated()
+	simulateMu.Unlock()
+
+	report := map[string]Usage{}
+	for username, limit := range limits {
+		var size, inodes int64
+		filepath.WalkDir(filepath.Join(m.homeBaseDir, username), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			inodes++
+			if d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+			return nil
+		})
+		report[username] = Usage{
+			Username: username,
+			UsedMB:   size / (1024 * 1024),
+			LimitMB:  limit.DiskMB,
+			Files:    inodes,
+			MaxFiles: limit.Inodes,
+		}
+	}
+	return report, nil
+}
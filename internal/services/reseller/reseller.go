@@ -0,0 +1,297 @@
+package reseller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoPool          = errors.New("no resource pool granted to this reseller")
+	ErrPoolExceeded    = errors.New("reseller resource pool exceeded")
+	ErrPackageNotOwned = errors.New("package not found")
+	ErrNotReseller     = errors.New("user is not a reseller")
+)
+
+// DB interface for database operations
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Manager enforces the resource pools admins grant to resellers
+type Manager struct {
+	db DB
+}
+
+// Pool is what an admin grants a reseller. Disk and domains are allocated
+// through the packages of the reseller's accounts, so the pool can never be
+// oversold. A limit of 0 means unlimited; packages without a disk or domain
+// limit are refused in a pool that has one.
+type Pool struct {
+	ResellerID  int64  `json:"reseller_id"`
+	Username    string `json:"username,omitempty"`
+	MaxAccounts int64  `json:"max_accounts"`
+	DiskQuota   int64  `json:"disk_quota"` // MB
+	MaxDomains  int64  `json:"max_domains"`
+	Usage       Usage  `json:"usage"`
+}
+
+// Usage is the part of a pool taken by the reseller's accounts
+type Usage struct {
+	Accounts  int64 `json:"accounts"`
+	DiskQuota int64 `json:"disk_quota"` // MB allocated by packages
+	Domains   int64 `json:"domains"`    // domains allocated by packages
+	// Accounts on packages without a disk or domain limit
+	UnlimitedDisk    int64 `json:"unlimited_disk,omitempty"`
+	UnlimitedDomains int64 `json:"unlimited_domains,omitempty"`
+}
+
+// add counts an account on a package with the given limits, or removes
+// it when n is -1
+func (u *Usage) add(n, diskQuota, maxDomains int64) {
+	u.DiskQuota += n * diskQuota
+	u.Domains += n * maxDomains
+	if diskQuota <= 0 {
+		u.UnlimitedDisk += n
+	}
+	if maxDomains <= 0 {
+		u.UnlimitedDomains += n
+	}
+}
+
+func NewManager(db DB) *Manager {
+	return &Manager{db: db}
+}
+
+// GetPool returns a reseller's pool and current usage
+func (m *Manager) GetPool(resellerID int64) (*Pool, error) {
+	p := Pool{ResellerID: resellerID}
+	err := m.db.QueryRow(`
+		SELECT u.username, r.max_accounts, r.disk_quota, r.max_domains
+		FROM reseller_pools r JOIN users u ON u.id = r.user_id
+		WHERE r.user_id = ?
+	`, resellerID).Scan(&p.Username, &p.MaxAccounts, &p.DiskQuota, &p.MaxDomains)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoPool
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := m.usage(resellerID, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	p.Usage = *usage
+	return &p, nil
+}
+
+// ListPools returns every reseller with their pool; resellers without a
+// pool are listed with zero limits
+func (m *Manager) ListPools() ([]Pool, error) {
+	rows, err := m.db.Query(`
+		SELECT u.id, u.username, COALESCE(r.max_accounts, 0), COALESCE(r.disk_quota, 0), COALESCE(r.max_domains, 0)
+		FROM users u LEFT JOIN reseller_pools r ON r.user_id = u.id
+		WHERE u.role = 'reseller'
+		ORDER BY u.username
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	pools := []Pool{}
+	for rows.Next() {
+		var p Pool
+		if err := rows.Scan(&p.ResellerID, &p.Username, &p.MaxAccounts, &p.DiskQuota, &p.MaxDomains); err != nil {
+			continue
+		}
+		pools = append(pools, p)
+	}
+	rows.Close()
+
+	for i := range pools {
+		if usage, err := m.usage(pools[i].ResellerID, 0, 0, 0); err == nil {
+			pools[i].Usage = *usage
+		}
+	}
+	return pools, nil
+}
+
+// SetPool grants or changes a reseller's pool
+func (m *Manager) SetPool(resellerID, maxAccounts, diskQuota, maxDomains int64) error {
+	var role string
+	if err := m.db.QueryRow("SELECT role FROM users WHERE id = ?", resellerID).Scan(&role); err != nil || role != "reseller" {
+		return ErrNotReseller
+	}
+	if maxAccounts < 0 || diskQuota < 0 || maxDomains < 0 {
+		return fmt.Errorf("%w: limits cannot be negative", ErrPoolExceeded)
+	}
+
+	_, err := m.db.Exec(`
+		INSERT INTO reseller_pools (user_id, max_accounts, disk_quota, max_domains)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET max_accounts = excluded.max_accounts,
+			disk_quota = excluded.disk_quota, max_domains = excluded.max_domains,
+			updated_at = CURRENT_TIMESTAMP
+	`, resellerID, maxAccounts, diskQuota, maxDomains)
+	return err
+}
+
+// OwnsAccount reports whether userID is one of the reseller's accounts
+func (m *Manager) OwnsAccount(resellerID, userID int64) bool {
+	var count int
+	m.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ? AND parent_id = ?", userID, resellerID).Scan(&count)
+	return count > 0
+}
+
+// OwnsPackage reports whether packageID was defined by the reseller
+func (m *Manager) OwnsPackage(resellerID, packageID int64) bool {
+	var count int
+	m.db.QueryRow("SELECT COUNT(*) FROM packages WHERE id = ? AND owner_id = ?", packageID, resellerID).Scan(&count)
+	return count > 0
+}
+
+// CheckPackage verifies that a single package fits into the pool
+func (m *Manager) CheckPackage(resellerID, diskQuota, maxDomains int64) error {
+	pool, err := m.GetPool(resellerID)
+	if err != nil {
+		return err
+	}
+	if pool.DiskQuota > 0 && diskQuota <= 0 {
+		return fmt.Errorf("%w: package needs a disk quota, the pool is limited to %d MB", ErrPoolExceeded, pool.DiskQuota)
+	}
+	if pool.MaxDomains > 0 && maxDomains <= 0 {
+		return fmt.Errorf("%w: package needs a domain limit, the pool is limited to %d", ErrPoolExceeded, pool.MaxDomains)
+	}
+	if pool.DiskQuota > 0 && diskQuota > pool.DiskQuota {
+		return fmt.Errorf("%w: package disk quota %d MB is larger than the pool (%d MB)", ErrPoolExceeded, diskQuota, pool.DiskQuota)
+	}
+	if pool.MaxDomains > 0 && maxDomains > pool.MaxDomains {
+		return fmt.Errorf("%w: package allows %d domains, the pool %d", ErrPoolExceeded, maxDomains, pool.MaxDomains)
+	}
+	return nil
+}
+
+// CheckPackageUpdate verifies that the reseller's accounts still fit into
+// the pool when a package gets new disk and domain limits
+func (m *Manager) CheckPackageUpdate(resellerID, packageID, diskQuota, maxDomains int64) error {
+	if err := m.CheckPackage(resellerID, diskQuota, maxDomains); err != nil {
+		return err
+	}
+	pool, err := m.GetPool(resellerID)
+	if err != nil {
+		return err
+	}
+	usage, err := m.usage(resellerID, packageID, diskQuota, maxDomains)
+	if err != nil {
+		return err
+	}
+	return pool.check(usage)
+}
+
+// CheckNewAccount verifies that one more account on packageID fits into the
+// reseller's pool
+func (m *Manager) CheckNewAccount(resellerID, packageID int64) error {
+	return m.CheckNewAccounts(resellerID, []int64{packageID})
+}
+
+// CheckNewAccounts verifies that a batch of new accounts, one per entry of
+// packageIDs, fits into the reseller's pool together
+func (m *Manager) CheckNewAccounts(resellerID int64, packageIDs []int64) error {
+	pool, err := m.GetPool(resellerID)
+	if err != nil {
+		return err
+	}
+
+	usage := pool.Usage
+	for _, packageID := range packageIDs {
+		diskQuota, maxDomains, err := m.packageLimits(resellerID, packageID)
+		if err != nil {
+			return err
+		}
+		usage.Accounts++
+		usage.add(1, diskQuota, maxDomains)
+	}
+	return pool.check(&usage)
+}
+
+// CheckPackageChange verifies that the pool still fits when one of the
+// reseller's accounts moves to packageID
+func (m *Manager) CheckPackageChange(resellerID, userID, packageID int64) error {
+	pool, err := m.GetPool(resellerID)
+	if err != nil {
+		return err
+	}
+
+	diskQuota, maxDomains, err := m.packageLimits(resellerID, packageID)
+	if err != nil {
+		return err
+	}
+	usage := pool.Usage
+	var oldDisk, oldDomains int64
+	if m.db.QueryRow(`
+		SELECT COALESCE(p.disk_quota, 0), COALESCE(p.max_domains, 0)
+		FROM user_packages up JOIN packages p ON p.id = up.package_id
+		WHERE up.user_id = ?
+	`, userID).Scan(&oldDisk, &oldDomains) == nil {
+		usage.add(-1, oldDisk, oldDomains)
+	}
+	usage.add(1, diskQuota, maxDomains)
+	return pool.check(&usage)
+}
+
+// packageLimits returns the disk and domain limits of one of the reseller's
+// packages
+func (m *Manager) packageLimits(resellerID, packageID int64) (int64, int64, error) {
+	var diskQuota, maxDomains int64
+	err := m.db.QueryRow("SELECT disk_quota, max_domains FROM packages WHERE id = ? AND owner_id = ?",
+		packageID, resellerID).Scan(&diskQuota, &maxDomains)
+	if err != nil {
+		return 0, 0, ErrPackageNotOwned
+	}
+	return diskQuota, maxDomains, nil
+}
+
+func (p *Pool) check(usage *Usage) error {
+	if p.MaxAccounts > 0 && usage.Accounts > p.MaxAccounts {
+		return fmt.Errorf("%w: account limit is %d", ErrPoolExceeded, p.MaxAccounts)
+	}
+	if p.DiskQuota > 0 && usage.UnlimitedDisk > 0 {
+		return fmt.Errorf("%w: %d accounts would have no disk quota in a pool limited to %d MB", ErrPoolExceeded, usage.UnlimitedDisk, p.DiskQuota)
+	}
+	if p.MaxDomains > 0 && usage.UnlimitedDomains > 0 {
+		return fmt.Errorf("%w: %d accounts would have no domain limit in a pool limited to %d", ErrPoolExceeded, usage.UnlimitedDomains, p.MaxDomains)
+	}
+	if p.DiskQuota > 0 && usage.DiskQuota > p.DiskQuota {
+		return fmt.Errorf("%w: %d of %d MB disk would be allocated", ErrPoolExceeded, usage.DiskQuota, p.DiskQuota)
+	}
+	if p.MaxDomains > 0 && usage.Domains > p.MaxDomains {
+		return fmt.Errorf("%w: %d of %d domains would be allocated", ErrPoolExceeded, usage.Domains, p.MaxDomains)
+	}
+	return nil
+}
+
+// usage sums the reseller's accounts and the limits of their packages. When
+// packageID is set, that package is counted with the given limits instead
+// of its stored ones.
+func (m *Manager) usage(resellerID, packageID, diskQuota, maxDomains int64) (*Usage, error) {
+	var u Usage
+	err := m.db.QueryRow(`
+		SELECT COUNT(u.id),
+			COALESCE(SUM(CASE WHEN p.id = ? THEN ? ELSE COALESCE(p.disk_quota, 0) END), 0),
+			COALESCE(SUM(CASE WHEN p.id = ? THEN ? ELSE COALESCE(p.max_domains, 0) END), 0),
+			COUNT(CASE WHEN p.id = ? THEN NULLIF(? <= 0, 0) ELSE NULLIF(p.disk_quota <= 0, 0) END),
+			COUNT(CASE WHEN p.id = ? THEN NULLIF(? <= 0, 0) ELSE NULLIF(p.max_domains <= 0, 0) END)
+		FROM users u
+		LEFT JOIN user_packages up ON up.user_id = u.id
+		LEFT JOIN packages p ON p.id = up.package_id
+		WHERE u.parent_id = ? AND u.role = 'user'
+	`, packageID, diskQuota, packageID, maxDomains, packageID, diskQuota, packageID, maxDomains, resellerID).Scan(
+		&u.Accounts, &u.DiskQuota, &u.Domains, &u.UnlimitedDisk, &u.UnlimitedDomains)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
@@ -0,0 +1,189 @@
+package sso
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// LDAPConfig configures login against an LDAP directory (OpenLDAP, Active
+// Directory, glauth). The user is searched with the service account, then
+// bound with their own password.
+type LDAPConfig struct {
+	Enabled            bool          `json:"enabled"`
+	URL                string        `json:"url"` // ldap://host:389 or ldaps://host:636
+	StartTLS           bool          `json:"start_tls"`
+	InsecureSkipVerify bool          `json:"insecure_skip_verify"`
+	BindDN             string        `json:"bind_dn"`
+	BindPassword       string        `json:"bind_password,omitempty"` // encrypted when stored
+	BaseDN             string        `json:"base_dn"`
+	UserFilter         string        `json:"user_filter"` // %s is the username, e.g. (uid=%s)
+	UsernameAttribute  string        `json:"username_attribute"`
+	EmailAttribute     string        `json:"email_attribute"`
+	GroupAttribute     string        `json:"group_attribute"` // memberOf
+	RoleMappings       []RoleMapping `json:"role_mappings"`
+	AutoProvision      bool          `json:"auto_provision"`
+}
+
+// LoadLDAPConfig reads the LDAP settings with defaults filled in. The bind
+// password stays encrypted.
+func LoadLDAPConfig(db DB) (*LDAPConfig, error) {
+	cfg := &LDAPConfig{}
+	if err := loadSettings(db, ldapSettingsKey, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.RoleMappings == nil {
+		cfg.RoleMappings = []RoleMapping{}
+	}
+	return cfg, nil
+}
+
+// SaveLDAPConfig validates and stores the LDAP settings. An empty bind
+// password keeps the current one.
+func SaveLDAPConfig(db DB, cfg *LDAPConfig) error {
+	if cfg.Enabled && (cfg.URL == "" || cfg.BaseDN == "") {
+		return fmt.Errorf("%w: url and base_dn are required", ErrMisconfiguration)
+	}
+	if cfg.UserFilter != "" && strings.Count(cfg.UserFilter, "%s") != 1 {
+		return fmt.Errorf("%w: user_filter must contain %%s once", ErrMisconfiguration)
+	}
+	if err := validateMappings(cfg.RoleMappings); err != nil {
+		return err
+	}
+
+	current, err := LoadLDAPConfig(db)
+	if err != nil {
+		return err
+	}
+	if cfg.BindPassword, err = encryptSecret(cfg.BindPassword, current.BindPassword); err != nil {
+		return err
+	}
+	return saveSettings(db, ldapSettingsKey, cfg)
+}
+
+// LDAPBackend authenticates users with an LDAP bind
+type LDAPBackend struct {
+	cfg *LDAPConfig
+}
+
+// NewLDAPBackend returns the LDAP backend, or ErrDisabled
+func NewLDAPBackend(db DB) (*LDAPBackend, error) {
+	cfg, err := LoadLDAPConfig(db)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, ErrDisabled
+	}
+	if cfg.BindPassword, err = decryptSecret(cfg.BindPassword); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMisconfiguration, err)
+	}
+	return &LDAPBackend{cfg: cfg}, nil
+}
+
+func (b *LDAPBackend) Source() string {
+	return SourceLDAP
+}
+
+// Authenticate finds the user's entry and binds as it with password
+func (b *LDAPBackend) Authenticate(username, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return nil, ErrInvalidLogin
+	}
+
+	conn, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if b.cfg.BindDN != "" {
+		if err := conn.Bind(b.cfg.BindDN, b.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service bind failed: %v", ErrMisconfiguration, err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		b.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(b.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{b.cfg.UsernameAttribute, b.cfg.EmailAttribute, b.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrInvalidLogin
+		}
+		return nil, fmt.Errorf("%w: search failed: %v", ErrMisconfiguration, err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidLogin
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, ErrInvalidLogin
+	}
+
+	name := entry.GetAttributeValue(b.cfg.UsernameAttribute)
+	if name == "" {
+		name = username
+	}
+	return &Identity{
+		Source:     SourceLDAP,
+		ExternalID: entry.DN,
+		Username:   name,
+		Email:      entry.GetAttributeValue(b.cfg.EmailAttribute),
+		Groups:     entry.GetAttributeValues(b.cfg.GroupAttribute),
+	}, nil
+}
+
+// Role maps the identity's groups to a panel role
+func (b *LDAPBackend) Role(ident *Identity) (string, error) {
+	return MapRole(b.cfg.RoleMappings, ident.Groups)
+}
+
+// AutoProvision reports whether unknown users are created on first login
+func (b *LDAPBackend) AutoProvision() bool {
+	return b.cfg.AutoProvision
+}
+
+func (b *LDAPBackend) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: b.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(b.cfg.URL,
+		ldap.DialWithTLSConfig(tlsConfig),
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMisconfiguration, err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if b.cfg.StartTLS {
+		if host, _, err := net.SplitHostPort(strings.TrimPrefix(b.cfg.URL, "ldap://")); err == nil {
+			tlsConfig.ServerName = host
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: StartTLS: %v", ErrMisconfiguration, err)
+		}
+	}
+	return conn, nil
+}
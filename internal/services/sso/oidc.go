@@ -0,0 +1,449 @@
+package sso
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCStateTTL is how long a login may stay at the identity provider
+const OIDCStateTTL = 10 * time.Minute
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// OIDCConfig configures OpenID Connect login with the authorization code
+// flow (Keycloak, Authentik, Azure AD, Google Workspace...)
+type OIDCConfig struct {
+	Enabled       bool          `json:"enabled"`
+	Issuer        string        `json:"issuer"`
+	ClientID      string        `json:"client_id"`
+	ClientSecret  string        `json:"client_secret,omitempty"` // encrypted when stored
+	RedirectURL   string        `json:"redirect_url"`            // https://panel:8443/api/v1/auth/oidc/callback
+	Scopes        []string      `json:"scopes"`
+	UsernameClaim string        `json:"username_claim"`
+	GroupsClaim   string        `json:"groups_claim"`
+	RoleMappings  []RoleMapping `json:"role_mappings"`
+	AutoProvision bool          `json:"auto_provision"`
+}
+
+// LoadOIDCConfig reads the OIDC settings with defaults filled in. The client
+// secret stays encrypted.
+func LoadOIDCConfig(db DB) (*OIDCConfig, error) {
+	cfg := &OIDCConfig{}
+	if err := loadSettings(db, oidcSettingsKey, cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email", "groups"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.RoleMappings == nil {
+		cfg.RoleMappings = []RoleMapping{}
+	}
+	return cfg, nil
+}
+
+// SaveOIDCConfig validates and stores the OIDC settings. An empty client
+// secret keeps the current one.
+func SaveOIDCConfig(db DB, cfg *OIDCConfig) error {
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	if cfg.Enabled && (cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "") {
+		return fmt.Errorf("%w: issuer, client_id and redirect_url are required", ErrMisconfiguration)
+	}
+	if err := validateMappings(cfg.RoleMappings); err != nil {
+		return err
+	}
+
+	current, err := LoadOIDCConfig(db)
+	if err != nil {
+		return err
+	}
+	if cfg.ClientSecret, err = encryptSecret(cfg.ClientSecret, current.ClientSecret); err != nil {
+		return err
+	}
+	return saveSettings(db, oidcSettingsKey, cfg)
+}
+
+// OIDCProvider runs the authorization code flow against the configured
+// identity provider
+type OIDCProvider struct {
+	db  DB
+	cfg *OIDCConfig
+}
+
+// providerMetadata is the part of the discovery document we use
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discovery documents and signing keys are cached per issuer; keys are
+// fetched again when a token names an unknown kid
+var oidcCache = struct {
+	sync.Mutex
+	metadata map[string]*providerMetadata
+	keys     map[string]map[string]interface{}
+}{
+	metadata: map[string]*providerMetadata{},
+	keys:     map[string]map[string]interface{}{},
+}
+
+// NewOIDCProvider returns the OIDC provider, or ErrDisabled
+func NewOIDCProvider(db DB) (*OIDCProvider, error) {
+	cfg, err := LoadOIDCConfig(db)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, ErrDisabled
+	}
+	if cfg.ClientSecret, err = decryptSecret(cfg.ClientSecret); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMisconfiguration, err)
+	}
+	return &OIDCProvider{db: db, cfg: cfg}, nil
+}
+
+// AuthURL starts a login: it stores a single-use state with a nonce and a
+// PKCE verifier and returns the identity provider URL to redirect to. The
+// state must also be kept in the browser and passed back to Exchange.
+func (p *OIDCProvider) AuthURL() (authURL, state string, err error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, verifier := randomToken(), randomToken()
+	state = randomToken()
+	p.db.Exec("DELETE FROM oidc_states WHERE created_at < datetime('now', ?)", fmt.Sprintf("-%d seconds", int(OIDCStateTTL.Seconds())))
+	if _, err := p.db.Exec("INSERT INTO oidc_states (state, nonce, verifier) VALUES (?, ?, ?)", state, nonce, verifier); err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+// Exchange completes a login: it consumes the state, redeems the code and
+// verifies the ID token. browserState is the state kept by the browser that
+// started the login; without it an attacker could finish their own login
+// in a victim's browser.
+func (p *OIDCProvider) Exchange(state, browserState, code string) (*Identity, error) {
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return nil, fmt.Errorf("%w: state was not started by this browser", ErrInvalidLogin)
+	}
+	var nonce, verifier string
+	err := p.db.QueryRow(`
+		SELECT nonce, verifier FROM oidc_states WHERE state = ? AND created_at > datetime('now', ?)
+	`, state, fmt.Sprintf("-%d seconds", int(OIDCStateTTL.Seconds()))).Scan(&nonce, &verifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown or expired state", ErrInvalidLogin)
+	}
+	result, err := p.db.Exec("DELETE FROM oidc_states WHERE state = ?", state)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("%w: state already used", ErrInvalidLogin)
+	}
+
+	meta, err := p.metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.PostForm(meta.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: token endpoint: %v", ErrMisconfiguration, err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens)
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: code exchange failed: %s %s", ErrInvalidLogin, resp.Status, tokens.Error)
+	}
+
+	claims, err := p.verifyIDToken(meta, tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ident := &Identity{
+		Source:     SourceOIDC,
+		ExternalID: meta.Issuer + "|" + stringClaim(claims, "sub"),
+		Username:   stringClaim(claims, p.cfg.UsernameClaim),
+		Email:      stringClaim(claims, "email"),
+		Groups:     stringsClaim(claims, p.cfg.GroupsClaim),
+	}
+	if ident.Username == "" {
+		ident.Username = ident.Email
+	}
+	return ident, nil
+}
+
+// Role maps the identity's groups to a panel role
+func (p *OIDCProvider) Role(ident *Identity) (string, error) {
+	return MapRole(p.cfg.RoleMappings, ident.Groups)
+}
+
+// AutoProvision reports whether unknown users are created on first login
+func (p *OIDCProvider) AutoProvision() bool {
+	return p.cfg.AutoProvision
+}
+
+func (p *OIDCProvider) verifyIDToken(meta *providerMetadata, idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.signingKey(meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id_token: %v", ErrInvalidLogin, err)
+	}
+	if stringClaim(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("%w: id_token nonce mismatch", ErrInvalidLogin)
+	}
+	if stringClaim(claims, "sub") == "" {
+		return nil, fmt.Errorf("%w: id_token has no subject", ErrInvalidLogin)
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) metadata() (*providerMetadata, error) {
+	oidcCache.Lock()
+	meta := oidcCache.metadata[p.cfg.Issuer]
+	oidcCache.Unlock()
+	if meta != nil {
+		return meta, nil
+	}
+
+	meta = &providerMetadata{}
+	if err := getJSON(p.cfg.Issuer+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, fmt.Errorf("%w: discovery: %v", ErrMisconfiguration, err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer || meta.AuthorizationEndpoint == "" ||
+		meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document does not match issuer %s", ErrMisconfiguration, p.cfg.Issuer)
+	}
+
+	oidcCache.Lock()
+	oidcCache.metadata[p.cfg.Issuer] = meta
+	oidcCache.Unlock()
+	return meta, nil
+}
+
+func (p *OIDCProvider) signingKey(meta *providerMetadata, kid string) (interface{}, error) {
+	oidcCache.Lock()
+	key, ok := oidcCache.keys[p.cfg.Issuer][kid]
+	oidcCache.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %v", err)
+	}
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+
+	oidcCache.Lock()
+	oidcCache.keys[p.cfg.Issuer] = keys
+	oidcCache.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jsonWebKey is an RSA or EC public key from a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		return new(big.Int).SetBytes(b), err
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func getJSON(u string, v interface{}) error {
+	resp, err := httpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// stringsClaim reads a claim that may be a list or a single string
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// handoffTTL is how long the panel frontend has to redeem a handoff code
+const handoffTTL = time.Minute
+
+// CreateHandoff returns a single-use code for a user who completed an OIDC
+// login. The callback redirects the browser to the panel with this code,
+// so tokens never appear in URLs.
+func CreateHandoff(db DB, userID int64) (string, error) {
+	code := randomToken()
+	sum := sha256.Sum256([]byte(code))
+	db.Exec("DELETE FROM sso_handoffs WHERE created_at < datetime('now', ?)", fmt.Sprintf("-%d seconds", int(handoffTTL.Seconds())))
+	_, err := db.Exec("INSERT INTO sso_handoffs (code_hash, user_id) VALUES (?, ?)", hex.EncodeToString(sum[:]), userID)
+	return code, err
+}
+
+// RedeemHandoff consumes a handoff code and returns its user
+func RedeemHandoff(db DB, code string) (int64, error) {
+	sum := sha256.Sum256([]byte(code))
+	hash := hex.EncodeToString(sum[:])
+
+	var userID int64
+	err := db.QueryRow("SELECT user_id FROM sso_handoffs WHERE code_hash = ? AND created_at > datetime('now', ?)",
+		hash, fmt.Sprintf("-%d seconds", int(handoffTTL.Seconds()))).Scan(&userID)
+	if err != nil {
+		return 0, ErrInvalidLogin
+	}
+	result, err := db.Exec("DELETE FROM sso_handoffs WHERE code_hash = ?", hash)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, ErrInvalidLogin
+	}
+	return userID, nil
+}
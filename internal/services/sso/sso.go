@@ -0,0 +1,254 @@
+package sso
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/asergenalkan/serverpanel/internal/auth"
+	"github.com/asergenalkan/serverpanel/internal/models"
+)
+
+// Authentication sources stored in users.auth_source
+const (
+	SourceLocal = "local"
+	SourceLDAP  = "ldap"
+	SourceOIDC  = "oidc"
+)
+
+// server_settings keys holding the JSON configuration of each backend
+const (
+	ldapSettingsKey = "sso_ldap"
+	oidcSettingsKey = "sso_oidc"
+)
+
+var (
+	ErrDisabled         = errors.New("single sign-on backend is not enabled")
+	ErrInvalidLogin     = errors.New("invalid credentials")
+	ErrNoRole           = errors.New("identity is not in a group mapped to a panel role")
+	ErrNotProvisioned   = errors.New("no panel user for this identity and auto-provisioning is off")
+	ErrUsernameTaken    = errors.New("username belongs to another panel user")
+	ErrInvalidUsername  = errors.New("identity has no usable username")
+	ErrInvalidMapping   = errors.New("role mappings may only assign admin or reseller")
+	ErrMisconfiguration = errors.New("single sign-on backend is misconfigured")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9._-]{0,63}$`)
+
+// DB interface for database operations
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Identity is a user as asserted by an external identity provider
+type Identity struct {
+	Source     string
+	ExternalID string // LDAP DN or OIDC issuer|subject
+	Username   string
+	Email      string
+	Groups     []string
+}
+
+// PasswordBackend checks a username and password against an external
+// directory. Login uses it for users the local bcrypt check does not cover.
+type PasswordBackend interface {
+	Source() string
+	Authenticate(username, password string) (*Identity, error)
+	Role(ident *Identity) (string, error)
+	AutoProvision() bool
+}
+
+// PasswordBackends returns the enabled password backends
+func PasswordBackends(db DB) []PasswordBackend {
+	backends := []PasswordBackend{}
+	if b, err := NewLDAPBackend(db); err == nil {
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// RoleMapping assigns a panel role to members of a group. Groups compare
+// case-insensitively; an LDAP group is its DN or its CN.
+type RoleMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// MapRole returns the most privileged role mapped to any of groups
+func MapRole(mappings []RoleMapping, groups []string) (string, error) {
+	role := ""
+	for _, m := range mappings {
+		for _, g := range groups {
+			if !groupMatches(m.Group, g) {
+				continue
+			}
+			if m.Role == models.RoleAdmin {
+				return models.RoleAdmin, nil
+			}
+			role = m.Role
+		}
+	}
+	if role == "" {
+		return "", ErrNoRole
+	}
+	return role, nil
+}
+
+func groupMatches(want, group string) bool {
+	if strings.EqualFold(want, group) {
+		return true
+	}
+	// cn=panel-admins,ou=groups,dc=example,dc=com matches "panel-admins"
+	if first, _, ok := strings.Cut(group, ","); ok {
+		if k, v, ok := strings.Cut(first, "="); ok && strings.EqualFold(strings.TrimSpace(k), "cn") {
+			return strings.EqualFold(strings.TrimSpace(v), want)
+		}
+	}
+	return false
+}
+
+func validateMappings(mappings []RoleMapping) error {
+	for _, m := range mappings {
+		if strings.TrimSpace(m.Group) == "" || (m.Role != models.RoleAdmin && m.Role != models.RoleReseller) {
+			return ErrInvalidMapping
+		}
+	}
+	return nil
+}
+
+// normalizeUsername turns an IdP username into a panel username: lower
+// case, and the local part when the IdP hands out e-mail addresses
+func normalizeUsername(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	if !usernamePattern.MatchString(name) {
+		return "", ErrInvalidUsername
+	}
+	return name, nil
+}
+
+// Provision returns the panel user for an identity. The user is matched by
+// source and external ID, then by username among users of the same source
+// that are not yet linked to an external ID.
+// Known users get their role and e-mail synced from the IdP; unknown users
+// are created when autoProvision is set. Local users are never taken over.
+func Provision(db DB, ident *Identity, role string, autoProvision bool) (int64, bool, error) {
+	username, err := normalizeUsername(ident.Username)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var id int64
+	var source string
+	err = db.QueryRow("SELECT id, COALESCE(auth_source, 'local') FROM users WHERE auth_source = ? AND external_id = ?",
+		ident.Source, ident.ExternalID).Scan(&id, &source)
+	if err == sql.ErrNoRows {
+		var externalID string
+		err = db.QueryRow("SELECT id, COALESCE(auth_source, 'local'), COALESCE(external_id, '') FROM users WHERE username = ?",
+			username).Scan(&id, &source, &externalID)
+		if err == nil && (source != ident.Source || externalID != "") {
+			return 0, false, ErrUsernameTaken
+		}
+	}
+
+	if err == nil {
+		email := ident.Email
+		if email == "" {
+			db.QueryRow("SELECT email FROM users WHERE id = ?", id).Scan(&email)
+		}
+		_, err = db.Exec(`
+			UPDATE users SET role = ?, email = ?, external_id = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, role, email, ident.ExternalID, id)
+		return id, false, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	if !autoProvision {
+		return 0, false, ErrNotProvisioned
+	}
+
+	// The local password is random and never used: Login sends these users
+	// to their backend
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return 0, false, err
+	}
+	hash, err := auth.HashPassword(hex.EncodeToString(b))
+	if err != nil {
+		return 0, false, err
+	}
+
+	email := ident.Email
+	if email == "" {
+		email = fmt.Sprintf("%s@%s.invalid", username, ident.Source)
+	}
+	result, err := db.Exec(`
+		INSERT INTO users (username, email, password, role, active, auth_source, external_id)
+		VALUES (?, ?, ?, ?, 1, ?, ?)
+	`, username, email, hash, role, ident.Source, ident.ExternalID)
+	if err != nil {
+		return 0, false, ErrUsernameTaken
+	}
+	id, _ = result.LastInsertId()
+	return id, true, nil
+}
+
+// UserSource returns how a user authenticates
+func UserSource(db DB, userID int64) string {
+	source := SourceLocal
+	db.QueryRow("SELECT COALESCE(auth_source, 'local') FROM users WHERE id = ?", userID).Scan(&source)
+	return source
+}
+
+func loadSettings(db DB, key string, v interface{}) error {
+	var value string
+	err := db.QueryRow("SELECT value FROM server_settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows || value == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(value), v)
+}
+
+func saveSettings(db DB, key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO server_settings (key, value, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, key, string(value))
+	return err
+}
+
+// encryptSecret keeps secrets encrypted in the settings JSON. An empty new
+// value keeps the stored one so settings can be saved without re-entering
+// passwords.
+func encryptSecret(value, stored string) (string, error) {
+	if value == "" {
+		return stored, nil
+	}
+	return auth.EncryptSecret(value)
+}
+
+func decryptSecret(stored string) (string, error) {
+	if stored == "" {
+		return "", nil
+	}
+	return auth.DecryptSecret(stored)
+}
@@ -0,0 +1,318 @@
+package subuser
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Features a sub-user can be granted
+const (
+	PermFiles     = "files"
+	PermDatabases = "databases"
+	PermEmail     = "email"
+	PermDNS       = "dns"
+	PermCron      = "cron"
+	PermSSL       = "ssl"
+	PermFTP       = "ftp"
+)
+
+// Permissions lists every feature in display order
+var Permissions = []string{PermFiles, PermDatabases, PermEmail, PermDNS, PermCron, PermSSL, PermFTP}
+
+var (
+	ErrNotFound          = errors.New("sub-user not found")
+	ErrExists            = errors.New("sub-user already exists")
+	ErrInvalidName       = errors.New("invalid sub-user name")
+	ErrInvalidPermission = errors.New("invalid permission")
+	ErrInvalidFileRoot   = errors.New("invalid file root")
+	ErrWeakPassword      = errors.New("password must be at least 8 characters")
+	ErrInvalidLogin      = errors.New("invalid credentials")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9._-]{1,31}$`)
+
+// DB interface for database operations
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Manager manages the sub-users of hosting accounts
+type Manager struct {
+	db DB
+}
+
+// SubUser is a login under a hosting account with a subset of its features.
+// It signs in as name@owner.
+type SubUser struct {
+	ID            int64    `json:"id"`
+	OwnerID       int64    `json:"owner_id"`
+	OwnerUsername string   `json:"owner_username"`
+	Name          string   `json:"name"`
+	Login         string   `json:"login"`
+	Email         string   `json:"email"`
+	Permissions   []string `json:"permissions"`
+	FileRoot      string   `json:"file_root"` // relative to the account home, empty = whole home
+	Active        bool     `json:"active"`
+	LastLoginAt   *string  `json:"last_login_at,omitempty"`
+	CreatedAt     string   `json:"created_at"`
+}
+
+// Request holds the fields to create or update a sub-user. On update, nil
+// fields stay unchanged.
+type Request struct {
+	Name        string    `json:"name"`
+	Email       *string   `json:"email"`
+	Password    string    `json:"password"`
+	Permissions *[]string `json:"permissions"`
+	FileRoot    *string   `json:"file_root"`
+	Active      *bool     `json:"active"`
+}
+
+func NewManager(db DB) *Manager {
+	return &Manager{db: db}
+}
+
+// Has reports whether perms grants perm
+func Has(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePermissions checks permission names
+func ValidatePermissions(perms []string) error {
+	for _, p := range perms {
+		if !Has(Permissions, p) {
+			return fmt.Errorf("%w: %s", ErrInvalidPermission, p)
+		}
+	}
+	return nil
+}
+
+// CleanFileRoot normalises a file root to a relative path inside the home
+// directory; "" and "/" mean the whole home
+func CleanFileRoot(root string) (string, error) {
+	root = strings.Trim(filepath.Clean("/"+strings.TrimSpace(root)), "/")
+	if strings.Contains(root, "..") {
+		return "", ErrInvalidFileRoot
+	}
+	return root, nil
+}
+
+const columns = `s.id, s.owner_id, u.username, s.name, s.email, s.permissions, s.file_root, s.active,
+	s.last_login_at, s.created_at`
+
+func scan(scanner interface{ Scan(...interface{}) error }) (*SubUser, error) {
+	var s SubUser
+	var perms string
+	err := scanner.Scan(&s.ID, &s.OwnerID, &s.OwnerUsername, &s.Name, &s.Email, &perms, &s.FileRoot,
+		&s.Active, &s.LastLoginAt, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.Login = s.Name + "@" + s.OwnerUsername
+	s.Permissions = []string{}
+	for _, p := range strings.Split(perms, ",") {
+		if p != "" {
+			s.Permissions = append(s.Permissions, p)
+		}
+	}
+	return &s, nil
+}
+
+// List returns the sub-users of an account
+func (m *Manager) List(ownerID int64) ([]SubUser, error) {
+	rows, err := m.db.Query("SELECT "+columns+` FROM sub_users s JOIN users u ON u.id = s.owner_id
+		WHERE s.owner_id = ? ORDER BY s.name`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subUsers := []SubUser{}
+	for rows.Next() {
+		s, err := scan(rows)
+		if err != nil {
+			continue
+		}
+		subUsers = append(subUsers, *s)
+	}
+	return subUsers, nil
+}
+
+// Get returns a sub-user of an account
+func (m *Manager) Get(id, ownerID int64) (*SubUser, error) {
+	s, err := scan(m.db.QueryRow("SELECT "+columns+` FROM sub_users s JOIN users u ON u.id = s.owner_id
+		WHERE s.id = ? AND s.owner_id = ?`, id, ownerID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return s, err
+}
+
+// Load returns a sub-user by ID regardless of owner
+func (m *Manager) Load(id int64) (*SubUser, error) {
+	s, err := scan(m.db.QueryRow("SELECT "+columns+` FROM sub_users s JOIN users u ON u.id = s.owner_id
+		WHERE s.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return s, err
+}
+
+// Create adds a sub-user to an account
+func (m *Manager) Create(ownerID int64, req Request) (*SubUser, error) {
+	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	if !namePattern.MatchString(req.Name) {
+		return nil, ErrInvalidName
+	}
+	if len(req.Password) < 8 {
+		return nil, ErrWeakPassword
+	}
+
+	perms := []string{}
+	if req.Permissions != nil {
+		perms = *req.Permissions
+	}
+	if err := ValidatePermissions(perms); err != nil {
+		return nil, err
+	}
+	root := ""
+	if req.FileRoot != nil {
+		var err error
+		if root, err = CleanFileRoot(*req.FileRoot); err != nil {
+			return nil, err
+		}
+	}
+	email := ""
+	if req.Email != nil {
+		email = strings.TrimSpace(*req.Email)
+	}
+	active := req.Active == nil || *req.Active
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := m.db.Exec(`
+		INSERT INTO sub_users (owner_id, name, email, password, permissions, file_root, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, ownerID, req.Name, email, string(hash), strings.Join(perms, ","), root, active)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return nil, ErrExists
+		}
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return m.Get(id, ownerID)
+}
+
+// Update changes a sub-user. It reports whether the password changed or the
+// sub-user was disabled, after which existing sessions should end.
+func (m *Manager) Update(id, ownerID int64, req Request) (*SubUser, bool, error) {
+	if _, err := m.Get(id, ownerID); err != nil {
+		return nil, false, err
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+	endSessions := false
+
+	if req.Email != nil {
+		updates = append(updates, "email = ?")
+		args = append(args, strings.TrimSpace(*req.Email))
+	}
+	if req.Password != "" {
+		if len(req.Password) < 8 {
+			return nil, false, ErrWeakPassword
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+		if err != nil {
+			return nil, false, err
+		}
+		updates = append(updates, "password = ?")
+		args = append(args, string(hash))
+		endSessions = true
+	}
+	if req.Permissions != nil {
+		if err := ValidatePermissions(*req.Permissions); err != nil {
+			return nil, false, err
+		}
+		updates = append(updates, "permissions = ?")
+		args = append(args, strings.Join(*req.Permissions, ","))
+	}
+	if req.FileRoot != nil {
+		root, err := CleanFileRoot(*req.FileRoot)
+		if err != nil {
+			return nil, false, err
+		}
+		updates = append(updates, "file_root = ?")
+		args = append(args, root)
+	}
+	if req.Active != nil {
+		updates = append(updates, "active = ?")
+		args = append(args, *req.Active)
+		endSessions = endSessions || !*req.Active
+	}
+
+	if len(updates) > 0 {
+		args = append(args, id, ownerID)
+		if _, err := m.db.Exec("UPDATE sub_users SET "+strings.Join(updates, ", ")+" WHERE id = ? AND owner_id = ?", args...); err != nil {
+			return nil, false, err
+		}
+	}
+
+	s, err := m.Get(id, ownerID)
+	return s, endSessions, err
+}
+
+// Delete removes a sub-user; its sessions go with it
+func (m *Manager) Delete(id, ownerID int64) error {
+	result, err := m.db.Exec("DELETE FROM sub_users WHERE id = ? AND owner_id = ?", id, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate checks a name@owner login. Disabled sub-users and sub-users
+// of suspended accounts cannot log in.
+func (m *Manager) Authenticate(login, password string) (*SubUser, error) {
+	at := strings.LastIndex(login, "@")
+	if at <= 0 {
+		return nil, ErrInvalidLogin
+	}
+	name, owner := strings.ToLower(login[:at]), login[at+1:]
+
+	var hash string
+	var id int64
+	err := m.db.QueryRow(`
+		SELECT s.id, s.password FROM sub_users s JOIN users u ON u.id = s.owner_id
+		WHERE s.name = ? AND u.username = ? AND s.active = 1 AND u.active = 1 AND u.role = 'user'
+	`, name, owner).Scan(&id, &hash)
+	if err != nil {
+		return nil, ErrInvalidLogin
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, ErrInvalidLogin
+	}
+
+	m.db.Exec("UPDATE sub_users SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return m.Load(id)
+}
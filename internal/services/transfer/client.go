@@ -0,0 +1,213 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ChecksumHeader carries the hex SHA-256 of a transferred archive
+const ChecksumHeader = "X-Transfer-Checksum"
+
+// CheckRequest asks the target whether an account can be received
+type CheckRequest struct {
+	Username string   `json:"username"`
+	Domains  []string `json:"domains"`
+}
+
+// CheckResponse describes the target panel
+type CheckResponse struct {
+	Hostname  string   `json:"hostname"`
+	ServerIP  string   `json:"server_ip"`
+	Conflicts []string `json:"conflicts"`
+}
+
+// ReceiveResponse is returned once the target stored the archive and
+// started restoring it
+type ReceiveResponse struct {
+	TaskID   string `json:"task_id"`
+	BackupID int64  `json:"backup_id"`
+	ServerIP string `json:"server_ip"`
+}
+
+// RemoteTask is the restore task running on the target
+type RemoteTask struct {
+	ID     string   `json:"id"`
+	Status string   `json:"status"` // running, completed, failed
+	Logs   []string `json:"logs"`
+}
+
+// Client talks to the transfer endpoints of a target panel
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient creates a client for the panel at target (e.g.
+// https://panel2.example.com:8443). insecure skips TLS verification for
+// panels still using a self-signed certificate.
+func NewClient(target, token string, insecure bool) (*Client, error) {
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("target must be an http(s) URL")
+	}
+	if token == "" {
+		return nil, errors.New("transfer token is required")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(strings.TrimSuffix(u.String(), "/"), "/api/v1") + "/api/v1",
+		token:   token,
+		// No overall timeout: archives can take hours to upload
+		http: &http.Client{Transport: transport},
+	}, nil
+}
+
+// Check verifies the token and reports conflicts on the target
+func (c *Client) Check(req CheckRequest) (*CheckResponse, error) {
+	body, _ := json.Marshal(req)
+	var resp CheckResponse
+	if err := c.do(http.MethodPost, "/transfers/check", bytes.NewReader(body), -1, nil, &resp, 30*time.Second); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Send streams an account archive to the target. progress is called with the
+// number of bytes sent so far.
+func (c *Client) Send(archivePath, sourceIP string, progress func(sent, total int64)) (*ReceiveResponse, error) {
+	checksum, err := fileChecksum(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("name", filepath.Base(archivePath))
+	query.Set("source_ip", sourceIP)
+
+	body := &progressReader{r: f, total: info.Size(), progress: progress}
+	headers := map[string]string{
+		"Content-Type": "application/gzip",
+		ChecksumHeader: checksum,
+	}
+
+	var resp ReceiveResponse
+	if err := c.do(http.MethodPost, "/transfers/receive?"+query.Encode(), body, info.Size(), headers, &resp, 0); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Status returns the restore task on the target
+func (c *Client) Status(taskID string) (*RemoteTask, error) {
+	var task RemoteTask
+	if err := c.do(http.MethodGet, "/transfers/receive/"+url.PathEscape(taskID), nil, -1, nil, &task, 30*time.Second); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// do sends a request and decodes the data field of the APIResponse envelope
+func (c *Client) do(method, path string, body io.Reader, size int64, headers map[string]string, out interface{}, timeout time.Duration) error {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	req.Header.Set(TokenHeader, c.token)
+	if body != nil && headers == nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := c.http
+	if timeout > 0 {
+		client = &http.Client{Transport: c.http.Transport, Timeout: timeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+		Error   string          `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&envelope); err != nil {
+		return fmt.Errorf("target returned HTTP %d", resp.StatusCode)
+	}
+	if !envelope.Success {
+		if envelope.Error == "" {
+			envelope.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		}
+		return fmt.Errorf("target: %s", envelope.Error)
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		return json.Unmarshal(envelope.Data, out)
+	}
+	return nil
+}
+
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.sent += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.sent, p.total)
+	}
+	return n, err
+}
+
+// fileChecksum returns the hex SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,149 @@
+package transfer
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/asergenalkan/serverpanel/internal/config"
+)
+
+// TokenHeader carries the transfer token on panel-to-panel requests
+const TokenHeader = "X-Transfer-Token"
+
+// DefaultTokenTTL is used when a token is created without a lifetime
+const DefaultTokenTTL = 24 * time.Hour
+
+var (
+	ErrTokenNotFound = errors.New("transfer token not found")
+	ErrInvalidToken  = errors.New("invalid or expired transfer token")
+)
+
+// DB interface for database operations
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Manager keeps the tokens other panels use to push accounts to this one
+type Manager struct {
+	db  DB
+	cfg *config.Config
+}
+
+// Token allows a source panel to send accounts to this panel. Only the
+// SHA-256 of the secret is stored.
+type Token struct {
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	CreatedBy  int64   `json:"created_by"`
+	ExpiresAt  string  `json:"expires_at"`
+	LastUsedAt *string `json:"last_used_at,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+func NewManager(db DB) *Manager {
+	return &Manager{
+		db:  db,
+		cfg: config.Get(),
+	}
+}
+
+// CreateToken generates a new token and returns its secret, which is shown
+// only once
+func (m *Manager) CreateToken(name string, ttl time.Duration, createdBy int64) (string, *Token, error) {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := hex.EncodeToString(b)
+	expiresAt := time.Now().UTC().Add(ttl).Format("2006-01-02 15:04:05")
+
+	result, err := m.db.Exec(
+		"INSERT INTO transfer_tokens (name, token_hash, created_by, expires_at) VALUES (?, ?, ?, ?)",
+		name, hashToken(secret), createdBy, expiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	token, err := m.GetToken(id)
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, token, nil
+}
+
+func (m *Manager) ListTokens() ([]Token, error) {
+	rows, err := m.db.Query("SELECT id, name, created_by, expires_at, last_used_at, created_at FROM transfer_tokens ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		var t Token
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedBy, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func (m *Manager) GetToken(id int64) (*Token, error) {
+	var t Token
+	err := m.db.QueryRow("SELECT id, name, created_by, expires_at, last_used_at, created_at FROM transfer_tokens WHERE id = ?", id).
+		Scan(&t.ID, &t.Name, &t.CreatedBy, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteToken revokes a token; transfers already received keep running
+func (m *Manager) DeleteToken(id int64) error {
+	result, err := m.db.Exec("DELETE FROM transfer_tokens WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// ValidateToken looks up an unexpired token by its secret and records its use
+func (m *Manager) ValidateToken(secret string) (*Token, error) {
+	if secret == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var id int64
+	err := m.db.QueryRow(
+		"SELECT id FROM transfer_tokens WHERE token_hash = ? AND expires_at > ?",
+		hashToken(secret), time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&id)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	m.db.Exec("UPDATE transfer_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return m.GetToken(id)
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -103,7 +103,7 @@ func (d *ApacheDriver) generateConfig(config VhostConfig) string {
     
     # Logging
     ErrorLog %s/error.log
-    CustomLog %s/access.log combined
+    CustomLog %s combined
     
     # Security Headers
     Header always set X-Frame-Options "SAMEORIGIN"
@@ -119,7 +119,7 @@ func (d *ApacheDriver) generateConfig(config VhostConfig) string {
 		config.DocumentRoot,
 		phpFpmSocket,
 		filepath.Join(config.HomeDir, "logs"),
-		filepath.Join(config.HomeDir, "logs"),
+		filepath.Join(AccessLogDir(DriverApache, d.simulateMode, d.basePath), config.Domain+"-access.log"),
 	)
 
 	// Add SSL configuration if enabled
@@ -149,7 +149,7 @@ func (d *ApacheDriver) generateConfig(config VhostConfig) string {
     
     # Logging
     ErrorLog %s/error.log
-    CustomLog %s/access.log combined
+    CustomLog %s combined
     
     # Security Headers
     Header always set X-Frame-Options "SAMEORIGIN"
@@ -166,7 +166,7 @@ func (d *ApacheDriver) generateConfig(config VhostConfig) string {
 			config.SSLCertPath,
 			config.SSLKeyPath,
 			filepath.Join(config.HomeDir, "logs"),
-			filepath.Join(config.HomeDir, "logs"),
+			filepath.Join(AccessLogDir(DriverApache, d.simulateMode, d.basePath), config.Domain+"-ssl-access.log"),
 		)
 	}
 
@@ -182,6 +182,7 @@ func (d *ApacheDriver) DeleteVhost(domain string) error {
 	if err := os.Remove(configFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove config file: %w", err)
 	}
+	os.Remove(configFile + suspendedSuffix)
 
 	log.Printf("🗑️ Apache config deleted: %s", configFile)
 	return d.Reload()
@@ -305,3 +306,103 @@ func (d *ApacheDriver) DeleteWebmailVhost(domain string) error {
 	webmailDomain := "webmail." + domain
 	return d.DeleteVhost(webmailDomain)
 }
+
+// SuspendVhost swaps the site's config for one that answers every request
+// with the suspended page. ServerName, aliases and certificates are kept so
+// HTTPS keeps working.
+func (d *ApacheDriver) SuspendVhost(name string) error {
+	pageDir := suspendedPageDir(d.simulateMode, d.basePath)
+	if err := writeSuspendedPage(pageDir); err != nil {
+		return err
+	}
+
+	configFile := filepath.Join(d.GetConfigPath(), name+".conf")
+	err := swapVhost(configFile, func(original string) string {
+		return d.generateSuspendedConfig(name, original, pageDir)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("⏸️ Apache vhost suspended: %s", name)
+	return nil
+}
+
+// UnsuspendVhost restores the site's original config
+func (d *ApacheDriver) UnsuspendVhost(name string) error {
+	if err := restoreVhost(filepath.Join(d.GetConfigPath(), name+".conf")); err != nil {
+		return err
+	}
+
+	log.Printf("▶️ Apache vhost restored: %s", name)
+	return nil
+}
+
+// apacheSuspendedKeep lists the directives copied from the original vhost
+var apacheSuspendedKeep = map[string]bool{
+	"servername":              true,
+	"serveralias":             true,
+	"sslengine":               true,
+	"sslcertificatefile":      true,
+	"sslcertificatekeyfile":   true,
+	"sslcertificatechainfile": true,
+}
+
+func (d *ApacheDriver) generateSuspendedConfig(name, original, pageDir string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Suspended: %s\n# Original config: %s.conf%s\n", name, name, suspendedSuffix)
+
+	for _, line := range strings.Split(original, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		directive := strings.ToLower(fields[0])
+
+		switch {
+		case strings.HasPrefix(directive, "<virtualhost"):
+			b.WriteString(line + "\n")
+		case strings.HasPrefix(directive, "</virtualhost"):
+			fmt.Fprintf(&b, `
+    DocumentRoot %s
+    <Directory %s>
+        Require all granted
+    </Directory>
+
+    ErrorDocument 503 /index.html
+    RewriteEngine On
+    RewriteCond %%{REQUEST_URI} !=/index.html
+    RewriteRule ^ - [R=503,L]
+`, pageDir, pageDir)
+			b.WriteString(line + "\n")
+		case apacheSuspendedKeep[directive]:
+			b.WriteString(line + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// SetThrottles limits throttled sites with mod_ratelimit from a global
+// config matching their Host header
+func (d *ApacheDriver) SetThrottles(limits map[string]int) (bool, error) {
+	path := filepath.Join("/etc/apache2/conf-enabled", throttleConfigName)
+	if d.simulateMode {
+		path = filepath.Join(d.basePath, "apache", "conf-enabled", throttleConfigName)
+	}
+
+	var b strings.Builder
+	if len(limits) > 0 {
+		b.WriteString("# Bandwidth throttling - generated by ServerPanel\n<IfModule mod_ratelimit.c>\n")
+		for _, host := range sortedHosts(limits) {
+			fmt.Fprintf(&b, "<If \"%%{HTTP_HOST} == '%s'\">\n    SetOutputFilter RATE_LIMIT\n    SetEnv rate-limit %d\n</If>\n", host, limits[host])
+		}
+		b.WriteString("</IfModule>\n")
+	}
+
+	changed, err := writeThrottleConfig(path, []byte(b.String()))
+	if changed {
+		log.Printf("🐢 Apache throttle config updated: %d host(s)", len(limits))
+	}
+	return changed, err
+}
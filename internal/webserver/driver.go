@@ -1,5 +1,7 @@
 package webserver
 
+import "path/filepath"
+
 // Driver interface for web server operations
 type Driver interface {
 	// Name returns the web server name
@@ -17,6 +19,19 @@ type Driver interface {
 	// DisableSite disables a site
 	DisableSite(domain string) error
 
+	// SuspendVhost replaces a site's config with one serving the suspended
+	// landing page, keeping the original aside. The caller reloads.
+	SuspendVhost(name string) error
+
+	// UnsuspendVhost puts a suspended site's original config back. The
+	// caller reloads.
+	UnsuspendVhost(name string) error
+
+	// SetThrottles writes the bandwidth limits (KB/s per hostname) of
+	// throttled sites, replacing the previous set, and reports whether
+	// anything changed. The caller reloads.
+	SetThrottles(limits map[string]int) (bool, error)
+
 	// Reload reloads the web server configuration
 	Reload() error
 
@@ -51,6 +66,21 @@ const (
 	DriverNginx  DriverType = "nginx"
 )
 
+// AccessLogDir returns the directory a web server writes the per-domain
+// access logs (<domain>-access.log, <domain>-ssl-access.log) to. It is
+// owned by root: the logs are the source of bandwidth accounting and must
+// not be editable by the account.
+func AccessLogDir(driverType DriverType, simulateMode bool, basePath string) string {
+	name := "apache2"
+	if driverType == DriverNginx {
+		name = "nginx"
+	}
+	if simulateMode {
+		return filepath.Join(basePath, "log", name)
+	}
+	return filepath.Join("/var/log", name)
+}
+
 // NewDriver creates a new web server driver based on type
 func NewDriver(driverType DriverType, simulateMode bool, basePath string) Driver {
 	switch driverType {
@@ -91,7 +91,7 @@ server {
     root %s;
     index index.php index.html index.htm;
     
-    access_log %s/access.log;
+    access_log %s;
     error_log %s/error.log;
     
     # Main location
@@ -122,7 +122,7 @@ server {
 		config.Username,
 		serverNames,
 		config.DocumentRoot,
-		filepath.Join(config.HomeDir, "logs"),
+		filepath.Join(AccessLogDir(DriverNginx, d.simulateMode, d.basePath), config.Domain+"-access.log"),
 		filepath.Join(config.HomeDir, "logs"),
 		phpFpmSocket,
 	)
@@ -143,7 +143,7 @@ server {
     ssl_ciphers ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256;
     ssl_prefer_server_ciphers off;
     
-    access_log %s/access.log;
+    access_log %s;
     error_log %s/error.log;
     
     location / {
@@ -171,7 +171,7 @@ server {
 			config.DocumentRoot,
 			config.SSLCertPath,
 			config.SSLKeyPath,
-			filepath.Join(config.HomeDir, "logs"),
+			filepath.Join(AccessLogDir(DriverNginx, d.simulateMode, d.basePath), config.Domain+"-ssl-access.log"),
 			filepath.Join(config.HomeDir, "logs"),
 			phpFpmSocket,
 		)
@@ -189,6 +189,7 @@ func (d *NginxDriver) DeleteVhost(domain string) error {
 	if err := os.Remove(configFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove config file: %w", err)
 	}
+	os.Remove(configFile + suspendedSuffix)
 
 	log.Printf("🗑️ Nginx config deleted: %s", configFile)
 	return d.Reload()
@@ -264,3 +265,111 @@ func (d *NginxDriver) TestConfig() error {
 	}
 	return nil
 }
+
+// SuspendVhost swaps the site's config for one that answers every request
+// with the suspended page. Listen ports, server names and certificates are
+// kept so HTTPS keeps working.
+func (d *NginxDriver) SuspendVhost(name string) error {
+	pageDir := suspendedPageDir(d.simulateMode, d.basePath)
+	if err := writeSuspendedPage(pageDir); err != nil {
+		return err
+	}
+
+	configFile := filepath.Join(d.GetConfigPath(), name+".conf")
+	err := swapVhost(configFile, func(original string) string {
+		return d.generateSuspendedConfig(name, original, pageDir)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("⏸️ Nginx vhost suspended: %s", name)
+	return nil
+}
+
+// UnsuspendVhost restores the site's original config
+func (d *NginxDriver) UnsuspendVhost(name string) error {
+	if err := restoreVhost(filepath.Join(d.GetConfigPath(), name+".conf")); err != nil {
+		return err
+	}
+
+	log.Printf("▶️ Nginx vhost restored: %s", name)
+	return nil
+}
+
+// nginxSuspendedKeep lists the server level directives copied from the
+// original config
+var nginxSuspendedKeep = map[string]bool{
+	"listen":                    true,
+	"server_name":               true,
+	"ssl_certificate":           true,
+	"ssl_certificate_key":       true,
+	"ssl_protocols":             true,
+	"ssl_ciphers":               true,
+	"ssl_prefer_server_ciphers": true,
+}
+
+func (d *NginxDriver) generateSuspendedConfig(name, original, pageDir string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Suspended: %s\n# Original config: %s.conf%s\n", name, name, suspendedSuffix)
+
+	depth := 0
+	for _, line := range strings.Split(original, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		opens := strings.Count(trimmed, "{")
+		closes := strings.Count(trimmed, "}")
+
+		switch {
+		case depth == 0 && strings.HasPrefix(trimmed, "server") && opens > closes:
+			b.WriteString("server {\n")
+		case depth == 1 && closes > opens:
+			fmt.Fprintf(&b, `
+    root %s;
+    error_page 503 /index.html;
+    location = /index.html {
+        internal;
+    }
+    location / {
+        return 503;
+    }
+}
+`, pageDir)
+		case depth == 1 && opens == 0:
+			fields := strings.Fields(strings.TrimSuffix(trimmed, ";"))
+			if nginxSuspendedKeep[fields[0]] {
+				b.WriteString("    " + trimmed + "\n")
+			}
+		}
+
+		depth += opens - closes
+	}
+
+	return b.String()
+}
+
+// SetThrottles limits throttled sites with limit_rate, set for the whole
+// http block from a map on the Host header
+func (d *NginxDriver) SetThrottles(limits map[string]int) (bool, error) {
+	path := filepath.Join("/etc/nginx/conf.d", throttleConfigName)
+	if d.simulateMode {
+		path = filepath.Join(d.basePath, "nginx", "conf.d", throttleConfigName)
+	}
+
+	var b strings.Builder
+	if len(limits) > 0 {
+		b.WriteString("# Bandwidth throttling - generated by ServerPanel\nmap $host $serverpanel_limit_rate {\n    default 0;\n")
+		for _, host := range sortedHosts(limits) {
+			fmt.Fprintf(&b, "    %s %dk;\n", host, limits[host])
+		}
+		b.WriteString("}\nlimit_rate $serverpanel_limit_rate;\n")
+	}
+
+	changed, err := writeThrottleConfig(path, []byte(b.String()))
+	if changed {
+		log.Printf("🐢 Nginx throttle config updated: %d host(s)", len(limits))
+	}
+	return changed, err
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // PHPFPMManager manages PHP-FPM pools for users
@@ -20,6 +22,77 @@ type PHPFPMConfig struct {
 	Username   string
 	HomeDir    string
 	PHPVersion string
+	Settings   PHPSettings // empty values use DefaultPHPSettings
+}
+
+// PHPSettings are the php.ini values set in a pool
+type PHPSettings struct {
+	MemoryLimit       string
+	MaxExecutionTime  int
+	MaxInputTime      int
+	PostMaxSize       string
+	UploadMaxFilesize string
+	MaxFileUploads    int
+	DisplayErrors     bool
+	ErrorReporting    string
+}
+
+// DefaultPHPSettings are the pool values when a package or domain sets none
+var DefaultPHPSettings = PHPSettings{
+	MemoryLimit:       "256M",
+	MaxExecutionTime:  300,
+	MaxInputTime:      300,
+	PostMaxSize:       "64M",
+	UploadMaxFilesize: "64M",
+}
+
+// WithDefaults fills empty values from DefaultPHPSettings
+func (s PHPSettings) WithDefaults() PHPSettings {
+	if s.MemoryLimit == "" {
+		s.MemoryLimit = DefaultPHPSettings.MemoryLimit
+	}
+	if s.MaxExecutionTime <= 0 {
+		s.MaxExecutionTime = DefaultPHPSettings.MaxExecutionTime
+	}
+	if s.MaxInputTime <= 0 {
+		s.MaxInputTime = DefaultPHPSettings.MaxInputTime
+	}
+	if s.PostMaxSize == "" {
+		s.PostMaxSize = DefaultPHPSettings.PostMaxSize
+	}
+	if s.UploadMaxFilesize == "" {
+		s.UploadMaxFilesize = DefaultPHPSettings.UploadMaxFilesize
+	}
+	return s
+}
+
+// ParsePHPSize converts a php.ini size such as 128M to bytes
+func ParsePHPSize(value string) int64 {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	if strings.HasSuffix(value, "G") {
+		multiplier = 1024 * 1024 * 1024
+		value = strings.TrimSuffix(value, "G")
+	} else if strings.HasSuffix(value, "M") {
+		multiplier = 1024 * 1024
+		value = strings.TrimSuffix(value, "M")
+	} else if strings.HasSuffix(value, "K") {
+		multiplier = 1024
+		value = strings.TrimSuffix(value, "K")
+	}
+	val, _ := strconv.ParseInt(value, 10, 64)
+	return val * multiplier
+}
+
+// PHPSizeWithin reports whether a php.ini size is within a limit. PHP reads
+// -1 and 0 as unlimited, so they (and unparsable values) exceed any limit.
+func PHPSizeWithin(value, limit string) bool {
+	max := ParsePHPSize(limit)
+	if max <= 0 {
+		return true
+	}
+	size := ParsePHPSize(value)
+	return size > 0 && size <= max
 }
 
 // NewPHPFPMManager creates a new PHP-FPM manager
@@ -65,13 +138,49 @@ func (m *PHPFPMManager) CreatePool(config PHPFPMConfig) error {
 	return m.Reload()
 }
 
+// UpdatePool rewrites a user's pool with new settings and reloads PHP-FPM.
+// A pool disabled by DisablePool is updated in place and stays disabled.
+func (m *PHPFPMManager) UpdatePool(config PHPFPMConfig) error {
+	if err := m.WritePool(config); err != nil {
+		return err
+	}
+	return m.Reload()
+}
+
+// WritePool is UpdatePool without the reload, for callers updating many
+// pools that reload once at the end. A missing pool is created (and
+// PHP-FPM reloaded) as by CreatePool.
+func (m *PHPFPMManager) WritePool(config PHPFPMConfig) error {
+	phpVersion := config.PHPVersion
+	if phpVersion == "" {
+		phpVersion = m.phpVersion
+	}
+
+	poolFile := filepath.Join(m.GetPoolPath(), config.Username+".conf")
+	if _, err := os.Stat(poolFile); os.IsNotExist(err) {
+		if _, err := os.Stat(poolFile + suspendedSuffix); err == nil {
+			poolFile += suspendedSuffix
+		} else {
+			return m.CreatePool(config)
+		}
+	}
+
+	if err := os.WriteFile(poolFile, []byte(m.generatePoolConfig(config, phpVersion)), 0644); err != nil {
+		return fmt.Errorf("failed to write pool config: %w", err)
+	}
+
+	log.Printf("📝 PHP-FPM pool updated: %s", poolFile)
+	return nil
+}
+
 func (m *PHPFPMManager) generatePoolConfig(config PHPFPMConfig, phpVersion string) string {
 	socketPath := fmt.Sprintf("/run/php/php%s-fpm-%s.sock", phpVersion, config.Username)
 	if m.simulateMode {
 		socketPath = filepath.Join(m.basePath, "php-fpm", config.Username+".sock")
 	}
+	settings := config.Settings.WithDefaults()
 
-	return fmt.Sprintf(`[%s]
+	poolConfig := fmt.Sprintf(`[%s]
 ; Pool for user %s
 
 user = %s
@@ -100,11 +209,11 @@ php_admin_value[upload_tmp_dir] = %s/tmp
 php_admin_value[session.save_path] = %s/tmp
 
 ; Limits
-php_admin_value[memory_limit] = 256M
-php_admin_value[max_execution_time] = 300
-php_admin_value[max_input_time] = 300
-php_admin_value[post_max_size] = 64M
-php_admin_value[upload_max_filesize] = 64M
+php_admin_value[memory_limit] = %s
+php_admin_value[max_execution_time] = %d
+php_admin_value[max_input_time] = %d
+php_admin_value[post_max_size] = %s
+php_admin_value[upload_max_filesize] = %s
 `,
 		config.Username,
 		config.Username,
@@ -115,7 +224,26 @@ php_admin_value[upload_max_filesize] = 64M
 		config.HomeDir,
 		config.HomeDir,
 		config.HomeDir,
+		settings.MemoryLimit,
+		settings.MaxExecutionTime,
+		settings.MaxInputTime,
+		settings.PostMaxSize,
+		settings.UploadMaxFilesize,
 	)
+
+	// Values a domain's PHP settings may add
+	if settings.MaxFileUploads > 0 {
+		poolConfig += fmt.Sprintf("php_admin_value[max_file_uploads] = %d\n", settings.MaxFileUploads)
+	}
+	if settings.ErrorReporting != "" {
+		displayErrors := "off"
+		if settings.DisplayErrors {
+			displayErrors = "on"
+		}
+		poolConfig += fmt.Sprintf("php_admin_flag[display_errors] = %s\nphp_admin_value[error_reporting] = %s\n",
+			displayErrors, settings.ErrorReporting)
+	}
+	return poolConfig
 }
 
 // DeletePool removes a PHP-FPM pool
@@ -124,6 +252,7 @@ func (m *PHPFPMManager) DeletePool(username string) error {
 	if err := os.Remove(poolFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove pool config: %w", err)
 	}
+	os.Remove(poolFile + suspendedSuffix)
 
 	log.Printf("🗑️ PHP-FPM pool deleted: %s", poolFile)
 	return m.Reload()
@@ -166,3 +295,32 @@ func (m *PHPFPMManager) Reload() error {
 	log.Printf("✅ PHP-FPM reloaded successfully")
 	return nil
 }
+
+// DisablePool stops a user's pool by renaming its config out of the *.conf
+// include. Returns os.ErrNotExist when the user has no pool for this version.
+func (m *PHPFPMManager) DisablePool(username string) error {
+	poolFile := filepath.Join(m.GetPoolPath(), username+".conf")
+	if _, err := os.Stat(poolFile); err != nil {
+		return err
+	}
+	if err := os.Rename(poolFile, poolFile+suspendedSuffix); err != nil {
+		return fmt.Errorf("failed to disable pool: %w", err)
+	}
+
+	log.Printf("⏸️ PHP-FPM pool disabled: %s", poolFile)
+	return m.Reload()
+}
+
+// EnablePool puts a pool disabled by DisablePool back
+func (m *PHPFPMManager) EnablePool(username string) error {
+	poolFile := filepath.Join(m.GetPoolPath(), username+".conf")
+	if _, err := os.Stat(poolFile + suspendedSuffix); err != nil {
+		return err
+	}
+	if err := os.Rename(poolFile+suspendedSuffix, poolFile); err != nil {
+		return fmt.Errorf("failed to enable pool: %w", err)
+	}
+
+	log.Printf("▶️ PHP-FPM pool enabled: %s", poolFile)
+	return m.Reload()
+}
@@ -0,0 +1,100 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrVhostNotFound is returned when a site has no config to suspend or restore
+var ErrVhostNotFound = errors.New("vhost config not found")
+
+// suspendedSuffix is appended to a site's original config while it is suspended
+const suspendedSuffix = ".suspended"
+
+const suspendedPageHTML = `<!DOCTYPE html>
+<html lang="tr">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Hesap Askıya Alındı</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            background: #f3f4f6;
+            color: #374151;
+        }
+        .container { text-align: center; padding: 2rem; }
+        h1 { font-size: 2rem; margin-bottom: 1rem; }
+        p { opacity: 0.8; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>Hesap Askıya Alındı</h1>
+        <p>Bu web sitesi geçici olarak hizmet dışıdır.</p>
+        <p>This account has been suspended.</p>
+    </div>
+</body>
+</html>
+`
+
+// suspendedPageDir returns the directory the suspended landing page is
+// served from
+func suspendedPageDir(simulateMode bool, basePath string) string {
+	if simulateMode {
+		return filepath.Join(basePath, "suspended")
+	}
+	return "/var/www/serverpanel-suspended"
+}
+
+// writeSuspendedPage makes sure the landing page exists
+func writeSuspendedPage(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create suspended page directory: %w", err)
+	}
+	return os.WriteFile(filepath.Join(dir, "index.html"), []byte(suspendedPageHTML), 0644)
+}
+
+// swapVhost moves a site's config aside and writes the suspended config
+// generated from it in its place. The enabled symlink keeps pointing at the
+// same file, so a disabled site stays disabled.
+func swapVhost(configFile string, generate func(original string) string) error {
+	if _, err := os.Stat(configFile + suspendedSuffix); err == nil {
+		return nil // already suspended
+	}
+
+	original, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return ErrVhostNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read vhost config: %w", err)
+	}
+
+	if err := os.Rename(configFile, configFile+suspendedSuffix); err != nil {
+		return fmt.Errorf("failed to move vhost config: %w", err)
+	}
+	if err := os.WriteFile(configFile, []byte(generate(string(original))), 0644); err != nil {
+		os.Rename(configFile+suspendedSuffix, configFile)
+		return fmt.Errorf("failed to write suspended vhost config: %w", err)
+	}
+	return nil
+}
+
+// restoreVhost puts the original config back
+func restoreVhost(configFile string) error {
+	if _, err := os.Stat(configFile + suspendedSuffix); os.IsNotExist(err) {
+		return ErrVhostNotFound
+	}
+	if err := os.Rename(configFile+suspendedSuffix, configFile); err != nil {
+		return fmt.Errorf("failed to restore vhost config: %w", err)
+	}
+	return nil
+}
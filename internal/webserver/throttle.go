@@ -0,0 +1,54 @@
+package webserver
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// throttleConfigName is the file holding the rate limits of throttled sites
+const throttleConfigName = "serverpanel-throttle.conf"
+
+// writeThrottleConfig replaces the throttle config with content, removing
+// it when content is empty. Reports whether the file changed.
+func writeThrottleConfig(path string, content []byte) (bool, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read throttle config: %w", err)
+	}
+	exists := err == nil
+
+	if len(content) == 0 {
+		if !exists {
+			return false, nil
+		}
+		if err := os.Remove(path); err != nil {
+			return false, fmt.Errorf("failed to remove throttle config: %w", err)
+		}
+		return true, nil
+	}
+
+	if exists && bytes.Equal(current, content) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("failed to create throttle config directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return false, fmt.Errorf("failed to write throttle config: %w", err)
+	}
+	return true, nil
+}
+
+// sortedHosts returns the hostnames of a throttle map in a stable order so
+// an unchanged set produces an identical file
+func sortedHosts(limits map[string]int) []string {
+	hosts := make([]string, 0, len(limits))
+	for host := range limits {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
@@ -35,6 +35,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
           }
         } catch {
           localStorage.removeItem('token');
+          localStorage.removeItem('refresh_token');
           localStorage.removeItem('user');
           setToken(null);
         }
@@ -48,8 +49,9 @@ export function AuthProvider({ children }: { children: ReactNode }) {
   const login = async (username: string, password: string) => {
     const response = await authAPI.login(username, password);
     if (response.data.success) {
-      const { token, user } = response.data.data;
+      const { token, refresh_token, user } = response.data.data;
       localStorage.setItem('token', token);
+      localStorage.setItem('refresh_token', refresh_token);
       localStorage.setItem('user', JSON.stringify(user));
       setToken(token);
       setUser(user);
@@ -61,6 +63,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
   const logout = () => {
     authAPI.logout().catch(() => {});
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('user');
     setToken(null);
     setUser(null);
@@ -16,14 +16,51 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
-// Response interceptor - handle errors
+// Refresh token rotation - one refresh at a time, shared by concurrent 401s
+let refreshPromise: Promise<string> | null = null;
+
+const refreshAccessToken = () => {
+  if (!refreshPromise) {
+    refreshPromise = axios
+      .post('/api/v1/auth/refresh', { refresh_token: localStorage.getItem('refresh_token') })
+      .then((response) => {
+        const { token, refresh_token } = response.data.data;
+        localStorage.setItem('token', token);
+        localStorage.setItem('refresh_token', refresh_token);
+        return token as string;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
+const clearSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refresh_token');
+  localStorage.removeItem('user');
+  window.location.href = '/login';
+};
+
+// Response interceptor - renew expired access tokens, handle errors
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
     if (error.response?.status === 401) {
-      localStorage.removeItem('token');
-      localStorage.removeItem('user');
-      window.location.href = '/login';
+      if (original && !original._retry && localStorage.getItem('refresh_token')) {
+        original._retry = true;
+        try {
+          const token = await refreshAccessToken();
+          original.headers.Authorization = `Bearer ${token}`;
+          return api(original);
+        } catch {
+          clearSession();
+        }
+      } else {
+        clearSession();
+      }
     }
     return Promise.reject(error);
   }